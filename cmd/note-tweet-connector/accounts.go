@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"go.yaml.in/yaml/v2"
+)
+
+// accountNamePattern keeps pair names usable in URL paths, stream rule tags
+// and metric labels.
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// AccountConfig is one Misskey account and the Twitter account it is
+// connected to. The *File fields name files to read the secrets from.
+type AccountConfig struct {
+	Name                     string `yaml:"name"`
+	MisskeyHost              string `yaml:"misskey_host"`
+	MisskeyToken             string `yaml:"misskey_token"`
+	MisskeyTokenFile         string `yaml:"misskey_token_file,omitempty"`
+	MisskeyHookSecret        string `yaml:"misskey_hook_secret"`
+	MisskeyHookSecretFile    string `yaml:"misskey_hook_secret_file,omitempty"`
+	MisskeyMediaHost         string `yaml:"misskey_media_host"`
+	TwitterOAuth2ClientID    string `yaml:"twitter_oauth2_client_id"`
+	TwitterOAuth2RedirectURL string `yaml:"twitter_oauth2_redirect_url"`
+	TwitterTokenStorePath    string `yaml:"twitter_token_store_path"`
+	TwitterBearerToken       string `yaml:"twitter_bearer_token"`
+	TwitterBearerTokenFile   string `yaml:"twitter_bearer_token_file,omitempty"`
+	TwitterUsername          string `yaml:"twitter_username"`
+}
+
+type accountsFile struct {
+	Accounts []AccountConfig `yaml:"accounts"`
+}
+
+// namespace returns the tracker namespace and stream rule tag suffix of the
+// pair. The default pair uses the empty namespace so that it keeps the records
+// and the stream rule of a single-pair setup.
+func (a AccountConfig) namespace() string {
+	if a.Name == metrics.DefaultPair {
+		return ""
+	}
+	return a.Name
+}
+
+// loginPath returns the path of the pair's Twitter OAuth 2.0 login URL.
+func (a AccountConfig) loginPath() string {
+	if a.namespace() == "" {
+		return "/twitter/login"
+	}
+	return "/twitter/login/" + a.Name
+}
+
+func (a AccountConfig) twitterOAuth2Config() twitter.OAuth2Config {
+	return twitter.OAuth2Config{
+		ClientID:       a.TwitterOAuth2ClientID,
+		RedirectURL:    a.TwitterOAuth2RedirectURL,
+		TokenStorePath: a.TwitterTokenStorePath,
+		LoginPath:      a.loginPath(),
+	}
+}
+
+// loadAccounts reads the account pairs from -accounts-file, or completes the
+// pairs listed in the configuration file. Secrets are read from their *_file
+// fields, empty Misskey host, media host, OAuth 2.0 client and bearer token
+// fields fall back to the corresponding flags, and the token store defaults to
+// a file per pair next to -twitter-token-store-path.
+func (cfg *Config) loadAccounts() error {
+	if cfg.AccountsFile != "" {
+		if cfg.Accounts != nil {
+			return fmt.Errorf("accounts are listed in both -accounts-file and the configuration file")
+		}
+		data, err := os.ReadFile(cfg.AccountsFile)
+		if err != nil {
+			return fmt.Errorf("read accounts file: %w", err)
+		}
+		var file accountsFile
+		if err := yaml.UnmarshalStrict(data, &file); err != nil {
+			return fmt.Errorf("parse accounts file: %w", err)
+		}
+		cfg.Accounts = file.Accounts
+		if cfg.Accounts == nil {
+			cfg.Accounts = []AccountConfig{}
+		}
+	}
+
+	for i := range cfg.Accounts {
+		account := &cfg.Accounts[i]
+		for _, secret := range []struct {
+			value *string
+			path  string
+			name  string
+		}{
+			{&account.MisskeyToken, account.MisskeyTokenFile, "misskey_token"},
+			{&account.MisskeyHookSecret, account.MisskeyHookSecretFile, "misskey_hook_secret"},
+			{&account.TwitterBearerToken, account.TwitterBearerTokenFile, "twitter_bearer_token"},
+		} {
+			if secret.path == "" {
+				continue
+			}
+			if *secret.value != "" {
+				return fmt.Errorf("account %q sets both %s and %s_file", account.Name, secret.name, secret.name)
+			}
+			value, err := readSecretFile(secret.path)
+			if err != nil {
+				return fmt.Errorf("account %q: %w", account.Name, err)
+			}
+			*secret.value = value
+		}
+		account.MisskeyHost = fallback(account.MisskeyHost, cfg.MisskeyHost)
+		account.MisskeyMediaHost = fallback(account.MisskeyMediaHost, cfg.MisskeyMediaHost)
+		account.TwitterOAuth2ClientID = fallback(account.TwitterOAuth2ClientID, cfg.TwitterOAuth2ClientID)
+		account.TwitterOAuth2RedirectURL = fallback(account.TwitterOAuth2RedirectURL, cfg.TwitterOAuth2RedirectURL)
+		account.TwitterBearerToken = fallback(account.TwitterBearerToken, cfg.TwitterBearerToken)
+		if account.TwitterTokenStorePath == "" {
+			dir := filepath.Dir(cfg.TwitterTokenStorePath)
+			account.TwitterTokenStorePath = filepath.Join(dir, "twitter_oauth2_token-"+account.Name+".json")
+		}
+	}
+	return nil
+}
+
+// hasAccountList reports whether the account pairs come from -accounts-file or
+// the configuration file rather than from the per-account flags.
+func (cfg *Config) hasAccountList() bool {
+	return cfg.AccountsFile != "" || cfg.Accounts != nil
+}
+
+// accounts returns the configured account pairs. Without an account list the
+// flags describe a single pair named default.
+func (cfg *Config) accounts() []AccountConfig {
+	if cfg.hasAccountList() {
+		return cfg.Accounts
+	}
+	return []AccountConfig{{
+		Name:                     metrics.DefaultPair,
+		MisskeyHost:              cfg.MisskeyHost,
+		MisskeyToken:             cfg.MisskeyToken,
+		MisskeyHookSecret:        cfg.MisskeyHookSecret,
+		MisskeyMediaHost:         cfg.MisskeyMediaHost,
+		TwitterOAuth2ClientID:    cfg.TwitterOAuth2ClientID,
+		TwitterOAuth2RedirectURL: cfg.TwitterOAuth2RedirectURL,
+		TwitterTokenStorePath:    cfg.TwitterTokenStorePath,
+		TwitterBearerToken:       cfg.TwitterBearerToken,
+		TwitterUsername:          cfg.TwitterUsername,
+	}}
+}
+
+func (cfg *Config) validateAccounts() error {
+	if len(cfg.Accounts) == 0 {
+		return fmt.Errorf("the account list must contain at least one account")
+	}
+
+	names := map[string]bool{}
+	secrets := map[string]string{}
+	tokenStorePaths := map[string]string{}
+	for _, account := range cfg.Accounts {
+		if !accountNamePattern.MatchString(account.Name) {
+			return fmt.Errorf("account name %q must match %s", account.Name, accountNamePattern)
+		}
+		if names[account.Name] {
+			return fmt.Errorf("account name %q is used more than once", account.Name)
+		}
+		names[account.Name] = true
+
+		var missing []string
+		for name, value := range cfg.requiredAccountSettings(account) {
+			if value == "" {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf("account %q is missing: %s", account.Name, strings.Join(missing, ", "))
+		}
+
+		// Webhooks are routed to a pair by their secret.
+		if account.MisskeyHookSecret != "" {
+			if other, ok := secrets[account.MisskeyHookSecret]; ok {
+				return fmt.Errorf("accounts %q and %q use the same misskey_hook_secret", other, account.Name)
+			}
+			secrets[account.MisskeyHookSecret] = account.Name
+		}
+		path := filepath.Clean(account.TwitterTokenStorePath)
+		if other, ok := tokenStorePaths[path]; ok {
+			return fmt.Errorf("accounts %q and %q use the same twitter_token_store_path", other, account.Name)
+		}
+		tokenStorePaths[path] = account.Name
+	}
+	return nil
+}
+
+// requiredAccountSettings returns the account settings needed by the enabled
+// directions, keyed by their configuration file names. Posting tweets needs
+// the OAuth 2.0 client and the Misskey webhook secret; receiving tweets needs
+// the bearer token and the username to follow.
+func (cfg *Config) requiredAccountSettings(account AccountConfig) map[string]string {
+	required := map[string]string{
+		"misskey_host":  account.MisskeyHost,
+		"misskey_token": account.MisskeyToken,
+	}
+	if cfg.Note2TweetEnabled {
+		required["misskey_media_host"] = account.MisskeyMediaHost
+		required["twitter_oauth2_client_id"] = account.TwitterOAuth2ClientID
+		required["twitter_oauth2_redirect_url"] = account.TwitterOAuth2RedirectURL
+		if cfg.MisskeySource == misskeySourceWebhook {
+			required["misskey_hook_secret"] = account.MisskeyHookSecret
+		}
+	}
+	if cfg.Tweet2NoteEnabled {
+		required["twitter_bearer_token"] = account.TwitterBearerToken
+		required["twitter_username"] = account.TwitterUsername
+	}
+	return required
+}
+
+func fallback(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
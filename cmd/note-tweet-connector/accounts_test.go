@@ -0,0 +1,236 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+)
+
+func writeAccountsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "accounts.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestConfigLoadAccountsFallsBackToFlags(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.TwitterTokenStorePath = "data/twitter_oauth2_token.json"
+	cfg.AccountsFile = writeAccountsFile(t, `{"accounts":[
+		{"name":"default","misskey_token":"token-a","misskey_hook_secret":"secret-a","twitter_username":"alice"},
+		{"name":"bob","misskey_host":"other.example","misskey_token":"token-b","misskey_hook_secret":"secret-b","twitter_username":"bob","twitter_token_store_path":"data/bob.json"}
+	]}`)
+
+	if err := cfg.loadAccounts(); err != nil {
+		t.Fatalf("loadAccounts() error = %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	accounts := cfg.accounts()
+	if len(accounts) != 2 {
+		t.Fatalf("accounts = %d, want 2", len(accounts))
+	}
+	if accounts[0].MisskeyHost != cfg.MisskeyHost || accounts[0].TwitterBearerToken != cfg.TwitterBearerToken {
+		t.Fatalf("accounts[0] = %+v, want flag fallbacks", accounts[0])
+	}
+	if want := filepath.Join("data", "twitter_oauth2_token-default.json"); accounts[0].TwitterTokenStorePath != want {
+		t.Fatalf("accounts[0].TwitterTokenStorePath = %q, want %q", accounts[0].TwitterTokenStorePath, want)
+	}
+	if accounts[0].namespace() != "" || accounts[0].loginPath() != "/twitter/login" {
+		t.Fatalf("default pair namespace = %q, login path = %q", accounts[0].namespace(), accounts[0].loginPath())
+	}
+	if accounts[1].MisskeyHost != "other.example" || accounts[1].TwitterTokenStorePath != "data/bob.json" {
+		t.Fatalf("accounts[1] = %+v, want its own fields", accounts[1])
+	}
+	if accounts[1].namespace() != "bob" || accounts[1].loginPath() != "/twitter/login/bob" {
+		t.Fatalf("bob namespace = %q, login path = %q", accounts[1].namespace(), accounts[1].loginPath())
+	}
+}
+
+func TestConfigLoadAccountsReadsYAML(t *testing.T) {
+	cfg := validTestConfig()
+	secretPath := filepath.Join(t.TempDir(), "misskey_token")
+	if err := os.WriteFile(secretPath, []byte("token-b\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cfg.AccountsFile = writeAccountsFile(t, `accounts:
+  - name: default
+    misskey_token: token-a
+    misskey_hook_secret: secret-a
+    twitter_username: alice
+  - name: bob
+    misskey_token_file: `+secretPath+`
+    misskey_hook_secret: secret-b
+    twitter_username: bob
+`)
+
+	if err := cfg.loadAccounts(); err != nil {
+		t.Fatalf("loadAccounts() error = %v", err)
+	}
+	accounts := cfg.accounts()
+	if len(accounts) != 2 || accounts[0].MisskeyToken != "token-a" || accounts[1].Name != "bob" || accounts[1].MisskeyToken != "token-b" {
+		t.Fatalf("accounts() = %+v, want alice and bob from the YAML file", accounts)
+	}
+
+	cfg = validTestConfig()
+	cfg.AccountsFile = writeAccountsFile(t, "accounts:\n  - name: a\n    misskey_tokn: t\n")
+	if err := cfg.loadAccounts(); err == nil || !strings.Contains(err.Error(), "misskey_tokn") {
+		t.Fatalf("loadAccounts() error = %v, want the unknown key rejected", err)
+	}
+}
+
+func TestConfigAccountsWithoutFileUsesFlags(t *testing.T) {
+	cfg := validTestConfig()
+
+	accounts := cfg.accounts()
+	if len(accounts) != 1 || accounts[0].Name != metrics.DefaultPair || accounts[0].MisskeyHookSecret != cfg.MisskeyHookSecret {
+		t.Fatalf("accounts() = %+v, want a default pair from flags", accounts)
+	}
+}
+
+func TestConfigValidateAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts string
+		want     string
+	}{
+		{
+			name:     "invalid name",
+			accounts: `{"name":"Bad Name","misskey_token":"t","misskey_hook_secret":"s","twitter_username":"u"}`,
+			want:     "must match",
+		},
+		{
+			name: "duplicate name",
+			accounts: `{"name":"a","misskey_token":"t","misskey_hook_secret":"s1","twitter_username":"u"},
+				{"name":"a","misskey_token":"t","misskey_hook_secret":"s2","twitter_username":"u"}`,
+			want: "used more than once",
+		},
+		{
+			name:     "missing field",
+			accounts: `{"name":"a","misskey_hook_secret":"s","twitter_username":"u"}`,
+			want:     "misskey_token",
+		},
+		{
+			name: "duplicate secret",
+			accounts: `{"name":"a","misskey_token":"t","misskey_hook_secret":"s","twitter_username":"u"},
+				{"name":"b","misskey_token":"t","misskey_hook_secret":"s","twitter_username":"u"}`,
+			want: "misskey_hook_secret",
+		},
+		{
+			name: "duplicate token store",
+			accounts: `{"name":"a","misskey_token":"t","misskey_hook_secret":"s1","twitter_username":"u","twitter_token_store_path":"data/x.json"},
+				{"name":"b","misskey_token":"t","misskey_hook_secret":"s2","twitter_username":"u","twitter_token_store_path":"data/./x.json"}`,
+			want: "twitter_token_store_path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			cfg.AccountsFile = writeAccountsFile(t, `{"accounts":[`+tt.accounts+`]}`)
+			if err := cfg.loadAccounts(); err != nil {
+				t.Fatalf("loadAccounts() error = %v", err)
+			}
+			err := cfg.validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("validate() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerWebhookRejectsUnknownSecret(t *testing.T) {
+	s := &server{
+		pairs: []*accountPair{
+			{account: AccountConfig{Name: "a", MisskeyHookSecret: "secret-a"}, metrics: metrics.NewNoop()},
+			{account: AccountConfig{Name: "b", MisskeyHookSecret: "secret-b"}, metrics: metrics.NewNoop()},
+		},
+		metrics: metrics.NewNoop(),
+	}
+
+	if pair := s.pairForMisskeySecret("secret-b"); pair == nil || pair.account.Name != "b" {
+		t.Fatalf("pairForMisskeySecret(secret-b) = %v, want pair b", pair)
+	}
+	if pair := s.pairForMisskeySecret(""); pair != nil {
+		t.Fatalf("pairForMisskeySecret(\"\") = %v, want nil", pair)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	req.Header.Set("User-Agent", "Misskey-Hooks")
+	req.Header.Set("X-Misskey-Hook-Secret", "secret-c")
+	rec := httptest.NewRecorder()
+	s.webhookHandler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestServerTwitterLoginUnknownPair(t *testing.T) {
+	s := &server{
+		pairs: []*accountPair{
+			{account: AccountConfig{Name: "a"}},
+			{account: AccountConfig{Name: "b"}},
+		},
+		metrics: metrics.NewNoop(),
+	}
+	if pair := s.pairByName(""); pair != nil {
+		t.Fatalf("pairByName(\"\") = %v, want nil without a default pair", pair)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/twitter/login/{pair}", s.twitterLoginHandler)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/twitter/login/c", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestTwitterStreamGroupRoutesByRuleTag(t *testing.T) {
+	pairs := []*accountPair{
+		{account: AccountConfig{Name: metrics.DefaultPair, TwitterBearerToken: "bearer-1"}},
+		{account: AccountConfig{Name: "bob", TwitterBearerToken: "bearer-1"}},
+		{account: AccountConfig{Name: "carol", TwitterBearerToken: "bearer-2"}},
+	}
+
+	accounts := make([]AccountConfig, len(pairs))
+	for i, pair := range pairs {
+		accounts[i] = pair.account
+	}
+	groups := newTwitterStreamGroups(pairs, accounts, &Config{}, nil)
+	if len(groups) != 2 || len(groups[0].pairs) != 2 || len(groups[1].pairs) != 1 {
+		t.Fatalf("groups = %+v, want pairs grouped by bearer token", groups)
+	}
+
+	got := groups[0].pairsForPayload([]byte(`{"data":{"id":"1"},"matching_rules":[{"id":"r","tag":"note-tweet-connector:bob"}]}`))
+	if len(got) != 1 || got[0].account.Name != "bob" {
+		t.Fatalf("pairsForPayload() = %v, want bob", got)
+	}
+	got = groups[0].pairsForPayload([]byte(`{"data":{"id":"1"},"matching_rules":[{"id":"r","tag":"note-tweet-connector"}]}`))
+	if len(got) != 1 || got[0].account.Name != metrics.DefaultPair {
+		t.Fatalf("pairsForPayload() = %v, want default", got)
+	}
+	got = groups[1].pairsForPayload([]byte(`{"data":{"id":"1"},"matching_rules":[{"id":"r","tag":"note-tweet-connector:carol"}]}`))
+	if len(got) != 1 || got[0].account.Name != "carol" {
+		t.Fatalf("pairsForPayload() = %v, want carol", got)
+	}
+	// A rule left by a pair that moved to another bearer token must not
+	// deliver its tweets to the pair that stayed.
+	got = groups[1].pairsForPayload([]byte(`{"data":{"id":"1"},"matching_rules":[{"id":"r","tag":"note-tweet-connector:bob"}]}`))
+	if len(got) != 0 {
+		t.Fatalf("pairsForPayload() = %v, want none for a rule of another pair", got)
+	}
+	got = groups[1].pairsForPayload([]byte(`{"data":{"id":"1"}}`))
+	if len(got) != 0 {
+		t.Fatalf("pairsForPayload() = %v, want none without matching rules", got)
+	}
+}
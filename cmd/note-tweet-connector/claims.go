@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+const claimsUsage = "usage: note-tweet-connector claims list [flags]\n       note-tweet-connector claims release [-pair name] [flags] <direction> <source ID>"
+
+// runClaimsCommand implements the claims subcommand, which lists the
+// cross-post claims held in the tracker database and releases the claims left
+// by a crashed process once the operator has checked that the post does not
+// exist.
+func runClaimsCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "release") {
+		_, _ = fmt.Fprintln(stderr, claimsUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("claims "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := &Config{}
+	cfg.registerFlags(fs)
+	pairName := fs.String("pair", "", "Account pair of the claim to release. Defaults to the default pair")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := cfg.applyConfigSources(fs, os.LookupEnv); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	if err := cfg.loadAccounts(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A non-positive retention keeps the command from pruning records.
+	rootTracker, err := tracker.NewSQLiteCrossPostTracker(ctx, cfg.TrackerDBPath, 0)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Failed to open cross-post tracker: %v\n", err)
+		return 1
+	}
+	defer func() { _ = rootTracker.Close() }()
+
+	if args[0] == "list" {
+		if fs.NArg() != 0 {
+			_, _ = fmt.Fprintln(stderr, claimsUsage)
+			return 2
+		}
+		if err := listClaims(ctx, stdout, rootTracker, cfg.accounts(), time.Now()); err != nil {
+			_, _ = fmt.Fprintf(stderr, "Failed to list claims: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if fs.NArg() != 2 {
+		_, _ = fmt.Fprintln(stderr, claimsUsage)
+		return 2
+	}
+	if err := releaseClaim(ctx, stdout, rootTracker, cfg.accounts(), *pairName, fs.Arg(0), fs.Arg(1)); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Failed to release claim: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// listClaims prints the claims of every pair with their age.
+func listClaims(ctx context.Context, w io.Writer, rootTracker *tracker.SQLiteCrossPostTracker, accounts []AccountConfig, now time.Time) error {
+	for _, account := range accounts {
+		claims, err := rootTracker.WithNamespace(account.namespace()).ListClaims(ctx)
+		if err != nil {
+			return err
+		}
+		for _, claim := range claims {
+			age := now.Sub(claim.ClaimedAt).Truncate(time.Second)
+			if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", account.Name, claim.Direction, claim.SourceID, claim.ClaimedAt.UTC().Format(time.RFC3339), age); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseClaim drops a held claim so that the next delivery of the post
+// cross-posts it.
+func releaseClaim(ctx context.Context, w io.Writer, rootTracker *tracker.SQLiteCrossPostTracker, accounts []AccountConfig, pairName, direction, sourceID string) error {
+	if direction != tracker.DirectionMisskeyToTweet && direction != tracker.DirectionTweetToMisskey {
+		return fmt.Errorf("direction must be %s or %s", tracker.DirectionMisskeyToTweet, tracker.DirectionTweetToMisskey)
+	}
+	account, ok := accountByName(accounts, pairName)
+	if !ok {
+		return fmt.Errorf("unknown account pair %q", pairName)
+	}
+
+	pairTracker := rootTracker.WithNamespace(account.namespace())
+	claims, err := pairTracker.ListClaims(ctx)
+	if err != nil {
+		return err
+	}
+	for _, claim := range claims {
+		if claim.Direction != direction || claim.SourceID != sourceID {
+			continue
+		}
+		if err := pairTracker.ReleaseClaim(ctx, direction, sourceID); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "released\t%s\t%s\t%s\n", account.Name, direction, sourceID)
+		return err
+	}
+	return fmt.Errorf("no %s claim of %s in pair %s", direction, sourceID, account.Name)
+}
+
+// accountByName returns the pair with the given name. An empty name selects
+// the default pair, or the only pair.
+func accountByName(accounts []AccountConfig, name string) (AccountConfig, bool) {
+	for _, account := range accounts {
+		if account.Name == name || (name == "" && account.namespace() == "") {
+			return account, true
+		}
+	}
+	if name == "" && len(accounts) == 1 {
+		return accounts[0], true
+	}
+	return AccountConfig{}, false
+}
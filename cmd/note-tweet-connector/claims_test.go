@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+func TestRunClaimsCommand(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "tracker.sqlite")
+	rootTracker, err := tracker.NewSQLiteCrossPostTracker(ctx, dbPath, 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	if err := rootTracker.Claim(ctx, tracker.DirectionMisskeyToTweet, "note-1"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if err := rootTracker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runClaimsCommand([]string{"list", "-tracker-db-path", dbPath}, &stdout, &stderr); code != 0 {
+		t.Fatalf("claims list exit code = %d, stderr = %q", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "default\tmisskey_to_tweet\tnote-1\t") {
+		t.Fatalf("claims list output = %q, want the held claim", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runClaimsCommand([]string{"release", "-tracker-db-path", dbPath, tracker.DirectionMisskeyToTweet, "note-2"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("claims release of a missing claim exit code = %d, want 1", code)
+	}
+	if code := runClaimsCommand([]string{"release", "-tracker-db-path", dbPath, "sideways", "note-1"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("claims release with an unknown direction exit code = %d, want 1", code)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runClaimsCommand([]string{"release", "-tracker-db-path", dbPath, tracker.DirectionMisskeyToTweet, "note-1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("claims release exit code = %d, stderr = %q", code, stderr.String())
+	}
+	if got, want := stdout.String(), "released\tdefault\tmisskey_to_tweet\tnote-1\n"; got != want {
+		t.Fatalf("claims release output = %q, want %q", got, want)
+	}
+
+	rootTracker, err = tracker.NewSQLiteCrossPostTracker(ctx, dbPath, 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer func() { _ = rootTracker.Close() }()
+	if claims, err := rootTracker.ListClaims(ctx); err != nil || len(claims) != 0 {
+		t.Fatalf("ListClaims() = %+v, %v; want the claim released", claims, err)
+	}
+}
+
+func TestListClaimsShowsAge(t *testing.T) {
+	ctx := context.Background()
+	rootTracker, err := tracker.NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer func() { _ = rootTracker.Close() }()
+	if err := rootTracker.WithNamespace("alice").Claim(ctx, tracker.DirectionTweetToMisskey, "tweet-1"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	accounts := []AccountConfig{{Name: "alice"}, {Name: "bob"}}
+	if err := listClaims(ctx, &out, rootTracker, accounts, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("listClaims() error = %v", err)
+	}
+	fields := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\t")
+	if len(fields) != 5 || fields[0] != "alice" || fields[2] != "tweet-1" || !strings.HasPrefix(fields[4], "2h") {
+		t.Fatalf("listClaims() output = %q, want alice's claim about 2h old", out.String())
+	}
+}
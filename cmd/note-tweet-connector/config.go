@@ -0,0 +1,307 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+const (
+	configFileFlag = "config-file"
+	redactedValue  = "REDACTED"
+)
+
+// secretFlags hold credentials. They can be read from a file through the
+// *_FILE environment variables and *_file configuration keys, and are hidden
+// by config print --redacted.
+var secretFlags = map[string]bool{
+	"misskey-hook-secret":  true,
+	"misskey-token":        true,
+	"twitter-bearer-token": true,
+	"discord-webhook-url":  true,
+}
+
+// envReferencePattern matches ${NAME} and ${NAME:-default} in configuration
+// file values.
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// configFile is the layout of -config-file. Every flag can be set with its
+// name in snake case, and the account pairs can be listed as in
+// -accounts-file.
+type configFile struct {
+	Settings map[string]string `yaml:",inline"`
+	Accounts []AccountConfig   `yaml:"accounts"`
+}
+
+// configKey returns the configuration file key of a flag.
+func configKey(flagName string) string {
+	return strings.ReplaceAll(flagName, "-", "_")
+}
+
+// envName returns the environment variable of a flag.
+func envName(flagName string) string {
+	return strings.ToUpper(configKey(flagName))
+}
+
+// applyConfigSources fills the flags that were not given on the command line
+// from -config-file and then from the environment. Flags take precedence over
+// the environment, which takes precedence over the file. Empty environment
+// variables are treated as unset, and command options such as -version are
+// never read from the environment.
+func (cfg *Config) applyConfigSources(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit[configFileFlag] {
+		if path, ok := lookupEnv(envName(configFileFlag)); ok && path != "" {
+			cfg.ConfigFile = path
+		}
+	}
+	if cfg.ConfigFile != "" {
+		file, err := readConfigFile(cfg.ConfigFile, lookupEnv)
+		if err != nil {
+			return err
+		}
+		for name, value := range file.Settings {
+			if explicit[name] {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %w", cfg.ConfigFile, configKey(name), err)
+			}
+		}
+		cfg.Accounts = file.Accounts
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || !isConfigurableFlag(f.Name) {
+			return
+		}
+		value, ok, lookupErr := lookupEnvValue(f.Name, lookupEnv)
+		if lookupErr != nil {
+			err = lookupErr
+			return
+		}
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// lookupEnvValue returns the environment value of a flag. Secrets can also be
+// read from the file named by the *_FILE variable. An empty variable does not
+// override the flag default, so that compose files can pass unset variables
+// through.
+func lookupEnvValue(flagName string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	name := envName(flagName)
+	value, ok := lookupNonEmptyEnv(lookupEnv, name)
+	if !secretFlags[flagName] {
+		return value, ok, nil
+	}
+	path, fileOK := lookupNonEmptyEnv(lookupEnv, name+"_FILE")
+	if !fileOK {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	}
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return value, true, nil
+}
+
+func lookupNonEmptyEnv(lookupEnv func(string) (string, bool), name string) (string, bool) {
+	value, ok := lookupEnv(name)
+	return value, ok && value != ""
+}
+
+// readConfigFile parses a configuration file, expands environment references
+// and reads the *_file secrets. The returned settings are keyed by flag name.
+func readConfigFile(path string, lookupEnv func(string) (string, bool)) (configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configFile{}, fmt.Errorf("read configuration file: %w", err)
+	}
+	var file configFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return configFile{}, fmt.Errorf("parse configuration file %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(file.Settings))
+	for key, value := range file.Settings {
+		value, err := expandEnv(value, lookupEnv)
+		if err != nil {
+			return configFile{}, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		name := strings.ReplaceAll(key, "_", "-")
+		if secretName, ok := strings.CutSuffix(name, "-file"); ok && secretFlags[secretName] {
+			if _, ok := file.Settings[configKey(secretName)]; ok {
+				return configFile{}, fmt.Errorf("%s: both %s and %s are set", path, configKey(secretName), key)
+			}
+			if value, err = readSecretFile(value); err != nil {
+				return configFile{}, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			name = secretName
+		}
+		if !isConfigurableFlag(name) {
+			return configFile{}, fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		settings[name] = value
+	}
+	file.Settings = settings
+
+	for i := range file.Accounts {
+		if err := expandEnvFields(&file.Accounts[i], lookupEnv); err != nil {
+			return configFile{}, fmt.Errorf("%s: account %q: %w", path, file.Accounts[i].Name, err)
+		}
+	}
+	return file, nil
+}
+
+// isConfigurableFlag reports whether a flag can be set from the configuration
+// file.
+func isConfigurableFlag(name string) bool {
+	if name == configFileFlag {
+		return false
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	(&Config{}).registerFlags(fs)
+	return fs.Lookup(name) != nil
+}
+
+// expandEnv replaces ${NAME} and ${NAME:-default} with environment values.
+// A reference to an unset variable without a default is an error, so that a
+// missing secret is not silently replaced with an empty string.
+func expandEnv(value string, lookupEnv func(string) (string, bool)) (string, error) {
+	var err error
+	expanded := envReferencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := envReferencePattern.FindStringSubmatch(ref)
+		v, ok := lookupEnv(match[1])
+		if strings.Contains(ref, ":-") && v == "" {
+			return match[2]
+		}
+		if ok {
+			return v
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", match[1])
+		}
+		return ""
+	})
+	return expanded, err
+}
+
+// expandEnvFields expands environment references in the string fields of a
+// struct.
+func expandEnvFields(v any, lookupEnv func(string) (string, bool)) error {
+	fields := reflect.ValueOf(v).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if field.Kind() != reflect.String {
+			continue
+		}
+		expanded, err := expandEnv(field.String(), lookupEnv)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fields.Type().Field(i).Name, err)
+		}
+		field.SetString(expanded)
+	}
+	return nil
+}
+
+// readSecretFile reads a secret from a file, dropping the trailing newline
+// that editors and secret mounts usually add.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// runConfigCommand implements the config subcommand.
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		_, _ = fmt.Fprintln(stderr, "usage: note-tweet-connector config print [--redacted] [flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := &Config{}
+	cfg.registerFlags(fs)
+	redacted := fs.Bool("redacted", false, "Hide secrets")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := cfg.applyConfigSources(fs, os.LookupEnv); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	if err := cfg.loadAccounts(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+
+	if err := printConfig(stdout, fs, cfg, *redacted); err != nil {
+		_, _ = fmt.Fprintf(stderr, "Failed to print configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// printConfig writes the effective configuration in the configuration file
+// format.
+func printConfig(w io.Writer, fs *flag.FlagSet, cfg *Config, redacted bool) error {
+	var settings yaml.MapSlice
+	fs.VisitAll(func(f *flag.Flag) {
+		if !isConfigurableFlag(f.Name) {
+			return
+		}
+		value := f.Value.String()
+		if redacted && secretFlags[f.Name] && value != "" {
+			value = redactedValue
+		}
+		settings = append(settings, yaml.MapItem{Key: configKey(f.Name), Value: value})
+	})
+
+	if cfg.hasAccountList() {
+		accounts := append([]AccountConfig(nil), cfg.Accounts...)
+		if redacted {
+			for i := range accounts {
+				accounts[i].redactSecrets()
+			}
+		}
+		settings = append(settings, yaml.MapItem{Key: "accounts", Value: accounts})
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (a *AccountConfig) redactSecrets() {
+	for _, secret := range []*string{&a.MisskeyToken, &a.MisskeyHookSecret, &a.TwitterBearerToken} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+}
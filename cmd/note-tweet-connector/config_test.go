@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func loadTestConfig(t *testing.T, args []string, env map[string]string) (*Config, *flag.FlagSet, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := &Config{}
+	cfg.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	err := cfg.applyConfigSources(fs, func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	return cfg, fs, err
+}
+
+func TestApplyConfigSourcesPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+port: 8081
+metrics_port: 9091
+log_level: debug
+misskey_host: ${MISSKEY_DOMAIN}
+misskey_media_host: ${MEDIA_DOMAIN:-media.example}
+deletion_sync_interval: 5m
+`)
+
+	cfg, _, err := loadTestConfig(t, []string{"-config-file", path, "-log-level", "error"}, map[string]string{
+		"MISSKEY_DOMAIN": "misskey.example",
+		"METRICS_PORT":   "9092",
+		"LOG_LEVEL":      "warn",
+	})
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+	if cfg.Port != "8081" {
+		t.Fatalf("Port = %q, want the file value", cfg.Port)
+	}
+	if cfg.MetricsPort != "9092" {
+		t.Fatalf("MetricsPort = %q, want the environment to override the file", cfg.MetricsPort)
+	}
+	if cfg.LogLevel != "error" {
+		t.Fatalf("LogLevel = %q, want the flag to override the environment", cfg.LogLevel)
+	}
+	if cfg.MisskeyHost != "misskey.example" || cfg.MisskeyMediaHost != "media.example" {
+		t.Fatalf("MisskeyHost = %q, MisskeyMediaHost = %q; want interpolated values", cfg.MisskeyHost, cfg.MisskeyMediaHost)
+	}
+	if cfg.DeletionSyncInterval != 5*time.Minute {
+		t.Fatalf("DeletionSyncInterval = %v, want 5m", cfg.DeletionSyncInterval)
+	}
+	if cfg.TrackerDBPath != "data/tracker.sqlite" {
+		t.Fatalf("TrackerDBPath = %q, want the flag default", cfg.TrackerDBPath)
+	}
+}
+
+func TestLoadConfigIgnoresEmptyEnvironment(t *testing.T) {
+	tokenPath := writeConfigFile(t, "misskey_token", "token-from-file\n")
+	path := writeConfigFile(t, "config.yaml", "metrics_port: 9091\n")
+
+	cfg, fs, err := loadConfig(nil, flag.ContinueOnError, func(name string) (string, bool) {
+		value, ok := map[string]string{
+			"CONFIG_FILE":        path,
+			"VERSION":            "1.2.3",
+			"METRICS_PORT":       "",
+			"WEBHOOK_WORKERS":    "",
+			"MISSKEY_TOKEN":      "",
+			"MISSKEY_TOKEN_FILE": tokenPath,
+			"TWITTER_SOURCE":     "",
+		}[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.MetricsPort != "9091" {
+		t.Fatalf("MetricsPort = %q, want the file value", cfg.MetricsPort)
+	}
+	if cfg.WebhookWorkers != 4 || cfg.TwitterSource != twitterSourceStream {
+		t.Fatalf("WebhookWorkers = %d, TwitterSource = %q; want the flag defaults", cfg.WebhookWorkers, cfg.TwitterSource)
+	}
+	if cfg.MisskeyToken != "token-from-file" {
+		t.Fatalf("MisskeyToken = %q, want the *_FILE value", cfg.MisskeyToken)
+	}
+	if got := fs.Lookup("version").Value.String(); got != "false" {
+		t.Fatalf("version = %q, want the environment to be ignored", got)
+	}
+}
+
+func TestApplyConfigSourcesSecretFiles(t *testing.T) {
+	tokenPath := writeConfigFile(t, "misskey_token", "token-from-file\n")
+	bearerPath := writeConfigFile(t, "bearer", "bearer-from-file\n")
+	path := writeConfigFile(t, "config.yaml", "misskey_token_file: "+tokenPath+"\n")
+
+	cfg, _, err := loadTestConfig(t, nil, map[string]string{
+		"CONFIG_FILE":               path,
+		"TWITTER_BEARER_TOKEN_FILE": bearerPath,
+	})
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+	if cfg.MisskeyToken != "token-from-file" {
+		t.Fatalf("MisskeyToken = %q, want token-from-file", cfg.MisskeyToken)
+	}
+	if cfg.TwitterBearerToken != "bearer-from-file" {
+		t.Fatalf("TwitterBearerToken = %q, want bearer-from-file", cfg.TwitterBearerToken)
+	}
+}
+
+func TestApplyConfigSourcesErrors(t *testing.T) {
+	secretPath := writeConfigFile(t, "secret", "secret")
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{
+			name:   "unknown setting",
+			config: "misskey_hots: misskey.example\n",
+			want:   `unknown setting "misskey_hots"`,
+		},
+		{
+			name:   "unset variable",
+			config: "misskey_token: ${MISSKEY_TOKEN_VALUE}\n",
+			want:   "MISSKEY_TOKEN_VALUE is not set",
+		},
+		{
+			name:   "secret and secret file",
+			config: "misskey_token: token\nmisskey_token_file: " + secretPath + "\n",
+			want:   "both misskey_token and misskey_token_file",
+		},
+		{
+			name:   "file variant of a non-secret",
+			config: "misskey_host_file: " + secretPath + "\n",
+			want:   "unknown setting",
+		},
+		{
+			name:   "environment secret and secret file",
+			config: "port: 8080\n",
+			env:    map[string]string{"MISSKEY_TOKEN": "token", "MISSKEY_TOKEN_FILE": secretPath},
+			want:   "both MISSKEY_TOKEN and MISSKEY_TOKEN_FILE",
+		},
+		{
+			name:   "invalid duration",
+			config: "deletion_sync_interval: soon\n",
+			want:   "deletion_sync_interval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, "config.yaml", tt.config)
+			_, _, err := loadTestConfig(t, []string{"-config-file", path}, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("applyConfigSources() error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFileAccounts(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+misskey_host: misskey.example
+twitter_bearer_token: bearer
+accounts:
+  - name: alice
+    misskey_token: ${ALICE_TOKEN}
+    misskey_hook_secret: secret-a
+    twitter_username: alice
+`)
+
+	cfg, _, err := loadTestConfig(t, []string{"-config-file", path}, map[string]string{"ALICE_TOKEN": "token-a"})
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+	if err := cfg.loadAccounts(); err != nil {
+		t.Fatalf("loadAccounts() error = %v", err)
+	}
+	accounts := cfg.accounts()
+	if len(accounts) != 1 || accounts[0].MisskeyToken != "token-a" || accounts[0].MisskeyHost != "misskey.example" {
+		t.Fatalf("accounts() = %+v, want the interpolated account with flag fallbacks", accounts)
+	}
+
+	cfg.AccountsFile = writeAccountsFile(t, `{"accounts":[]}`)
+	if err := cfg.loadAccounts(); err == nil {
+		t.Fatal("loadAccounts() error = nil, want an error for accounts in both files")
+	}
+}
+
+func TestPrintConfigRedacted(t *testing.T) {
+	cfg, fs, err := loadTestConfig(t, []string{"-misskey-token", "token-1", "-misskey-host", "misskey.example"}, map[string]string{
+		"DISCORD_WEBHOOK_URL": "https://discord.example/webhook",
+	})
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+
+	var redacted bytes.Buffer
+	if err := printConfig(&redacted, fs, cfg, true); err != nil {
+		t.Fatalf("printConfig() error = %v", err)
+	}
+	out := redacted.String()
+	for _, secret := range []string{"token-1", "discord.example"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("redacted output contains %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"misskey_token: REDACTED", "misskey_host: misskey.example", "misskey_hook_secret: \"\""} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("redacted output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "config_file") {
+		t.Fatalf("output contains config_file:\n%s", out)
+	}
+
+	var plain bytes.Buffer
+	if err := printConfig(&plain, fs, cfg, false); err != nil {
+		t.Fatalf("printConfig() error = %v", err)
+	}
+	if !strings.Contains(plain.String(), "misskey_token: token-1") {
+		t.Fatalf("output does not contain the token:\n%s", plain.String())
+	}
+}
+
+func TestApplyConfigSourcesDirections(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "tweet2note_enabled: false\n")
+	cfg, _, err := loadTestConfig(t, []string{"-config-file", path}, nil)
+	if err != nil {
+		t.Fatalf("applyConfigSources() error = %v", err)
+	}
+	if !cfg.Note2TweetEnabled || cfg.Tweet2NoteEnabled {
+		t.Fatalf("Note2TweetEnabled = %v, Tweet2NoteEnabled = %v; want note2tweet only", cfg.Note2TweetEnabled, cfg.Tweet2NoteEnabled)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
+	"github.com/Soli0222/note-tweet-connector/internal/handler"
+)
+
+// misskeyVisibilities are the values of the visibility override.
+var misskeyVisibilities = []string{"public", "home", "followers", "specified"}
+
+// loadFilterRules reads -filter-rules-file. Without it the handlers use the
+// built-in rules.
+func (cfg *Config) loadFilterRules() error {
+	cfg.filterRules = filter.Rules{}
+	if cfg.FilterRulesFile == "" {
+		return nil
+	}
+	rules, err := readFilterRules(cfg.FilterRulesFile)
+	if err != nil {
+		return err
+	}
+	cfg.filterRules = rules
+	return nil
+}
+
+// readFilterRules loads a filter rules file and checks that the overrides
+// are valid for the direction of their rule.
+func readFilterRules(path string) (filter.Rules, error) {
+	rules, err := filter.Load(path)
+	if err != nil {
+		return filter.Rules{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if rules.Note2Tweet != nil {
+		for _, rule := range rules.Note2Tweet.Rules {
+			overrides := rule.Overrides
+			if overrides.Visibility != "" || overrides.CW != "" {
+				return filter.Rules{}, fmt.Errorf("%s: note2tweet rule %q: visibility and cw overrides only apply to tweet2note", path, rule.Name)
+			}
+			if overrides.CWPolicy != "" && !slices.Contains(handler.CWPolicies(), overrides.CWPolicy) {
+				return filter.Rules{}, fmt.Errorf("%s: note2tweet rule %q: cw_policy must be one of %v", path, rule.Name, handler.CWPolicies())
+			}
+			if overrides.LongNotePolicy != "" && !slices.Contains(handler.LongNotePolicies(), overrides.LongNotePolicy) {
+				return filter.Rules{}, fmt.Errorf("%s: note2tweet rule %q: long_note_policy must be one of %v", path, rule.Name, handler.LongNotePolicies())
+			}
+		}
+	}
+	if rules.Tweet2Note != nil {
+		for _, rule := range rules.Tweet2Note.Rules {
+			overrides := rule.Overrides
+			if overrides.CWPolicy != "" || overrides.LongNotePolicy != "" {
+				return filter.Rules{}, fmt.Errorf("%s: tweet2note rule %q: cw_policy and long_note_policy overrides only apply to note2tweet", path, rule.Name)
+			}
+			if overrides.Visibility != "" && !slices.Contains(misskeyVisibilities, overrides.Visibility) {
+				return filter.Rules{}, fmt.Errorf("%s: tweet2note rule %q: visibility must be one of %v", path, rule.Name, misskeyVisibilities)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// runFilterCommand implements the filter subcommand, which prints the
+// decision of a rule set for saved Misskey webhook and Filtered Stream
+// payloads.
+func runFilterCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		_, _ = fmt.Fprintln(stderr, "usage: note-tweet-connector filter test [-rules file] payload.json...")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("filter test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	rulesFile := fs.String("rules", "", "Path to a filter rules file. Defaults to the built-in rules")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		_, _ = fmt.Fprintln(stderr, "usage: note-tweet-connector filter test [-rules file] payload.json...")
+		return 2
+	}
+
+	var rules filter.Rules
+	if *rulesFile != "" {
+		var err error
+		if rules, err = readFilterRules(*rulesFile); err != nil {
+			_, _ = fmt.Fprintf(stderr, "Invalid filter rules: %v\n", err)
+			return 1
+		}
+	}
+	if rules.Note2Tweet == nil {
+		rules.Note2Tweet = filter.DefaultNote2Tweet()
+	}
+	if rules.Tweet2Note == nil {
+		rules.Tweet2Note = filter.DefaultTweet2Note()
+	}
+
+	status := 0
+	for _, path := range fs.Args() {
+		if err := testFilterPayload(stdout, path, rules); err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// testFilterPayload prints the decision for each post in a payload file.
+func testFilterPayload(w io.Writer, path string, rules filter.Rules) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var payload struct {
+		Body struct {
+			Note json.RawMessage `json:"note"`
+		} `json:"body"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	var direction string
+	var set *filter.RuleSet
+	var posts []filter.Post
+	switch {
+	case payload.Body.Note != nil:
+		direction, set = "note2tweet", rules.Note2Tweet
+		post, err := handler.NoteFilterPost(data)
+		if err != nil {
+			return err
+		}
+		posts = []filter.Post{post}
+	case payload.Data != nil:
+		direction, set = "tweet2note", rules.Tweet2Note
+		if posts, err = handler.TweetFilterPosts(data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("not a Misskey webhook or Filtered Stream payload")
+	}
+
+	for _, post := range posts {
+		decision := set.Evaluate(post)
+		action := filter.ActionForward
+		if decision.Skip {
+			action = filter.ActionSkip
+		}
+		rule := decision.Rule
+		if rule == "" {
+			rule = "-"
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", path, direction, rule, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
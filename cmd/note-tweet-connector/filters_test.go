@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadFilterRulesValidatesOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown cw policy",
+			content: "note2tweet:\n  rules:\n    - name: a\n      action: forward\n      overrides:\n        cw_policy: hide\n",
+			wantErr: "cw_policy must be one of",
+		},
+		{
+			name:    "unknown long note policy",
+			content: "note2tweet:\n  rules:\n    - name: a\n      action: forward\n      overrides:\n        long_note_policy: split\n",
+			wantErr: "long_note_policy must be one of",
+		},
+		{
+			name:    "visibility on note2tweet",
+			content: "note2tweet:\n  rules:\n    - name: a\n      action: forward\n      overrides:\n        visibility: home\n",
+			wantErr: "only apply to tweet2note",
+		},
+		{
+			name:    "cw policy on tweet2note",
+			content: "tweet2note:\n  rules:\n    - name: a\n      action: forward\n      overrides:\n        cw_policy: full\n",
+			wantErr: "only apply to note2tweet",
+		},
+		{
+			name:    "unknown visibility",
+			content: "tweet2note:\n  rules:\n    - name: a\n      action: forward\n      overrides:\n        visibility: private\n",
+			wantErr: "visibility must be one of",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, "filters.yaml", tt.content)
+			_, err := readFilterRules(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("readFilterRules() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunFilterCommand(t *testing.T) {
+	payloads := []string{"../../testdata/misskey_note.json", "../../testdata/filtered_stream_tweet.json"}
+
+	var stdout, stderr bytes.Buffer
+	if code := runFilterCommand(append([]string{"test"}, payloads...), &stdout, &stderr); code != 0 {
+		t.Fatalf("runFilterCommand() = %d, stderr = %s", code, stderr.String())
+	}
+	want := "../../testdata/misskey_note.json\tnote2tweet\tnot_public\tskip\n" +
+		"../../testdata/filtered_stream_tweet.json\ttweet2note\trn_pattern\tskip\n"
+	if stdout.String() != want {
+		t.Fatalf("output = %q, want %q", stdout.String(), want)
+	}
+
+	rules := writeConfigFile(t, "filters.yaml", `
+note2tweet:
+  builtin: false
+  rules:
+    - name: followers_ok
+      match:
+        visibility: [followers]
+      action: forward
+tweet2note:
+  builtin: false
+  rules: []
+`)
+	stdout.Reset()
+	if code := runFilterCommand(append([]string{"test", "-rules", rules}, payloads...), &stdout, &stderr); code != 0 {
+		t.Fatalf("runFilterCommand() = %d, stderr = %s", code, stderr.String())
+	}
+	want = "../../testdata/misskey_note.json\tnote2tweet\tfollowers_ok\tforward\n" +
+		"../../testdata/filtered_stream_tweet.json\ttweet2note\t-\tforward\n"
+	if stdout.String() != want {
+		t.Fatalf("output = %q, want %q", stdout.String(), want)
+	}
+
+	stderr.Reset()
+	if code := runFilterCommand([]string{"test", rules}, &stdout, &stderr); code != 1 {
+		t.Fatalf("runFilterCommand() = %d, want 1 for a file that is not a payload", code)
+	}
+	if code := runFilterCommand([]string{"test"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("runFilterCommand() = %d, want 2 without payloads", code)
+	}
+}
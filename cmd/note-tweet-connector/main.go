@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,15 +11,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
 	"github.com/Soli0222/note-tweet-connector/internal/handler"
 	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/mfm"
 	"github.com/Soli0222/note-tweet-connector/internal/misskey"
 	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/outbox"
 	"github.com/Soli0222/note-tweet-connector/internal/tracker"
 	"github.com/Soli0222/note-tweet-connector/internal/twitter"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,109 +32,235 @@ import (
 
 var version = "dev"
 
+// Values for -misskey-source.
+const (
+	misskeySourceWebhook = "webhook"
+	misskeySourceStream  = "stream"
+)
+
+// Values for -twitter-source.
+const (
+	twitterSourceStream   = "stream"
+	twitterSourceTimeline = "timeline"
+)
+
+// Tracker cursors of the timeline poller. twitterTimelineCursor holds the
+// newest tweet ID whose older tweets were all fetched. While a poll is cut
+// short by the page limit or the rate limit, twitterTimelineUntilCursor holds
+// the oldest tweet ID fetched so far, and twitterTimelinePendingCursor the
+// newest one, which becomes the since_id once the gap below it is fetched.
+const (
+	twitterTimelineCursor        = "twitter_timeline_since_id"
+	twitterTimelineUntilCursor   = "twitter_timeline_until_id"
+	twitterTimelinePendingCursor = "twitter_timeline_pending_since_id"
+)
+
 // Config holds the application configuration
 type Config struct {
-	Port             string
-	MetricsPort      string
-	TrackerDBPath    string
-	TrackerRetention time.Duration
-	ReadTimeout      time.Duration
-	WriteTimeout     time.Duration
-	IdleTimeout      time.Duration
-	ShutdownTimeout  time.Duration
-	LogLevel         string
-
+	ConfigFile           string
+	Port                 string
+	MetricsPort          string
+	TrackerDBPath        string
+	TrackerRetention     time.Duration
+	TrackerClaimLease    time.Duration
+	DeletionSyncInterval time.Duration
+	DeletionSyncWindow   time.Duration
+	DeletionSyncMaxNotes int
+	OutboxRetryMin       time.Duration
+	OutboxRetryMax       time.Duration
+	OutboxMaxAttempts    int
+	ReadTimeout          time.Duration
+	WriteTimeout         time.Duration
+	IdleTimeout          time.Duration
+	ShutdownTimeout      time.Duration
+	WebhookWorkers       int
+	WebhookQueueSize     int
+	LogLevel             string
+	AccountsFile         string
+	Accounts             []AccountConfig
+	Note2TweetEnabled    bool
+	Tweet2NoteEnabled    bool
+	FilterRulesFile      string
+
+	MisskeySource              string
 	MisskeyHookSecret          string
 	MisskeyHost                string
 	MisskeyToken               string
 	MisskeyMediaHost           string
 	TwitterMediaHosts          string
+	MisskeyDriveMaxFileMB      int
+	MisskeyStreamKeepAlive     time.Duration
+	MisskeyStreamReconnectMin  time.Duration
+	MisskeyStreamReconnectMax  time.Duration
 	TwitterOAuth2ClientID      string
 	TwitterOAuth2RedirectURL   string
 	TwitterTokenStorePath      string
 	TwitterBearerToken         string
+	TwitterSource              string
+	TwitterTimelinePoll        time.Duration
 	TwitterStreamKeepAlive     time.Duration
 	TwitterStreamReconnectMin  time.Duration
 	TwitterStreamReconnectMax  time.Duration
 	TwitterUsername            string
+	TwitterLongNotePolicy      string
+	TwitterCWPolicy            string
+	TwitterCWMediaPolicy       string
+	TwitterCustomEmoji         string
 	DiscordWebhookURL          string
 	DiscordNotifyTimeout       time.Duration
 	DiscordStreamLoopWindow    time.Duration
 	DiscordStreamLoopThreshold int
 	DiscordErrorDedupeWindow   time.Duration
+	DiscordRateLimitThreshold  int
+
+	// filterRules holds the rules read from FilterRulesFile.
+	filterRules filter.Rules
+}
+
+// registerFlags defines the flags for every Config field on fs.
+func (cfg *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.ConfigFile, configFileFlag, "", "Path to a YAML configuration file")
+	fs.StringVar(&cfg.Port, "port", "8080", "Server port")
+	fs.StringVar(&cfg.MetricsPort, "metrics-port", "9090", "Metrics server port")
+	fs.StringVar(&cfg.TrackerDBPath, "tracker-db-path", "data/tracker.sqlite", "Path to sqlite database for the cross-post tracker")
+	fs.DurationVar(&cfg.TrackerRetention, "tracker-retention", 90*24*time.Hour, "Duration to keep tracker records before pruning; non-positive keeps records indefinitely")
+	fs.DurationVar(&cfg.TrackerClaimLease, "tracker-claim-lease", time.Hour, "Age after which a cross-post claim is taken to be left by a crashed worker and its post fails; non-positive retries claimed posts indefinitely")
+	fs.DurationVar(&cfg.DeletionSyncInterval, "deletion-sync-interval", 10*time.Minute, "Interval for checking tracked posts for deletions; 0 disables deletion sync")
+	fs.DurationVar(&cfg.DeletionSyncWindow, "deletion-sync-window", 72*time.Hour, "Age of the tracked posts checked for deletions")
+	fs.IntVar(&cfg.DeletionSyncMaxNotes, "deletion-sync-max-notes", 100, "Number of tracked posts checked per deletion sync; the rest are checked by the following syncs. 0 checks every post")
+	fs.DurationVar(&cfg.OutboxRetryMin, "outbox-retry-min", outbox.DefaultRetryMin, "Delay before the first retry of a failed cross-post")
+	fs.DurationVar(&cfg.OutboxRetryMax, "outbox-retry-max", outbox.DefaultRetryMax, "Maximum delay between retries of a failed cross-post")
+	fs.IntVar(&cfg.OutboxMaxAttempts, "outbox-max-attempts", 0, "Attempts before a failed cross-post is given up; 0 retries until it succeeds")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 15*time.Second, "HTTP read timeout")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 15*time.Second, "HTTP write timeout")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "HTTP idle timeout")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Graceful shutdown timeout")
+	fs.IntVar(&cfg.WebhookWorkers, "webhook-workers", 4, "Number of Misskey webhooks and stream notes posted at the same time")
+	fs.IntVar(&cfg.WebhookQueueSize, "webhook-queue-size", 64, "Number of accepted Misskey webhooks waiting for a worker before new ones are rejected with 429")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	fs.BoolVar(&cfg.Note2TweetEnabled, "note2tweet-enabled", true, "Cross-post Misskey notes to Twitter")
+	fs.BoolVar(&cfg.Tweet2NoteEnabled, "tweet2note-enabled", true, "Cross-post tweets to Misskey")
+	fs.StringVar(&cfg.FilterRulesFile, "filter-rules-file", "", "Path to a YAML file with the rules deciding which notes and tweets are cross-posted")
+	fs.StringVar(&cfg.AccountsFile, "accounts-file", "", "Path to a YAML file listing Misskey/Twitter account pairs; replaces the per-account flags")
+	fs.StringVar(&cfg.MisskeySource, "misskey-source", misskeySourceWebhook, "How to receive Misskey notes (webhook, stream)")
+	fs.StringVar(&cfg.MisskeyHookSecret, "misskey-hook-secret", "", "Secret used to verify Misskey webhook requests")
+	fs.StringVar(&cfg.MisskeyHost, "misskey-host", "", "Misskey instance host")
+	fs.StringVar(&cfg.MisskeyToken, "misskey-token", "", "Misskey API token")
+	fs.StringVar(&cfg.MisskeyMediaHost, "misskey-media-host", "", "Allowed Misskey media host for Twitter uploads")
+	fs.IntVar(&cfg.MisskeyDriveMaxFileMB, "misskey-drive-max-file-mb", 30, "Maximum size in MB of Twitter media files uploaded to Misskey Drive")
+	fs.DurationVar(&cfg.MisskeyStreamKeepAlive, "misskey-stream-keep-alive-timeout", 90*time.Second, "Misskey stream keep-alive timeout")
+	fs.DurationVar(&cfg.MisskeyStreamReconnectMin, "misskey-stream-reconnect-min", 5*time.Second, "Minimum Misskey stream reconnect backoff")
+	fs.DurationVar(&cfg.MisskeyStreamReconnectMax, "misskey-stream-reconnect-max", 5*time.Minute, "Maximum Misskey stream reconnect backoff")
+	fs.StringVar(&cfg.TwitterMediaHosts, "twitter-media-hosts", misskey.DefaultTwitterMediaHosts, "Comma-separated allowed Twitter media hosts for Misskey uploads")
+	fs.StringVar(&cfg.TwitterOAuth2ClientID, "twitter-oauth2-client-id", "", "Twitter OAuth 2.0 client ID")
+	fs.StringVar(&cfg.TwitterOAuth2RedirectURL, "twitter-oauth2-redirect-url", "", "Twitter OAuth 2.0 redirect URL")
+	fs.StringVar(&cfg.TwitterTokenStorePath, "twitter-token-store-path", "data/twitter_oauth2_token.json", "Path to JSON file for refreshed Twitter OAuth 2.0 tokens")
+	fs.StringVar(&cfg.TwitterBearerToken, "twitter-bearer-token", "", "Twitter Application-Only Bearer Token for Filtered Stream")
+	fs.StringVar(&cfg.TwitterSource, "twitter-source", twitterSourceStream, "How to receive tweets (stream, timeline)")
+	fs.DurationVar(&cfg.TwitterTimelinePoll, "twitter-timeline-poll-interval", 2*time.Minute, "Interval for polling the Twitter user timeline")
+	fs.DurationVar(&cfg.TwitterStreamKeepAlive, "twitter-stream-keep-alive-timeout", 90*time.Second, "Twitter stream keep-alive timeout")
+	fs.DurationVar(&cfg.TwitterStreamReconnectMin, "twitter-stream-reconnect-min", 5*time.Second, "Minimum Twitter stream reconnect backoff")
+	fs.DurationVar(&cfg.TwitterStreamReconnectMax, "twitter-stream-reconnect-max", 5*time.Minute, "Maximum Twitter stream reconnect backoff")
+	fs.StringVar(&cfg.TwitterUsername, "twitter-username", "", "Fallback Twitter username")
+	fs.StringVar(&cfg.TwitterLongNotePolicy, "twitter-long-note-policy", handler.LongNotePolicyPost, "How to post notes longer than a tweet ("+strings.Join(handler.LongNotePolicies(), ", ")+")")
+	fs.StringVar(&cfg.TwitterCWPolicy, "twitter-cw-policy", handler.CWPolicyMask, "How to post notes with a CW ("+strings.Join(handler.CWPolicies(), ", ")+")")
+	fs.StringVar(&cfg.TwitterCWMediaPolicy, "twitter-cw-media-policy", "", "How to post notes with a CW and files. Defaults to -twitter-cw-policy")
+	fs.StringVar(&cfg.TwitterCustomEmoji, "twitter-custom-emoji", mfm.CustomEmojiText, "How to render Misskey custom emoji in tweets (text, drop)")
+	fs.StringVar(&cfg.DiscordWebhookURL, "discord-webhook-url", "", "Discord webhook URL for operator notifications")
+	fs.DurationVar(&cfg.DiscordNotifyTimeout, "discord-notify-timeout", 5*time.Second, "Discord notification request timeout")
+	fs.DurationVar(&cfg.DiscordStreamLoopWindow, "discord-stream-loop-window", 10*time.Minute, "Window for Twitter stream disconnect loop notification")
+	fs.IntVar(&cfg.DiscordStreamLoopThreshold, "discord-stream-loop-threshold", 5, "Disconnect count threshold for Twitter stream loop notification")
+	fs.DurationVar(&cfg.DiscordErrorDedupeWindow, "discord-error-dedupe-window", 10*time.Minute, "Duration to suppress duplicate Discord error notifications")
+	fs.IntVar(&cfg.DiscordRateLimitThreshold, "discord-rate-limit-threshold", 5, "Remaining Twitter requests at which a rate limit warning is sent; 0 disables the warning")
 }
 
-func parseFlags() *Config {
+func parseFlags() (*Config, *flag.FlagSet, error) {
+	return loadConfig(os.Args[1:], flag.ExitOnError, os.LookupEnv)
+}
+
+// loadConfig builds the configuration from the command line arguments, the
+// environment and the configuration file. The returned flag set holds the
+// effective value of every setting.
+func loadConfig(args []string, errorHandling flag.ErrorHandling, lookupEnv func(string) (string, bool)) (*Config, *flag.FlagSet, error) {
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
 	cfg := &Config{}
+	cfg.registerFlags(fs)
+	showVersion := fs.Bool("version", false, "Show version and exit")
 
-	flag.StringVar(&cfg.Port, "port", "8080", "Server port")
-	flag.StringVar(&cfg.MetricsPort, "metrics-port", "9090", "Metrics server port")
-	flag.StringVar(&cfg.TrackerDBPath, "tracker-db-path", "data/tracker.sqlite", "Path to sqlite database for the cross-post tracker")
-	flag.DurationVar(&cfg.TrackerRetention, "tracker-retention", 90*24*time.Hour, "Duration to keep tracker records before pruning; non-positive keeps records indefinitely")
-	flag.DurationVar(&cfg.ReadTimeout, "read-timeout", 15*time.Second, "HTTP read timeout")
-	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", 15*time.Second, "HTTP write timeout")
-	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", 60*time.Second, "HTTP idle timeout")
-	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Graceful shutdown timeout")
-	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
-	flag.StringVar(&cfg.MisskeyHookSecret, "misskey-hook-secret", "", "Secret used to verify Misskey webhook requests")
-	flag.StringVar(&cfg.MisskeyHost, "misskey-host", "", "Misskey instance host")
-	flag.StringVar(&cfg.MisskeyToken, "misskey-token", "", "Misskey API token")
-	flag.StringVar(&cfg.MisskeyMediaHost, "misskey-media-host", "", "Allowed Misskey media host for Twitter uploads")
-	flag.StringVar(&cfg.TwitterMediaHosts, "twitter-media-hosts", misskey.DefaultTwitterMediaHosts, "Comma-separated allowed Twitter media hosts for Misskey uploads")
-	flag.StringVar(&cfg.TwitterOAuth2ClientID, "twitter-oauth2-client-id", "", "Twitter OAuth 2.0 client ID")
-	flag.StringVar(&cfg.TwitterOAuth2RedirectURL, "twitter-oauth2-redirect-url", "", "Twitter OAuth 2.0 redirect URL")
-	flag.StringVar(&cfg.TwitterTokenStorePath, "twitter-token-store-path", "data/twitter_oauth2_token.json", "Path to JSON file for refreshed Twitter OAuth 2.0 tokens")
-	flag.StringVar(&cfg.TwitterBearerToken, "twitter-bearer-token", "", "Twitter Application-Only Bearer Token for Filtered Stream")
-	flag.DurationVar(&cfg.TwitterStreamKeepAlive, "twitter-stream-keep-alive-timeout", 90*time.Second, "Twitter stream keep-alive timeout")
-	flag.DurationVar(&cfg.TwitterStreamReconnectMin, "twitter-stream-reconnect-min", 5*time.Second, "Minimum Twitter stream reconnect backoff")
-	flag.DurationVar(&cfg.TwitterStreamReconnectMax, "twitter-stream-reconnect-max", 5*time.Minute, "Maximum Twitter stream reconnect backoff")
-	flag.StringVar(&cfg.TwitterUsername, "twitter-username", "", "Fallback Twitter username")
-	flag.StringVar(&cfg.DiscordWebhookURL, "discord-webhook-url", "", "Discord webhook URL for operator notifications")
-	flag.DurationVar(&cfg.DiscordNotifyTimeout, "discord-notify-timeout", 5*time.Second, "Discord notification request timeout")
-	flag.DurationVar(&cfg.DiscordStreamLoopWindow, "discord-stream-loop-window", 10*time.Minute, "Window for Twitter stream disconnect loop notification")
-	flag.IntVar(&cfg.DiscordStreamLoopThreshold, "discord-stream-loop-threshold", 5, "Disconnect count threshold for Twitter stream loop notification")
-	flag.DurationVar(&cfg.DiscordErrorDedupeWindow, "discord-error-dedupe-window", 10*time.Minute, "Duration to suppress duplicate Discord error notifications")
-
-	showVersion := flag.Bool("version", false, "Show version and exit")
-
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
 
 	if *showVersion {
 		fmt.Printf("note-tweet-connector version %s\n", version)
 		os.Exit(0)
 	}
 
-	return cfg
+	if err := cfg.applyConfigSources(fs, lookupEnv); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs, nil
 }
 
 func (cfg *Config) validate() error {
-	var missing []string
-	required := map[string]string{
-		"-misskey-hook-secret": cfg.MisskeyHookSecret,
-		"-misskey-host":        cfg.MisskeyHost,
-		"-misskey-token":       cfg.MisskeyToken,
-		"-misskey-media-host":  cfg.MisskeyMediaHost,
+	if !cfg.Note2TweetEnabled && !cfg.Tweet2NoteEnabled {
+		return fmt.Errorf("at least one of -note2tweet-enabled and -tweet2note-enabled must be true")
 	}
-	for name, value := range required {
-		if value == "" {
-			missing = append(missing, name)
+	switch cfg.MisskeySource {
+	case misskeySourceWebhook, misskeySourceStream:
+	default:
+		return fmt.Errorf("-misskey-source must be one of: %s, %s", misskeySourceWebhook, misskeySourceStream)
+	}
+	if cfg.hasAccountList() {
+		if err := cfg.validateAccounts(); err != nil {
+			return err
 		}
+	} else if err := cfg.validateAccountFlags(); err != nil {
+		return err
 	}
-	if len(missing) > 0 {
-		sort.Strings(missing)
-		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	if cfg.DeletionSyncInterval < 0 {
+		return fmt.Errorf("-deletion-sync-interval must be non-negative")
+	}
+	if cfg.DeletionSyncWindow <= 0 {
+		return fmt.Errorf("-deletion-sync-window must be positive")
+	}
+	if cfg.DeletionSyncMaxNotes < 0 {
+		return fmt.Errorf("-deletion-sync-max-notes must be non-negative")
+	}
+	if cfg.WebhookWorkers <= 0 {
+		return fmt.Errorf("-webhook-workers must be positive")
+	}
+	if cfg.WebhookQueueSize < 0 {
+		return fmt.Errorf("-webhook-queue-size must be non-negative")
+	}
+	if cfg.OutboxRetryMin <= 0 {
+		return fmt.Errorf("-outbox-retry-min must be positive")
+	}
+	if cfg.OutboxRetryMax < cfg.OutboxRetryMin {
+		return fmt.Errorf("-outbox-retry-max must be greater than or equal to -outbox-retry-min")
+	}
+	if cfg.OutboxMaxAttempts < 0 {
+		return fmt.Errorf("-outbox-max-attempts must be non-negative")
 	}
-	if cfg.TwitterOAuth2ClientID == "" {
-		return fmt.Errorf("missing required flags: -twitter-oauth2-client-id")
+	if cfg.MisskeyDriveMaxFileMB <= 0 {
+		return fmt.Errorf("-misskey-drive-max-file-mb must be positive")
 	}
-	if cfg.TwitterOAuth2RedirectURL == "" {
-		return fmt.Errorf("missing required flags: -twitter-oauth2-redirect-url")
+	if cfg.MisskeyStreamKeepAlive <= 0 {
+		return fmt.Errorf("-misskey-stream-keep-alive-timeout must be positive")
 	}
-	if cfg.TwitterBearerToken == "" {
-		return fmt.Errorf("missing required flags: -twitter-bearer-token")
+	if cfg.MisskeyStreamReconnectMin <= 0 {
+		return fmt.Errorf("-misskey-stream-reconnect-min must be positive")
 	}
-	if cfg.TwitterUsername == "" {
-		return fmt.Errorf("missing required flags: -twitter-username")
+	if cfg.MisskeyStreamReconnectMax < cfg.MisskeyStreamReconnectMin {
+		return fmt.Errorf("-misskey-stream-reconnect-max must be greater than or equal to -misskey-stream-reconnect-min")
+	}
+	switch cfg.TwitterSource {
+	case twitterSourceStream, twitterSourceTimeline:
+	default:
+		return fmt.Errorf("-twitter-source must be one of: %s, %s", twitterSourceStream, twitterSourceTimeline)
+	}
+	if cfg.TwitterTimelinePoll <= 0 {
+		return fmt.Errorf("-twitter-timeline-poll-interval must be positive")
 	}
 	if cfg.TwitterStreamKeepAlive <= 0 {
 		return fmt.Errorf("-twitter-stream-keep-alive-timeout must be positive")
@@ -139,6 +271,20 @@ func (cfg *Config) validate() error {
 	if cfg.TwitterStreamReconnectMax < cfg.TwitterStreamReconnectMin {
 		return fmt.Errorf("-twitter-stream-reconnect-max must be greater than or equal to -twitter-stream-reconnect-min")
 	}
+	if !slices.Contains(handler.LongNotePolicies(), cfg.TwitterLongNotePolicy) {
+		return fmt.Errorf("-twitter-long-note-policy must be one of: %s", strings.Join(handler.LongNotePolicies(), ", "))
+	}
+	if !slices.Contains(handler.CWPolicies(), cfg.TwitterCWPolicy) {
+		return fmt.Errorf("-twitter-cw-policy must be one of: %s", strings.Join(handler.CWPolicies(), ", "))
+	}
+	if cfg.TwitterCWMediaPolicy != "" && !slices.Contains(handler.CWPolicies(), cfg.TwitterCWMediaPolicy) {
+		return fmt.Errorf("-twitter-cw-media-policy must be one of: %s", strings.Join(handler.CWPolicies(), ", "))
+	}
+	switch cfg.TwitterCustomEmoji {
+	case mfm.CustomEmojiText, mfm.CustomEmojiDrop:
+	default:
+		return fmt.Errorf("-twitter-custom-emoji must be one of: text, drop")
+	}
 	if cfg.DiscordNotifyTimeout <= 0 {
 		return fmt.Errorf("-discord-notify-timeout must be positive")
 	}
@@ -151,62 +297,190 @@ func (cfg *Config) validate() error {
 	if cfg.DiscordErrorDedupeWindow < 0 {
 		return fmt.Errorf("-discord-error-dedupe-window must be non-negative")
 	}
+	if cfg.DiscordRateLimitThreshold < 0 {
+		return fmt.Errorf("-discord-rate-limit-threshold must be non-negative")
+	}
 	return nil
 }
 
-func (cfg *Config) handlerConfig(bearerTokenSource twitter.BearerTokenSource, notifier notify.Notifier) handler.Config {
+// validateAccountFlags checks the flags that describe the single account pair
+// used without -accounts-file.
+func (cfg *Config) validateAccountFlags() error {
+	var missing []string
+	for name, value := range cfg.requiredAccountSettings(cfg.accounts()[0]) {
+		if value == "" {
+			missing = append(missing, "-"+strings.ReplaceAll(name, "_", "-"))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// directions returns the enabled cross-post directions.
+func (cfg *Config) directions() metrics.Directions {
+	return metrics.Directions{
+		Note2Tweet: cfg.Note2TweetEnabled,
+		Tweet2Note: cfg.Tweet2NoteEnabled,
+	}
+}
+
+func (cfg *Config) handlerConfig(account AccountConfig, bearerTokenSource twitter.BearerTokenSource, notifier notify.Notifier) handler.Config {
 	return handler.Config{
-		MisskeyHost:              cfg.MisskeyHost,
-		MisskeyToken:             cfg.MisskeyToken,
-		TwitterUsername:          cfg.TwitterUsername,
+		MisskeyHost:              account.MisskeyHost,
+		MisskeyToken:             account.MisskeyToken,
+		TwitterUsername:          account.TwitterUsername,
 		TwitterMediaAllowedHosts: misskey.ParseAllowedHosts(cfg.TwitterMediaHosts),
+		MisskeyDriveMaxFileBytes: int64(cfg.MisskeyDriveMaxFileMB) * 1024 * 1024,
+		LongNotePolicy:           cfg.TwitterLongNotePolicy,
+		CWPolicy:                 cfg.TwitterCWPolicy,
+		CWMediaPolicy:            cfg.TwitterCWMediaPolicy,
+		CustomEmoji:              cfg.TwitterCustomEmoji,
+		Note2TweetFilter:         cfg.filterRules.Note2Tweet,
+		Tweet2NoteFilter:         cfg.filterRules.Tweet2Note,
 		Twitter: twitter.Config{
-			OAuth2ClientID:    cfg.TwitterOAuth2ClientID,
-			OAuth2RedirectURL: cfg.TwitterOAuth2RedirectURL,
-			TokenStorePath:    cfg.TwitterTokenStorePath,
+			OAuth2ClientID:    account.TwitterOAuth2ClientID,
+			OAuth2RedirectURL: account.TwitterOAuth2RedirectURL,
+			TokenStorePath:    account.TwitterTokenStorePath,
 			BearerTokenSource: bearerTokenSource,
-			MisskeyMediaHost:  cfg.MisskeyMediaHost,
+			MisskeyMediaHost:  account.MisskeyMediaHost,
 		},
-		Notifier: notifier,
+		Notifier:   notifier,
+		ClaimLease: cfg.TrackerClaimLease,
 	}
 }
 
-func (cfg *Config) twitterOAuth2Config() twitter.OAuth2Config {
-	return twitter.OAuth2Config{
-		ClientID:       cfg.TwitterOAuth2ClientID,
-		RedirectURL:    cfg.TwitterOAuth2RedirectURL,
-		TokenStorePath: cfg.TwitterTokenStorePath,
-	}
+// logLevel is the level of the default logger. It is changed on reload.
+var logLevel = new(slog.LevelVar)
+
+// newNotifier builds the operator notification chain.
+func (cfg *Config) newNotifier() notify.Notifier {
+	return notify.NewDedupeNotifier(
+		notify.NewDiscordNotifier(cfg.DiscordWebhookURL, cfg.DiscordNotifyTimeout),
+		cfg.DiscordErrorDedupeWindow,
+	)
 }
 
 func setupLogger(level string) {
-	var logLevel slog.Level
+	logLevel.Set(parseLogLevel(level))
+
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: logLevel,
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+func parseLogLevel(level string) slog.Level {
 	switch strings.ToLower(level) {
 	case "debug":
-		logLevel = slog.LevelDebug
+		return slog.LevelDebug
 	case "info":
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo
 	case "warn":
-		logLevel = slog.LevelWarn
+		return slog.LevelWarn
 	case "error":
-		logLevel = slog.LevelError
+		return slog.LevelError
 	default:
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo
 	}
-
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	})
-	slog.SetDefault(slog.New(handler))
 }
 
 type server struct {
+	pairs []*accountPair
+	// webhooks posts the accepted Misskey webhooks.
+	webhooks *webhookPool
+	// metrics records requests that do not belong to a pair.
+	metrics    *metrics.Metrics
+	directions metrics.Directions
+}
+
+// accountPair holds the clients and state of one account pair.
+type accountPair struct {
+	account AccountConfig
+	// cfg is replaced on reload; read it with handlerConfig.
+	cfg              atomic.Pointer[handler.Config]
 	crossPostTracker tracker.CrossPostTracker
-	metrics          *metrics.Metrics
-	cfg              handler.Config
-	misskeySecret    string
-	twitterOAuth2    *twitter.OAuth2LoginManager
-	notifier         notify.Notifier
+	// outbox records the cross-posts of the pair and retries failed ones.
+	outbox        *outbox.Queue
+	metrics       *metrics.Metrics
+	notifier      notify.Notifier
+	twitterOAuth2 *twitter.OAuth2LoginManager
+}
+
+func newAccountPair(ctx context.Context, cfg *Config, account AccountConfig, rootTracker *tracker.SQLiteCrossPostTracker, m *metrics.Metrics, notifier notify.Notifier) (*accountPair, error) {
+	pairNotifier := notify.NewPairNotifier(notifier, account.Name)
+	pairTracker := rootTracker.WithNamespace(account.namespace())
+	pair := &accountPair{
+		account:          account,
+		crossPostTracker: pairTracker,
+		metrics:          m.ForPair(account.Name),
+		notifier:         pairNotifier,
+	}
+	pair.outbox = cfg.newOutbox(pair, pairTracker)
+
+	// The OAuth 2.0 user token is only used to post and delete tweets.
+	var bearerTokenSource twitter.BearerTokenSource
+	var budget *twitter.Budget
+	if cfg.Note2TweetEnabled {
+		oauth2Cfg := account.twitterOAuth2Config()
+		tokenManager, err := twitter.NewTokenManager(oauth2Cfg)
+		if err != nil {
+			return nil, fmt.Errorf("initialize Twitter OAuth 2.0 token source: %w", err)
+		}
+		oauth2Login, err := twitter.NewOAuth2LoginManager(tokenManager, oauth2Cfg)
+		if err != nil {
+			return nil, fmt.Errorf("initialize Twitter OAuth 2.0 login manager: %w", err)
+		}
+		if tokenManager.AuthorizationRequired() {
+			notifyTwitterOAuth2AuthorizationRequired(ctx, oauth2Login, pairNotifier)
+		}
+		pair.twitterOAuth2 = oauth2Login
+		budget = cfg.newTwitterBudget(ctx, pair, pairTracker)
+		bearerTokenSource = &authorizationLoggingTokenSource{
+			source:   tokenManager,
+			login:    oauth2Login,
+			notifier: pairNotifier,
+		}
+	}
+
+	handlerCfg := cfg.handlerConfig(account, bearerTokenSource, pairNotifier)
+	handlerCfg.Twitter.Budget = budget
+	pair.cfg.Store(&handlerCfg)
+	return pair, nil
+}
+
+// handlerConfig returns the current handler configuration of the pair.
+func (p *accountPair) handlerConfig() handler.Config {
+	return *p.cfg.Load()
+}
+
+// pairByName returns the pair with the given name. An empty name selects the
+// default pair, or the only pair.
+func (s *server) pairByName(name string) *accountPair {
+	for _, pair := range s.pairs {
+		if pair.account.Name == name || (name == "" && pair.account.namespace() == "") {
+			return pair
+		}
+	}
+	if name == "" && len(s.pairs) == 1 {
+		return s.pairs[0]
+	}
+	return nil
+}
+
+// pairForMisskeySecret returns the pair whose webhook secret matches.
+func (s *server) pairForMisskeySecret(secret string) *accountPair {
+	if secret == "" {
+		return nil
+	}
+	for _, pair := range s.pairs {
+		if pair.account.MisskeyHookSecret == secret {
+			return pair
+		}
+	}
+	return nil
 }
 
 type authorizationLoggingTokenSource struct {
@@ -240,9 +514,8 @@ func (s *server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 	userAgent := r.Header.Get("User-Agent")
 	if strings.Contains(userAgent, "Misskey-Hooks") {
 		start := time.Now()
-		secret := r.Header.Get("X-Misskey-Hook-Secret")
-		expectedSecret := s.misskeySecret
-		if expectedSecret == "" || secret != expectedSecret {
+		pair := s.pairForMisskeySecret(r.Header.Get("X-Misskey-Hook-Secret"))
+		if pair == nil {
 			http.Error(w, "Invalid Misskey secret", http.StatusUnauthorized)
 			slog.Error("Invalid Misskey secret")
 			s.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "unauthorized").Inc()
@@ -253,22 +526,32 @@ func (s *server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-			slog.Error("Failed to read request body", slog.Any("error", err))
-			s.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "error").Inc()
-			s.metrics.WebhookRequestErrors.WithLabelValues("misskey", "read_body").Inc()
+			slog.Error("Failed to read request body", slog.String("pair", pair.account.Name), slog.Any("error", err))
+			pair.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "error").Inc()
+			pair.metrics.WebhookRequestErrors.WithLabelValues("misskey", "read_body").Inc()
 			return
 		}
 
-		err = handler.Note2TweetHandlerWithConfig(r.Context(), s.cfg, body, s.crossPostTracker, s.metrics)
+		if !s.webhooks.reserve() {
+			http.Error(w, "Too many webhooks in progress", http.StatusTooManyRequests)
+			slog.Warn("Webhook worker pool is saturated", slog.String("pair", pair.account.Name))
+			pair.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "saturated").Inc()
+			pair.metrics.WebhookRequestErrors.WithLabelValues("misskey", "saturated").Inc()
+			return
+		}
+		job, err := pair.outbox.Enqueue(r.Context(), jobNote2Tweet, body)
 		if err != nil {
+			s.webhooks.release()
 			http.Error(w, "Failed to handle request", http.StatusInternalServerError)
-			slog.Error("Failed to handle request", slog.Any("error", err))
-			s.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "error").Inc()
+			slog.Error("Failed to record webhook", slog.String("pair", pair.account.Name), slog.Any("error", err))
+			pair.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "error").Inc()
+			pair.metrics.WebhookRequestErrors.WithLabelValues("misskey", "enqueue").Inc()
 			return
 		}
+		s.webhooks.submit(webhookJob{pair: pair, job: job})
 
-		s.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "success").Inc()
-		s.metrics.WebhookRequestDuration.WithLabelValues("misskey").Observe(time.Since(start).Seconds())
+		pair.metrics.WebhookRequestsTotal.WithLabelValues("misskey", "success").Inc()
+		pair.metrics.WebhookRequestDuration.WithLabelValues("misskey").Observe(time.Since(start).Seconds())
 
 	} else {
 		http.Error(w, "Unsupported User-Agent", http.StatusBadRequest)
@@ -278,7 +561,7 @@ func (s *server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusAccepted)
 }
 
 func (s *server) twitterLoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -286,12 +569,17 @@ func (s *server) twitterLoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
-	if s.twitterOAuth2 == nil {
+	pair := s.pairByName(r.PathValue("pair"))
+	if pair == nil {
+		http.Error(w, "Unknown account pair", http.StatusNotFound)
+		return
+	}
+	if pair.twitterOAuth2 == nil {
 		http.Error(w, "Twitter OAuth 2.0 login is not configured", http.StatusInternalServerError)
 		return
 	}
 
-	authorizeURL, err := s.twitterOAuth2.BeginLogin(r.URL.Query().Get("auth"))
+	authorizeURL, err := pair.twitterOAuth2.BeginLogin(r.URL.Query().Get("auth"))
 	if err != nil {
 		if errors.Is(err, twitter.ErrInvalidLoginAuth) {
 			http.Error(w, "Invalid or expired login auth token", http.StatusForbidden)
@@ -310,40 +598,46 @@ func (s *server) twitterCallbackHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
-	if s.twitterOAuth2 == nil {
+	state := r.URL.Query().Get("state")
+	pair := s.pairForOAuth2State(r.PathValue("pair"), state)
+	if pair == nil {
+		http.Error(w, "Invalid or expired state; restart Twitter OAuth 2.0 login", http.StatusBadRequest)
+		return
+	}
+	if pair.twitterOAuth2 == nil {
 		http.Error(w, "Twitter OAuth 2.0 login is not configured", http.StatusInternalServerError)
 		return
 	}
 
 	if oauthErr := r.URL.Query().Get("error"); oauthErr != "" {
-		s.twitterOAuth2.CancelLogin(r.URL.Query().Get("state"))
+		pair.twitterOAuth2.CancelLogin(state)
 		http.Error(w, "Twitter OAuth 2.0 authorization failed: "+oauthErr, http.StatusBadRequest)
 		slog.Warn("Twitter OAuth 2.0 authorization failed",
+			slog.String("pair", pair.account.Name),
 			slog.String("error", oauthErr),
 			slog.String("error_description", r.URL.Query().Get("error_description")))
-		notifyTwitterOAuth2AuthorizationRequired(r.Context(), s.twitterOAuth2, s.notifier)
+		notifyTwitterOAuth2AuthorizationRequired(r.Context(), pair.twitterOAuth2, pair.notifier)
 		return
 	}
 
 	code := r.URL.Query().Get("code")
-	state := r.URL.Query().Get("state")
 	if code == "" || state == "" {
 		http.Error(w, "Missing code or state", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.twitterOAuth2.CompleteLogin(r.Context(), state, code); err != nil {
+	if err := pair.twitterOAuth2.CompleteLogin(r.Context(), state, code); err != nil {
 		if errors.Is(err, twitter.ErrInvalidOAuth2State) {
 			http.Error(w, "Invalid or expired state; restart Twitter OAuth 2.0 login", http.StatusBadRequest)
-			notifyTwitterOAuth2AuthorizationRequired(r.Context(), s.twitterOAuth2, s.notifier)
+			notifyTwitterOAuth2AuthorizationRequired(r.Context(), pair.twitterOAuth2, pair.notifier)
 			return
 		}
 		http.Error(w, "Failed to complete Twitter OAuth 2.0 login", http.StatusBadGateway)
-		slog.Error("Failed to complete Twitter OAuth 2.0 login", slog.Any("error", err))
-		notifyTwitterOAuth2AuthorizationRequired(r.Context(), s.twitterOAuth2, s.notifier)
+		slog.Error("Failed to complete Twitter OAuth 2.0 login", slog.String("pair", pair.account.Name), slog.Any("error", err))
+		notifyTwitterOAuth2AuthorizationRequired(r.Context(), pair.twitterOAuth2, pair.notifier)
 		return
 	}
-	notifyTwitterOAuth2AuthorizationRecovered(r.Context(), s.notifier)
+	notifyTwitterOAuth2AuthorizationRecovered(r.Context(), pair.notifier)
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	if _, err := w.Write([]byte("Twitter OAuth 2.0 authorization completed. You can close this page.\n")); err != nil {
@@ -351,6 +645,25 @@ func (s *server) twitterCallbackHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// pairForOAuth2State returns the pair that started the login with state. The
+// callback URL can be shared by all pairs, so without a pair in the path the
+// pair is found by its pending login. When only one pair can match, it is
+// returned even for an unknown state so that the expired login is reported.
+func (s *server) pairForOAuth2State(name, state string) *accountPair {
+	if name != "" {
+		return s.pairByName(name)
+	}
+	for _, pair := range s.pairs {
+		if pair.twitterOAuth2 != nil && pair.twitterOAuth2.HasLoginState(state) {
+			return pair
+		}
+	}
+	if len(s.pairs) == 1 {
+		return s.pairs[0]
+	}
+	return nil
+}
+
 func notifyTwitterOAuth2AuthorizationRequired(ctx context.Context, login *twitter.OAuth2LoginManager, notifier notify.Notifier) {
 	if login == nil {
 		return
@@ -400,6 +713,42 @@ func notifyTwitterOAuth2AuthorizationRecovered(ctx context.Context, notifier not
 	}
 }
 
+type statusResponse struct {
+	Version    string           `json:"version"`
+	Directions statusDirections `json:"directions"`
+	Pairs      []string         `json:"pairs"`
+}
+
+type statusDirections struct {
+	Note2Tweet bool `json:"note2tweet"`
+	Tweet2Note bool `json:"tweet2note"`
+}
+
+// statusHandler reports the version, the enabled directions and the account
+// pairs of the process.
+func (s *server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := statusResponse{
+		Version: version,
+		Directions: statusDirections{
+			Note2Tweet: s.directions.Note2Tweet,
+			Tweet2Note: s.directions.Tweet2Note,
+		},
+		Pairs: make([]string, 0, len(s.pairs)),
+	}
+	for _, pair := range s.pairs {
+		status.Pairs = append(status.Pairs, pair.account.Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		slog.Error("Failed to write response", slog.Any("error", err))
+	}
+}
+
 func healthzHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write([]byte("ok\n")); err != nil {
@@ -443,6 +792,51 @@ func updateTrackerEntriesMetric(ctx context.Context, crossPostTracker tracker.Cr
 		return
 	}
 	m.TrackerEntriesTotal.Set(float64(count))
+
+	claims, err := crossPostTracker.ListClaims(ctx)
+	if err != nil {
+		slog.Error("Failed to list cross-post claims", slog.Any("error", err))
+		return
+	}
+	m.TrackerClaims.Set(float64(len(claims)))
+}
+
+// logStaleClaims reports the claims left by an earlier process. Their posts
+// may have been published without being recorded, so they are not posted
+// again until an operator checks the post and releases the claim with the
+// claims command.
+func logStaleClaims(ctx context.Context, pair *accountPair) {
+	claims, err := pair.crossPostTracker.ListClaims(ctx)
+	if err != nil {
+		slog.Error("Failed to list cross-post claims", slog.String("pair", pair.account.Name), slog.Any("error", err))
+		return
+	}
+	for _, claim := range claims {
+		slog.Warn("Stale cross-post claim from an earlier run",
+			slog.String("pair", pair.account.Name),
+			slog.String("direction", claim.Direction),
+			slog.String("source_id", claim.SourceID),
+			slog.Time("claimed_at", claim.ClaimedAt))
+	}
+}
+
+func periodicDeletionSync(ctx context.Context, pair *accountPair, interval, window time.Duration, maxNotes int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := handler.SyncDeletions(ctx, pair.handlerConfig(), pair.crossPostTracker, pair.metrics, time.Now().Add(-window), maxNotes)
+			if resetAt, ok := handler.DeferUntil(err); ok {
+				slog.Info("Deletion sync stopped until the Twitter rate limit resets", slog.String("pair", pair.account.Name), slog.Time("reset_at", resetAt))
+			} else if err != nil {
+				slog.Error("Failed to sync deletions", slog.String("pair", pair.account.Name), slog.Any("error", err))
+			}
+		}
+	}
 }
 
 type streamDisconnectLoopTracker struct {
@@ -466,18 +860,19 @@ func (t *streamDisconnectLoopTracker) record(now time.Time) int {
 	return len(t.events)
 }
 
-func runTwitterStream(ctx context.Context, streamClient *twitter.StreamClient, cfg handler.Config, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics, reconnectMin, reconnectMax time.Duration, notifier notify.Notifier, loopWindow time.Duration, loopThreshold int) {
+func runTwitterStream(ctx context.Context, group *twitterStreamGroup, reconnectMin, reconnectMax time.Duration, loopWindow time.Duration, loopThreshold int) {
+	streamClient := group.client
 	backoff := reconnectMin
 	loopTracker := &streamDisconnectLoopTracker{
 		window:    loopWindow,
 		threshold: loopThreshold,
 	}
-	onConnect := streamClient.OnConnect
 	streamClient.OnConnect = func() {
 		backoff = reconnectMin
-		if onConnect != nil {
-			onConnect()
+		for _, pair := range group.pairs {
+			pair.metrics.TwitterStreamConnects.WithLabelValues("success").Inc()
 		}
+		slog.Info("Connected to Twitter Filtered Stream", slog.Any("pairs", group.pairNames()))
 	}
 
 	for {
@@ -485,15 +880,26 @@ func runTwitterStream(ctx context.Context, streamClient *twitter.StreamClient, c
 			return
 		}
 
-		m.TwitterStreamConnects.WithLabelValues("attempt").Inc()
+		for _, pair := range group.pairs {
+			pair.metrics.TwitterStreamConnects.WithLabelValues("attempt").Inc()
+		}
 		err := streamClient.Consume(ctx, func(ctx context.Context, line []byte) error {
-			m.TwitterStreamLastMessageTime.Set(float64(time.Now().Unix()))
-			if err := handler.Tweet2NoteHandlerWithConfig(ctx, cfg, line, crossPostTracker, m); err != nil {
-				m.TwitterStreamMessages.WithLabelValues("error").Inc()
-				slog.Error("Failed to process Twitter stream message", slog.Any("error", err))
+			for _, pair := range group.pairs {
+				pair.metrics.TwitterStreamLastMessageTime.Set(float64(time.Now().Unix()))
+			}
+			pairs := group.pairsForPayload(line)
+			if len(pairs) == 0 {
+				slog.Debug("Ignoring Twitter stream message without a matching account pair")
 				return nil
 			}
-			m.TwitterStreamMessages.WithLabelValues("success").Inc()
+			for _, pair := range pairs {
+				if err := pair.outbox.Submit(ctx, jobTweet2Note, line); err != nil {
+					pair.metrics.TwitterStreamMessages.WithLabelValues("error").Inc()
+					slog.Error("Failed to process Twitter stream message", slog.String("pair", pair.account.Name), slog.Any("error", err))
+					continue
+				}
+				pair.metrics.TwitterStreamMessages.WithLabelValues("success").Inc()
+			}
 			return nil
 		})
 		if err == nil || errors.Is(err, context.Canceled) || (errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil) {
@@ -501,8 +907,11 @@ func runTwitterStream(ctx context.Context, streamClient *twitter.StreamClient, c
 		}
 
 		reason := twitterStreamDisconnectReason(err)
-		m.TwitterStreamDisconnects.WithLabelValues(reason).Inc()
+		for _, pair := range group.pairs {
+			pair.metrics.TwitterStreamDisconnects.WithLabelValues(reason).Inc()
+		}
 		slog.Warn("Twitter stream disconnected",
+			slog.Any("pairs", group.pairNames()),
 			slog.String("reason", reason),
 			slog.Duration("reconnect_after", backoff),
 			slog.Any("error", err))
@@ -513,7 +922,7 @@ func runTwitterStream(ctx context.Context, streamClient *twitter.StreamClient, c
 		}
 		disconnectCount := loopTracker.record(time.Now())
 		if disconnectCount >= loopThreshold {
-			notifyTwitterStreamDisconnectLoop(ctx, notifier, loopWindow, disconnectCount, reason, err, sleep)
+			notifyTwitterStreamDisconnectLoop(ctx, group.notifier, loopWindow, disconnectCount, reason, err, sleep)
 		}
 		if !sleepContext(ctx, sleep) {
 			return
@@ -527,6 +936,223 @@ func runTwitterStream(ctx context.Context, streamClient *twitter.StreamClient, c
 	}
 }
 
+// submitStreamNote records a note from the Misskey stream and passes it to the
+// worker pool, so that media uploads do not hold up the stream read loop.
+// When the pool is saturated the job is left to the outbox retry loop.
+func submitStreamNote(ctx context.Context, pool *webhookPool, pair *accountPair, note []byte) error {
+	payload, err := handler.StreamNotePayload(pair.handlerConfig(), note)
+	if err != nil {
+		return err
+	}
+	job, err := pair.outbox.Enqueue(ctx, jobNote2Tweet, payload)
+	if err != nil {
+		return err
+	}
+	if !pool.reserve() {
+		slog.Warn("Webhook worker pool is saturated, leaving the stream note to the outbox retry loop", slog.String("pair", pair.account.Name))
+		return nil
+	}
+	pool.submit(webhookJob{pair: pair, job: job})
+	return nil
+}
+
+func runMisskeyStream(ctx context.Context, streamClient *misskey.StreamClient, pool *webhookPool, pair *accountPair, reconnectMin, reconnectMax time.Duration) {
+	m := pair.metrics
+	backoff := reconnectMin
+	onConnect := streamClient.OnConnect
+	streamClient.OnConnect = func() {
+		backoff = reconnectMin
+		if onConnect != nil {
+			onConnect()
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.MisskeyStreamConnects.WithLabelValues("attempt").Inc()
+		err := streamClient.Consume(ctx, func(ctx context.Context, note []byte) error {
+			m.MisskeyStreamLastMessageTime.Set(float64(time.Now().Unix()))
+			if err := submitStreamNote(ctx, pool, pair, note); err != nil {
+				m.MisskeyStreamMessages.WithLabelValues("error").Inc()
+				slog.Error("Failed to process Misskey stream note", slog.String("pair", pair.account.Name), slog.Any("error", err))
+				return nil
+			}
+			m.MisskeyStreamMessages.WithLabelValues("success").Inc()
+			return nil
+		})
+		if err == nil || errors.Is(err, context.Canceled) || (errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil) {
+			return
+		}
+
+		reason := misskeyStreamDisconnectReason(err)
+		m.MisskeyStreamDisconnects.WithLabelValues(reason).Inc()
+		slog.Warn("Misskey stream disconnected",
+			slog.String("pair", pair.account.Name),
+			slog.String("reason", reason),
+			slog.Duration("reconnect_after", backoff),
+			slog.Any("error", err))
+
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		if backoff < reconnectMax {
+			backoff *= 2
+			if backoff > reconnectMax {
+				backoff = reconnectMax
+			}
+		}
+	}
+}
+
+func runTwitterTimeline(ctx context.Context, timelineClient *twitter.TimelineClient, userID string, pair *accountPair, interval time.Duration) {
+	m := pair.metrics
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := interval
+		resetAt, err := pollTwitterTimeline(ctx, timelineClient, userID, pair.outbox, pair.crossPostTracker, m)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			status := "error"
+			var rateLimitErr *twitter.StreamRateLimitError
+			if errors.As(err, &rateLimitErr) {
+				status = "rate_limited"
+			}
+			m.TwitterTimelinePolls.WithLabelValues(status).Inc()
+			delay = twitterStreamReconnectDelay(err, interval)
+			slog.Warn("Failed to poll Twitter user timeline",
+				slog.String("pair", pair.account.Name),
+				slog.Duration("retry_after", delay),
+				slog.Any("error", err))
+		} else {
+			m.TwitterTimelinePolls.WithLabelValues("success").Inc()
+			if wait := time.Until(resetAt); wait > delay {
+				delay = wait
+				slog.Info("Twitter user timeline rate limit exhausted", slog.String("pair", pair.account.Name), slog.Time("reset_at", resetAt))
+			}
+		}
+
+		if !sleepContext(ctx, delay) {
+			return
+		}
+	}
+}
+
+// pollTwitterTimeline submits the tweets posted since the saved cursor to the
+// outbox and returns the rate limit reset time when the window was exhausted.
+// Without a cursor it only records the newest tweet so that old tweets are
+// not forwarded.
+func pollTwitterTimeline(ctx context.Context, timelineClient *twitter.TimelineClient, userID string, queue *outbox.Queue, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics) (time.Time, error) {
+	sinceID, err := crossPostTracker.LoadCursor(ctx, twitterTimelineCursor)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var untilID string
+	if sinceID != "" {
+		if untilID, err = crossPostTracker.LoadCursor(ctx, twitterTimelineUntilCursor); err != nil {
+			return time.Time{}, err
+		}
+	}
+	result, err := timelineClient.UserTweetsBetween(ctx, userID, sinceID, untilID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if sinceID == "" {
+		slog.Info("Starting Twitter user timeline polling from the latest tweet", slog.String("since_id", result.NewestID))
+	} else {
+		for i := len(result.Pages) - 1; i >= 0; i-- {
+			payloads, err := handler.UserTimelinePayloads(result.Pages[i].Body)
+			if err != nil {
+				m.TwitterTimelineTweets.WithLabelValues("error").Inc()
+				slog.Error("Failed to parse Twitter user timeline", slog.Any("error", err))
+				continue
+			}
+			for _, payload := range payloads {
+				if err := queue.Submit(ctx, jobTweet2Note, payload); err != nil {
+					m.TwitterTimelineTweets.WithLabelValues("error").Inc()
+					slog.Error("Failed to process Twitter user timeline tweet", slog.Any("error", err))
+					continue
+				}
+				m.TwitterTimelineTweets.WithLabelValues("success").Inc()
+			}
+		}
+	}
+
+	if err := saveTwitterTimelineCursors(ctx, crossPostTracker, untilID, result); err != nil {
+		return time.Time{}, err
+	}
+	return result.RateLimitResetAt, nil
+}
+
+// saveTwitterTimelineCursors advances since_id only after the oldest page of
+// a poll has been fetched. A poll cut short resumes below its oldest tweet on
+// the next poll instead, so that the tweets in between are not skipped.
+func saveTwitterTimelineCursors(ctx context.Context, crossPostTracker tracker.CrossPostTracker, untilID string, result twitter.TimelineResult) error {
+	newestID := result.NewestID
+	if untilID != "" {
+		pendingID, err := crossPostTracker.LoadCursor(ctx, twitterTimelinePendingCursor)
+		if err != nil {
+			return err
+		}
+		newestID = pendingID
+	}
+
+	if !result.Complete {
+		if result.OldestID == "" {
+			return nil
+		}
+		slog.Info("Twitter user timeline poll stopped before the oldest page; resuming from the oldest fetched tweet",
+			slog.String("until_id", result.OldestID))
+		if untilID == "" {
+			if err := crossPostTracker.SaveCursor(ctx, twitterTimelinePendingCursor, newestID); err != nil {
+				return err
+			}
+		}
+		return crossPostTracker.SaveCursor(ctx, twitterTimelineUntilCursor, result.OldestID)
+	}
+
+	// Clear until_id first: a since_id newer than a leftover until_id would
+	// make every later poll empty.
+	if untilID != "" {
+		if err := crossPostTracker.SaveCursor(ctx, twitterTimelineUntilCursor, ""); err != nil {
+			return err
+		}
+	}
+	if newestID == "" {
+		return nil
+	}
+	return crossPostTracker.SaveCursor(ctx, twitterTimelineCursor, newestID)
+}
+
+func misskeyStreamDisconnectReason(err error) string {
+	if errors.Is(err, misskey.ErrStreamKeepAliveTimeout) {
+		return "keep_alive_timeout"
+	}
+	if errors.Is(err, misskey.ErrWebSocketClosed) {
+		return "closed"
+	}
+	var handshakeErr *misskey.WebSocketHandshakeError
+	if errors.As(err, &handshakeErr) {
+		return fmt.Sprintf("http_%d", handshakeErr.StatusCode)
+	}
+	var apiErr *misskey.APIError
+	if errors.As(err, &apiErr) {
+		return "api_error"
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "eof"
+	}
+	return "error"
+}
+
 func notifyTwitterStreamDisconnectLoop(ctx context.Context, notifier notify.Notifier, window time.Duration, disconnectCount int, reason string, streamErr error, reconnectAfter time.Duration) {
 	if notifier == nil {
 		return
@@ -594,9 +1220,31 @@ func sleepContext(ctx context.Context, d time.Duration) bool {
 }
 
 func main() {
-	cfg := parseFlags()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "filter" {
+		os.Exit(runFilterCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "claims" {
+		os.Exit(runClaimsCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	cfg, fs, err := parseFlags()
+	if err != nil {
+		slog.Error("Invalid configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	setupLogger(cfg.LogLevel)
+	if err := cfg.loadAccounts(); err != nil {
+		slog.Error("Invalid configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if err := cfg.loadFilterRules(); err != nil {
+		slog.Error("Invalid configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
 	if err := cfg.validate(); err != nil {
 		slog.Error("Invalid configuration", slog.Any("error", err))
 		os.Exit(1)
@@ -608,11 +1256,8 @@ func main() {
 	defer cancel()
 
 	// Initialize metrics
-	m := metrics.New(version)
-	notifier := notify.NewDedupeNotifier(
-		notify.NewDiscordNotifier(cfg.DiscordWebhookURL, cfg.DiscordNotifyTimeout),
-		cfg.DiscordErrorDedupeWindow,
-	)
+	m := metrics.New(version, cfg.directions())
+	notifier := notify.NewSwappableNotifier(cfg.newNotifier())
 
 	crossPostTracker, err := tracker.NewSQLiteCrossPostTracker(ctx, cfg.TrackerDBPath, cfg.TrackerRetention)
 	if err != nil {
@@ -624,62 +1269,45 @@ func main() {
 			slog.Error("Failed to close cross-post tracker", slog.Any("error", err))
 		}
 	}()
-	updateTrackerEntriesMetric(ctx, crossPostTracker, m)
-	go periodicTrackerEntriesMetric(ctx, crossPostTracker, m)
 
-	oauth2Cfg := cfg.twitterOAuth2Config()
-	tokenManager, err := twitter.NewTokenManager(oauth2Cfg)
-	if err != nil {
-		slog.Error("Failed to initialize Twitter OAuth 2.0 token source", slog.Any("error", err))
-		os.Exit(1)
-	}
-	oauth2Login, err := twitter.NewOAuth2LoginManager(tokenManager, oauth2Cfg)
-	if err != nil {
-		slog.Error("Failed to initialize Twitter OAuth 2.0 login manager", slog.Any("error", err))
-		os.Exit(1)
-	}
-	if tokenManager.AuthorizationRequired() {
-		notifyTwitterOAuth2AuthorizationRequired(ctx, oauth2Login, notifier)
+	var pairs []*accountPair
+	for _, account := range cfg.accounts() {
+		pair, err := newAccountPair(ctx, cfg, account, crossPostTracker, m, notifier)
+		if err != nil {
+			slog.Error("Failed to initialize account pair", slog.String("pair", account.Name), slog.Any("error", err))
+			os.Exit(1)
+		}
+		pairs = append(pairs, pair)
+		logStaleClaims(ctx, pair)
+		updateTrackerEntriesMetric(ctx, pair.crossPostTracker, pair.metrics)
+		go periodicTrackerEntriesMetric(ctx, pair.crossPostTracker, pair.metrics)
+		go pair.outbox.Run(ctx, cfg.OutboxRetryMin)
 	}
-	handlerCfg := cfg.handlerConfig(&authorizationLoggingTokenSource{
-		source:   tokenManager,
-		login:    oauth2Login,
-		notifier: notifier,
-	}, notifier)
-	streamClient := twitter.NewStreamClient(twitter.StaticBearerTokenSource{Token: cfg.TwitterBearerToken})
-	streamClient.KeepAliveTimeout = cfg.TwitterStreamKeepAlive
-	streamClient.OnConnect = func() {
-		m.TwitterStreamConnects.WithLabelValues("success").Inc()
-		slog.Info("Connected to Twitter Filtered Stream")
-	}
-	streamRule := twitter.DefaultStreamRule(cfg.TwitterUsername)
-	streamRuleTag := twitter.DefaultStreamRuleTag()
-	m.TwitterStreamRuleUpdates.WithLabelValues("ensure", "attempt").Inc()
-	if err := streamClient.EnsureRule(ctx, streamRule, streamRuleTag); err != nil {
-		m.TwitterStreamRuleUpdates.WithLabelValues("ensure", "error").Inc()
-		slog.Error("Failed to ensure Twitter stream rule", slog.Any("error", err))
+
+	workers := newTwitterWorkers(ctx, cfg, notifier)
+	if err := workers.prepare(ctx, pairs, cfg.accounts()); err != nil {
+		slog.Error("Failed to set up Twitter workers", slog.Any("error", err))
 		os.Exit(1)
 	}
-	m.TwitterStreamRuleUpdates.WithLabelValues("ensure", "success").Inc()
-	slog.Info("Ensured Twitter stream rule",
-		slog.String("rule", streamRule),
-		slog.String("tag", streamRuleTag))
 
 	s := &server{
-		crossPostTracker: crossPostTracker,
-		metrics:          m,
-		cfg:              handlerCfg,
-		misskeySecret:    cfg.MisskeyHookSecret,
-		twitterOAuth2:    oauth2Login,
-		notifier:         notifier,
+		pairs:      pairs,
+		webhooks:   newWebhookPool(cfg.WebhookWorkers, cfg.WebhookQueueSize),
+		metrics:    m,
+		directions: cfg.directions(),
 	}
 
 	// Main server
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.webhookHandler)
-	mux.HandleFunc("/twitter/login", s.twitterLoginHandler)
-	mux.HandleFunc("/twitter/callback", s.twitterCallbackHandler)
+	if cfg.Note2TweetEnabled {
+		mux.HandleFunc("/", s.webhookHandler)
+		mux.HandleFunc("/twitter/login", s.twitterLoginHandler)
+		mux.HandleFunc("/twitter/login/{pair}", s.twitterLoginHandler)
+		mux.HandleFunc("/twitter/callback", s.twitterCallbackHandler)
+		mux.HandleFunc("/twitter/callback/{pair}", s.twitterCallbackHandler)
+	}
 	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/status", s.statusHandler)
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -709,14 +1337,52 @@ func main() {
 		}
 	}()
 
-	// Start Twitter stream worker
+	// Start Twitter stream or timeline workers
+	workers.start()
+
+	for _, pair := range pairs {
+		// Start Misskey stream worker
+		if cfg.Note2TweetEnabled && cfg.MisskeySource == misskeySourceStream {
+			misskeyStreamClient := misskey.NewStreamClient(pair.account.MisskeyHost, pair.account.MisskeyToken)
+			misskeyStreamClient.KeepAliveTimeout = cfg.MisskeyStreamKeepAlive
+			misskeyStreamClient.OnConnect = func() {
+				pair.metrics.MisskeyStreamConnects.WithLabelValues("success").Inc()
+				slog.Info("Connected to Misskey streaming API", slog.String("pair", pair.account.Name))
+			}
+			go func() {
+				slog.Info("Starting Misskey stream worker", slog.String("pair", pair.account.Name))
+				runMisskeyStream(ctx, misskeyStreamClient, s.webhooks, pair, cfg.MisskeyStreamReconnectMin, cfg.MisskeyStreamReconnectMax)
+			}()
+		}
+
+		// Start deletion sync worker. Looking up and deleting tweets needs the
+		// OAuth 2.0 user token, which is only set up for note-to-tweet.
+		if cfg.Note2TweetEnabled && cfg.DeletionSyncInterval > 0 {
+			go periodicDeletionSync(ctx, pair, cfg.DeletionSyncInterval, cfg.DeletionSyncWindow, cfg.DeletionSyncMaxNotes)
+		}
+	}
+
+	// Reload configuration on SIGHUP
+	configReloader := newReloader(os.Args[1:], os.LookupEnv, fs, cfg, pairs, notifier, workers, m)
 	go func() {
-		slog.Info("Starting Twitter Filtered Stream worker")
-		runTwitterStream(ctx, streamClient, handlerCfg, crossPostTracker, m, cfg.TwitterStreamReconnectMin, cfg.TwitterStreamReconnectMax, notifier, cfg.DiscordStreamLoopWindow, cfg.DiscordStreamLoopThreshold)
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				if err := configReloader.reload(ctx); err != nil {
+					slog.Error("Failed to reload configuration", slog.Any("error", err))
+				}
+			}
+		}
 	}()
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
@@ -730,6 +1396,9 @@ func main() {
 		if err := srv.Shutdown(shutdownCtx); err != nil {
 			slog.Error("Server shutdown error", slog.Any("error", err))
 		}
+		if err := s.webhooks.drain(shutdownCtx); err != nil {
+			slog.Error("Webhook jobs did not finish before shutdown; they are retried after the restart", slog.Any("error", err))
+		}
 		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
 			slog.Error("Metrics server shutdown error", slog.Any("error", err))
 		}
@@ -747,6 +1416,7 @@ func main() {
 		slog.Error("ListenAndServe", slog.Any("error", err))
 		os.Exit(1)
 	}
+	<-shutdownDone
 
 	slog.Info("Server stopped gracefully")
 }
@@ -2,12 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
 	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
 	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNotifyTwitterOAuth2AuthorizationRequiredDedupesLoginURL(t *testing.T) {
@@ -137,3 +147,256 @@ func assertMainField(t *testing.T, event notify.Event, name string) {
 	}
 	t.Fatalf("field %q not found in %#v", name, event.Fields)
 }
+
+func validTestConfig() *Config {
+	return &Config{
+		Note2TweetEnabled:          true,
+		Tweet2NoteEnabled:          true,
+		MisskeySource:              misskeySourceWebhook,
+		MisskeyHookSecret:          "secret",
+		MisskeyHost:                "misskey.example",
+		MisskeyToken:               "token",
+		MisskeyMediaHost:           "media.misskey.example",
+		MisskeyDriveMaxFileMB:      30,
+		MisskeyStreamKeepAlive:     90 * time.Second,
+		MisskeyStreamReconnectMin:  5 * time.Second,
+		MisskeyStreamReconnectMax:  5 * time.Minute,
+		TwitterOAuth2ClientID:      "client-id",
+		TwitterOAuth2RedirectURL:   "https://connector.example/twitter/callback",
+		TwitterBearerToken:         "bearer",
+		TwitterSource:              twitterSourceStream,
+		TwitterTimelinePoll:        2 * time.Minute,
+		TwitterUsername:            "alice",
+		TwitterStreamKeepAlive:     90 * time.Second,
+		TwitterStreamReconnectMin:  5 * time.Second,
+		TwitterStreamReconnectMax:  5 * time.Minute,
+		TwitterLongNotePolicy:      "post",
+		TwitterCWPolicy:            "mask",
+		TwitterCustomEmoji:         "text",
+		DeletionSyncWindow:         72 * time.Hour,
+		OutboxRetryMin:             30 * time.Second,
+		OutboxRetryMax:             30 * time.Minute,
+		WebhookWorkers:             4,
+		DiscordNotifyTimeout:       5 * time.Second,
+		DiscordStreamLoopWindow:    10 * time.Minute,
+		DiscordStreamLoopThreshold: 5,
+	}
+}
+
+func TestConfigValidateMisskeySource(t *testing.T) {
+	if err := validTestConfig().validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	cfg := validTestConfig()
+	cfg.MisskeyHookSecret = ""
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() error = nil, want missing hook secret for webhook source")
+	}
+
+	cfg.MisskeySource = misskeySourceStream
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() stream source error = %v", err)
+	}
+
+	cfg.MisskeySource = "polling"
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() error = nil, want unknown source error")
+	}
+}
+
+func TestMisskeyStreamDisconnectReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: misskey.ErrStreamKeepAliveTimeout, want: "keep_alive_timeout"},
+		{err: misskey.ErrWebSocketClosed, want: "closed"},
+		{err: &misskey.WebSocketHandshakeError{StatusCode: 401}, want: "http_401"},
+		{err: &misskey.APIError{Operation: "get current user", StatusCode: 500}, want: "api_error"},
+		{err: errors.New("boom"), want: "error"},
+	}
+	for _, tt := range tests {
+		if got := misskeyStreamDisconnectReason(tt.err); got != tt.want {
+			t.Fatalf("misskeyStreamDisconnectReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidateTwitterSource(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.TwitterSource = twitterSourceTimeline
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() timeline source error = %v", err)
+	}
+
+	cfg.TwitterTimelinePoll = 0
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() error = nil, want non-positive poll interval error")
+	}
+
+	cfg = validTestConfig()
+	cfg.TwitterSource = "webhook"
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() error = nil, want unknown source error")
+	}
+}
+
+func TestPollTwitterTimelineBootstrapsCursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var sinceIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sinceIDs = append(sinceIDs, r.URL.Query().Get("since_id"))
+		if r.URL.Query().Get("since_id") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"id":"30","text":"old tweet"}],"meta":{"newest_id":"30","result_count":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"meta":{"result_count":0}}`))
+	}))
+	defer server.Close()
+
+	timelineClient := twitter.NewTimelineClient(twitter.StaticBearerTokenSource{Token: "bearer"})
+	timelineClient.HTTPClient = server.Client()
+	timelineClient.Endpoint = server.URL
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	m := metrics.NewNoop()
+	pair := newTestOutboxPair(crossPostTracker, m)
+
+	for range 2 {
+		if _, err := pollTwitterTimeline(ctx, timelineClient, "user-1", pair.outbox, crossPostTracker, m); err != nil {
+			t.Fatalf("pollTwitterTimeline() error = %v", err)
+		}
+	}
+
+	if len(sinceIDs) != 2 || sinceIDs[0] != "" || sinceIDs[1] != "30" {
+		t.Fatalf("since_id values = %q, want [\"\" \"30\"]", sinceIDs)
+	}
+	if cursor, err := crossPostTracker.LoadCursor(ctx, twitterTimelineCursor); err != nil || cursor != "30" {
+		t.Fatalf("LoadCursor() = %q, %v; want 30", cursor, err)
+	}
+	if got := testutil.ToFloat64(m.TwitterTimelineTweets.WithLabelValues("success")); got != 0 {
+		t.Fatalf("processed tweets = %v, want bootstrap to skip old tweets", got)
+	}
+}
+
+func TestPollTwitterTimelineResumesBelowOldestFetchedTweet(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reset := time.Now().Add(time.Minute).Unix()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		queries = append(queries, "since_id="+query.Get("since_id")+" until_id="+query.Get("until_id"))
+		switch {
+		case query.Get("until_id") == "20":
+			_, _ = w.Write([]byte(`{"data":[{"id":"15","text":"oldest"}],"meta":{"newest_id":"15","oldest_id":"15","result_count":1}}`))
+		case query.Get("since_id") == "10":
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+			_, _ = w.Write([]byte(`{"data":[{"id":"30","text":"newest"},{"id":"20","text":"middle"}],"meta":{"newest_id":"30","oldest_id":"20","result_count":2,"next_token":"page-2"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"meta":{"result_count":0}}`))
+		}
+	}))
+	defer server.Close()
+
+	timelineClient := twitter.NewTimelineClient(twitter.StaticBearerTokenSource{Token: "bearer"})
+	timelineClient.HTTPClient = server.Client()
+	timelineClient.Endpoint = server.URL
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	if err := crossPostTracker.SaveCursor(ctx, twitterTimelineCursor, "10"); err != nil {
+		t.Fatalf("SaveCursor() error = %v", err)
+	}
+	m := metrics.NewNoop()
+	pair := newTestOutboxPair(crossPostTracker, m)
+
+	resetAt, err := pollTwitterTimeline(ctx, timelineClient, "user-1", pair.outbox, crossPostTracker, m)
+	if err != nil {
+		t.Fatalf("pollTwitterTimeline() error = %v", err)
+	}
+	if resetAt.Unix() != reset {
+		t.Fatalf("resetAt = %v, want the rate limit reset", resetAt)
+	}
+	if cursor, _ := crossPostTracker.LoadCursor(ctx, twitterTimelineCursor); cursor != "10" {
+		t.Fatalf("since_id cursor = %q, want 10 until the oldest page is fetched", cursor)
+	}
+
+	for range 2 {
+		if _, err := pollTwitterTimeline(ctx, timelineClient, "user-1", pair.outbox, crossPostTracker, m); err != nil {
+			t.Fatalf("pollTwitterTimeline() error = %v", err)
+		}
+	}
+	want := []string{"since_id=10 until_id=", "since_id=10 until_id=20", "since_id=30 until_id="}
+	if !reflect.DeepEqual(queries, want) {
+		t.Fatalf("queries = %q, want %q", queries, want)
+	}
+	if got := testutil.ToFloat64(m.TwitterTimelineTweets.WithLabelValues("success")); got != 3 {
+		t.Fatalf("processed tweets = %v, want every tweet newer than the cursor", got)
+	}
+}
+
+func TestConfigValidateDirections(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Tweet2NoteEnabled = false
+	cfg.TwitterBearerToken = ""
+	cfg.TwitterUsername = ""
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() note2tweet only error = %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Note2TweetEnabled = false
+	cfg.MisskeyHookSecret = ""
+	cfg.MisskeyMediaHost = ""
+	cfg.TwitterOAuth2ClientID = ""
+	cfg.TwitterOAuth2RedirectURL = ""
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() tweet2note only error = %v", err)
+	}
+	cfg.TwitterBearerToken = ""
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "-twitter-bearer-token") {
+		t.Fatalf("validate() error = %v, want missing bearer token", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Note2TweetEnabled = false
+	cfg.Tweet2NoteEnabled = false
+	if err := cfg.validate(); err == nil {
+		t.Fatal("validate() error = nil, want an error with both directions disabled")
+	}
+
+	cfg = validTestConfig()
+	cfg.Tweet2NoteEnabled = false
+	cfg.AccountsFile = writeAccountsFile(t, `{"accounts":[{"name":"a","misskey_token":"t","misskey_hook_secret":"s"}]}`)
+	cfg.TwitterBearerToken = ""
+	if err := cfg.loadAccounts(); err != nil {
+		t.Fatalf("loadAccounts() error = %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate() note2tweet only accounts error = %v", err)
+	}
+}
+
+func TestServerStatusHandler(t *testing.T) {
+	s := &server{
+		pairs:      []*accountPair{{account: AccountConfig{Name: metrics.DefaultPair}}},
+		metrics:    metrics.NewNoop(),
+		directions: metrics.Directions{Note2Tweet: true},
+	}
+
+	rec := httptest.NewRecorder()
+	s.statusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !got.Directions.Note2Tweet || got.Directions.Tweet2Note || len(got.Pairs) != 1 || got.Pairs[0] != metrics.DefaultPair {
+		t.Fatalf("status = %+v, want note2tweet only for the default pair", got)
+	}
+}
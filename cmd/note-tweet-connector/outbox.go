@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Soli0222/note-tweet-connector/internal/handler"
+	"github.com/Soli0222/note-tweet-connector/internal/outbox"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+// Outbox job kinds. note2tweet jobs hold a Misskey webhook payload and
+// tweet2note jobs a Filtered Stream payload, so they are processed with the
+// configuration current at each attempt.
+const (
+	jobNote2Tweet = "note2tweet"
+	jobTweet2Note = "tweet2note"
+)
+
+// newOutbox creates the outbox of a pair, which stores its jobs in store.
+func (cfg *Config) newOutbox(pair *accountPair, store tracker.Outbox) *outbox.Queue {
+	queue := outbox.New(pair.account.Name, store, pair.metrics)
+	queue.RetryMin = cfg.OutboxRetryMin
+	queue.RetryMax = cfg.OutboxRetryMax
+	queue.MaxAttempts = cfg.OutboxMaxAttempts
+	queue.IsPermanent = handler.IsPermanent
+	queue.DeferUntil = handler.DeferUntil
+	queue.Handle(jobNote2Tweet, func(ctx context.Context, payload []byte) error {
+		return handler.Note2TweetHandlerWithConfig(ctx, pair.handlerConfig(), payload, pair.crossPostTracker, pair.metrics)
+	})
+	queue.Handle(jobTweet2Note, func(ctx context.Context, payload []byte) error {
+		return handler.Tweet2NoteHandlerWithConfig(ctx, pair.handlerConfig(), payload, pair.crossPostTracker, pair.metrics)
+	})
+	return queue
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/handler"
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestOutboxPair returns a pair without Misskey or Twitter credentials, so
+// that every cross-post fails.
+func newTestOutboxPair(crossPostTracker *tracker.MemoryCrossPostTracker, m *metrics.Metrics) *accountPair {
+	pair := &accountPair{
+		account:          AccountConfig{Name: metrics.DefaultPair, MisskeyHookSecret: "secret"},
+		crossPostTracker: crossPostTracker,
+		metrics:          m,
+	}
+	pair.cfg.Store(&handler.Config{})
+	pair.outbox = validTestConfig().newOutbox(pair, crossPostTracker)
+	return pair
+}
+
+func TestPollTwitterTimelineQueuesFailedTweets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"id":"31","text":"second"},{"id":"30","text":"first"}],"meta":{"newest_id":"31","result_count":2}}`))
+	}))
+	defer server.Close()
+
+	timelineClient := twitter.NewTimelineClient(twitter.StaticBearerTokenSource{Token: "bearer"})
+	timelineClient.HTTPClient = server.Client()
+	timelineClient.Endpoint = server.URL
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	if err := crossPostTracker.SaveCursor(ctx, twitterTimelineCursor, "29"); err != nil {
+		t.Fatalf("SaveCursor() error = %v", err)
+	}
+	m := metrics.NewNoop()
+	pair := newTestOutboxPair(crossPostTracker, m)
+
+	if _, err := pollTwitterTimeline(ctx, timelineClient, "user-1", pair.outbox, crossPostTracker, m); err != nil {
+		t.Fatalf("pollTwitterTimeline() error = %v", err)
+	}
+	jobs, err := crossPostTracker.DueJobs(ctx, time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Kind != jobTweet2Note || !strings.Contains(string(jobs[0].Payload), `"id":"30"`) || !strings.Contains(string(jobs[1].Payload), `"id":"31"`) {
+		t.Fatalf("jobs = %+v, want both tweets queued oldest first", jobs)
+	}
+	if got := testutil.ToFloat64(m.TwitterTimelineTweets.WithLabelValues("success")); got != 2 {
+		t.Fatalf("processed tweets = %v, want 2 queued tweets", got)
+	}
+}
+
+func TestOutboxContinuesIncompleteThread(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type postedTweet struct {
+		Text  string `json:"text"`
+		Reply struct {
+			InReplyToTweetID string `json:"in_reply_to_tweet_id"`
+		} `json:"reply"`
+	}
+	var posted []postedTweet
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tweet postedTweet
+		if err := json.NewDecoder(r.Body).Decode(&tweet); err != nil {
+			t.Errorf("decode tweet: %v", err)
+		}
+		if len(posted) == 1 && !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		posted = append(posted, tweet)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"data":{"id":"tweet-%d"}}`, len(posted))
+	}))
+	defer server.Close()
+
+	oldEndpoint := twitter.ManageTweetEndpoint
+	twitter.ManageTweetEndpoint = server.URL
+	defer func() { twitter.ManageTweetEndpoint = oldEndpoint }()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	pair := newTestOutboxPair(crossPostTracker, metrics.NewNoop())
+	pair.cfg.Store(&handler.Config{
+		LongNotePolicy: handler.LongNotePolicyThread,
+		Twitter:        twitter.Config{BearerTokenSource: twitter.StaticBearerTokenSource{Token: "access-token"}},
+	})
+
+	text := strings.Repeat("word ", 150)
+	payload, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{"id": "note-1", "visibility": "public", "text": text},
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	if err := pair.outbox.Submit(ctx, jobNote2Tweet, payload); err != nil {
+		t.Fatalf("Submit() error = %v, want the failed part to be retried", err)
+	}
+	if len(posted) != 1 {
+		t.Fatalf("posted = %d tweets, want the thread to stop after part 1", len(posted))
+	}
+
+	jobs, err := crossPostTracker.DueJobs(ctx, time.Now().Add(time.Hour), 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("DueJobs() = %+v, %v; want the job to be retried", jobs, err)
+	}
+	if err := pair.outbox.Attempt(ctx, jobs[0]); err != nil {
+		t.Fatalf("Attempt() error = %v", err)
+	}
+
+	if len(posted) != 3 {
+		t.Fatalf("posted = %+v, want all three parts", posted)
+	}
+	for i, tweet := range posted[1:] {
+		if want := fmt.Sprintf("tweet-%d", i+1); tweet.Reply.InReplyToTweetID != want {
+			t.Fatalf("part %d replies to %q, want %q", i+2, tweet.Reply.InReplyToTweetID, want)
+		}
+	}
+	record, ok, err := crossPostTracker.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok || record.Incomplete || len(record.ThreadTweetIDs) != 2 {
+		t.Fatalf("FindByMisskeyNoteID() = %+v, %v, %v; want the complete thread", record, ok, err)
+	}
+	if stats, err := crossPostTracker.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Fatalf("JobStats() = %+v, %v; want the job to finish", stats, err)
+	}
+}
+
+func TestServerWebhookRejectsPermanentFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	m := metrics.NewNoop()
+	pair := newTestOutboxPair(crossPostTracker, m)
+	s := &server{pairs: []*accountPair{pair}, webhooks: newWebhookPool(1, 0), metrics: m}
+	defer func() { _ = s.webhooks.drain(ctx) }()
+
+	rec := httptest.NewRecorder()
+	s.webhookHandler(rec, newTestWebhookRequest())
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	// The pool posts the webhook after the response, so wait for its worker
+	// instead of draining the pool.
+	deadline := time.Now().Add(5 * time.Second)
+	var stats tracker.JobStats
+	for {
+		var err error
+		if stats, err = crossPostTracker.JobStats(ctx); err != nil {
+			t.Fatalf("JobStats() error = %v", err)
+		}
+		if stats.Failed != 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Pending != 0 || stats.Failed != 1 {
+		t.Fatalf("JobStats() = %+v, want the malformed payload to fail without retries", stats)
+	}
+	if got := testutil.ToFloat64(m.OutboxJobAttempts.WithLabelValues(jobNote2Tweet, "failed")); got != 1 {
+		t.Fatalf("failed attempts = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.OutboxJobAttempts.WithLabelValues(jobNote2Tweet, "retry")); got != 0 {
+		t.Fatalf("retried attempts = %v, want 0", got)
+	}
+}
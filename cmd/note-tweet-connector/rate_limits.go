@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+// twitterRateLimits receives the Twitter rate limits of a pair. It saves them
+// so that a restart keeps waiting for an exhausted limit, exports them as
+// metrics and warns once per window when a limit runs low.
+type twitterRateLimits struct {
+	store     tracker.RateLimitStore
+	metrics   *metrics.Metrics
+	notifier  notify.Notifier
+	threshold int
+
+	mu sync.Mutex
+	// warned holds the reset time of the window last warned about per
+	// endpoint and window.
+	warned map[[2]string]time.Time
+}
+
+// newTwitterBudget creates the rate limit budget of a pair and restores the
+// limits saved in store.
+func (cfg *Config) newTwitterBudget(ctx context.Context, pair *accountPair, store tracker.RateLimitStore) *twitter.Budget {
+	limits := &twitterRateLimits{
+		store:     store,
+		metrics:   pair.metrics,
+		notifier:  pair.notifier,
+		threshold: cfg.DiscordRateLimitThreshold,
+		warned:    make(map[[2]string]time.Time),
+	}
+	budget := twitter.NewBudget(limits.update)
+
+	saved, err := store.LoadRateLimits(ctx, time.Now())
+	if err != nil {
+		slog.Warn("Failed to load saved Twitter rate limits",
+			slog.String("pair", pair.account.Name),
+			slog.Any("error", err))
+		return budget
+	}
+	restored := make([]twitter.RateLimit, 0, len(saved))
+	for _, limit := range saved {
+		restored = append(restored, twitter.RateLimit{
+			Endpoint:  limit.Endpoint,
+			Window:    limit.Window,
+			Limit:     limit.Limit,
+			Remaining: limit.Remaining,
+			Reset:     limit.ResetAt,
+		})
+	}
+	budget.Restore(restored)
+	for _, limit := range budget.Limits() {
+		limits.setMetrics(limit)
+	}
+	return budget
+}
+
+func (l *twitterRateLimits) update(limit twitter.RateLimit) {
+	l.setMetrics(limit)
+
+	ctx := context.Background()
+	if err := l.store.SaveRateLimit(ctx, tracker.RateLimit{
+		Endpoint:  limit.Endpoint,
+		Window:    limit.Window,
+		Limit:     limit.Limit,
+		Remaining: limit.Remaining,
+		ResetAt:   limit.Reset,
+	}); err != nil {
+		slog.Error("Failed to save Twitter rate limit",
+			slog.String("endpoint", limit.Endpoint),
+			slog.String("window", limit.Window),
+			slog.Any("error", err))
+	}
+
+	if l.threshold <= 0 || limit.Remaining > l.threshold || !l.markWarned(limit) {
+		return
+	}
+	slog.Warn("Twitter rate limit is running low",
+		slog.String("endpoint", limit.Endpoint),
+		slog.String("window", limit.Window),
+		slog.Int("remaining", limit.Remaining),
+		slog.Time("reset_at", limit.Reset))
+	notifyTwitterRateLimitLow(ctx, l.notifier, limit)
+}
+
+func (l *twitterRateLimits) setMetrics(limit twitter.RateLimit) {
+	l.metrics.TwitterRateLimitLimit.WithLabelValues(limit.Endpoint, limit.Window).Set(float64(limit.Limit))
+	l.metrics.TwitterRateLimitRemaining.WithLabelValues(limit.Endpoint, limit.Window).Set(float64(limit.Remaining))
+	l.metrics.TwitterRateLimitReset.WithLabelValues(limit.Endpoint, limit.Window).Set(float64(limit.Reset.Unix()))
+}
+
+// markWarned reports whether the window of limit was not warned about yet
+// and records it.
+func (l *twitterRateLimits) markWarned(limit twitter.RateLimit) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := [2]string{limit.Endpoint, limit.Window}
+	if last, ok := l.warned[key]; ok && last.Equal(limit.Reset) {
+		return false
+	}
+	l.warned[key] = limit.Reset
+	return true
+}
+
+func notifyTwitterRateLimitLow(ctx context.Context, notifier notify.Notifier, limit twitter.RateLimit) {
+	if notifier == nil {
+		return
+	}
+	if err := notifier.Notify(ctx, notify.Event{
+		Kind:     notify.EventTwitterRateLimitLow,
+		Severity: notify.SeverityWarning,
+		Title:    "Twitter のレート制限の残りが少なくなっています",
+		Message:  "残りを使い切ると、リセットされるまで Twitter への投稿は延期されます。",
+		Fields: []notify.Field{
+			{Name: "endpoint", Value: limit.Endpoint},
+			{Name: "window", Value: limit.Window},
+			{Name: "remaining", Value: fmt.Sprintf("%d / %d", limit.Remaining, limit.Limit)},
+			{Name: "reset_at", Value: limit.Reset.Format(time.RFC3339)},
+		},
+	}); err != nil {
+		slog.Warn("Failed to send Discord notification", slog.Any("error", err), slog.String("kind", string(notify.EventTwitterRateLimitLow)))
+	}
+}
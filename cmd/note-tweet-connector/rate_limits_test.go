@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTwitterRateLimitsUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := tracker.NewCrossPostTracker(ctx, time.Hour)
+	recorder := &mainRecordingNotifier{}
+	limits := &twitterRateLimits{
+		store:     store,
+		metrics:   metrics.NewNoop(),
+		notifier:  recorder,
+		threshold: 5,
+		warned:    make(map[[2]string]time.Time),
+	}
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	for _, remaining := range []int{6, 5, 4} {
+		limits.update(twitter.RateLimit{
+			Endpoint:  twitter.EndpointCreateTweet,
+			Window:    twitter.WindowUser24Hour,
+			Limit:     17,
+			Remaining: remaining,
+			Reset:     reset,
+		})
+	}
+
+	if len(recorder.events) != 1 || recorder.events[0].Kind != notify.EventTwitterRateLimitLow {
+		t.Fatalf("events = %+v, want one low rate limit warning for the window", recorder.events)
+	}
+	assertMainField(t, recorder.events[0], "remaining")
+	if got := testutil.ToFloat64(limits.metrics.TwitterRateLimitRemaining.WithLabelValues(twitter.EndpointCreateTweet, twitter.WindowUser24Hour)); got != 4 {
+		t.Fatalf("remaining metric = %v, want 4", got)
+	}
+	saved, err := store.LoadRateLimits(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("LoadRateLimits() error = %v", err)
+	}
+	if len(saved) != 1 || saved[0].Remaining != 4 || !saved[0].ResetAt.Equal(reset) {
+		t.Fatalf("LoadRateLimits() = %+v, want the latest limit", saved)
+	}
+
+	limits.update(twitter.RateLimit{
+		Endpoint:  twitter.EndpointCreateTweet,
+		Window:    twitter.WindowUser24Hour,
+		Limit:     17,
+		Remaining: 3,
+		Reset:     reset.Add(24 * time.Hour),
+	})
+	if len(recorder.events) != 2 {
+		t.Fatalf("events = %d, want a warning for the next window", len(recorder.events))
+	}
+}
+
+func TestNewTwitterBudgetRestoresSavedLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := tracker.NewCrossPostTracker(ctx, time.Hour)
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := store.SaveRateLimit(ctx, tracker.RateLimit{
+		Endpoint:  twitter.EndpointCreateTweet,
+		Window:    twitter.WindowUser24Hour,
+		Limit:     17,
+		Remaining: 0,
+		ResetAt:   reset,
+	}); err != nil {
+		t.Fatalf("SaveRateLimit() error = %v", err)
+	}
+	cfg := &Config{DiscordRateLimitThreshold: 5}
+	pair := &accountPair{metrics: metrics.NewNoop(), notifier: notify.NoopNotifier{}}
+
+	budget := cfg.newTwitterBudget(ctx, pair, store)
+	restored := budget.Limits()
+	if len(restored) != 1 || restored[0].Remaining != 0 || !restored[0].Reset.Equal(reset) {
+		t.Fatalf("Limits() = %+v, want the saved limit", restored)
+	}
+	if got := testutil.ToFloat64(pair.metrics.TwitterRateLimitReset.WithLabelValues(twitter.EndpointCreateTweet, twitter.WindowUser24Hour)); got != float64(reset.Unix()) {
+		t.Fatalf("reset metric = %v, want %d", got, reset.Unix())
+	}
+}
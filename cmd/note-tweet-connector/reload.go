@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"go.yaml.in/yaml/v2"
+)
+
+// accountFlags are the flags that fill the account pairs. Their changes are
+// compared per pair instead.
+var accountFlags = map[string]bool{
+	"accounts-file":               true,
+	"misskey-host":                true,
+	"misskey-token":               true,
+	"misskey-hook-secret":         true,
+	"misskey-media-host":          true,
+	"twitter-oauth2-client-id":    true,
+	"twitter-oauth2-redirect-url": true,
+	"twitter-token-store-path":    true,
+	"twitter-bearer-token":        true,
+	"twitter-username":            true,
+}
+
+// reloadableSettings are the flags applied on reload. Changes to the other
+// flags are reported as requiring a restart.
+var reloadableSettings = map[string]bool{
+	"log-level":                   true,
+	"discord-webhook-url":         true,
+	"discord-notify-timeout":      true,
+	"discord-error-dedupe-window": true,
+	"twitter-media-hosts":         true,
+	"misskey-drive-max-file-mb":   true,
+	"twitter-long-note-policy":    true,
+	"twitter-cw-policy":           true,
+	"twitter-cw-media-policy":     true,
+	"twitter-custom-emoji":        true,
+	"filter-rules-file":           true,
+}
+
+// reloadableAccountSettings are the account keys applied on reload.
+var reloadableAccountSettings = map[string]bool{
+	"misskey_media_host":   true,
+	"twitter_username":     true,
+	"twitter_bearer_token": true,
+}
+
+// reloader re-reads the configuration and applies the settings that can be
+// changed without a restart.
+type reloader struct {
+	args      []string
+	lookupEnv func(string) (string, bool)
+	notifier  *notify.SwappableNotifier
+	pairs     []*accountPair
+	workers   *twitterWorkers
+	metrics   *metrics.Metrics
+
+	// settings, accounts and filterRules hold the running configuration.
+	settings    map[string]string
+	accounts    []AccountConfig
+	filterRules string
+}
+
+func newReloader(args []string, lookupEnv func(string) (string, bool), fs *flag.FlagSet, cfg *Config, pairs []*accountPair, notifier *notify.SwappableNotifier, workers *twitterWorkers, m *metrics.Metrics) *reloader {
+	return &reloader{
+		args:        args,
+		lookupEnv:   lookupEnv,
+		notifier:    notifier,
+		pairs:       pairs,
+		workers:     workers,
+		metrics:     m,
+		settings:    configSettings(fs),
+		accounts:    cfg.accounts(),
+		filterRules: filterRulesDigest(cfg.filterRules),
+	}
+}
+
+// configSettings returns the value of every configurable flag.
+func configSettings(fs *flag.FlagSet) map[string]string {
+	settings := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if isConfigurableFlag(f.Name) {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+	return settings
+}
+
+// reload re-reads the configuration with the original command line. An
+// invalid configuration is rejected as a whole and the running one is kept.
+func (r *reloader) reload(ctx context.Context) error {
+	next, fs, err := loadConfig(r.args, flag.ContinueOnError, r.lookupEnv)
+	if err == nil {
+		err = next.loadAccounts()
+	}
+	if err == nil {
+		err = next.loadFilterRules()
+	}
+	if err == nil {
+		err = next.validate()
+	}
+	if err != nil {
+		r.metrics.ConfigReloads.WithLabelValues("error").Inc()
+		return err
+	}
+
+	settings := configSettings(fs)
+	accounts := next.accounts()
+	var applied, restartRequired []string
+
+	for name, value := range settings {
+		if accountFlags[name] || r.settings[name] == value {
+			continue
+		}
+		if reloadableSettings[name] {
+			applied = append(applied, configKey(name))
+		} else {
+			restartRequired = append(restartRequired, configKey(name))
+		}
+	}
+
+	// The rules file is read again on every reload, so edits to it apply
+	// even when the path stays the same.
+	filterRules := filterRulesDigest(next.filterRules)
+	if r.settings["filter-rules-file"] == settings["filter-rules-file"] && r.filterRules != filterRules {
+		applied = append(applied, configKey("filter-rules-file"))
+	}
+
+	running := slices.Clone(r.accounts)
+	var workersChanged bool
+	if !slices.EqualFunc(running, accounts, func(a, b AccountConfig) bool { return a.Name == b.Name }) {
+		restartRequired = append(restartRequired, "accounts")
+	} else {
+		for i := range running {
+			for _, key := range changedAccountKeys(running[i], accounts[i]) {
+				name := running[i].Name + "." + key
+				if !reloadableAccountSettings[key] {
+					restartRequired = append(restartRequired, name)
+					continue
+				}
+				setAccountKey(&running[i], key, accounts[i])
+				applied = append(applied, name)
+				if key != "misskey_media_host" {
+					workersChanged = true
+				}
+			}
+		}
+	}
+
+	if workersChanged {
+		if err := r.workers.reload(ctx, r.pairs, running); err != nil {
+			slog.Error("Failed to apply Twitter settings", slog.Any("error", err))
+			applied = slices.DeleteFunc(applied, func(name string) bool {
+				return strings.HasSuffix(name, ".twitter_username") || strings.HasSuffix(name, ".twitter_bearer_token")
+			})
+			restartRequired = append(restartRequired, "twitter_workers")
+			for i := range running {
+				running[i].TwitterUsername = r.accounts[i].TwitterUsername
+				running[i].TwitterBearerToken = r.accounts[i].TwitterBearerToken
+			}
+		}
+	}
+
+	if r.settings["log-level"] != settings["log-level"] {
+		logLevel.Set(parseLogLevel(next.LogLevel))
+	}
+	for _, name := range []string{"discord-webhook-url", "discord-notify-timeout", "discord-error-dedupe-window"} {
+		if r.settings[name] != settings[name] {
+			r.notifier.Swap(next.newNotifier())
+			break
+		}
+	}
+	for i, pair := range r.pairs {
+		if i < len(running) {
+			pair.reloadHandlerConfig(next, running[i])
+		}
+	}
+
+	for name := range reloadableSettings {
+		r.settings[name] = settings[name]
+	}
+	r.accounts = running
+	r.filterRules = filterRules
+
+	slices.Sort(applied)
+	slices.Sort(restartRequired)
+	slog.Info("Reloaded configuration",
+		slog.Any("applied", applied),
+		slog.Any("restart_required", restartRequired))
+	if err := r.notifier.Notify(ctx, notify.Event{
+		Kind:     notify.EventConfigReloaded,
+		Severity: notify.SeverityInfo,
+		Title:    "設定を再読み込みしました",
+		Message:  "Note Tweet Connector が SIGHUP を受けて設定を再読み込みしました。",
+		Fields: []notify.Field{
+			{Name: "適用済み", Value: listOrNone(applied)},
+			{Name: "再起動が必要", Value: listOrNone(restartRequired)},
+		},
+	}); err != nil {
+		slog.Warn("Failed to send Discord notification", slog.Any("error", err), slog.String("kind", string(notify.EventConfigReloaded)))
+	}
+	r.metrics.ConfigReloads.WithLabelValues("success").Inc()
+	return nil
+}
+
+// reloadHandlerConfig replaces the reloadable fields of the pair's handler
+// configuration. The clients and credentials are kept.
+func (p *accountPair) reloadHandlerConfig(cfg *Config, account AccountConfig) {
+	handlerCfg := p.handlerConfig()
+	handlerCfg.TwitterUsername = account.TwitterUsername
+	handlerCfg.TwitterMediaAllowedHosts = misskey.ParseAllowedHosts(cfg.TwitterMediaHosts)
+	handlerCfg.MisskeyDriveMaxFileBytes = int64(cfg.MisskeyDriveMaxFileMB) * 1024 * 1024
+	handlerCfg.LongNotePolicy = cfg.TwitterLongNotePolicy
+	handlerCfg.CWPolicy = cfg.TwitterCWPolicy
+	handlerCfg.CWMediaPolicy = cfg.TwitterCWMediaPolicy
+	handlerCfg.CustomEmoji = cfg.TwitterCustomEmoji
+	handlerCfg.Note2TweetFilter = cfg.filterRules.Note2Tweet
+	handlerCfg.Tweet2NoteFilter = cfg.filterRules.Tweet2Note
+	handlerCfg.Twitter.MisskeyMediaHost = account.MisskeyMediaHost
+	p.cfg.Store(&handlerCfg)
+}
+
+// changedAccountKeys returns the configuration keys whose values differ
+// between two accounts. The *_file keys are compared through the secrets
+// they were read into.
+func changedAccountKeys(a, b AccountConfig) []string {
+	fields := []struct {
+		key  string
+		a, b string
+	}{
+		{"name", a.Name, b.Name},
+		{"misskey_host", a.MisskeyHost, b.MisskeyHost},
+		{"misskey_token", a.MisskeyToken, b.MisskeyToken},
+		{"misskey_hook_secret", a.MisskeyHookSecret, b.MisskeyHookSecret},
+		{"misskey_media_host", a.MisskeyMediaHost, b.MisskeyMediaHost},
+		{"twitter_oauth2_client_id", a.TwitterOAuth2ClientID, b.TwitterOAuth2ClientID},
+		{"twitter_oauth2_redirect_url", a.TwitterOAuth2RedirectURL, b.TwitterOAuth2RedirectURL},
+		{"twitter_token_store_path", a.TwitterTokenStorePath, b.TwitterTokenStorePath},
+		{"twitter_bearer_token", a.TwitterBearerToken, b.TwitterBearerToken},
+		{"twitter_username", a.TwitterUsername, b.TwitterUsername},
+	}
+	var keys []string
+	for _, field := range fields {
+		if field.a != field.b {
+			keys = append(keys, field.key)
+		}
+	}
+	return keys
+}
+
+// setAccountKey copies a reloadable account setting from src to dst.
+func setAccountKey(dst *AccountConfig, key string, src AccountConfig) {
+	switch key {
+	case "misskey_media_host":
+		dst.MisskeyMediaHost = src.MisskeyMediaHost
+	case "twitter_username":
+		dst.TwitterUsername = src.TwitterUsername
+	case "twitter_bearer_token":
+		dst.TwitterBearerToken = src.TwitterBearerToken
+	}
+}
+
+// filterRulesDigest returns a comparable form of the filter rules.
+func filterRulesDigest(rules filter.Rules) string {
+	data, err := yaml.Marshal(rules)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
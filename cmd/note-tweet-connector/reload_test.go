@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/handler"
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const reloadTestConfig = `
+misskey_host: misskey.example
+misskey_token: token
+misskey_hook_secret: secret
+misskey_media_host: media.misskey.example
+twitter_oauth2_client_id: client-id
+twitter_oauth2_redirect_url: https://connector.example/twitter/callback
+twitter_bearer_token: bearer
+twitter_username: alice
+`
+
+// newTestReloader starts a reloader for a single pair configured by the file
+// at path.
+func newTestReloader(t *testing.T, path string, notifier notify.Notifier) (*reloader, *accountPair) {
+	t.Helper()
+	args := []string{"-config-file", path}
+	lookupEnv := func(string) (string, bool) { return "", false }
+	cfg, fs, err := loadConfig(args, flag.ContinueOnError, lookupEnv)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if err := cfg.loadAccounts(); err != nil {
+		t.Fatalf("loadAccounts() error = %v", err)
+	}
+	if err := cfg.loadFilterRules(); err != nil {
+		t.Fatalf("loadFilterRules() error = %v", err)
+	}
+
+	account := cfg.accounts()[0]
+	pair := &accountPair{account: account, metrics: metrics.NewNoop()}
+	handlerCfg := cfg.handlerConfig(account, nil, nil)
+	pair.cfg.Store(&handlerCfg)
+
+	pairs := []*accountPair{pair}
+	workers := newTwitterWorkers(context.Background(), cfg, nil)
+	r := newReloader(args, lookupEnv, fs, cfg, pairs, notify.NewSwappableNotifier(notifier), workers, metrics.NewNoop())
+	return r, pair
+}
+
+func TestReloaderAppliesReloadableSettings(t *testing.T) {
+	previous := logLevel.Level()
+	t.Cleanup(func() { logLevel.Set(previous) })
+	logLevel.Set(slog.LevelInfo)
+
+	path := writeConfigFile(t, "config.yaml", reloadTestConfig)
+	recorder := &mainRecordingNotifier{}
+	r, pair := newTestReloader(t, path, recorder)
+
+	content := strings.Replace(reloadTestConfig, "media.misskey.example", "media2.misskey.example", 1) + `
+log_level: debug
+port: "8081"
+twitter_cw_policy: skip
+twitter_media_hosts: pbs.twimg.com
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := r.reload(context.Background()); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+
+	cfg := pair.handlerConfig()
+	if cfg.CWPolicy != handler.CWPolicySkip || cfg.Twitter.MisskeyMediaHost != "media2.misskey.example" {
+		t.Fatalf("handler config = %+v, want the reloaded policy and media host", cfg)
+	}
+	if len(cfg.TwitterMediaAllowedHosts) != 1 || cfg.TwitterMediaAllowedHosts[0] != "pbs.twimg.com" {
+		t.Fatalf("TwitterMediaAllowedHosts = %v, want [pbs.twimg.com]", cfg.TwitterMediaAllowedHosts)
+	}
+	if cfg.MisskeyToken != "token" {
+		t.Fatalf("MisskeyToken = %q, want the credentials kept", cfg.MisskeyToken)
+	}
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Fatalf("log level = %v, want debug", got)
+	}
+	if got := testutil.ToFloat64(r.metrics.ConfigReloads.WithLabelValues("success")); got != 1 {
+		t.Fatalf("config_reloads_total{status=success} = %v, want 1", got)
+	}
+
+	if len(recorder.events) != 1 || recorder.events[0].Kind != notify.EventConfigReloaded {
+		t.Fatalf("events = %+v, want one config reload event", recorder.events)
+	}
+	fields := map[string]string{}
+	for _, field := range recorder.events[0].Fields {
+		fields[field.Name] = field.Value
+	}
+	if want := "default.misskey_media_host, log_level, twitter_cw_policy, twitter_media_hosts"; fields["適用済み"] != want {
+		t.Fatalf("applied = %q, want %q", fields["適用済み"], want)
+	}
+	if fields["再起動が必要"] != "port" {
+		t.Fatalf("restart required = %q, want port", fields["再起動が必要"])
+	}
+
+	// A second reload with the same file has nothing to apply.
+	recorder.events = nil
+	if err := r.reload(context.Background()); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := recorder.events[0].Fields[0].Value; got != "none" {
+		t.Fatalf("applied = %q, want none", got)
+	}
+}
+
+func TestReloaderKeepsRunningConfigOnError(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", reloadTestConfig)
+	recorder := &mainRecordingNotifier{}
+	r, pair := newTestReloader(t, path, recorder)
+
+	content := reloadTestConfig + "twitter_cw_policy: skip\ntwitter_custom_emoji: image\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := r.reload(context.Background()); err == nil {
+		t.Fatal("reload() error = nil, want a validation error")
+	}
+	if got := pair.handlerConfig().CWPolicy; got != handler.CWPolicyMask {
+		t.Fatalf("CWPolicy = %q, want the running value", got)
+	}
+	if len(recorder.events) != 0 {
+		t.Fatalf("events = %+v, want none", recorder.events)
+	}
+	if got := testutil.ToFloat64(r.metrics.ConfigReloads.WithLabelValues("error")); got != 1 {
+		t.Fatalf("config_reloads_total{status=error} = %v, want 1", got)
+	}
+}
+
+func TestReloaderSwapsNotifier(t *testing.T) {
+	received := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload struct {
+			Embeds []struct {
+				Title string `json:"title"`
+			} `json:"embeds"`
+		}
+		_ = json.Unmarshal(body, &payload)
+		if len(payload.Embeds) > 0 {
+			received <- payload.Embeds[0].Title
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	path := writeConfigFile(t, "config.yaml", reloadTestConfig)
+	recorder := &mainRecordingNotifier{}
+	r, _ := newTestReloader(t, path, recorder)
+
+	if err := os.WriteFile(path, []byte(reloadTestConfig+"discord_webhook_url: "+webhook.URL+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := r.reload(context.Background()); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if len(recorder.events) != 0 {
+		t.Fatalf("previous notifier received %+v, want the new one to be used", recorder.events)
+	}
+	select {
+	case title := <-received:
+		if !strings.Contains(title, "設定を再読み込みしました") {
+			t.Fatalf("title = %q, want the config reload event", title)
+		}
+	default:
+		t.Fatal("new Discord webhook did not receive the config reload event")
+	}
+}
+
+func TestTwitterWorkersReloadUpdatesRuleWithoutReconnect(t *testing.T) {
+	var requests []string
+	rules := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+string(body))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":[{"id":"1","value":"from:alice","tag":"note-tweet-connector"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer rules.Close()
+
+	cfg := validTestConfig()
+	pair := &accountPair{account: cfg.accounts()[0], metrics: metrics.NewNoop()}
+	pairs := []*accountPair{pair}
+	workers := newTwitterWorkers(context.Background(), cfg, nil)
+	workers.groups = newTwitterStreamGroups(pairs, cfg.accounts(), cfg, nil)
+	group := workers.groups[0]
+	group.client.RulesEndpoint = rules.URL
+	var cancelled bool
+	group.cancel = func() { cancelled = true }
+
+	accounts := cfg.accounts()
+	accounts[0].TwitterUsername = "bob"
+	if err := workers.reload(context.Background(), pairs, accounts); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if cancelled || len(workers.groups) != 1 || workers.groups[0] != group {
+		t.Fatalf("stream group was replaced, want the running connection kept")
+	}
+	if group.rules[0] != "from:bob" {
+		t.Fatalf("rules = %v, want from:bob", group.rules)
+	}
+	if len(requests) != 3 || !strings.Contains(requests[1], `"delete"`) || !strings.Contains(requests[2], `"from:bob"`) {
+		t.Fatalf("rule requests = %v, want list, delete and add", requests)
+	}
+}
+
+func TestReloaderReloadsFilterRules(t *testing.T) {
+	rules := writeConfigFile(t, "filters.yaml", "tweet2note:\n  rules: []\n")
+	path := writeConfigFile(t, "config.yaml", reloadTestConfig+"filter_rules_file: "+rules+"\n")
+	recorder := &mainRecordingNotifier{}
+	r, pair := newTestReloader(t, path, recorder)
+	if cfg := pair.handlerConfig(); cfg.Tweet2NoteFilter == nil || cfg.Note2TweetFilter != nil {
+		t.Fatalf("filters = %+v, %+v; want only the tweet2note rules set", cfg.Note2TweetFilter, cfg.Tweet2NoteFilter)
+	}
+
+	content := "tweet2note:\n  default: skip\n  rules: []\n"
+	if err := os.WriteFile(rules, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := r.reload(context.Background()); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := pair.handlerConfig().Tweet2NoteFilter; got == nil || got.Default != "skip" {
+		t.Fatalf("Tweet2NoteFilter = %+v, want the edited rules", got)
+	}
+	if got := recorder.events[0].Fields[0].Value; got != "filter_rules_file" {
+		t.Fatalf("applied = %q, want filter_rules_file", got)
+	}
+
+	if err := os.WriteFile(rules, []byte("tweet2note:\n  default: drop\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := r.reload(context.Background()); err == nil {
+		t.Fatal("reload() error = nil, want invalid filter rules to be rejected")
+	}
+	if got := pair.handlerConfig().Tweet2NoteFilter; got.Default != "skip" {
+		t.Fatalf("Tweet2NoteFilter = %+v, want the running rules kept", got)
+	}
+}
+
+func TestTwitterWorkersReloadWaitsForReplacedTimeline(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"id":"42"}}`))
+	}))
+	defer users.Close()
+	oldEndpoint := twitter.UsersEndpoint
+	twitter.UsersEndpoint = users.URL
+	defer func() { twitter.UsersEndpoint = oldEndpoint }()
+
+	cfg := validTestConfig()
+	pair := &accountPair{account: cfg.accounts()[0], metrics: metrics.NewNoop()}
+	// The replacement worker exits at once on the cancelled context.
+	workersCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	workers := newTwitterWorkers(workersCtx, cfg, nil)
+	old := &twitterTimelineWorker{pair: pair, bearerToken: "bearer", username: pair.account.TwitterUsername, done: make(chan struct{})}
+	cancelled := make(chan struct{})
+	old.cancel = func() { close(cancelled) }
+	workers.timelines = []*twitterTimelineWorker{old}
+
+	accounts := cfg.accounts()
+	accounts[0].TwitterBearerToken = "new-bearer"
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- workers.reloadTimelines(context.Background(), accounts) }()
+
+	<-cancelled
+	select {
+	case err := <-reloaded:
+		t.Fatalf("reloadTimelines() = %v before the replaced worker stopped", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(old.done)
+	if err := <-reloaded; err != nil {
+		t.Fatalf("reloadTimelines() error = %v", err)
+	}
+	if worker := workers.timelines[0]; worker == old || worker.bearerToken != "new-bearer" || worker.userID != "42" {
+		t.Fatalf("timelines[0] = %+v, want a worker with the new bearer token", worker)
+	}
+}
+
+func TestChangedAccountKeys(t *testing.T) {
+	a := AccountConfig{Name: "alice", TwitterUsername: "alice", MisskeyTokenFile: "/run/secrets/a"}
+	b := a
+	b.TwitterUsername = "bob"
+	b.TwitterBearerToken = "bearer"
+	b.MisskeyTokenFile = "/run/secrets/b"
+	got := changedAccountKeys(a, b)
+	if want := []string{"twitter_bearer_token", "twitter_username"}; !slices.Equal(got, want) {
+		t.Fatalf("changedAccountKeys() = %v, want %v", got, want)
+	}
+	if got := changedAccountKeys(a, a); len(got) != 0 {
+		t.Fatalf("changedAccountKeys() of equal accounts = %v, want none", got)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Soli0222/note-tweet-connector/internal/notify"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+// twitterStreamGroup is a Filtered Stream connection shared by the pairs that
+// use the same bearer token. X allows one connection per app, so each pair
+// adds a rule with its own tag and payloads are routed by the matching rules.
+type twitterStreamGroup struct {
+	client      *twitter.StreamClient
+	bearerToken string
+	pairs       []*accountPair
+	// rules holds the stream rule of each pair.
+	rules    []string
+	notifier notify.Notifier
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newTwitterStreamGroups groups the pairs by bearer token. accounts holds the
+// configuration of each pair.
+func newTwitterStreamGroups(pairs []*accountPair, accounts []AccountConfig, cfg *Config, notifier notify.Notifier) []*twitterStreamGroup {
+	var groups []*twitterStreamGroup
+	byToken := map[string]*twitterStreamGroup{}
+	for i, pair := range pairs {
+		account := accounts[i]
+		group, ok := byToken[account.TwitterBearerToken]
+		if !ok {
+			client := twitter.NewStreamClient(twitter.StaticBearerTokenSource{Token: account.TwitterBearerToken})
+			client.KeepAliveTimeout = cfg.TwitterStreamKeepAlive
+			group = &twitterStreamGroup{client: client, bearerToken: account.TwitterBearerToken}
+			byToken[account.TwitterBearerToken] = group
+			groups = append(groups, group)
+		}
+		group.pairs = append(group.pairs, pair)
+		group.rules = append(group.rules, twitter.DefaultStreamRule(account.TwitterUsername))
+	}
+	for _, group := range groups {
+		group.notifier = notify.NewPairNotifier(notifier, strings.Join(group.pairNames(), ","))
+	}
+	return groups
+}
+
+func (g *twitterStreamGroup) pairNames() []string {
+	names := make([]string, 0, len(g.pairs))
+	for _, pair := range g.pairs {
+		names = append(names, pair.account.Name)
+	}
+	return names
+}
+
+// ensureRules sets the given stream rule of each pair in the group and
+// deletes the connector rules of pairs outside the group, which would
+// otherwise deliver another account's tweets on this connection.
+func (g *twitterStreamGroup) ensureRules(ctx context.Context, rules []string) error {
+	streamRules := make([]twitter.StreamRule, 0, len(g.pairs))
+	for i, pair := range g.pairs {
+		streamRules = append(streamRules, twitter.StreamRule{Value: rules[i], Tag: twitter.StreamRuleTag(pair.account.namespace())})
+		pair.metrics.TwitterStreamRuleUpdates.WithLabelValues("ensure", "attempt").Inc()
+	}
+	deleted, err := g.client.SyncRules(ctx, streamRules)
+	logDeletedStreamRules(g.pairNames(), deleted)
+	if err != nil {
+		for _, pair := range g.pairs {
+			pair.metrics.TwitterStreamRuleUpdates.WithLabelValues("ensure", "error").Inc()
+		}
+		return fmt.Errorf("ensure Twitter stream rules for %s: %w", strings.Join(g.pairNames(), ","), err)
+	}
+	for i, pair := range g.pairs {
+		pair.metrics.TwitterStreamRuleUpdates.WithLabelValues("ensure", "success").Inc()
+		slog.Info("Ensured Twitter stream rule",
+			slog.String("pair", pair.account.Name),
+			slog.String("rule", streamRules[i].Value),
+			slog.String("tag", streamRules[i].Tag))
+	}
+	return nil
+}
+
+// deleteRules deletes the connector rules of a connection that no pair uses
+// anymore.
+func (g *twitterStreamGroup) deleteRules(ctx context.Context) {
+	deleted, err := g.client.SyncRules(ctx, nil)
+	logDeletedStreamRules(g.pairNames(), deleted)
+	if err != nil {
+		slog.Warn("Failed to delete Twitter stream rules of an unused bearer token",
+			slog.Any("pairs", g.pairNames()),
+			slog.Any("error", err))
+	}
+}
+
+func logDeletedStreamRules(pairs []string, rules []twitter.StreamRule) {
+	for _, rule := range rules {
+		slog.Info("Deleted Twitter stream rule",
+			slog.Any("pairs", pairs),
+			slog.String("rule", rule.Value),
+			slog.String("tag", rule.Tag))
+	}
+}
+
+// pairsForPayload returns the pairs whose rules matched a stream payload.
+// Payloads are always routed by tag, so that a rule left by another pair on
+// the same app does not deliver its tweets to this group.
+func (g *twitterStreamGroup) pairsForPayload(line []byte) []*accountPair {
+	tags := twitter.MatchingRuleTags(line)
+	var pairs []*accountPair
+	for _, pair := range g.pairs {
+		if slices.Contains(tags, twitter.StreamRuleTag(pair.account.namespace())) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// twitterTimelineWorker polls the timeline of one pair.
+type twitterTimelineWorker struct {
+	pair        *accountPair
+	client      *twitter.TimelineClient
+	bearerToken string
+	username    string
+	userID      string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// twitterWorkers runs the Twitter stream or timeline workers. On reload it
+// keeps the running connections and only replaces the ones whose bearer token
+// or pairs changed, so that a reload does not reconnect Filtered Stream. No
+// worker runs while tweet-to-note is disabled.
+type twitterWorkers struct {
+	ctx      context.Context
+	cfg      *Config
+	notifier notify.Notifier
+
+	mu        sync.Mutex
+	groups    []*twitterStreamGroup
+	timelines []*twitterTimelineWorker
+}
+
+func newTwitterWorkers(ctx context.Context, cfg *Config, notifier notify.Notifier) *twitterWorkers {
+	return &twitterWorkers{
+		ctx:      ctx,
+		cfg:      cfg,
+		notifier: notifier,
+	}
+}
+
+// prepare ensures the stream rules, or looks up the timeline users, before the
+// workers are started.
+func (w *twitterWorkers) prepare(ctx context.Context, pairs []*accountPair, accounts []AccountConfig) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.cfg.Tweet2NoteEnabled {
+		return nil
+	}
+	if w.cfg.TwitterSource == twitterSourceTimeline {
+		for i, pair := range pairs {
+			worker, err := newTwitterTimelineWorker(ctx, pair, accounts[i])
+			if err != nil {
+				return err
+			}
+			w.timelines = append(w.timelines, worker)
+		}
+		return nil
+	}
+
+	w.groups = newTwitterStreamGroups(pairs, accounts, w.cfg, w.notifier)
+	for _, group := range w.groups {
+		if err := group.ensureRules(ctx, group.rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start runs the prepared workers.
+func (w *twitterWorkers) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, group := range w.groups {
+		w.startStreamGroup(group)
+	}
+	for _, worker := range w.timelines {
+		w.startTimelineWorker(worker)
+	}
+}
+
+// reload applies the bearer tokens and usernames of accounts. A changed
+// username only updates the stream rule; a changed bearer token moves the
+// pair to another connection, and both connections are reconnected.
+func (w *twitterWorkers) reload(ctx context.Context, pairs []*accountPair, accounts []AccountConfig) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.cfg.Tweet2NoteEnabled {
+		return nil
+	}
+	if w.cfg.TwitterSource == twitterSourceTimeline {
+		return w.reloadTimelines(ctx, accounts)
+	}
+	return w.reloadStreams(ctx, pairs, accounts)
+}
+
+func (w *twitterWorkers) reloadStreams(ctx context.Context, pairs []*accountPair, accounts []AccountConfig) error {
+	var kept, started []*twitterStreamGroup
+	for _, group := range newTwitterStreamGroups(pairs, accounts, w.cfg, w.notifier) {
+		current := w.findStreamGroup(group)
+		if current == nil {
+			if err := group.ensureRules(ctx, group.rules); err != nil {
+				return err
+			}
+			started = append(started, group)
+			continue
+		}
+		if !slices.Equal(current.rules, group.rules) {
+			// Rule changes apply to the open connection.
+			if err := current.ensureRules(ctx, group.rules); err != nil {
+				return err
+			}
+			current.rules = group.rules
+		}
+		kept = append(kept, current)
+	}
+
+	next := append(kept, started...)
+
+	// Close the replaced connections first; X rejects a second connection
+	// with the same bearer token. A token no group uses anymore keeps its
+	// rules on the app, so delete them as well.
+	for _, group := range w.groups {
+		if slices.Contains(kept, group) {
+			continue
+		}
+		slog.Info("Stopping Twitter Filtered Stream worker", slog.Any("pairs", group.pairNames()))
+		group.cancel()
+		<-group.done
+		if !slices.ContainsFunc(next, func(other *twitterStreamGroup) bool {
+			return other.bearerToken == group.bearerToken
+		}) {
+			group.deleteRules(ctx)
+		}
+	}
+	for _, group := range started {
+		w.startStreamGroup(group)
+	}
+	w.groups = next
+	return nil
+}
+
+// findStreamGroup returns the running group with the same bearer token and
+// pairs as group.
+func (w *twitterWorkers) findStreamGroup(group *twitterStreamGroup) *twitterStreamGroup {
+	for _, current := range w.groups {
+		if current.bearerToken == group.bearerToken && slices.Equal(current.pairs, group.pairs) {
+			return current
+		}
+	}
+	return nil
+}
+
+func (w *twitterWorkers) startStreamGroup(group *twitterStreamGroup) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	group.cancel = cancel
+	group.done = make(chan struct{})
+	go func() {
+		defer close(group.done)
+		slog.Info("Starting Twitter Filtered Stream worker", slog.Any("pairs", group.pairNames()))
+		runTwitterStream(ctx, group, w.cfg.TwitterStreamReconnectMin, w.cfg.TwitterStreamReconnectMax, w.cfg.DiscordStreamLoopWindow, w.cfg.DiscordStreamLoopThreshold)
+	}()
+}
+
+func (w *twitterWorkers) reloadTimelines(ctx context.Context, accounts []AccountConfig) error {
+	for i, current := range w.timelines {
+		account := accounts[i]
+		if current.bearerToken == account.TwitterBearerToken && current.username == account.TwitterUsername {
+			continue
+		}
+		worker, err := newTwitterTimelineWorker(ctx, current.pair, account)
+		if err != nil {
+			return err
+		}
+		// Wait for the old worker so that the two never poll at once.
+		slog.Info("Stopping Twitter user timeline worker", slog.String("pair", current.pair.account.Name), slog.String("user_id", current.userID))
+		current.cancel()
+		<-current.done
+		w.startTimelineWorker(worker)
+		w.timelines[i] = worker
+	}
+	return nil
+}
+
+func newTwitterTimelineWorker(ctx context.Context, pair *accountPair, account AccountConfig) (*twitterTimelineWorker, error) {
+	client := twitter.NewTimelineClient(twitter.StaticBearerTokenSource{Token: account.TwitterBearerToken})
+	userID, err := client.LookupUserID(ctx, account.TwitterUsername)
+	if err != nil {
+		return nil, fmt.Errorf("look up Twitter user for %s: %w", pair.account.Name, err)
+	}
+	return &twitterTimelineWorker{
+		pair:        pair,
+		client:      client,
+		bearerToken: account.TwitterBearerToken,
+		username:    account.TwitterUsername,
+		userID:      userID,
+	}, nil
+}
+
+func (w *twitterWorkers) startTimelineWorker(worker *twitterTimelineWorker) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	worker.cancel = cancel
+	worker.done = make(chan struct{})
+	go func() {
+		defer close(worker.done)
+		slog.Info("Starting Twitter user timeline worker", slog.String("pair", worker.pair.account.Name), slog.String("user_id", worker.userID))
+		runTwitterTimeline(ctx, worker.client, worker.userID, worker.pair, w.cfg.TwitterTimelinePoll)
+	}()
+}
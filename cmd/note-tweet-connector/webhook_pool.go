@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+// webhookJob is a verified Misskey webhook or a Misskey stream note recorded
+// in the pair's outbox.
+type webhookJob struct {
+	pair *accountPair
+	job  tracker.Job
+}
+
+// webhookPool posts accepted Misskey webhooks and stream notes in the
+// background so that the request can be acknowledged, and the stream read,
+// before media uploads finish. It holds at most
+// workers running and queueSize waiting jobs.
+type webhookPool struct {
+	slots chan struct{}
+	jobs  chan webhookJob
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+
+	// ctx is not canceled on shutdown, so that running jobs can finish
+	// until drain gives up.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newWebhookPool(workers, queueSize int) *webhookPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &webhookPool{
+		slots:  make(chan struct{}, workers+queueSize),
+		jobs:   make(chan webhookJob, workers+queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for range workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// reserve takes a place for a job. It returns false when the pool is
+// saturated.
+func (p *webhookPool) reserve() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release gives back a place taken by reserve that was not used.
+func (p *webhookPool) release() {
+	<-p.slots
+}
+
+// submit queues a job into a place taken by reserve. It returns false once
+// the pool is draining; the place is then released and the job is left to
+// the outbox retry loop.
+func (p *webhookPool) submit(job webhookJob) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.release()
+		return false
+	}
+	p.jobs <- job
+	return true
+}
+
+func (p *webhookPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		pair := job.pair
+		if err := pair.outbox.Attempt(p.ctx, job.job); err != nil {
+			pair.metrics.WebhookRequestErrors.WithLabelValues("misskey", "handler").Inc()
+			slog.Error("Failed to handle request", slog.String("pair", pair.account.Name), slog.Any("error", err))
+		}
+		p.release()
+	}
+}
+
+// drain stops accepting jobs and waits for the queued and running ones. When
+// ctx ends first, the remaining attempts are canceled and the outbox retries
+// their jobs after the restart.
+func (p *webhookPool) drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/handler"
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+func newTestWebhookRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"body":`))
+	req.Header.Set("User-Agent", "Misskey-Hooks")
+	req.Header.Set("X-Misskey-Hook-Secret", "secret")
+	return req
+}
+
+func TestServerWebhookRejectsWhenSaturated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	pair := newTestOutboxPair(crossPostTracker, metrics.NewNoop())
+	s := &server{pairs: []*accountPair{pair}, webhooks: newWebhookPool(1, 0), metrics: metrics.NewNoop()}
+
+	if !s.webhooks.reserve() {
+		t.Fatal("reserve() = false, want the only place to be free")
+	}
+	rec := httptest.NewRecorder()
+	s.webhookHandler(rec, newTestWebhookRequest())
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if stats, err := crossPostTracker.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Fatalf("JobStats() = %+v, %v; want the rejected webhook not to be recorded", stats, err)
+	}
+
+	s.webhooks.release()
+	rec = httptest.NewRecorder()
+	s.webhookHandler(rec, newTestWebhookRequest())
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d after release, want %d", rec.Code, http.StatusAccepted)
+	}
+}
+
+func TestWebhookPoolDrainCancelsAfterTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	pair := newTestOutboxPair(crossPostTracker, metrics.NewNoop())
+	started := make(chan struct{})
+	pair.outbox.Handle(jobNote2Tweet, func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	pool := newWebhookPool(1, 0)
+	job, err := pair.outbox.Enqueue(ctx, jobNote2Tweet, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if !pool.reserve() || !pool.submit(webhookJob{pair: pair, job: job}) {
+		t.Fatal("submit() = false, want the job to be queued")
+	}
+	<-started
+
+	drainCtx, drainCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer drainCancel()
+	if err := pool.drain(drainCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drain() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if pool.reserve() && pool.submit(webhookJob{pair: pair, job: job}) {
+		t.Fatal("submit() = true after drain, want false")
+	}
+	jobs, err := crossPostTracker.DueJobs(ctx, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("DueJobs() = %+v, want the canceled job to be retried right away", jobs)
+	}
+}
+
+func TestSubmitStreamNotePostsInWorkerPool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	pair := newTestOutboxPair(crossPostTracker, metrics.NewNoop())
+	pair.cfg.Store(&handler.Config{MisskeyHost: "misskey.example"})
+	posted := make(chan []byte, 1)
+	pair.outbox.Handle(jobNote2Tweet, func(ctx context.Context, payload []byte) error {
+		posted <- payload
+		return nil
+	})
+
+	pool := newWebhookPool(1, 0)
+	if err := submitStreamNote(ctx, pool, pair, []byte(`{"id":"note-1"}`)); err != nil {
+		t.Fatalf("submitStreamNote() error = %v", err)
+	}
+	if err := pool.drain(ctx); err != nil {
+		t.Fatalf("drain() error = %v", err)
+	}
+	select {
+	case payload := <-posted:
+		if !strings.Contains(string(payload), `"server":"https://misskey.example"`) {
+			t.Fatalf("payload = %s, want the webhook format", payload)
+		}
+	default:
+		t.Fatal("stream note was not posted by the pool")
+	}
+}
+
+func TestSubmitStreamNoteLeavesJobToOutboxWhenSaturated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	pair := newTestOutboxPair(crossPostTracker, metrics.NewNoop())
+	pair.outbox.Handle(jobNote2Tweet, func(ctx context.Context, payload []byte) error {
+		t.Fatal("stream note was posted by a saturated pool")
+		return nil
+	})
+
+	pool := newWebhookPool(1, 0)
+	defer func() { _ = pool.drain(ctx) }()
+	if !pool.reserve() {
+		t.Fatal("reserve() = false, want the only place to be free")
+	}
+	if err := submitStreamNote(ctx, pool, pair, []byte(`{"id":"note-1"}`)); err != nil {
+		t.Fatalf("submitStreamNote() error = %v", err)
+	}
+	if stats, err := crossPostTracker.JobStats(ctx); err != nil || stats.Pending != 1 {
+		t.Fatalf("JobStats() = %+v, %v; want the note left pending for the retry loop", stats, err)
+	}
+	pool.release()
+}
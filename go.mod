@@ -4,6 +4,7 @@ go 1.26.6
 
 require (
 	github.com/prometheus/client_golang v1.24.1
+	go.yaml.in/yaml/v2 v2.4.4
 	modernc.org/sqlite v1.57.0
 )
 
@@ -21,7 +22,6 @@ require (
 	github.com/prometheus/common v0.70.1 // indirect
 	github.com/prometheus/procfs v0.21.1 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	go.yaml.in/yaml/v2 v2.4.4 // indirect
 	golang.org/x/sys v0.47.0 // indirect
 	google.golang.org/protobuf v1.36.11 // indirect
 	modernc.org/libc v1.74.4 // indirect
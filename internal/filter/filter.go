@@ -0,0 +1,260 @@
+// Package filter decides which notes and tweets are cross-posted.
+package filter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+const (
+	// ActionSkip drops the post.
+	ActionSkip = "skip"
+	// ActionForward cross-posts the post, applying the rule's overrides.
+	ActionForward = "forward"
+)
+
+// DefaultRuleName is the skip reason of a post that matched no rule in a set
+// whose default action is ActionSkip.
+const DefaultRuleName = "default"
+
+var ruleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Post holds the attributes of a note or tweet that rules match on. Tweets
+// are always public and have no CW, local-only flag or channel.
+type Post struct {
+	Text       string
+	Hashtags   []string
+	Visibility string
+	LocalOnly  bool
+	CW         bool
+	HasMedia   bool
+	ChannelID  string
+}
+
+// Match lists the conditions of a rule. A rule matches a post when every
+// condition that is set matches; list conditions match any of their values.
+type Match struct {
+	Hashtags   []string `yaml:"hashtags,omitempty"`
+	Regex      string   `yaml:"regex,omitempty"`
+	Visibility []string `yaml:"visibility,omitempty"`
+	LocalOnly  *bool    `yaml:"local_only,omitempty"`
+	CW         *bool    `yaml:"cw,omitempty"`
+	Media      *bool    `yaml:"media,omitempty"`
+	Channels   []string `yaml:"channels,omitempty"`
+
+	regex *regexp.Regexp
+	// otherVisibility matches the posts whose visibility is none of its
+	// values, including an empty or unknown one. Only built-in rules use it.
+	otherVisibility []string
+}
+
+// Overrides change how a forwarded post is cross-posted. CWPolicy and
+// LongNotePolicy apply to notes posted to Twitter, Visibility and CW to
+// tweets posted to Misskey, and Media to both.
+type Overrides struct {
+	CWPolicy       string `yaml:"cw_policy,omitempty"`
+	LongNotePolicy string `yaml:"long_note_policy,omitempty"`
+	Media          *bool  `yaml:"media,omitempty"`
+	Visibility     string `yaml:"visibility,omitempty"`
+	CW             string `yaml:"cw,omitempty"`
+}
+
+// Rule is a named condition and the action taken on the posts it matches.
+type Rule struct {
+	Name      string    `yaml:"name"`
+	Match     Match     `yaml:"match"`
+	Action    string    `yaml:"action"`
+	Overrides Overrides `yaml:"overrides,omitempty"`
+}
+
+// RuleSet is the ordered rules of one direction. The first matching rule
+// decides; a post that matches no rule takes the Default action, which is
+// ActionForward when empty. A set read from a file evaluates the built-in
+// rules of its direction first unless Builtin is false.
+type RuleSet struct {
+	Builtin *bool  `yaml:"builtin,omitempty"`
+	Default string `yaml:"default,omitempty"`
+	Rules   []Rule `yaml:"rules"`
+
+	builtin *RuleSet
+}
+
+// Rules holds the rule sets of both directions. A nil set keeps the built-in
+// rules of its direction.
+type Rules struct {
+	Note2Tweet *RuleSet `yaml:"note2tweet,omitempty"`
+	Tweet2Note *RuleSet `yaml:"tweet2note,omitempty"`
+}
+
+// Decision is the result of evaluating a post.
+type Decision struct {
+	// Rule is the name of the matching rule, or DefaultRuleName when no rule
+	// matched. It is empty when a post matched no rule and is forwarded.
+	Rule      string
+	Skip      bool
+	Overrides Overrides
+}
+
+// DefaultNote2Tweet returns the built-in rules for notes: only public notes
+// that are not local-only and do not start with "RT @" are posted.
+func DefaultNote2Tweet() *RuleSet {
+	set := &RuleSet{Rules: []Rule{
+		{Name: "not_public", Match: Match{otherVisibility: []string{"public"}}, Action: ActionSkip},
+		{Name: "local_only", Match: Match{LocalOnly: boolPtr(true)}, Action: ActionSkip},
+		{Name: "rt_pattern", Match: Match{Regex: `^RT\s*@`}, Action: ActionSkip},
+	}}
+	mustCompile(set)
+	return set
+}
+
+// DefaultTweet2Note returns the built-in rules for tweets: tweets starting
+// with "RN [at]", which the connector itself posts, are skipped.
+func DefaultTweet2Note() *RuleSet {
+	set := &RuleSet{Rules: []Rule{
+		{Name: "rn_pattern", Match: Match{Regex: `^RN\s*\[at\]`}, Action: ActionSkip},
+	}}
+	mustCompile(set)
+	return set
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func mustCompile(set *RuleSet) {
+	if err := set.compile(); err != nil {
+		panic(err)
+	}
+}
+
+// Load reads the rules from a YAML file.
+func Load(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, fmt.Errorf("read filter rules: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates YAML rules.
+func Parse(data []byte) (Rules, error) {
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return Rules{}, fmt.Errorf("parse filter rules: %w", err)
+	}
+	for direction, set := range map[string]*RuleSet{"note2tweet": rules.Note2Tweet, "tweet2note": rules.Tweet2Note} {
+		if set == nil {
+			continue
+		}
+		if err := set.compile(); err != nil {
+			return Rules{}, fmt.Errorf("%s: %w", direction, err)
+		}
+	}
+	if set := rules.Note2Tweet; set != nil && (set.Builtin == nil || *set.Builtin) {
+		set.builtin = DefaultNote2Tweet()
+	}
+	if set := rules.Tweet2Note; set != nil && (set.Builtin == nil || *set.Builtin) {
+		set.builtin = DefaultTweet2Note()
+	}
+	return rules, nil
+}
+
+// compile validates the set and compiles its regular expressions.
+func (s *RuleSet) compile() error {
+	switch s.Default {
+	case "", ActionForward, ActionSkip:
+	default:
+		return fmt.Errorf("default must be %s or %s", ActionForward, ActionSkip)
+	}
+
+	names := map[string]bool{}
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if !ruleNamePattern.MatchString(rule.Name) {
+			return fmt.Errorf("rule name %q must match %s", rule.Name, ruleNamePattern)
+		}
+		if names[rule.Name] || rule.Name == DefaultRuleName {
+			return fmt.Errorf("rule name %q is used more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Action {
+		case ActionSkip:
+			if rule.Overrides != (Overrides{}) {
+				return fmt.Errorf("rule %q: overrides need the %s action", rule.Name, ActionForward)
+			}
+		case ActionForward:
+		default:
+			return fmt.Errorf("rule %q: action must be %s or %s", rule.Name, ActionForward, ActionSkip)
+		}
+
+		if rule.Match.Regex != "" {
+			regex, err := regexp.Compile(rule.Match.Regex)
+			if err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			rule.Match.regex = regex
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the decision of the first rule that matches post. The
+// built-in rules, which only skip, are evaluated before the set's own rules.
+func (s *RuleSet) Evaluate(post Post) Decision {
+	if s.builtin != nil {
+		if decision := s.builtin.Evaluate(post); decision.Skip {
+			return decision
+		}
+	}
+	for _, rule := range s.Rules {
+		if !rule.Match.matches(post) {
+			continue
+		}
+		if rule.Action == ActionSkip {
+			return Decision{Rule: rule.Name, Skip: true}
+		}
+		return Decision{Rule: rule.Name, Overrides: rule.Overrides}
+	}
+	if s.Default == ActionSkip {
+		return Decision{Rule: DefaultRuleName, Skip: true}
+	}
+	return Decision{}
+}
+
+func (m Match) matches(post Post) bool {
+	if len(m.Hashtags) > 0 && !slices.ContainsFunc(m.Hashtags, func(tag string) bool {
+		return slices.ContainsFunc(post.Hashtags, func(postTag string) bool {
+			return strings.EqualFold(strings.TrimPrefix(tag, "#"), strings.TrimPrefix(postTag, "#"))
+		})
+	}) {
+		return false
+	}
+	if m.regex != nil && !m.regex.MatchString(post.Text) {
+		return false
+	}
+	if len(m.Visibility) > 0 && !slices.Contains(m.Visibility, post.Visibility) {
+		return false
+	}
+	if len(m.otherVisibility) > 0 && slices.Contains(m.otherVisibility, post.Visibility) {
+		return false
+	}
+	if m.LocalOnly != nil && *m.LocalOnly != post.LocalOnly {
+		return false
+	}
+	if m.CW != nil && *m.CW != post.CW {
+		return false
+	}
+	if m.Media != nil && *m.Media != post.HasMedia {
+		return false
+	}
+	if len(m.Channels) > 0 && !slices.Contains(m.Channels, post.ChannelID) {
+		return false
+	}
+	return true
+}
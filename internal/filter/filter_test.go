@@ -0,0 +1,201 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAndEvaluate(t *testing.T) {
+	rules, err := Parse([]byte(`
+note2tweet:
+  rules:
+    - name: nsfw
+      match:
+        hashtags: ["#NSFW"]
+        media: true
+      action: skip
+    - name: channel
+      match:
+        channels: [chan1]
+      action: forward
+      overrides:
+        long_note_policy: thread
+    - name: quiet
+      match:
+        regex: "(?i)^\\[quiet\\]"
+        cw: false
+      action: skip
+  default: forward
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if rules.Tweet2Note != nil {
+		t.Fatalf("Tweet2Note = %+v, want nil to keep the built-in rules", rules.Tweet2Note)
+	}
+
+	tests := []struct {
+		name string
+		post Post
+		want Decision
+	}{
+		{
+			name: "hashtag without media",
+			post: Post{Text: "hi", Visibility: "public", Hashtags: []string{"nsfw"}},
+			want: Decision{},
+		},
+		{
+			name: "hashtag with media",
+			post: Post{Text: "hi", Visibility: "public", Hashtags: []string{"nsfw"}, HasMedia: true},
+			want: Decision{Rule: "nsfw", Skip: true},
+		},
+		{
+			name: "channel",
+			post: Post{Text: "[quiet] hi", Visibility: "public", ChannelID: "chan1"},
+			want: Decision{Rule: "channel", Overrides: Overrides{LongNotePolicy: "thread"}},
+		},
+		{
+			name: "regex",
+			post: Post{Text: "[QUIET] hi", Visibility: "public"},
+			want: Decision{Rule: "quiet", Skip: true},
+		},
+		{
+			name: "regex with cw",
+			post: Post{Text: "[quiet] hi", Visibility: "public", CW: true},
+			want: Decision{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Note2Tweet.Evaluate(tt.post); got != tt.want {
+				t.Fatalf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateDefaultSkip(t *testing.T) {
+	rules, err := Parse([]byte(`
+tweet2note:
+  default: skip
+  rules:
+    - name: tagged
+      match:
+        hashtags: [misskey]
+      action: forward
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := rules.Tweet2Note.Evaluate(Post{Text: "hi"}); got != (Decision{Rule: DefaultRuleName, Skip: true}) {
+		t.Fatalf("Evaluate() = %+v, want the default skip", got)
+	}
+	if got := rules.Tweet2Note.Evaluate(Post{Text: "hi", Hashtags: []string{"Misskey"}}); got.Skip || got.Rule != "tagged" {
+		t.Fatalf("Evaluate() = %+v, want tagged", got)
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	note2tweet := DefaultNote2Tweet()
+	for _, tt := range []struct {
+		post Post
+		rule string
+	}{
+		{Post{Text: "hi", Visibility: "public"}, ""},
+		{Post{Text: "hi", Visibility: "followers"}, "not_public"},
+		{Post{Text: "hi", Visibility: ""}, "not_public"},
+		{Post{Text: "hi", Visibility: "unlisted"}, "not_public"},
+		{Post{Text: "hi", Visibility: "public", LocalOnly: true}, "local_only"},
+		{Post{Text: "RT @someone hi", Visibility: "public"}, "rt_pattern"},
+	} {
+		if got := note2tweet.Evaluate(tt.post); got.Rule != tt.rule {
+			t.Fatalf("Evaluate(%+v) rule = %q, want %q", tt.post, got.Rule, tt.rule)
+		}
+	}
+
+	if got := DefaultTweet2Note().Evaluate(Post{Text: "RN [at]someone hi", Visibility: "public"}); got.Rule != "rn_pattern" || !got.Skip {
+		t.Fatalf("Evaluate() = %+v, want rn_pattern", got)
+	}
+}
+
+func TestParseEvaluatesBuiltinRulesFirst(t *testing.T) {
+	rules, err := Parse([]byte(`
+note2tweet:
+  rules:
+    - name: everything
+      match: {}
+      action: forward
+tweet2note:
+  builtin: false
+  rules: []
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := rules.Note2Tweet.Evaluate(Post{Text: "hi", Visibility: "followers"}); got.Rule != "not_public" || !got.Skip {
+		t.Fatalf("Evaluate(followers) = %+v, want the built-in not_public rule", got)
+	}
+	if got := rules.Note2Tweet.Evaluate(Post{Text: "hi", Visibility: "public"}); got.Rule != "everything" || got.Skip {
+		t.Fatalf("Evaluate(public) = %+v, want everything", got)
+	}
+	if got := rules.Tweet2Note.Evaluate(Post{Text: "RN [at]someone hi", Visibility: "public"}); got.Skip {
+		t.Fatalf("Evaluate() = %+v, want builtin: false to drop rn_pattern", got)
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			content: "note2tweet:\n  rules:\n    - name: a\n      match:\n        hashtag: [x]\n      action: skip\n",
+			wantErr: "hashtag",
+		},
+		{
+			name:    "bad action",
+			content: "note2tweet:\n  rules:\n    - name: a\n      action: drop\n",
+			wantErr: "action must be",
+		},
+		{
+			name:    "duplicate name",
+			content: "tweet2note:\n  rules:\n    - name: a\n      action: skip\n    - name: a\n      action: skip\n",
+			wantErr: "more than once",
+		},
+		{
+			name:    "reserved name",
+			content: "tweet2note:\n  rules:\n    - name: default\n      action: skip\n",
+			wantErr: "more than once",
+		},
+		{
+			name:    "invalid name",
+			content: "tweet2note:\n  rules:\n    - name: Bad Name\n      action: skip\n",
+			wantErr: "must match",
+		},
+		{
+			name:    "overrides on skip",
+			content: "note2tweet:\n  rules:\n    - name: a\n      action: skip\n      overrides:\n        cw_policy: full\n",
+			wantErr: "overrides need",
+		},
+		{
+			name:    "invalid regex",
+			content: "note2tweet:\n  rules:\n    - name: a\n      match:\n        regex: \"(\"\n      action: skip\n",
+			wantErr: "note2tweet: rule \"a\"",
+		},
+		{
+			name:    "bad default",
+			content: "note2tweet:\n  default: drop\n  rules: []\n",
+			wantErr: "default must be",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
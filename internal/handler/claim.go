@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+// postClaim is the tracker claim a handler holds on a source post while it is
+// cross-posted, so that a concurrent delivery of the same post waits instead
+// of posting it twice.
+type postClaim struct {
+	tracker   tracker.CrossPostTracker
+	direction string
+	sourceID  string
+	done      bool
+}
+
+// claimPost takes the claim of a source post. The caller must defer release.
+// It returns tracker.ErrClaimed when another worker is posting it.
+func claimPost(ctx context.Context, crossPostTracker tracker.CrossPostTracker, direction, sourceID string) (*postClaim, error) {
+	if err := crossPostTracker.Claim(ctx, direction, sourceID); err != nil {
+		return nil, err
+	}
+	return &postClaim{tracker: crossPostTracker, direction: direction, sourceID: sourceID}, nil
+}
+
+// staleClaim reports whether err is a claim held for longer than lease, and
+// the claim. Such a claim was left by a worker that crashed or could not
+// record its post.
+func staleClaim(err error, lease time.Duration) (tracker.Claim, bool) {
+	var claimedErr *tracker.ClaimedError
+	if lease <= 0 || !errors.As(err, &claimedErr) {
+		return tracker.Claim{}, false
+	}
+	claimedAt := claimedErr.Claim.ClaimedAt
+	return claimedErr.Claim, !claimedAt.IsZero() && time.Since(claimedAt) > lease
+}
+
+// complete drops the claim once the cross-post is recorded.
+func (c *postClaim) complete(ctx context.Context) {
+	c.done = true
+	if err := c.tracker.CompleteClaim(context.WithoutCancel(ctx), c.direction, c.sourceID); err != nil {
+		slog.Error("Failed to complete cross-post claim",
+			slog.String("direction", c.direction),
+			slog.String("source_id", c.sourceID),
+			slog.Any("error", err))
+	}
+}
+
+// keep leaves the claim in place when the post may exist but could not be
+// recorded. Later deliveries are retried until the claim outlives the lease
+// or an operator resolves it.
+func (c *postClaim) keep() {
+	if c.done {
+		return
+	}
+	c.done = true
+	slog.Warn("Keeping cross-post claim of a post that may exist without a record",
+		slog.String("direction", c.direction),
+		slog.String("source_id", c.sourceID))
+}
+
+// release drops the claim unless it was completed or kept, so that a later
+// delivery can post it.
+func (c *postClaim) release(ctx context.Context) {
+	if c.done {
+		return
+	}
+	c.done = true
+	if err := c.tracker.ReleaseClaim(context.WithoutCancel(ctx), c.direction, c.sourceID); err != nil {
+		slog.Error("Failed to release cross-post claim",
+			slog.String("direction", c.direction),
+			slog.String("source_id", c.sourceID),
+			slog.Any("error", err))
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+func TestNote2TweetHandler_ClaimsNote(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+
+	payload := []byte(`{"server":"https://misskey.example","body":{"note":{"id":"note-1","text":"Public note","visibility":"public"}}}`)
+	tests := []struct {
+		name       string
+		held       bool
+		tweetID    string
+		postErr    error
+		wantPosted bool
+		wantClaim  bool
+	}{
+		{name: "held by another worker", held: true, wantClaim: true},
+		{name: "post failed", postErr: &twitter.APIError{Operation: "POST request", StatusCode: 503}, wantPosted: true},
+		{name: "posted without id", wantPosted: true, wantClaim: true},
+		{name: "posted", tweetID: "tweet-1", wantPosted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+			if tt.held {
+				if err := crossPostTracker.Claim(ctx, tracker.DirectionMisskeyToTweet, "note-1"); err != nil {
+					t.Fatalf("Claim() error = %v", err)
+				}
+			}
+			posted := false
+			postTweet = func(ctx context.Context, text string) (string, error) {
+				posted = true
+				return tt.tweetID, tt.postErr
+			}
+
+			err := Note2TweetHandler(ctx, payload, crossPostTracker, m)
+			if tt.held && !errors.Is(err, tracker.ErrClaimed) {
+				t.Fatalf("Note2TweetHandler() error = %v, want %v", err, tracker.ErrClaimed)
+			}
+			if posted != tt.wantPosted {
+				t.Fatalf("posted = %v, want %v", posted, tt.wantPosted)
+			}
+			claims, err := crossPostTracker.ListClaims(ctx)
+			if err != nil {
+				t.Fatalf("ListClaims() error = %v", err)
+			}
+			if got := len(claims) == 1; got != tt.wantClaim {
+				t.Fatalf("ListClaims() = %+v, want claim held = %v", claims, tt.wantClaim)
+			}
+		})
+	}
+}
+
+func TestHandleIncomingTweet_ClaimsTweet(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() { createMisskeyNoteWithOptions = oldCreate }()
+
+	tweet := IncomingTweet{ID: "123", Text: "hello", Username: "dummy_user", URL: "https://twitter.com/dummy_user/status/123"}
+	tests := []struct {
+		name       string
+		held       bool
+		noteID     string
+		createErr  error
+		wantPosted bool
+		wantClaim  bool
+	}{
+		{name: "held by another worker", held: true, wantClaim: true},
+		{name: "post failed", createErr: &misskey.APIError{Operation: "create note", StatusCode: 503}, wantPosted: true},
+		{name: "posted without id", wantPosted: true, wantClaim: true},
+		{name: "posted", noteID: "note-1", wantPosted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+			if tt.held {
+				if err := crossPostTracker.Claim(ctx, tracker.DirectionTweetToMisskey, tweet.ID); err != nil {
+					t.Fatalf("Claim() error = %v", err)
+				}
+			}
+			posted := false
+			createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+				posted = true
+				return tt.noteID, tt.createErr
+			}
+
+			err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m)
+			if tt.held && !errors.Is(err, tracker.ErrClaimed) {
+				t.Fatalf("HandleIncomingTweet() error = %v, want %v", err, tracker.ErrClaimed)
+			}
+			if posted != tt.wantPosted {
+				t.Fatalf("posted = %v, want %v", posted, tt.wantPosted)
+			}
+			claims, err := crossPostTracker.ListClaims(ctx)
+			if err != nil {
+				t.Fatalf("ListClaims() error = %v", err)
+			}
+			if got := len(claims) == 1; got != tt.wantClaim {
+				t.Fatalf("ListClaims() = %+v, want claim held = %v", claims, tt.wantClaim)
+			}
+		})
+	}
+}
+
+func TestNote2TweetHandler_FailsClaimOutlivingLease(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+	postTweet = func(ctx context.Context, text string) (string, error) {
+		t.Fatal("PostTweet should not be called for a claimed note")
+		return "", nil
+	}
+
+	payload := []byte(`{"server":"https://misskey.example","body":{"note":{"id":"note-1","text":"Public note","visibility":"public"}}}`)
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	if err := crossPostTracker.Claim(ctx, tracker.DirectionMisskeyToTweet, "note-1"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	err := Note2TweetHandlerWithConfig(ctx, Config{ClaimLease: time.Hour}, payload, crossPostTracker, m)
+	if !errors.Is(err, tracker.ErrClaimed) || IsPermanent(err) {
+		t.Fatalf("Note2TweetHandlerWithConfig() error = %v, want a retryable claim error within the lease", err)
+	}
+	err = Note2TweetHandlerWithConfig(ctx, Config{ClaimLease: time.Nanosecond}, payload, crossPostTracker, m)
+	if !errors.Is(err, errStaleClaim) || !IsPermanent(err) {
+		t.Fatalf("Note2TweetHandlerWithConfig() error = %v, want a permanent stale claim error", err)
+	}
+	if claims, err := crossPostTracker.ListClaims(ctx); err != nil || len(claims) != 1 {
+		t.Fatalf("ListClaims() = %+v, %v; want the stale claim kept for the operator", claims, err)
+	}
+}
+
+// racingTracker records the cross-post of another worker right before a claim
+// is taken, as if that worker completed its claim between the tracker check
+// and the claim.
+type racingTracker struct {
+	tracker.CrossPostTracker
+}
+
+func (t racingTracker) Claim(ctx context.Context, direction, sourceID string) error {
+	var err error
+	if direction == tracker.DirectionMisskeyToTweet {
+		err = t.RememberMisskeyToTweet(ctx, sourceID, "tweet-other")
+	} else {
+		err = t.RememberTweetToMisskey(ctx, sourceID, "note-other")
+	}
+	if err != nil {
+		return err
+	}
+	return t.CrossPostTracker.Claim(ctx, direction, sourceID)
+}
+
+func TestHandlers_SkipPostCompletedBeforeClaim(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldPost := postTweet
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() {
+		postTweet = oldPost
+		createMisskeyNoteWithOptions = oldCreate
+	}()
+	postTweet = func(ctx context.Context, text string) (string, error) {
+		t.Fatal("PostTweet should not be called for a note posted by another worker")
+		return "", nil
+	}
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		t.Fatal("CreateNote should not be called for a tweet posted by another worker")
+		return "", nil
+	}
+
+	crossPostTracker := racingTracker{tracker.NewCrossPostTracker(ctx, time.Hour)}
+	payload := []byte(`{"server":"https://misskey.example","body":{"note":{"id":"note-1","text":"Public note","visibility":"public"}}}`)
+	if err := Note2TweetHandler(ctx, payload, crossPostTracker, m); err != nil {
+		t.Fatalf("Note2TweetHandler() error = %v", err)
+	}
+	tweet := IncomingTweet{ID: "123", Text: "hello", Username: "dummy_user", URL: "https://twitter.com/dummy_user/status/123"}
+	if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+		t.Fatalf("HandleIncomingTweet() error = %v", err)
+	}
+	if claims, err := crossPostTracker.ListClaims(ctx); err != nil || len(claims) != 0 {
+		t.Fatalf("ListClaims() = %+v, %v; want both claims released", claims, err)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Soli0222/note-tweet-connector/internal/mfm"
+)
+
+const (
+	// CWPolicyMask posts the CW, the note text masked with "○" and the note URL.
+	CWPolicyMask = "mask"
+	// CWPolicyLink posts the CW and the note URL without attachments.
+	CWPolicyLink = "link"
+	// CWPolicySkip drops notes with a CW.
+	CWPolicySkip = "skip"
+	// CWPolicyFull posts the full note text prefixed with the CW.
+	CWPolicyFull = "full"
+)
+
+const cwMask = "○"
+
+// CWPolicies lists the accepted values for Config.CWPolicy and
+// Config.CWMediaPolicy.
+func CWPolicies() []string {
+	return []string{
+		CWPolicyMask,
+		CWPolicyLink,
+		CWPolicySkip,
+		CWPolicyFull,
+	}
+}
+
+// cwPolicy returns the policy for a CW note. CWMediaPolicy applies to notes
+// with files and falls back to CWPolicy, which defaults to CWPolicyMask.
+func cwPolicy(cfg Config, hasFiles bool) string {
+	if hasFiles && cfg.CWMediaPolicy != "" {
+		return cfg.CWMediaPolicy
+	}
+	if cfg.CWPolicy != "" {
+		return cfg.CWPolicy
+	}
+	return CWPolicyMask
+}
+
+// cwTweetText builds the tweet text for a note with a CW. It is not called for
+// CWPolicySkip. The mask has one circle per character of the text as rendered
+// by mfmOptions, so that MFM markup does not lengthen it.
+func cwTweetText(policy, cw, text, noteURI string, mfmOptions mfm.Options) string {
+	switch policy {
+	case CWPolicyLink:
+		return cw + "\n" + noteURI
+	case CWPolicyFull:
+		if text == "" {
+			return cw
+		}
+		return cw + "\n\n" + text
+	default:
+		circles := strings.Repeat(cwMask, utf8.RuneCountInString(mfm.ToPlainText(text, mfmOptions)))
+		return cw + "\n" + circles + "\n" + noteURI
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+var deleteTweetWithConfig = twitter.DeleteWithConfig
+var deletedTweetIDsWithConfig = twitter.DeletedTweetIDsWithConfig
+var misskeyNoteExists = misskey.NoteExists
+
+// deletionSyncCursor holds the creation time and Misskey note ID of the last
+// record checked by SyncDeletions, so that a capped sync resumes after it.
+const deletionSyncCursor = "deletion_sync_last_checked"
+
+// SyncDeletions checks the tracked cross-posts created since the given time
+// and deletes the counterpart of any post that was deleted on one side.
+// Handled records are marked as deleted rather than removed, so a late
+// webhook for them is still skipped as a duplicate. At most limit records are
+// checked per call, continuing after the ones checked last; a non-positive
+// limit checks every record. The sync stops early once Twitter or Misskey
+// rate-limits it.
+func SyncDeletions(ctx context.Context, cfg Config, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics, since time.Time, limit int) error {
+	records, err := crossPostTracker.ListActive(ctx, since)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	cursor, err := crossPostTracker.LoadCursor(ctx, deletionSyncCursor)
+	if err != nil {
+		return err
+	}
+	records = deletionSyncBatch(records, cursor, limit)
+
+	tweetIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		tweetIDs = append(tweetIDs, record.TweetID)
+	}
+	deletedTweetIDs, err := deletedTweetIDsWithConfig(ctx, cfg.Twitter, tweetIDs)
+	if err != nil {
+		return err
+	}
+	tweetDeleted := make(map[string]bool, len(deletedTweetIDs))
+	for _, tweetID := range deletedTweetIDs {
+		tweetDeleted[tweetID] = true
+	}
+
+	var errs []error
+	checked := ""
+	for _, record := range records {
+		exists, err := misskeyNoteExists(ctx, cfg.MisskeyHost, cfg.MisskeyToken, record.MisskeyNoteID)
+		if err == nil {
+			err = syncRecordDeletion(ctx, cfg, crossPostTracker, m, record, !exists, tweetDeleted[record.TweetID])
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if deletionSyncRateLimited(err) {
+				break
+			}
+		}
+		checked = deletionSyncPosition(record)
+	}
+	if checked != "" {
+		if err := crossPostTracker.SaveCursor(ctx, deletionSyncCursor, checked); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deletionSyncBatch returns up to limit records in creation order, starting
+// after the position in cursor and wrapping around to the oldest record.
+func deletionSyncBatch(records []tracker.CrossPostRecord, cursor string, limit int) []tracker.CrossPostRecord {
+	records = slices.Clone(records)
+	slices.SortFunc(records, compareDeletionSyncPosition)
+	if limit <= 0 || len(records) <= limit {
+		return records
+	}
+
+	start := 0
+	if unixNano, noteID, ok := strings.Cut(cursor, " "); ok {
+		if nanos, err := strconv.ParseInt(unixNano, 10, 64); err == nil {
+			last := tracker.CrossPostRecord{CreatedAt: time.Unix(0, nanos), MisskeyNoteID: noteID}
+			start = sort.Search(len(records), func(i int) bool {
+				return compareDeletionSyncPosition(records[i], last) > 0
+			}) % len(records)
+		}
+	}
+	batch := make([]tracker.CrossPostRecord, 0, limit)
+	for i := 0; i < limit; i++ {
+		batch = append(batch, records[(start+i)%len(records)])
+	}
+	return batch
+}
+
+func compareDeletionSyncPosition(a, b tracker.CrossPostRecord) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.MisskeyNoteID, b.MisskeyNoteID)
+}
+
+func deletionSyncPosition(record tracker.CrossPostRecord) string {
+	return strconv.FormatInt(record.CreatedAt.UnixNano(), 10) + " " + record.MisskeyNoteID
+}
+
+// deletionSyncRateLimited reports whether err means that Twitter's rate limit
+// budget is exhausted or that Misskey rate-limited the sync.
+func deletionSyncRateLimited(err error) bool {
+	if _, ok := DeferUntil(err); ok {
+		return true
+	}
+	var misskeyErr *misskey.APIError
+	return errors.As(err, &misskeyErr) && misskeyErr.StatusCode == http.StatusTooManyRequests
+}
+
+func syncRecordDeletion(ctx context.Context, cfg Config, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics, record tracker.CrossPostRecord, noteDeleted, tweetDeleted bool) error {
+	switch {
+	case noteDeleted && tweetDeleted:
+	case noteDeleted:
+		// スレッドは返信側から削除する
+		tweetIDs := append([]string{record.TweetID}, record.ThreadTweetIDs...)
+		for i := len(tweetIDs) - 1; i >= 0; i-- {
+			if err := deleteTweetWithConfig(ctx, cfg.Twitter, tweetIDs[i]); err != nil {
+				slog.Error("Failed to delete tweet for deleted note",
+					slog.String("note_id", record.MisskeyNoteID),
+					slog.String("tweet_id", tweetIDs[i]),
+					slog.Any("error", err))
+				return err
+			}
+		}
+		m.DeletionsPropagated.WithLabelValues("note2tweet").Inc()
+		slog.Info("Deleted tweet for deleted note",
+			slog.String("note_id", record.MisskeyNoteID),
+			slog.String("tweet_id", record.TweetID))
+	case tweetDeleted:
+		if err := deleteMisskeyNote(ctx, cfg.MisskeyHost, cfg.MisskeyToken, record.MisskeyNoteID); err != nil {
+			slog.Error("Failed to delete note for deleted tweet",
+				slog.String("tweet_id", record.TweetID),
+				slog.String("note_id", record.MisskeyNoteID),
+				slog.Any("error", err))
+			notifyMisskeyFailure(ctx, cfg, "delete note", record.TweetID, err, -1)
+			return err
+		}
+		m.DeletionsPropagated.WithLabelValues("tweet2note").Inc()
+		slog.Info("Deleted note for deleted tweet",
+			slog.String("tweet_id", record.TweetID),
+			slog.String("note_id", record.MisskeyNoteID))
+	default:
+		return nil
+	}
+	return crossPostTracker.MarkDeleted(ctx, record.MisskeyNoteID, time.Now())
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSyncDeletions(t *testing.T) {
+	ctx := context.Background()
+
+	oldDeleteTweet := deleteTweetWithConfig
+	oldDeletedTweetIDs := deletedTweetIDsWithConfig
+	oldNoteExists := misskeyNoteExists
+	oldDeleteNote := deleteMisskeyNote
+	defer func() {
+		deleteTweetWithConfig = oldDeleteTweet
+		deletedTweetIDsWithConfig = oldDeletedTweetIDs
+		misskeyNoteExists = oldNoteExists
+		deleteMisskeyNote = oldDeleteNote
+	}()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+	// note-1: deleted on Misskey, posted as a thread.
+	if err := crossPostTracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-1b"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	// note-2: its tweet was deleted.
+	if err := crossPostTracker.RememberTweetToMisskey(ctx, "tweet-2", "note-2"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() error = %v", err)
+	}
+	// note-3: still on both sides.
+	if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-3", "tweet-3"); err != nil {
+		t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+	}
+	// note-4: deleted on both sides.
+	if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-4", "tweet-4"); err != nil {
+		t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+	}
+
+	var calls []string
+	deletedTweetIDsWithConfig = func(ctx context.Context, cfg twitter.Config, tweetIDs []string) ([]string, error) {
+		return []string{"tweet-2", "tweet-4"}, nil
+	}
+	misskeyNoteExists = func(ctx context.Context, host, token, noteID string) (bool, error) {
+		return noteID == "note-2" || noteID == "note-3", nil
+	}
+	deleteTweetWithConfig = func(ctx context.Context, cfg twitter.Config, tweetID string) error {
+		calls = append(calls, "delete tweet:"+tweetID)
+		return nil
+	}
+	deleteMisskeyNote = func(ctx context.Context, host, token, noteID string) error {
+		calls = append(calls, "delete note:"+noteID)
+		return nil
+	}
+
+	if err := SyncDeletions(ctx, testHandlerConfig(), crossPostTracker, m, time.Now().Add(-time.Hour), 0); err != nil {
+		t.Fatalf("SyncDeletions() error = %v", err)
+	}
+
+	sort.Strings(calls)
+	want := []string{"delete note:note-2", "delete tweet:tweet-1", "delete tweet:tweet-1b"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %#v, want %#v", calls, want)
+	}
+	if got := testutil.ToFloat64(m.DeletionsPropagated.WithLabelValues("note2tweet")); got != 1 {
+		t.Fatalf("note2tweet deletions = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.DeletionsPropagated.WithLabelValues("tweet2note")); got != 1 {
+		t.Fatalf("tweet2note deletions = %v, want 1", got)
+	}
+
+	active, err := crossPostTracker.ListActive(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(active) != 1 || active[0].MisskeyNoteID != "note-3" {
+		t.Fatalf("ListActive() = %#v, %v; want note-3 only", active, err)
+	}
+	if ok, _ := crossPostTracker.HasMisskeyNote(ctx, "note-1"); !ok {
+		t.Fatal("deleted record was removed, want it kept to skip late webhooks")
+	}
+}
+
+func TestSyncDeletions_KeepsTweetWhenNoteLookupFails(t *testing.T) {
+	ctx := context.Background()
+
+	oldDeleteTweet := deleteTweetWithConfig
+	oldDeletedTweetIDs := deletedTweetIDsWithConfig
+	oldNoteExists := misskeyNoteExists
+	defer func() {
+		deleteTweetWithConfig = oldDeleteTweet
+		deletedTweetIDsWithConfig = oldDeletedTweetIDs
+		misskeyNoteExists = oldNoteExists
+	}()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-1", "tweet-1"); err != nil {
+		t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+	}
+
+	deletedTweetIDsWithConfig = func(ctx context.Context, cfg twitter.Config, tweetIDs []string) ([]string, error) {
+		return nil, nil
+	}
+	// A proxy in front of Misskey answers 404 without the NO_SUCH_NOTE body.
+	misskeyNoteExists = func(ctx context.Context, host, token, noteID string) (bool, error) {
+		return false, &misskey.APIError{Operation: "show note", StatusCode: 404, BodyPreview: "<html>Not Found</html>"}
+	}
+	deleted := false
+	deleteTweetWithConfig = func(ctx context.Context, cfg twitter.Config, tweetID string) error {
+		deleted = true
+		return nil
+	}
+
+	if err := SyncDeletions(ctx, testHandlerConfig(), crossPostTracker, metrics.NewNoop(), time.Now().Add(-time.Hour), 0); err == nil {
+		t.Fatal("SyncDeletions() error = nil, want the lookup failure")
+	}
+	if deleted {
+		t.Fatal("tweet was deleted, want nothing deleted for a bare 404")
+	}
+	active, err := crossPostTracker.ListActive(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(active) != 1 {
+		t.Fatalf("ListActive() = %#v, %v; want the record kept", active, err)
+	}
+}
+
+func TestSyncDeletions_KeepsRecordWhenDeleteFails(t *testing.T) {
+	ctx := context.Background()
+
+	oldDeleteTweet := deleteTweetWithConfig
+	oldDeletedTweetIDs := deletedTweetIDsWithConfig
+	oldNoteExists := misskeyNoteExists
+	defer func() {
+		deleteTweetWithConfig = oldDeleteTweet
+		deletedTweetIDsWithConfig = oldDeletedTweetIDs
+		misskeyNoteExists = oldNoteExists
+	}()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-1", "tweet-1"); err != nil {
+		t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+	}
+
+	deletedTweetIDsWithConfig = func(ctx context.Context, cfg twitter.Config, tweetIDs []string) ([]string, error) {
+		return nil, nil
+	}
+	misskeyNoteExists = func(ctx context.Context, host, token, noteID string) (bool, error) {
+		return false, nil
+	}
+	deleteTweetWithConfig = func(ctx context.Context, cfg twitter.Config, tweetID string) error {
+		return &twitter.APIError{Operation: "DELETE request", StatusCode: 503}
+	}
+
+	if err := SyncDeletions(ctx, testHandlerConfig(), crossPostTracker, metrics.NewNoop(), time.Now().Add(-time.Hour), 0); err == nil {
+		t.Fatal("SyncDeletions() error = nil, want delete failure")
+	}
+	active, err := crossPostTracker.ListActive(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(active) != 1 {
+		t.Fatalf("ListActive() = %#v, %v; want record retried on the next run", active, err)
+	}
+}
+
+func TestSyncDeletions_ChecksLimitedBatchInTurn(t *testing.T) {
+	ctx := context.Background()
+
+	oldDeletedTweetIDs := deletedTweetIDsWithConfig
+	oldNoteExists := misskeyNoteExists
+	defer func() {
+		deletedTweetIDsWithConfig = oldDeletedTweetIDs
+		misskeyNoteExists = oldNoteExists
+	}()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-"+id, "tweet-"+id); err != nil {
+			t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+		}
+	}
+
+	var lookedUp [][]string
+	var checked []string
+	deletedTweetIDsWithConfig = func(ctx context.Context, cfg twitter.Config, tweetIDs []string) ([]string, error) {
+		lookedUp = append(lookedUp, tweetIDs)
+		return nil, nil
+	}
+	misskeyNoteExists = func(ctx context.Context, host, token, noteID string) (bool, error) {
+		checked = append(checked, noteID)
+		return true, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := SyncDeletions(ctx, testHandlerConfig(), crossPostTracker, metrics.NewNoop(), time.Now().Add(-time.Hour), 2); err != nil {
+			t.Fatalf("SyncDeletions() error = %v", err)
+		}
+	}
+	if want := []string{"note-a", "note-b", "note-c", "note-a"}; !reflect.DeepEqual(checked, want) {
+		t.Fatalf("checked notes = %v, want %v", checked, want)
+	}
+	if want := [][]string{{"tweet-a", "tweet-b"}, {"tweet-c", "tweet-a"}}; !reflect.DeepEqual(lookedUp, want) {
+		t.Fatalf("looked up tweets = %v, want %v", lookedUp, want)
+	}
+}
+
+func TestSyncDeletions_StopsWhenRateLimited(t *testing.T) {
+	ctx := context.Background()
+
+	oldDeleteTweet := deleteTweetWithConfig
+	oldDeletedTweetIDs := deletedTweetIDsWithConfig
+	oldNoteExists := misskeyNoteExists
+	defer func() {
+		deleteTweetWithConfig = oldDeleteTweet
+		deletedTweetIDsWithConfig = oldDeletedTweetIDs
+		misskeyNoteExists = oldNoteExists
+	}()
+
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	for _, id := range []string{"a", "b"} {
+		if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-"+id, "tweet-"+id); err != nil {
+			t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+		}
+	}
+
+	resetAt := time.Now().Add(15 * time.Minute)
+	var deleted []string
+	deletedTweetIDsWithConfig = func(ctx context.Context, cfg twitter.Config, tweetIDs []string) ([]string, error) {
+		return nil, nil
+	}
+	misskeyNoteExists = func(ctx context.Context, host, token, noteID string) (bool, error) {
+		return false, nil
+	}
+	deleteTweetWithConfig = func(ctx context.Context, cfg twitter.Config, tweetID string) error {
+		deleted = append(deleted, tweetID)
+		return &twitter.RateLimitError{Endpoint: twitter.EndpointDeleteTweet, Window: twitter.WindowEndpoint, Reset: resetAt}
+	}
+
+	for i := 0; i < 2; i++ {
+		err := SyncDeletions(ctx, testHandlerConfig(), crossPostTracker, metrics.NewNoop(), time.Now().Add(-time.Hour), 0)
+		if until, ok := DeferUntil(err); !ok || !until.Equal(resetAt) {
+			t.Fatalf("SyncDeletions() error = %v, want the rate limit until %v", err, resetAt)
+		}
+	}
+	if want := []string{"tweet-a", "tweet-a"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted tweets = %v, want the sync stopped and resumed at tweet-a", deleted)
+	}
+}
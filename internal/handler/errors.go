@@ -1,7 +1,71 @@
 package handler
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+// errMissingID is permanent: the post may exist, so retrying it could post it
+// twice.
+var errMissingID = errors.New("post response did not include id")
 
 func errMissingPostedID(kind string) error {
-	return fmt.Errorf("%s post response did not include id", kind)
+	return fmt.Errorf("%s %w", kind, errMissingID)
+}
+
+// errStaleClaim is permanent: the claim was left by a worker that may have
+// posted without recording it, so only an operator can release it.
+var errStaleClaim = errors.New("cross-post claim outlived its lease")
+
+// IsPermanent reports whether retrying the cross-post that returned err
+// cannot succeed. Malformed payloads, notes that do not fit a tweet, media
+// Twitter does not accept, claims that outlived their lease and 4xx API
+// responses such as duplicate content are permanent. Network errors, 5xx
+// responses, rate limits and expired authorization are not.
+func IsPermanent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return true
+	}
+	if errors.Is(err, errTweetTooLong) || errors.Is(err, errMissingID) || errors.Is(err, errStaleClaim) || errors.Is(err, twitter.ErrMediaLimit) {
+		return true
+	}
+
+	var twitterErr *twitter.APIError
+	if errors.As(err, &twitterErr) {
+		return isPermanentStatus(twitterErr.StatusCode)
+	}
+	var misskeyErr *misskey.APIError
+	if errors.As(err, &misskeyErr) {
+		return isPermanentStatus(misskeyErr.StatusCode)
+	}
+	return false
+}
+
+// DeferUntil reports whether err only means that Twitter does not accept
+// posts until a rate limit resets, and the reset time.
+func DeferUntil(err error) (time.Time, bool) {
+	var rateLimitErr *twitter.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.Reset, true
+	}
+	return time.Time{}, false
+}
+
+func isPermanentStatus(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status >= 400 && status < 500
 }
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+func TestIsPermanent(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "invalid payload", err: syntaxErr, want: true},
+		{name: "tweet too long", err: errTweetTooLong, want: true},
+		{name: "missing id", err: errMissingPostedID("tweet"), want: true},
+		{name: "media limit", err: fmt.Errorf("upload: %w", &twitter.APIError{Operation: "media upload", Command: "validate", Err: fmt.Errorf("wrapped: %w", twitter.ErrMediaLimit)}), want: true},
+		{name: "duplicate content", err: &twitter.APIError{Operation: "post tweet", StatusCode: 403}, want: true},
+		{name: "misskey bad request", err: &misskey.APIError{Operation: "create note", StatusCode: 400}, want: true},
+		{name: "twitter unauthorized", err: &twitter.APIError{Operation: "post tweet", StatusCode: 401}, want: false},
+		{name: "rate limited", err: &twitter.APIError{Operation: "post tweet", StatusCode: 429}, want: false},
+		{name: "server error", err: &twitter.APIError{Operation: "post tweet", StatusCode: 503}, want: false},
+		{name: "misskey server error", err: &misskey.APIError{Operation: "create note", StatusCode: 502}, want: false},
+		{name: "network error", err: &misskey.APIError{Operation: "create note", Err: errors.New("connection refused")}, want: false},
+		{name: "authorization required", err: twitter.ErrAuthorizationRequired, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Fatalf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
+)
+
+var (
+	defaultNote2TweetFilter = filter.DefaultNote2Tweet()
+	defaultTweet2NoteFilter = filter.DefaultTweet2Note()
+)
+
+func note2TweetFilter(cfg Config) *filter.RuleSet {
+	if cfg.Note2TweetFilter != nil {
+		return cfg.Note2TweetFilter
+	}
+	return defaultNote2TweetFilter
+}
+
+func tweet2NoteFilter(cfg Config) *filter.RuleSet {
+	if cfg.Tweet2NoteFilter != nil {
+		return cfg.Tweet2NoteFilter
+	}
+	return defaultTweet2NoteFilter
+}
+
+// NoteFilterPost returns the filter attributes of a Misskey webhook payload.
+func NoteFilterPost(data []byte) (filter.Post, error) {
+	payload, err := parseNotePayload(data)
+	if err != nil {
+		return filter.Post{}, err
+	}
+	return noteFilterPost(payload), nil
+}
+
+func noteFilterPost(payload *payloadNoteData) filter.Post {
+	note := payload.Body.Note
+	return filter.Post{
+		Text:       note.Text,
+		Hashtags:   note.Tags,
+		Visibility: note.Visibility,
+		LocalOnly:  note.LocalOnly,
+		CW:         note.Cw != "",
+		HasMedia:   len(note.Files) > 0,
+		ChannelID:  note.ChannelID,
+	}
+}
+
+// TweetFilterPosts returns the filter attributes of the tweets in a Filtered
+// Stream payload.
+func TweetFilterPosts(data []byte) ([]filter.Post, error) {
+	tweets, err := parseFilteredStreamPayload(data)
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]filter.Post, 0, len(tweets))
+	for _, tweet := range tweets {
+		posts = append(posts, tweetFilterPost(tweet))
+	}
+	return posts, nil
+}
+
+func tweetFilterPost(tweet IncomingTweet) filter.Post {
+	return filter.Post{
+		Text:       tweet.Text,
+		Hashtags:   tweet.Hashtags,
+		Visibility: "public",
+		HasMedia:   len(tweet.MediaURLs) > 0,
+	}
+}
+
+func filteredStreamHashtags(tweet filteredStreamTweet) []string {
+	var tags []string
+	for _, entity := range tweet.Entities.Hashtags {
+		tags = append(tags, entity.Tag)
+	}
+	return tags
+}
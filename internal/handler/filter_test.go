@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testFilterRules(t *testing.T) filter.Rules {
+	t.Helper()
+	rules, err := filter.Parse([]byte(`
+note2tweet:
+  rules:
+    - name: private_tag
+      match:
+        hashtags: [private]
+      action: skip
+    - name: spoilers
+      match:
+        cw: true
+      action: forward
+      overrides:
+        cw_policy: full
+        media: false
+tweet2note:
+  rules:
+    - name: daily
+      match:
+        regex: "^daily:"
+      action: forward
+      overrides:
+        visibility: home
+        cw: 日記
+        media: false
+  default: skip
+`))
+	if err != nil {
+		t.Fatalf("filter.Parse() error = %v", err)
+	}
+	return rules
+}
+
+func TestNote2TweetHandler_FilterRules(t *testing.T) {
+	ctx := context.Background()
+	rules := testFilterRules(t)
+	cfg := Config{Note2TweetFilter: rules.Note2Tweet}
+
+	oldPost := postTweet
+	oldPostWithMedia := postTweetWithMedia
+	defer func() {
+		postTweet = oldPost
+		postTweetWithMedia = oldPostWithMedia
+	}()
+
+	notePayload := func(note map[string]interface{}) []byte {
+		note["id"] = "note-filter"
+		if _, ok := note["visibility"]; !ok {
+			note["visibility"] = "public"
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"server": "https://misskey.example",
+			"body":   map[string]interface{}{"note": note},
+		})
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		return data
+	}
+
+	t.Run("skip records the rule name", func(t *testing.T) {
+		m := metrics.NewNoop()
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatal("Post should not be called for a filtered note")
+			return "", nil
+		}
+		data := notePayload(map[string]interface{}{"text": "secret #Private", "tags": []string{"private"}})
+		if err := Note2TweetHandlerWithConfig(ctx, cfg, data, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues("private_tag")); got != 1 {
+			t.Fatalf("private_tag skipped metric = %v, want 1", got)
+		}
+	})
+
+	t.Run("forward applies overrides", func(t *testing.T) {
+		m := metrics.NewNoop()
+		var gotText string
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			gotText = text
+			return "tweet-filter", nil
+		}
+		postTweetWithMedia = func(ctx context.Context, text string, fileURLs []string) (string, error) {
+			t.Fatalf("media = %v, want none", fileURLs)
+			return "", nil
+		}
+		data := notePayload(map[string]interface{}{
+			"text":  "犯人はヤス",
+			"cw":    "ネタバレ",
+			"files": []map[string]interface{}{{"type": "image/png", "url": "https://media.example/spoiler.png"}},
+		})
+		if err := Note2TweetHandlerWithConfig(ctx, cfg, data, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if want := "ネタバレ\n\n犯人はヤス"; gotText != want {
+			t.Fatalf("posted text = %q, want %q", gotText, want)
+		}
+	})
+
+	t.Run("built-in rules run before custom rules", func(t *testing.T) {
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatalf("posted %q, want the built-in rules to skip the note", text)
+			return "", nil
+		}
+		for _, tt := range []struct {
+			note map[string]interface{}
+			rule string
+		}{
+			{map[string]interface{}{"text": "followers only", "visibility": "followers"}, "not_public"},
+			{map[string]interface{}{"text": "RT @someone quoted"}, "rt_pattern"},
+		} {
+			m := metrics.NewNoop()
+			if err := Note2TweetHandlerWithConfig(ctx, cfg, notePayload(tt.note), tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+				t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+			}
+			if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues(tt.rule)); got != 1 {
+				t.Fatalf("%s skipped metric = %v, want 1", tt.rule, got)
+			}
+		}
+	})
+
+	t.Run("builtin false drops the built-in rules", func(t *testing.T) {
+		rules, err := filter.Parse([]byte("note2tweet:\n  builtin: false\n  rules: []\n"))
+		if err != nil {
+			t.Fatalf("filter.Parse() error = %v", err)
+		}
+		m := metrics.NewNoop()
+		var posted bool
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			posted = true
+			return "tweet-rt", nil
+		}
+		data := notePayload(map[string]interface{}{"text": "RT @someone quoted"})
+		if err := Note2TweetHandlerWithConfig(ctx, Config{Note2TweetFilter: rules.Note2Tweet}, data, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if !posted {
+			t.Fatal("note was not posted, want the file to opt out of rt_pattern")
+		}
+	})
+}
+
+func TestTweet2NoteHandler_FilterRules(t *testing.T) {
+	ctx := context.Background()
+	rules := testFilterRules(t)
+	cfg := testHandlerConfig()
+	cfg.Tweet2NoteFilter = rules.Tweet2Note
+
+	oldCreate := createMisskeyNoteWithOptions
+	oldUpload := uploadMisskeyDriveFileFromURL
+	defer func() {
+		createMisskeyNoteWithOptions = oldCreate
+		uploadMisskeyDriveFileFromURL = oldUpload
+	}()
+	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token string, options misskey.UploadDriveFileOptions) (string, error) {
+		t.Fatal("UploadDriveFile should not be called when media is overridden off")
+		return "", nil
+	}
+	var got misskey.CreateNoteOptions
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		got = options
+		return "note-daily", nil
+	}
+
+	m := metrics.NewNoop()
+	tweets := []IncomingTweet{
+		{ID: "1", Text: "daily: 晴れ", MediaURLs: []string{"https://pbs.twimg.com/media/1.jpg"}},
+		{ID: "2", Text: "unrelated"},
+	}
+	for _, tweet := range tweets {
+		if err := HandleIncomingTweetWithConfig(ctx, cfg, tweet, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+			t.Fatalf("HandleIncomingTweetWithConfig() error = %v", err)
+		}
+	}
+	if got.Visibility != "home" || got.CW != "日記" || len(got.FileIDs) != 0 {
+		t.Fatalf("CreateNoteOptions = %+v, want home visibility, the CW and no files", got)
+	}
+	if got := testutil.ToFloat64(m.Tweet2NoteSkipped.WithLabelValues(filter.DefaultRuleName)); got != 1 {
+		t.Fatalf("default skipped metric = %v, want 1", got)
+	}
+}
+
+func TestFilterPostsFromTestData(t *testing.T) {
+	testdataDir := findTestdataDir(t)
+
+	note, err := os.ReadFile(filepath.Join(testdataDir, "misskey_note.json"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	post, err := NoteFilterPost(note)
+	if err != nil {
+		t.Fatalf("NoteFilterPost() error = %v", err)
+	}
+	if decision := defaultNote2TweetFilter.Evaluate(post); decision.Rule != "not_public" || !decision.Skip {
+		t.Fatalf("note decision = %+v, want not_public", decision)
+	}
+
+	tweet, err := os.ReadFile(filepath.Join(testdataDir, "filtered_stream_tweet.json"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	posts, err := TweetFilterPosts(tweet)
+	if err != nil {
+		t.Fatalf("TweetFilterPosts() error = %v", err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("tweet posts = %+v, want one post", posts)
+	}
+	if decision := defaultTweet2NoteFilter.Evaluate(posts[0]); decision.Rule != "rn_pattern" || !decision.Skip {
+		t.Fatalf("tweet decision = %+v, want rn_pattern", decision)
+	}
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+const (
+	// LongNotePolicyPost posts over-length notes as a single tweet and lets the
+	// Twitter API decide.
+	LongNotePolicyPost = "post"
+	// LongNotePolicyThread splits over-length notes into a reply thread.
+	LongNotePolicyThread = "thread"
+	// LongNotePolicyTruncate shortens over-length notes and appends the note URL.
+	LongNotePolicyTruncate = "truncate"
+	// LongNotePolicySkip drops over-length notes.
+	LongNotePolicySkip = "skip"
+	// LongNotePolicyFail rejects over-length notes without calling the API.
+	LongNotePolicyFail = "fail"
+)
+
+const truncationMarker = "…"
+
+var errTweetTooLong = errors.New("note text exceeds the tweet length limit")
+
+// LongNotePolicies lists the accepted values for Config.LongNotePolicy.
+func LongNotePolicies() []string {
+	return []string{
+		LongNotePolicyPost,
+		LongNotePolicyThread,
+		LongNotePolicyTruncate,
+		LongNotePolicySkip,
+		LongNotePolicyFail,
+	}
+}
+
+// truncateTweetText shortens text so that text, an ellipsis and noteURI fit in
+// a single tweet.
+func truncateTweetText(text, noteURI string) string {
+	suffix := truncationMarker + "\n" + noteURI
+	limit := twitter.MaxTweetLength - twitter.WeightedLength(suffix)
+	return twitter.TruncateToWeightedLength(text, limit) + suffix
+}
@@ -3,11 +3,14 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/mfm"
 	"github.com/Soli0222/note-tweet-connector/internal/tracker"
 	"github.com/Soli0222/note-tweet-connector/internal/twitter"
 )
@@ -30,6 +33,9 @@ type payloadNoteData struct {
 			Files      []interface{} `json:"files"`
 			Cw         string        `json:"cw"`
 			Text       string        `json:"text"`
+			Tags       []string      `json:"tags"`
+			ChannelID  string        `json:"channelId"`
+			Poll       *notePoll     `json:"poll"`
 			RenoteID   string        `json:"renoteId"`
 			ReplyID    string        `json:"replyId"`
 			User       struct {
@@ -38,7 +44,11 @@ type payloadNoteData struct {
 				Username string `json:"username"`
 			} `json:"user"`
 			Reply struct {
-				ID string `json:"id"`
+				ID     string `json:"id"`
+				UserID string `json:"userId"`
+				User   struct {
+					ID string `json:"id"`
+				} `json:"user"`
 			} `json:"reply"`
 			Renote struct {
 				ID     string `json:"id"`
@@ -59,6 +69,18 @@ func Note2TweetHandler(ctx context.Context, data []byte, crossPostTracker tracke
 	return Note2TweetHandlerWithConfig(ctx, Config{}, data, crossPostTracker, m)
 }
 
+// StreamNotePayload wraps a note received from the Misskey streaming API in
+// the webhook payload format.
+func StreamNotePayload(cfg Config, note []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"server": "https://" + cfg.MisskeyHost,
+		"type":   "note",
+		"body": map[string]json.RawMessage{
+			"note": note,
+		},
+	})
+}
+
 func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics) error {
 	m.Note2TweetTotal.Inc()
 
@@ -76,7 +98,7 @@ func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, c
 		return nil
 	}
 
-	tracked, err := crossPostTracker.HasMisskeyNote(ctx, noteID)
+	record, tracked, err := crossPostTracker.FindByMisskeyNoteID(ctx, noteID)
 	if err != nil {
 		slog.Error("Failed to check cross-post tracker",
 			slog.String("note_id", noteID),
@@ -84,7 +106,7 @@ func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, c
 		m.Note2TweetErrors.Inc()
 		return err
 	}
-	if tracked {
+	if tracked && !record.Incomplete {
 		slog.Info("Known cross-posted note, skipping",
 			slog.String("note_id", noteID))
 		m.Note2TweetSkipped.WithLabelValues("crosspost").Inc()
@@ -92,29 +114,99 @@ func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, c
 		return nil
 	}
 
-	if payload.Body.Note.Visibility != "public" {
-		slog.Info("Note is not public, skipping",
+	claim, err := claimPost(ctx, crossPostTracker, tracker.DirectionMisskeyToTweet, noteID)
+	if claimed, ok := staleClaim(err, cfg.ClaimLease); ok {
+		slog.Error("Note claim outlived its lease, giving up",
 			slog.String("note_id", noteID),
-			slog.String("visibility", payload.Body.Note.Visibility))
-		m.Note2TweetSkipped.WithLabelValues("not_public").Inc()
-		return nil
+			slog.Time("claimed_at", claimed.ClaimedAt))
+		m.Note2TweetErrors.Inc()
+		return errStaleClaim
+	}
+	if errors.Is(err, tracker.ErrClaimed) {
+		slog.Info("Note is being cross-posted by another worker",
+			slog.String("note_id", noteID))
+		m.Note2TweetSkipped.WithLabelValues("claimed").Inc()
+		return err
+	}
+	if err != nil {
+		slog.Error("Failed to claim note in cross-post tracker",
+			slog.String("note_id", noteID),
+			slog.Any("error", err))
+		m.Note2TweetErrors.Inc()
+		return err
 	}
+	defer claim.release(ctx)
 
-	if payload.Body.Note.LocalOnly {
-		slog.Info("Note is local only, skipping",
+	// Another worker may have posted the note and completed its claim between
+	// the check above and the claim, so the tracker is read again.
+	record, tracked, err = crossPostTracker.FindByMisskeyNoteID(ctx, noteID)
+	if err != nil {
+		slog.Error("Failed to check cross-post tracker",
 			slog.String("note_id", noteID),
-			slog.Bool("local_only", payload.Body.Note.LocalOnly))
-		m.Note2TweetSkipped.WithLabelValues("local_only").Inc()
+			slog.Any("error", err))
+		m.Note2TweetErrors.Inc()
+		return err
+	}
+	if tracked && !record.Incomplete {
+		slog.Info("Note was cross-posted by another worker, skipping",
+			slog.String("note_id", noteID))
+		m.Note2TweetSkipped.WithLabelValues("crosspost").Inc()
+		m.TrackerDuplicatesHit.Inc()
 		return nil
 	}
+	// A thread that stopped partway is continued after its last posted tweet.
+	var postedTweetIDs []string
+	if tracked {
+		postedTweetIDs = append([]string{record.TweetID}, record.ThreadTweetIDs...)
+		slog.Info("Continuing incomplete thread",
+			slog.String("note_id", noteID),
+			slog.Int("posted_tweet_count", len(postedTweetIDs)))
+	}
 
-	if replyID := noteReplyID(payload); replyID != "" {
-		slog.Info("Note is a reply, skipping",
+	decision := note2TweetFilter(cfg).Evaluate(noteFilterPost(payload))
+	if decision.Skip {
+		slog.Info("Note matched a filter rule, skipping",
 			slog.String("note_id", noteID),
-			slog.String("reply_id", replyID))
-		m.Note2TweetSkipped.WithLabelValues("reply").Inc()
+			slog.String("rule", decision.Rule),
+			slog.String("visibility", payload.Body.Note.Visibility))
+		m.Note2TweetSkipped.WithLabelValues(decision.Rule).Inc()
 		return nil
 	}
+	if policy := decision.Overrides.CWPolicy; policy != "" {
+		cfg.CWPolicy = policy
+		cfg.CWMediaPolicy = policy
+	}
+	if policy := decision.Overrides.LongNotePolicy; policy != "" {
+		cfg.LongNotePolicy = policy
+	}
+
+	replyTweetID := ""
+	if replyID := noteReplyID(payload); replyID != "" {
+		if !isOwnReply(payload) {
+			slog.Info("Note is a reply, skipping",
+				slog.String("note_id", noteID),
+				slog.String("reply_id", replyID))
+			m.Note2TweetSkipped.WithLabelValues("reply").Inc()
+			return nil
+		}
+		resolvedTweetID, ok, err := resolveTweetIDForMisskeyNote(ctx, crossPostTracker, replyID)
+		if err != nil {
+			slog.Error("Failed to resolve reply parent from tracker",
+				slog.String("note_id", noteID),
+				slog.String("reply_id", replyID),
+				slog.Any("error", err))
+			m.Note2TweetErrors.Inc()
+			return err
+		}
+		if !ok {
+			slog.Info("Reply parent not found in tracker, skipping",
+				slog.String("note_id", noteID),
+				slog.String("reply_id", replyID))
+			m.Note2TweetSkipped.WithLabelValues("reply_parent_missing").Inc()
+			return nil
+		}
+		replyTweetID = resolvedTweetID
+	}
 
 	if renoteID := noteRenoteID(payload); renoteID != "" && !isOwnQuoteRenote(payload) {
 		slog.Info("Note is a renote, skipping",
@@ -127,10 +219,26 @@ func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, c
 	noteText := payload.Body.Note.Text
 	noteURI := payload.Server + "/notes/" + payload.Body.Note.ID
 	quoteTweetID := ""
+	attachMedia := decision.Overrides.Media == nil || *decision.Overrides.Media
+	// A poll is posted only with the note body; masked and linked CW notes
+	// leave the choices to the note itself.
+	postsNoteBody := true
+	mfmOptions := mfm.Options{
+		CustomEmoji:  cfg.CustomEmoji,
+		LocalBaseURL: payload.Server,
+	}
 
-	if payload.Body.Note.Cw != "" {
-		circles := strings.Repeat("○", len(payload.Body.Note.Text))
-		noteText = payload.Body.Note.Cw + "\n" + circles + "\n" + noteURI
+	if cw := payload.Body.Note.Cw; cw != "" {
+		policy := cwPolicy(cfg, len(payload.Body.Note.Files) > 0)
+		if policy == CWPolicySkip {
+			slog.Info("Note has a CW, skipping",
+				slog.String("note_id", noteID))
+			m.Note2TweetSkipped.WithLabelValues("cw").Inc()
+			return nil
+		}
+		noteText = cwTweetText(policy, cw, noteText, noteURI, mfmOptions)
+		postsNoteBody = policy == CWPolicyFull
+		attachMedia = attachMedia && policy != CWPolicyLink
 	} else if isOwnQuoteRenote(payload) {
 		renoteID := noteRenoteID(payload)
 		resolvedTweetID, ok, err := resolveTweetIDForMisskeyNote(ctx, crossPostTracker, renoteID)
@@ -157,79 +265,280 @@ func Note2TweetHandlerWithConfig(ctx context.Context, cfg Config, data []byte, c
 		}
 	}
 
-	// "RT @" で始まるノートをスキップ
-	if rtAtPattern.MatchString(noteText) {
-		escapedText := strings.ReplaceAll(noteText, "\n", "\\n")
-		slog.Info("Skipping RT @ note",
-			slog.String("note_id", noteID),
-			slog.String("text_preview", escapedText[:min(50, len(escapedText))]))
-		m.Note2TweetSkipped.WithLabelValues("rt_pattern").Inc()
-		return nil
-	}
+	noteText = mfm.ToPlainText(noteText, mfmOptions)
 
-	var fileURLs []string
-	for _, f := range payload.Body.Note.Files {
-		if m, ok := f.(map[string]interface{}); ok {
-			typeStr, _ := m["type"].(string)
-			if !strings.Contains(typeStr, "image") {
-				continue
-			}
-			if urlStr, ok := m["url"].(string); ok {
-				fileURLs = append(fileURLs, urlStr)
-			}
+	var mediaFiles []noteMediaFile
+	if attachMedia {
+		mediaFiles = tweetMediaFiles(payload.Body.Note.Files)
+	}
+	fileURLs := make([]string, 0, len(mediaFiles))
+	var altTexts []string
+	var sensitive []bool
+	for _, file := range mediaFiles {
+		if err := checkNoteMedia(file); err != nil {
+			skipNoteMedia(m, noteID, file.URL, err)
+			continue
 		}
+		fileURLs = append(fileURLs, file.URL)
+		altTexts = append(altTexts, file.Comment)
+		sensitive = append(sensitive, file.IsSensitive)
+	}
+	if !containsNonEmpty(altTexts) {
+		altTexts = nil
+	}
+	if !containsTrue(sensitive) {
+		sensitive = nil
+	}
+	// A note whose every file was dropped still needs a tweet body.
+	if len(fileURLs) == 0 && len(mediaFiles) > 0 && strings.TrimSpace(noteText) == "" {
+		noteText = noteURI
 	}
 
-	var tweetID string
-	options := twitter.PostOptions{
-		Text:         noteText,
-		MediaURLs:    fileURLs,
-		QuoteTweetID: quoteTweetID,
+	var poll *twitter.Poll
+	notePoll := payload.Body.Note.Poll
+	if notePoll != nil && !postsNoteBody {
+		slog.Info("CW policy does not post the note body, dropping its poll",
+			slog.String("note_id", noteID))
+		m.PollFallbacks.WithLabelValues("note2tweet", "poll_dropped").Inc()
+	} else if notePoll != nil {
+		choices := make([]string, 0, len(notePoll.Choices))
+		for _, choice := range notePoll.Choices {
+			choices = append(choices, mfm.ToPlainText(choice.Text, mfmOptions))
+		}
+		converted, reason := tweetPollForNote(notePoll, choices, len(fileURLs) > 0 || quoteTweetID != "", time.Now())
+		if reason != "" {
+			slog.Info("Poll does not fit Twitter, posting choices as text",
+				slog.String("note_id", noteID),
+				slog.String("reason", reason))
+			m.PollFallbacks.WithLabelValues("note2tweet", reason).Inc()
+			noteText = pollFallbackText(noteText, choices)
+		} else {
+			poll = converted
+		}
 	}
-	if cfg.Twitter != (twitter.Config{}) {
-		tweetID, err = twitter.PostWithOptionsConfig(ctx, cfg.Twitter, options)
-	} else if quoteTweetID != "" {
-		tweetID, err = postTweetWithOptions(ctx, options)
-	} else if len(fileURLs) == 0 {
-		tweetID, err = postTweet(ctx, options.Text)
-	} else {
-		tweetID, err = postTweetWithMedia(ctx, options.Text, options.MediaURLs)
+
+	parts := []string{noteText}
+	if textLength := twitter.WeightedLength(noteText); textLength > twitter.MaxTweetLength {
+		switch cfg.LongNotePolicy {
+		case LongNotePolicyThread:
+			parts = splitTweetText(noteText, twitter.MaxTweetLength)
+		case LongNotePolicyTruncate:
+			slog.Info("Note is too long, truncating",
+				slog.String("note_id", noteID),
+				slog.Int("weighted_length", textLength))
+			parts = []string{truncateTweetText(noteText, noteURI)}
+		case LongNotePolicySkip:
+			slog.Info("Note is too long, skipping",
+				slog.String("note_id", noteID),
+				slog.Int("weighted_length", textLength))
+			m.Note2TweetSkipped.WithLabelValues("too_long").Inc()
+			return nil
+		case LongNotePolicyFail:
+			slog.Error("Note is too long",
+				slog.String("note_id", noteID),
+				slog.Int("weighted_length", textLength))
+			m.Note2TweetErrors.Inc()
+			return errTweetTooLong
+		}
 	}
 
-	if err == nil {
+	tweetIDs := make([]string, 0, len(parts))
+	tweetIDs = append(tweetIDs, postedTweetIDs...)
+	var postErr error
+	missingID := false
+	for i, part := range parts {
+		if i < len(tweetIDs) {
+			continue
+		}
+		options := twitter.PostOptions{Text: part}
+		if i == 0 {
+			options.OnMediaSkipped = func(mediaURL string, err error) {
+				skipNoteMedia(m, noteID, mediaURL, err)
+			}
+			options.MediaURLs = fileURLs
+			options.MediaAltTexts = altTexts
+			options.MediaSensitive = sensitive
+			options.QuoteTweetID = quoteTweetID
+			options.InReplyToTweetID = replyTweetID
+			options.Poll = poll
+		} else {
+			options.InReplyToTweetID = tweetIDs[i-1]
+		}
+
+		tweetID, err := postNoteTweet(ctx, cfg, options)
+		if err != nil {
+			postErr = err
+			break
+		}
 		if tweetID == "" {
-			m.Note2TweetErrors.Inc()
-			return errMissingPostedID("tweet")
+			missingID = true
+			break
+		}
+		tweetIDs = append(tweetIDs, tweetID)
+	}
+
+	// Record partial threads as incomplete so that a retry posts the rest
+	// instead of the leading tweets again.
+	if len(tweetIDs) > 0 {
+		remember := crossPostTracker.RememberMisskeyToTweetThread
+		if postErr != nil || missingID {
+			remember = crossPostTracker.RememberIncompleteMisskeyToTweetThread
 		}
-		if err := crossPostTracker.RememberMisskeyToTweet(ctx, noteID, tweetID); err != nil {
+		if err := remember(ctx, noteID, tweetIDs); err != nil {
 			slog.Error("Posted tweet but failed to record cross-post",
 				slog.String("note_id", noteID),
-				slog.String("tweet_id", tweetID),
+				slog.String("tweet_id", tweetIDs[0]),
+				slog.Int("tweet_count", len(tweetIDs)),
 				slog.Any("error", err))
+			claim.keep()
 			m.Note2TweetErrors.Inc()
 			return err
 		}
-		escapedText := strings.ReplaceAll(noteText, "\n", "\\n")
-		slog.Info("Successfully posted note to tweet",
-			slog.String("note_id", noteID),
-			slog.String("tweet_id", tweetID),
-			slog.String("text_preview", escapedText[:min(100, len(escapedText))]),
-			slog.String("quote_tweet_id", quoteTweetID),
-			slog.Bool("has_media", len(fileURLs) > 0),
-			slog.Int("media_count", len(fileURLs)))
-		m.Note2TweetSuccess.Inc()
-	} else {
+		claim.complete(ctx)
+	}
+
+	if missingID {
+		claim.keep()
+		m.Note2TweetErrors.Inc()
+		return errMissingPostedID("tweet")
+	}
+	if postErr != nil {
+		if until, ok := DeferUntil(postErr); ok {
+			slog.Info("Deferring note until the Twitter rate limit resets",
+				slog.String("note_id", noteID),
+				slog.Time("reset_at", until),
+				slog.Int("posted_tweet_count", len(tweetIDs)),
+				slog.Any("error", postErr))
+			m.Note2TweetDeferred.Inc()
+			return postErr
+		}
 		slog.Error("Failed to post note to tweet",
 			slog.String("note_id", noteID),
-			slog.Any("error", err))
-		notifyTwitterFailure(ctx, cfg, noteID, err, len(fileURLs), quoteTweetID)
+			slog.Int("posted_tweet_count", len(tweetIDs)),
+			slog.Any("error", postErr))
+		notifyTwitterFailure(ctx, cfg, noteID, postErr, len(fileURLs), quoteTweetID)
 		m.Note2TweetErrors.Inc()
-		return err
+		return postErr
+	}
+
+	escapedText := strings.ReplaceAll(noteText, "\n", "\\n")
+	slog.Info("Successfully posted note to tweet",
+		slog.String("note_id", noteID),
+		slog.String("tweet_id", tweetIDs[0]),
+		slog.String("text_preview", escapedText[:min(100, len(escapedText))]),
+		slog.String("quote_tweet_id", quoteTweetID),
+		slog.String("in_reply_to_tweet_id", replyTweetID),
+		slog.Bool("has_media", len(fileURLs) > 0),
+		slog.Int("media_count", len(fileURLs)),
+		slog.Bool("has_poll", poll != nil),
+		slog.Int("tweet_count", len(tweetIDs)))
+	m.Note2TweetSuccess.Inc()
+	if len(sensitive) > 0 {
+		m.SensitiveMediaForwarded.WithLabelValues("note2tweet").Inc()
 	}
 
 	return nil
 }
 
+func postNoteTweet(ctx context.Context, cfg Config, options twitter.PostOptions) (string, error) {
+	switch {
+	case cfg.Twitter != (twitter.Config{}):
+		return twitter.PostWithOptionsConfig(ctx, cfg.Twitter, options)
+	case options.QuoteTweetID != "" || options.InReplyToTweetID != "" || options.Poll != nil || len(options.MediaAltTexts) > 0 || len(options.MediaSensitive) > 0:
+		return postTweetWithOptions(ctx, options)
+	case len(options.MediaURLs) == 0:
+		return postTweet(ctx, options.Text)
+	default:
+		return postTweetWithMedia(ctx, options.Text, options.MediaURLs)
+	}
+}
+
+type noteMediaFile struct {
+	URL         string
+	Type        string
+	Size        int64
+	Duration    time.Duration
+	Comment     string
+	IsSensitive bool
+}
+
+// checkNoteMedia checks the size and duration Misskey reports for a file
+// against the Twitter limits, so that files over them are not downloaded.
+func checkNoteMedia(file noteMediaFile) error {
+	if err := twitter.CheckMediaSize(file.Type, file.Size); err != nil {
+		return err
+	}
+	return twitter.CheckVideoDuration(file.Type, file.Duration)
+}
+
+// skipNoteMedia records a note file dropped for exceeding the Twitter limits.
+func skipNoteMedia(m *metrics.Metrics, noteID, mediaURL string, err error) {
+	reason := "too_large"
+	if errors.Is(err, twitter.ErrMediaDuration) {
+		reason = "duration"
+	}
+	slog.Warn("Note media exceeds Twitter limits, posting without it",
+		slog.String("note_id", noteID),
+		slog.String("media_url", mediaURL),
+		slog.String("reason", reason),
+		slog.Any("error", err))
+	m.MediaSkipped.WithLabelValues("note2tweet", reason).Inc()
+}
+
+func containsNonEmpty(values []string) bool {
+	for _, v := range values {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTrue(values []bool) bool {
+	for _, v := range values {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+// tweetMediaFiles picks the note files to attach to a tweet. Twitter accepts
+// up to four images or a single video or animated GIF, so the first
+// attachable file decides which kind is used.
+func tweetMediaFiles(files []interface{}) []noteMediaFile {
+	var selected []noteMediaFile
+	for _, f := range files {
+		m, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		typeStr, _ := m["type"].(string)
+		urlStr, _ := m["url"].(string)
+		if urlStr == "" || (!strings.HasPrefix(typeStr, "image/") && !strings.HasPrefix(typeStr, "video/")) {
+			continue
+		}
+		size, _ := m["size"].(float64)
+		comment, _ := m["comment"].(string)
+		isSensitive, _ := m["isSensitive"].(bool)
+		file := noteMediaFile{URL: urlStr, Type: typeStr, Size: int64(size), Comment: comment, IsSensitive: isSensitive}
+		if properties, ok := m["properties"].(map[string]interface{}); ok {
+			if seconds, ok := properties["duration"].(float64); ok {
+				file.Duration = time.Duration(seconds * float64(time.Second))
+			}
+		}
+
+		if twitter.IsVideoMediaType(file.Type) {
+			if len(selected) == 0 {
+				return []noteMediaFile{file}
+			}
+			continue
+		}
+		selected = append(selected, file)
+	}
+	return selected
+}
+
 func noteReplyID(payload *payloadNoteData) string {
 	if payload.Body.Note.ReplyID != "" {
 		return payload.Body.Note.ReplyID
@@ -244,6 +553,16 @@ func noteRenoteID(payload *payloadNoteData) string {
 	return payload.Body.Note.Renote.ID
 }
 
+func isOwnReply(payload *payloadNoteData) bool {
+	if payload.Body.Note.UserID != "" && payload.Body.Note.Reply.UserID != "" {
+		return payload.Body.Note.UserID == payload.Body.Note.Reply.UserID
+	}
+	if payload.Body.Note.User.ID != "" && payload.Body.Note.Reply.User.ID != "" {
+		return payload.Body.Note.User.ID == payload.Body.Note.Reply.User.ID
+	}
+	return false
+}
+
 func isOwnQuoteRenote(payload *payloadNoteData) bool {
 	if payload.Body.Note.Text == "" || payload.Body.Note.Text == "null" {
 		return false
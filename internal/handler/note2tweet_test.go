@@ -3,6 +3,10 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -398,6 +402,200 @@ func TestNote2TweetHandler_SkipsReply(t *testing.T) {
 	}
 }
 
+func TestNote2TweetHandler_OwnReplyPostsTweetReply(t *testing.T) {
+	ctx := context.Background()
+
+	oldPost := postTweet
+	oldPostWithOptions := postTweetWithOptions
+	defer func() {
+		postTweet = oldPost
+		postTweetWithOptions = oldPostWithOptions
+	}()
+
+	payload := `{
+		"body": {
+			"note": {
+				"id": "reply-note",
+				"userId": "user-1",
+				"text": "Reply note",
+				"visibility": "public",
+				"replyId": "parent-note",
+				"reply": {
+					"id": "parent-note",
+					"userId": "user-1"
+				}
+			}
+		},
+		"server": "https://misskey.example"
+	}`
+
+	t.Run("parent tracked", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberMisskeyToTweet(ctx, "parent-note", "parent-tweet"); err != nil {
+			t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+		}
+
+		var got twitter.PostOptions
+		postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+			got = options
+			return "reply-tweet", nil
+		}
+
+		if err := Note2TweetHandler(ctx, []byte(payload), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandler() error = %v", err)
+		}
+		if got.Text != "Reply note" || got.InReplyToTweetID != "parent-tweet" {
+			t.Fatalf("posted = %#v, want reply to parent-tweet", got)
+		}
+		record, ok, err := crossPostTracker.FindByTweetID(ctx, "reply-tweet")
+		if err != nil || !ok || record.MisskeyNoteID != "reply-note" {
+			t.Fatalf("FindByTweetID() = %#v, %v, %v; want reply-note", record, ok, err)
+		}
+	})
+
+	t.Run("parent missing", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatal("Post should not be called when the reply parent is unknown")
+			return "", nil
+		}
+		postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+			t.Fatal("PostWithOptions should not be called when the reply parent is unknown")
+			return "", nil
+		}
+
+		if err := Note2TweetHandler(ctx, []byte(payload), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandler() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues("reply_parent_missing")); got != 1 {
+			t.Fatalf("reply_parent_missing skipped metric = %v, want 1", got)
+		}
+	})
+}
+
+func TestNote2TweetHandler_Poll(t *testing.T) {
+	ctx := context.Background()
+
+	oldPost := postTweet
+	oldPostWithOptions := postTweetWithOptions
+	defer func() {
+		postTweet = oldPost
+		postTweetWithOptions = oldPostWithOptions
+	}()
+
+	notePayload := func(multiple bool, cw string) []byte {
+		data, err := json.Marshal(map[string]interface{}{
+			"server": "https://misskey.example",
+			"body": map[string]interface{}{
+				"note": map[string]interface{}{
+					"id":         "note-poll",
+					"text":       "which?",
+					"cw":         cw,
+					"visibility": "public",
+					"poll": map[string]interface{}{
+						"multiple":  multiple,
+						"expiresAt": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+						"choices": []map[string]interface{}{
+							{"text": "a", "votes": 0},
+							{"text": "b", "votes": 0},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		return data
+	}
+
+	t.Run("posts twitter poll", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		var got twitter.PostOptions
+		postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+			got = options
+			return "tweet-poll", nil
+		}
+
+		if err := Note2TweetHandler(ctx, notePayload(false, ""), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandler() error = %v", err)
+		}
+		if got.Poll == nil || !reflect.DeepEqual(got.Poll.Options, []string{"a", "b"}) {
+			t.Fatalf("Poll = %#v, want options a, b", got.Poll)
+		}
+		if got.Poll.DurationMinutes < 59 || got.Poll.DurationMinutes > 60 {
+			t.Fatalf("DurationMinutes = %d, want about 60", got.Poll.DurationMinutes)
+		}
+	})
+
+	t.Run("falls back to text", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		var gotText string
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			gotText = text
+			return "tweet-poll", nil
+		}
+
+		if err := Note2TweetHandler(ctx, notePayload(true, ""), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandler() error = %v", err)
+		}
+		if gotText != "which?\n\n・a\n・b" {
+			t.Fatalf("posted text = %q", gotText)
+		}
+		if got := testutil.ToFloat64(m.PollFallbacks.WithLabelValues("note2tweet", "poll_multiple")); got != 1 {
+			t.Fatalf("poll_multiple fallback metric = %v, want 1", got)
+		}
+		if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues("poll_multiple")); got != 0 {
+			t.Fatalf("poll_multiple skipped metric = %v, want the note not counted as skipped", got)
+		}
+	})
+
+	t.Run("posts poll of a CW note posted in full", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		var got twitter.PostOptions
+		postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+			got = options
+			return "tweet-poll", nil
+		}
+
+		if err := Note2TweetHandlerWithConfig(ctx, Config{CWPolicy: CWPolicyFull}, notePayload(false, "spoiler"), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if got.Text != "spoiler\n\nwhich?" || got.Poll == nil || !reflect.DeepEqual(got.Poll.Options, []string{"a", "b"}) {
+			t.Fatalf("options = %#v, want the CW, the body and the poll", got)
+		}
+	})
+
+	t.Run("drops poll of a masked CW note", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		var gotText string
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			gotText = text
+			return "tweet-poll", nil
+		}
+		postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+			t.Fatalf("PostWithOptions() called with %#v, want no poll", options)
+			return "", nil
+		}
+
+		if err := Note2TweetHandler(ctx, notePayload(false, "spoiler"), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandler() error = %v", err)
+		}
+		if strings.Contains(gotText, "・a") {
+			t.Fatalf("posted text = %q, want the choices hidden with the body", gotText)
+		}
+		if got := testutil.ToFloat64(m.PollFallbacks.WithLabelValues("note2tweet", "poll_dropped")); got != 1 {
+			t.Fatalf("poll_dropped fallback metric = %v, want 1", got)
+		}
+	})
+}
+
 func TestNote2TweetHandler_RecordsCrossPostIDs(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
@@ -448,6 +646,37 @@ func TestNote2TweetHandler_RecordsCrossPostIDs(t *testing.T) {
 	}
 }
 
+func TestStreamNotePayload_UsesMisskeyHostAsServer(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+
+	var gotText string
+	postTweet = func(ctx context.Context, text string) (string, error) {
+		gotText = text
+		return "tweet-1", nil
+	}
+
+	cfg := Config{MisskeyHost: "misskey.example"}
+	note := `{"id":"note-1","userId":"user-1","text":"ab","cw":"spoiler","visibility":"public","localOnly":false,"files":[]}`
+	data, err := StreamNotePayload(cfg, []byte(note))
+	if err != nil {
+		t.Fatalf("StreamNotePayload() error = %v", err)
+	}
+	if err := Note2TweetHandlerWithConfig(ctx, cfg, data, crossPostTracker, m); err != nil {
+		t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+	}
+	if want := "spoiler\n○○\nhttps://misskey.example/notes/note-1"; gotText != want {
+		t.Fatalf("posted text = %q, want %q", gotText, want)
+	}
+	if ok, err := crossPostTracker.HasMisskeyNote(ctx, "note-1"); err != nil || !ok {
+		t.Fatal("note ID was not recorded")
+	}
+}
+
 func TestNote2TweetHandler_SkipsPlainAndExternalQuoteRenotes(t *testing.T) {
 	ctx := context.Background()
 
@@ -634,6 +863,241 @@ func TestNote2TweetHandler_OwnQuoteRenoteUsesTrackerTweetID(t *testing.T) {
 	}
 }
 
+func TestNote2TweetHandler_LongNoteThreadPostsReplies(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldPostWithMedia := postTweetWithMedia
+	oldPostWithOptions := postTweetWithOptions
+	defer func() {
+		postTweetWithMedia = oldPostWithMedia
+		postTweetWithOptions = oldPostWithOptions
+	}()
+
+	var posted []twitter.PostOptions
+	postTweetWithMedia = func(ctx context.Context, text string, fileURLs []string) (string, error) {
+		posted = append(posted, twitter.PostOptions{Text: text, MediaURLs: fileURLs})
+		return "tweet-1", nil
+	}
+	postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+		posted = append(posted, options)
+		return fmt.Sprintf("tweet-%d", len(posted)), nil
+	}
+
+	longText := strings.Repeat("あ", 130) + "。" + strings.Repeat("い", 130) + "。"
+	data, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{
+				"id":         "note-long",
+				"text":       longText,
+				"visibility": "public",
+				"files": []map[string]string{
+					{"type": "image/png", "url": "https://media.example/1.png"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	cfg := Config{LongNotePolicy: LongNotePolicyThread}
+	if err := Note2TweetHandlerWithConfig(ctx, cfg, data, crossPostTracker, m); err != nil {
+		t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+	}
+	if len(posted) != 2 {
+		t.Fatalf("posted tweets = %d, want 2", len(posted))
+	}
+	if len(posted[0].MediaURLs) != 1 || posted[0].InReplyToTweetID != "" {
+		t.Fatalf("first tweet = %#v, want media and no reply target", posted[0])
+	}
+	if len(posted[1].MediaURLs) != 0 || posted[1].InReplyToTweetID != "tweet-1" {
+		t.Fatalf("second tweet = %#v, want reply to tweet-1 without media", posted[1])
+	}
+	for _, tweetID := range []string{"tweet-1", "tweet-2"} {
+		record, ok, err := crossPostTracker.FindByTweetID(ctx, tweetID)
+		if err != nil || !ok || record.MisskeyNoteID != "note-long" {
+			t.Fatalf("FindByTweetID(%q) = %#v, %v, %v; want note-long", tweetID, record, ok, err)
+		}
+	}
+}
+
+func TestNote2TweetHandler_LongNoteThreadRecordsPartialThread(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldPost := postTweet
+	oldPostWithOptions := postTweetWithOptions
+	defer func() {
+		postTweet = oldPost
+		postTweetWithOptions = oldPostWithOptions
+	}()
+
+	postTweet = func(ctx context.Context, text string) (string, error) {
+		return "tweet-1", nil
+	}
+	postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+		return "", &twitter.APIError{Operation: "POST request", StatusCode: 503}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{
+				"id":         "note-long",
+				"text":       strings.Repeat("a", 200) + ". " + strings.Repeat("b", 200),
+				"visibility": "public",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	err = Note2TweetHandlerWithConfig(ctx, Config{LongNotePolicy: LongNotePolicyThread}, data, crossPostTracker, m)
+	if err == nil {
+		t.Fatal("Note2TweetHandlerWithConfig() succeeded, want error")
+	}
+	if ok, err := crossPostTracker.HasMisskeyNote(ctx, "note-long"); err != nil || !ok {
+		t.Fatal("partial thread should be recorded")
+	}
+}
+
+func TestNote2TweetHandler_LongNotePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+
+	longText := strings.Repeat("長文", 100)
+	data, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{
+				"id":         "note-long",
+				"text":       longText,
+				"visibility": "public",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	t.Run("truncate", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		var gotText string
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			gotText = text
+			return "tweet-1", nil
+		}
+
+		if err := Note2TweetHandlerWithConfig(ctx, Config{LongNotePolicy: LongNotePolicyTruncate}, data, crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if !strings.HasSuffix(gotText, "…\nhttps://misskey.example/notes/note-long") {
+			t.Fatalf("posted text = %q, want note URL suffix", gotText)
+		}
+		if got := twitter.WeightedLength(gotText); got > twitter.MaxTweetLength {
+			t.Fatalf("WeightedLength() = %d, want <= %d", got, twitter.MaxTweetLength)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatal("Post should not be called for a skipped long note")
+			return "", nil
+		}
+
+		if err := Note2TweetHandlerWithConfig(ctx, Config{LongNotePolicy: LongNotePolicySkip}, data, crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues("too_long")); got != 1 {
+			t.Fatalf("too_long skipped metric = %v, want 1", got)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		notifier := &recordingNotifier{}
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatal("Post should not be called for a rejected long note")
+			return "", nil
+		}
+
+		err := Note2TweetHandlerWithConfig(ctx, Config{LongNotePolicy: LongNotePolicyFail, Notifier: notifier}, data, crossPostTracker, m)
+		if !errors.Is(err, errTweetTooLong) {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v, want %v", err, errTweetTooLong)
+		}
+		if len(notifier.events) != 0 {
+			t.Fatalf("events = %d, want 0", len(notifier.events))
+		}
+	})
+}
+
+func TestNote2TweetHandler_ConvertsMFMToPlainText(t *testing.T) {
+	ctx := context.Background()
+
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{
+				"id":         "note-mfm",
+				"text":       "$[x2 **Hello**] :blobcat: <small>@alice@remote.example</small> @bob",
+				"visibility": "public",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "keep custom emoji",
+			want: "Hello :blobcat: https://remote.example/@alice https://misskey.example/@bob",
+		},
+		{
+			name: "drop custom emoji",
+			cfg:  Config{CustomEmoji: "drop"},
+			want: "Hello  https://remote.example/@alice https://misskey.example/@bob",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+			m := metrics.NewNoop()
+			var gotText string
+			postTweet = func(ctx context.Context, text string) (string, error) {
+				gotText = text
+				return "tweet-1", nil
+			}
+
+			if err := Note2TweetHandlerWithConfig(ctx, tt.cfg, data, crossPostTracker, m); err != nil {
+				t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+			}
+			if gotText != tt.want {
+				t.Fatalf("posted text = %q, want %q", gotText, tt.want)
+			}
+		})
+	}
+}
+
 func TestNote2TweetHandler_SkipsMissingNoteID(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
@@ -689,6 +1153,125 @@ func TestNote2TweetHandler_CWHandling(t *testing.T) {
 	}
 }
 
+func TestNote2TweetHandler_CWPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	oldPost := postTweet
+	oldPostWithMedia := postTweetWithMedia
+	defer func() {
+		postTweet = oldPost
+		postTweetWithMedia = oldPostWithMedia
+	}()
+
+	notePayload := func(text string, files []map[string]interface{}) []byte {
+		if text == "" {
+			text = "犯人はヤス"
+		}
+		data, err := json.Marshal(map[string]interface{}{
+			"server": "https://misskey.example",
+			"body": map[string]interface{}{
+				"note": map[string]interface{}{
+					"id":         "note-cw",
+					"text":       text,
+					"cw":         "ネタバレ",
+					"visibility": "public",
+					"files":      files,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		return data
+	}
+	image := []map[string]interface{}{{"type": "image/png", "url": "https://media.example/spoiler.png"}}
+
+	tests := []struct {
+		name      string
+		cfg       Config
+		text      string
+		files     []map[string]interface{}
+		wantText  string
+		wantMedia []string
+	}{
+		{
+			name:     "default masks runes",
+			wantText: "ネタバレ\n○○○○○\nhttps://misskey.example/notes/note-cw",
+		},
+		{
+			name:     "mask counts rendered text",
+			text:     "**犯人**は$[x2 ヤス]",
+			wantText: "ネタバレ\n○○○○○\nhttps://misskey.example/notes/note-cw",
+		},
+		{
+			name:     "link",
+			cfg:      Config{CWPolicy: CWPolicyLink},
+			wantText: "ネタバレ\nhttps://misskey.example/notes/note-cw",
+		},
+		{
+			name:     "full",
+			cfg:      Config{CWPolicy: CWPolicyFull},
+			wantText: "ネタバレ\n\n犯人はヤス",
+		},
+		{
+			name:      "mask keeps media",
+			files:     image,
+			wantText:  "ネタバレ\n○○○○○\nhttps://misskey.example/notes/note-cw",
+			wantMedia: []string{"https://media.example/spoiler.png"},
+		},
+		{
+			name:     "media policy drops media",
+			cfg:      Config{CWPolicy: CWPolicyFull, CWMediaPolicy: CWPolicyLink},
+			files:    image,
+			wantText: "ネタバレ\nhttps://misskey.example/notes/note-cw",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+			m := metrics.NewNoop()
+			var gotText string
+			var gotMedia []string
+			postTweet = func(ctx context.Context, text string) (string, error) {
+				gotText = text
+				return "tweet-cw", nil
+			}
+			postTweetWithMedia = func(ctx context.Context, text string, fileURLs []string) (string, error) {
+				gotText = text
+				gotMedia = fileURLs
+				return "tweet-cw", nil
+			}
+
+			if err := Note2TweetHandlerWithConfig(ctx, tt.cfg, notePayload(tt.text, tt.files), crossPostTracker, m); err != nil {
+				t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+			}
+			if gotText != tt.wantText {
+				t.Fatalf("posted text = %q, want %q", gotText, tt.wantText)
+			}
+			if !reflect.DeepEqual(gotMedia, tt.wantMedia) {
+				t.Fatalf("media = %#v, want %#v", gotMedia, tt.wantMedia)
+			}
+		})
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		postTweet = func(ctx context.Context, text string) (string, error) {
+			t.Fatal("Post should not be called for a skipped CW note")
+			return "", nil
+		}
+
+		if err := Note2TweetHandlerWithConfig(ctx, Config{CWPolicy: CWPolicySkip}, notePayload("", nil), crossPostTracker, m); err != nil {
+			t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Note2TweetSkipped.WithLabelValues("cw")); got != 1 {
+			t.Fatalf("cw skipped metric = %v, want 1", got)
+		}
+	})
+}
+
 func TestNote2TweetHandler_FileExtraction(t *testing.T) {
 	payload := `{
 		"body": {
@@ -718,29 +1301,152 @@ func TestNote2TweetHandler_FileExtraction(t *testing.T) {
 		t.Errorf("expected 4 files, got %d", len(result.Body.Note.Files))
 	}
 
-	// Verify image filtering logic
-	imageCount := 0
-	for _, f := range result.Body.Note.Files {
-		if m, ok := f.(map[string]interface{}); ok {
-			typeStr, _ := m["type"].(string)
-			if typeStr != "" && containsSubstring(typeStr, "image") {
-				imageCount++
-			}
-		}
+	// Images come first, so the video and the animated GIF are left out
+	files := tweetMediaFiles(result.Body.Note.Files)
+	var urls []string
+	for _, file := range files {
+		urls = append(urls, file.URL)
 	}
+	want := []string{"https://example.com/image1.png", "https://example.com/image2.jpg"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("media URLs = %#v, want %#v", urls, want)
+	}
+}
 
-	if imageCount != 3 {
-		t.Errorf("expected 3 images, got %d", imageCount)
+func TestTweetMediaFiles_VideoFirst(t *testing.T) {
+	files := tweetMediaFiles([]interface{}{
+		map[string]interface{}{"type": "video/mp4", "url": "https://example.com/video.mp4", "size": float64(1024)},
+		map[string]interface{}{"type": "image/png", "url": "https://example.com/image.png"},
+		map[string]interface{}{"type": "image/gif", "url": "https://example.com/anim.gif"},
+	})
+	want := []noteMediaFile{{URL: "https://example.com/video.mp4", Type: "video/mp4", Size: 1024}}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("tweetMediaFiles() = %#v, want %#v", files, want)
 	}
 }
 
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+func TestNote2TweetHandler_ForwardsAltTextAndSensitiveFlag(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldPostWithOptions := postTweetWithOptions
+	defer func() { postTweetWithOptions = oldPostWithOptions }()
+	var got twitter.PostOptions
+	postTweetWithOptions = func(ctx context.Context, options twitter.PostOptions) (string, error) {
+		got = options
+		return "tweet-alt", nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"server": "https://misskey.example",
+		"body": map[string]interface{}{
+			"note": map[string]interface{}{
+				"id":         "note-alt",
+				"text":       "photos",
+				"visibility": "public",
+				"files": []map[string]interface{}{
+					{"type": "image/png", "url": "https://media.example/1.png", "comment": nil, "isSensitive": true},
+					{"type": "image/png", "url": "https://media.example/2.png", "comment": "a cat on a keyboard", "isSensitive": false},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	if err := Note2TweetHandler(ctx, data, crossPostTracker, m); err != nil {
+		t.Fatalf("Note2TweetHandler() error = %v", err)
+	}
+	if want := []string{"https://media.example/1.png", "https://media.example/2.png"}; !reflect.DeepEqual(got.MediaURLs, want) {
+		t.Fatalf("MediaURLs = %#v, want %#v", got.MediaURLs, want)
+	}
+	if want := []string{"", "a cat on a keyboard"}; !reflect.DeepEqual(got.MediaAltTexts, want) {
+		t.Fatalf("MediaAltTexts = %#v, want %#v", got.MediaAltTexts, want)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(got.MediaSensitive, want) {
+		t.Fatalf("MediaSensitive = %#v, want %#v", got.MediaSensitive, want)
+	}
+	if got := testutil.ToFloat64(m.SensitiveMediaForwarded.WithLabelValues("note2tweet")); got != 1 {
+		t.Fatalf("sensitive media metric = %v, want 1", got)
+	}
+}
+
+func TestNote2TweetHandler_DropsMediaOverTwitterLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   map[string]interface{}
+		reason string
+	}{
+		{
+			name:   "oversized video",
+			file:   map[string]interface{}{"type": "video/mp4", "url": "https://media.example/video.mp4", "size": twitter.MaxVideoBytes + 1},
+			reason: "too_large",
+		},
+		{
+			name: "overlong video",
+			file: map[string]interface{}{
+				"type":       "video/mp4",
+				"url":        "https://media.example/video.mp4",
+				"size":       1024,
+				"properties": map[string]interface{}{"duration": 141.5},
+			},
+			reason: "duration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+			m := metrics.NewNoop()
+			notifier := &recordingNotifier{}
+
+			oldPost := postTweet
+			oldPostWithMedia := postTweetWithMedia
+			defer func() {
+				postTweet = oldPost
+				postTweetWithMedia = oldPostWithMedia
+			}()
+			var posted string
+			postTweet = func(ctx context.Context, text string) (string, error) {
+				posted = text
+				return "tweet-video", nil
+			}
+			postTweetWithMedia = func(ctx context.Context, text string, fileURLs []string) (string, error) {
+				t.Fatal("PostWithMedia should not be called for media over the Twitter limits")
+				return "", nil
+			}
+
+			data, err := json.Marshal(map[string]interface{}{
+				"server": "https://misskey.example",
+				"body": map[string]interface{}{
+					"note": map[string]interface{}{
+						"id":         "note-video",
+						"text":       "video",
+						"visibility": "public",
+						"files":      []map[string]interface{}{tt.file},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+
+			if err := Note2TweetHandlerWithConfig(ctx, Config{Notifier: notifier}, data, crossPostTracker, m); err != nil {
+				t.Fatalf("Note2TweetHandlerWithConfig() error = %v", err)
+			}
+			if posted != "video" {
+				t.Fatalf("posted text = %q, want note text without media", posted)
+			}
+			if got := testutil.ToFloat64(m.MediaSkipped.WithLabelValues("note2tweet", tt.reason)); got != 1 {
+				t.Fatalf("media skipped %s = %v, want 1", tt.reason, got)
+			}
+			if len(notifier.events) != 0 {
+				t.Fatalf("events = %#v, want none", notifier.events)
+			}
+		})
 	}
-	return false
 }
 
 func TestRTAtPattern(t *testing.T) {
@@ -33,6 +33,8 @@ func notifyTwitterFailure(ctx context.Context, cfg Config, noteID string, err er
 		}
 		if apiErr.BodyPreview != "" {
 			fields = append(fields, notify.Field{Name: "response", Value: apiErr.BodyPreview})
+		} else if apiErr.Err != nil {
+			fields = append(fields, notify.Field{Name: "error", Value: apiErr.Err.Error()})
 		}
 		notifyHandlerEvent(ctx, notifier, notify.Event{
 			Kind:      notify.EventTwitterMediaUploadFailed,
@@ -11,6 +11,7 @@ import (
 	"github.com/Soli0222/note-tweet-connector/internal/notify"
 	"github.com/Soli0222/note-tweet-connector/internal/tracker"
 	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNote2TweetNotifiesTwitterPostFailure(t *testing.T) {
@@ -51,6 +52,42 @@ func TestNote2TweetNotifiesTwitterPostFailure(t *testing.T) {
 	assertField(t, event, "status", "403")
 }
 
+func TestNote2TweetDoesNotNotifyRateLimitedPost(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
+	m := metrics.NewNoop()
+	notifier := &recordingNotifier{}
+
+	resetAt := time.Now().Add(time.Hour)
+	oldPost := postTweet
+	defer func() { postTweet = oldPost }()
+	postTweet = func(ctx context.Context, text string) (string, error) {
+		return "", &twitter.RateLimitError{
+			Endpoint: twitter.EndpointCreateTweet,
+			Window:   twitter.WindowUser24Hour,
+			Reset:    resetAt,
+		}
+	}
+
+	payload := []byte(`{"server":"https://misskey.example","body":{"note":{"id":"note-1","visibility":"public","text":"hello"}}}`)
+	err := Note2TweetHandlerWithConfig(ctx, Config{Notifier: notifier}, payload, crossPostTracker, m)
+	if until, ok := DeferUntil(err); !ok || !until.Equal(resetAt) {
+		t.Fatalf("DeferUntil(%v) = %v, %v; want %v", err, until, ok, resetAt)
+	}
+	if IsPermanent(err) {
+		t.Fatalf("IsPermanent(%v) = true, want a deferred post to be retried", err)
+	}
+	if len(notifier.events) != 0 {
+		t.Fatalf("events = %+v, want no notification for a deferred post", notifier.events)
+	}
+	if got := testutil.ToFloat64(m.Note2TweetDeferred); got != 1 {
+		t.Fatalf("Note2TweetDeferred = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.Note2TweetSkipped); got != 0 {
+		t.Fatalf("Note2TweetSkipped series = %d, want a deferred post not counted as skipped", got)
+	}
+}
+
 func TestNote2TweetNotifiesTwitterMediaUploadFailure(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, time.Hour)
@@ -138,7 +175,7 @@ func TestTweet2NoteNotifiesMisskeyDriveUploadFailure(t *testing.T) {
 
 	oldUpload := uploadMisskeyDriveFileFromURL
 	defer func() { uploadMisskeyDriveFileFromURL = oldUpload }()
-	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token, fileURL string, allowedHosts []string) (string, error) {
+	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token string, options misskey.UploadDriveFileOptions) (string, error) {
 		return "", &misskey.APIError{
 			Operation:   "upload drive file",
 			StatusCode:  502,
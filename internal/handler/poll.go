@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+type notePoll struct {
+	Multiple  bool   `json:"multiple"`
+	ExpiresAt string `json:"expiresAt"`
+	Choices   []struct {
+		Text string `json:"text"`
+	} `json:"choices"`
+}
+
+// TweetPoll is a poll attached to an incoming tweet.
+type TweetPoll struct {
+	Options         []string
+	DurationMinutes int
+	EndsAt          time.Time
+	Closed          bool
+}
+
+// tweetPollForNote converts Misskey poll choices to a Twitter poll. When the
+// poll does not fit Twitter's limits it returns the skip reason instead.
+func tweetPollForNote(poll *notePoll, choices []string, hasAttachment bool, now time.Time) (*twitter.Poll, string) {
+	if hasAttachment {
+		return nil, "poll_with_attachment"
+	}
+	if poll.Multiple {
+		return nil, "poll_multiple"
+	}
+	if len(choices) < twitter.MinPollOptions || len(choices) > twitter.MaxPollOptions {
+		return nil, "poll_choice_count"
+	}
+	for _, choice := range choices {
+		if utf8.RuneCountInString(choice) > twitter.MaxPollOptionLength {
+			return nil, "poll_choice_length"
+		}
+	}
+
+	if poll.ExpiresAt == "" {
+		return nil, "poll_duration"
+	}
+	expiresAt, err := time.Parse(time.RFC3339, poll.ExpiresAt)
+	if err != nil {
+		return nil, "poll_duration"
+	}
+	remaining := expiresAt.Sub(now)
+	if remaining <= 0 {
+		return nil, "poll_expired"
+	}
+	minutes := int(math.Ceil(remaining.Minutes()))
+	if minutes > twitter.MaxPollDurationMinutes {
+		return nil, "poll_duration"
+	}
+	return &twitter.Poll{
+		Options:         choices,
+		DurationMinutes: max(minutes, twitter.MinPollDurationMinutes),
+	}, ""
+}
+
+// misskeyPollForTweet converts a Twitter poll to a Misskey poll. When the poll
+// does not fit Misskey's limits it returns the skip reason instead.
+func misskeyPollForTweet(poll *TweetPoll, now time.Time) (*misskey.Poll, string) {
+	if poll.Closed {
+		return nil, "poll_closed"
+	}
+	if len(poll.Options) < misskey.MinPollChoices || len(poll.Options) > misskey.MaxPollChoices {
+		return nil, "poll_choice_count"
+	}
+	for _, option := range poll.Options {
+		if utf8.RuneCountInString(option) > misskey.MaxPollChoiceLength {
+			return nil, "poll_choice_length"
+		}
+	}
+
+	expiresAt := poll.EndsAt
+	if expiresAt.IsZero() && poll.DurationMinutes > 0 {
+		expiresAt = now.Add(time.Duration(poll.DurationMinutes) * time.Minute)
+	}
+	if expiresAt.IsZero() {
+		return nil, "poll_duration"
+	}
+	if !expiresAt.After(now) {
+		return nil, "poll_expired"
+	}
+	return &misskey.Poll{
+		Choices:   poll.Options,
+		ExpiresAt: expiresAt,
+	}, ""
+}
+
+// pollFallbackText appends the poll choices to text as a bulleted list.
+func pollFallbackText(text string, choices []string) string {
+	lines := make([]string, 0, len(choices))
+	for _, choice := range choices {
+		lines = append(lines, "・"+choice)
+	}
+	if text == "" {
+		return strings.Join(lines, "\n")
+	}
+	return text + "\n\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/misskey"
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+func TestTweetPollForNote(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresIn := func(d time.Duration) string {
+		return now.Add(d).Format(time.RFC3339)
+	}
+
+	tests := []struct {
+		name          string
+		poll          notePoll
+		choices       []string
+		hasAttachment bool
+		want          *twitter.Poll
+		wantReason    string
+	}{
+		{
+			name:    "fits",
+			poll:    notePoll{ExpiresAt: expiresIn(90*time.Minute + 30*time.Second)},
+			choices: []string{"a", "b"},
+			want:    &twitter.Poll{Options: []string{"a", "b"}, DurationMinutes: 91},
+		},
+		{
+			name:    "short duration is raised to the minimum",
+			poll:    notePoll{ExpiresAt: expiresIn(time.Minute)},
+			choices: []string{"a", "b"},
+			want:    &twitter.Poll{Options: []string{"a", "b"}, DurationMinutes: twitter.MinPollDurationMinutes},
+		},
+		{name: "attachment", poll: notePoll{ExpiresAt: expiresIn(time.Hour)}, choices: []string{"a", "b"}, hasAttachment: true, wantReason: "poll_with_attachment"},
+		{name: "multiple", poll: notePoll{Multiple: true, ExpiresAt: expiresIn(time.Hour)}, choices: []string{"a", "b"}, wantReason: "poll_multiple"},
+		{name: "too many choices", poll: notePoll{ExpiresAt: expiresIn(time.Hour)}, choices: []string{"a", "b", "c", "d", "e"}, wantReason: "poll_choice_count"},
+		{name: "long choice", poll: notePoll{ExpiresAt: expiresIn(time.Hour)}, choices: []string{"a", strings.Repeat("あ", 26)}, wantReason: "poll_choice_length"},
+		{name: "no expiry", choices: []string{"a", "b"}, wantReason: "poll_duration"},
+		{name: "too long", poll: notePoll{ExpiresAt: expiresIn(8 * 24 * time.Hour)}, choices: []string{"a", "b"}, wantReason: "poll_duration"},
+		{name: "expired", poll: notePoll{ExpiresAt: expiresIn(-time.Minute)}, choices: []string{"a", "b"}, wantReason: "poll_expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tweetPollForNote(&tt.poll, tt.choices, tt.hasAttachment, now)
+			if reason != tt.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("poll = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMisskeyPollForTweet(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		poll       TweetPoll
+		want       *misskey.Poll
+		wantReason string
+	}{
+		{
+			name: "uses end datetime",
+			poll: TweetPoll{Options: []string{"a", "b"}, DurationMinutes: 60, EndsAt: now.Add(30 * time.Minute)},
+			want: &misskey.Poll{Choices: []string{"a", "b"}, ExpiresAt: now.Add(30 * time.Minute)},
+		},
+		{
+			name: "falls back to duration",
+			poll: TweetPoll{Options: []string{"a", "b"}, DurationMinutes: 60},
+			want: &misskey.Poll{Choices: []string{"a", "b"}, ExpiresAt: now.Add(time.Hour)},
+		},
+		{name: "closed", poll: TweetPoll{Options: []string{"a", "b"}, DurationMinutes: 60, Closed: true}, wantReason: "poll_closed"},
+		{name: "one option", poll: TweetPoll{Options: []string{"a"}, DurationMinutes: 60}, wantReason: "poll_choice_count"},
+		{name: "expired", poll: TweetPoll{Options: []string{"a", "b"}, EndsAt: now.Add(-time.Minute)}, wantReason: "poll_expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := misskeyPollForTweet(&tt.poll, now)
+			if reason != tt.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tt.wantReason)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("poll = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollFallbackText(t *testing.T) {
+	if got, want := pollFallbackText("which?", []string{"a", "b"}), "which?\n\n・a\n・b"; got != want {
+		t.Fatalf("pollFallbackText() = %q, want %q", got, want)
+	}
+	if got, want := pollFallbackText("", []string{"a", "b"}), "・a\n・b"; got != want {
+		t.Fatalf("pollFallbackText(empty) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+// splitTweetText splits text into parts that each fit within limit. It prefers
+// line and sentence boundaries and only cuts inside a sentence when a single
+// sentence is longer than limit.
+func splitTweetText(text string, limit int) []string {
+	if limit <= 0 || twitter.WeightedLength(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	var current strings.Builder
+	flush := func() {
+		part := strings.TrimSpace(current.String())
+		if part != "" {
+			parts = append(parts, part)
+		}
+		current.Reset()
+	}
+
+	for _, segment := range splitTextSegments(text) {
+		if twitter.WeightedLength(current.String()+segment) <= limit {
+			current.WriteString(segment)
+			continue
+		}
+		flush()
+		segment = strings.TrimLeftFunc(segment, unicode.IsSpace)
+		for twitter.WeightedLength(segment) > limit {
+			head, tail := cutTextAtLength(segment, limit)
+			parts = append(parts, strings.TrimSpace(head))
+			segment = strings.TrimLeftFunc(tail, unicode.IsSpace)
+		}
+		current.WriteString(segment)
+	}
+	flush()
+
+	return parts
+}
+
+// splitTextSegments cuts text after line breaks and sentence terminators while
+// keeping every character, so joining the segments returns the original text.
+func splitTextSegments(text string) []string {
+	var segments []string
+	runes := []rune(text)
+	start := 0
+	for i, r := range runes {
+		cut := false
+		switch r {
+		case '\n', '。', '！', '？':
+			cut = true
+		case '.', '!', '?':
+			cut = i+1 < len(runes) && unicode.IsSpace(runes[i+1])
+		}
+		if cut {
+			segments = append(segments, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+func cutTextAtLength(text string, limit int) (string, string) {
+	var head strings.Builder
+	for i, r := range text {
+		if head.Len() > 0 && twitter.WeightedLength(head.String()+string(r)) > limit {
+			return head.String(), text[i:]
+		}
+		head.WriteRune(r)
+	}
+	return text, ""
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Soli0222/note-tweet-connector/internal/twitter"
+)
+
+func TestSplitTweetText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "fits in one tweet",
+			text:  "short note",
+			limit: 20,
+			want:  []string{"short note"},
+		},
+		{
+			name:  "splits at sentence boundaries",
+			text:  "First sentence. Second sentence. Third one.",
+			limit: 20,
+			want:  []string{"First sentence.", "Second sentence.", "Third one."},
+		},
+		{
+			name:  "splits at line boundaries",
+			text:  "line one\nline two\nline three",
+			limit: 18,
+			want:  []string{"line one\nline two", "line three"},
+		},
+		{
+			name:  "splits japanese sentences",
+			text:  "今日は晴れです。明日は雨です。",
+			limit: 16,
+			want:  []string{"今日は晴れです。", "明日は雨です。"},
+		},
+		{
+			name:  "does not split inside urls",
+			text:  "see https://example.com/a.b ok",
+			limit: 100,
+			want:  []string{"see https://example.com/a.b ok"},
+		},
+		{
+			name:  "cuts a sentence longer than the limit",
+			text:  "abcdefghij",
+			limit: 4,
+			want:  []string{"abcd", "efgh", "ij"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTweetText(tt.text, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("splitTweetText() = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if twitter.WeightedLength(part) > tt.limit {
+					t.Fatalf("part %q exceeds limit %d", part, tt.limit)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,18 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log/slog"
-	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
 	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/mfm"
 	"github.com/Soli0222/note-tweet-connector/internal/misskey"
 	"github.com/Soli0222/note-tweet-connector/internal/notify"
 	"github.com/Soli0222/note-tweet-connector/internal/tracker"
@@ -16,17 +22,24 @@ import (
 )
 
 type IncomingTweet struct {
-	ID               string
-	Text             string
-	UserID           string
-	Username         string
-	URL              string
-	MediaURLs        []string
-	IsRetweet        bool
-	QuotedTweetID    string
-	QuotedUserID     string
-	QuotedUsername   string
-	InReplyToTweetID string
+	ID                  string
+	Text                string
+	UserID              string
+	Username            string
+	URL                 string
+	MediaURLs           []string
+	MediaAltTexts       []string
+	MediaLinks          []string
+	Poll                *TweetPoll
+	IsRetweet           bool
+	QuotedTweetID       string
+	QuotedUserID        string
+	QuotedUsername      string
+	InReplyToTweetID    string
+	InReplyToUserID     string
+	PossiblySensitive   bool
+	EditHistoryTweetIDs []string
+	Hashtags            []string
 }
 
 type Config struct {
@@ -34,8 +47,20 @@ type Config struct {
 	MisskeyToken             string
 	TwitterUsername          string
 	TwitterMediaAllowedHosts []string
-	Twitter                  twitter.Config
-	Notifier                 notify.Notifier
+	MisskeyDriveMaxFileBytes int64
+	LongNotePolicy           string
+	CWPolicy                 string
+	CWMediaPolicy            string
+	CustomEmoji              string
+	// Note2TweetFilter and Tweet2NoteFilter decide which posts are
+	// cross-posted. A nil set uses the built-in rules.
+	Note2TweetFilter *filter.RuleSet
+	Tweet2NoteFilter *filter.RuleSet
+	Twitter          twitter.Config
+	Notifier         notify.Notifier
+	// ClaimLease is the age after which a held claim is taken to be left by
+	// a crashed worker and the post fails permanently. Zero waits forever.
+	ClaimLease time.Duration
 }
 
 type filteredStreamPayload struct {
@@ -44,16 +69,41 @@ type filteredStreamPayload struct {
 }
 
 type filteredStreamTweet struct {
-	ID               string                    `json:"id"`
-	Text             string                    `json:"text"`
-	AuthorID         string                    `json:"author_id"`
-	Attachments      filteredStreamAttachment  `json:"attachments"`
-	ReferencedTweets []filteredStreamReference `json:"referenced_tweets"`
-	InReplyToUserID  string                    `json:"in_reply_to_user_id"`
+	ID                  string                    `json:"id"`
+	Text                string                    `json:"text"`
+	AuthorID            string                    `json:"author_id"`
+	Attachments         filteredStreamAttachment  `json:"attachments"`
+	ReferencedTweets    []filteredStreamReference `json:"referenced_tweets"`
+	InReplyToUserID     string                    `json:"in_reply_to_user_id"`
+	Entities            filteredStreamEntities    `json:"entities"`
+	PossiblySensitive   bool                      `json:"possibly_sensitive"`
+	EditHistoryTweetIDs []string                  `json:"edit_history_tweet_ids"`
+}
+
+// filteredStreamEntities holds the entities the handler uses: URLs are
+// expanded in the note text and hashtags are matched by the filter rules.
+// Mentions are left to mfm.FromPlainText, which links every @username.
+type filteredStreamEntities struct {
+	URLs     []filteredStreamURLEntity     `json:"urls"`
+	Hashtags []filteredStreamHashtagEntity `json:"hashtags"`
+}
+
+type filteredStreamURLEntity struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url"`
+	DisplayURL  string `json:"display_url"`
+	MediaKey    string `json:"media_key"`
+}
+
+type filteredStreamHashtagEntity struct {
+	Tag string `json:"tag"`
 }
 
 type filteredStreamAttachment struct {
 	MediaKeys []string `json:"media_keys"`
+	PollIDs   []string `json:"poll_ids"`
 }
 
 type filteredStreamReference struct {
@@ -65,6 +115,7 @@ type filteredStreamIncludes struct {
 	Tweets []filteredStreamTweet `json:"tweets"`
 	Users  []filteredStreamUser  `json:"users"`
 	Media  []filteredStreamMedia `json:"media"`
+	Polls  []filteredStreamPoll  `json:"polls"`
 }
 
 type filteredStreamUser struct {
@@ -73,17 +124,41 @@ type filteredStreamUser struct {
 }
 
 type filteredStreamMedia struct {
-	MediaKey        string `json:"media_key"`
-	Type            string `json:"type"`
-	URL             string `json:"url"`
-	PreviewImageURL string `json:"preview_image_url"`
+	MediaKey        string                       `json:"media_key"`
+	Type            string                       `json:"type"`
+	URL             string                       `json:"url"`
+	PreviewImageURL string                       `json:"preview_image_url"`
+	AltText         string                       `json:"alt_text"`
+	DurationMS      int64                        `json:"duration_ms"`
+	Variants        []filteredStreamMediaVariant `json:"variants"`
+}
+
+type filteredStreamMediaVariant struct {
+	BitRate     int64  `json:"bit_rate"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+type filteredStreamPoll struct {
+	ID              string                     `json:"id"`
+	Options         []filteredStreamPollOption `json:"options"`
+	DurationMinutes int                        `json:"duration_minutes"`
+	EndDatetime     string                     `json:"end_datetime"`
+	VotingStatus    string                     `json:"voting_status"`
+}
+
+type filteredStreamPollOption struct {
+	Position int    `json:"position"`
+	Label    string `json:"label"`
 }
 
-// RNとat記号の検出用正規表現
-var rnAtPattern = regexp.MustCompile(`^RN\s*\[at\]`)
+const twitterProfileBaseURL = "https://twitter.com/"
 
 var createMisskeyNoteWithOptions = misskey.CreateNoteWithOptions
-var uploadMisskeyDriveFileFromURL = misskey.UploadDriveFileFromURLWithAllowedHosts
+var uploadMisskeyDriveFileFromURL = misskey.UploadDriveFileWithOptions
+var deleteMisskeyNote = misskey.DeleteNote
+var updateMisskeyNote = misskey.UpdateNote
+var misskeyNoteHasReplies = misskey.NoteHasReplies
 
 func Tweet2NoteHandler(ctx context.Context, data []byte, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics) error {
 	return Tweet2NoteHandlerWithConfig(ctx, Config{}, data, crossPostTracker, m)
@@ -124,6 +199,24 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 		return nil
 	}
 
+	// 編集されたtweetは新しいIDで届くので、RTやスキップの判定より先に
+	// 編集前のIDで転送済みのノートを探す
+	editedRecord, edited, err := findEditedTweetRecord(ctx, crossPostTracker, tweet)
+	if err != nil {
+		slog.Error("Failed to check cross-post tracker for edit history",
+			slog.String("tweet_id", tweet.ID),
+			slog.Any("error", err))
+		m.Tweet2NoteErrors.Inc()
+		return err
+	}
+	if edited && editedRecord.Direction != tracker.DirectionTweetToMisskey {
+		slog.Info("Edited tweet was cross-posted from Misskey, skipping",
+			slog.String("tweet_id", tweet.ID),
+			slog.String("original_tweet_id", editedRecord.TweetID))
+		m.Tweet2NoteSkipped.WithLabelValues("edited_crosspost").Inc()
+		return nil
+	}
+
 	tracked, err := crossPostTracker.HasTweet(ctx, tweet.ID)
 	if err != nil {
 		slog.Error("Failed to check cross-post tracker",
@@ -140,14 +233,75 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 		return nil
 	}
 
-	if tweet.InReplyToTweetID != "" {
-		slog.Info("Tweet is a reply, skipping",
+	claim, err := claimPost(ctx, crossPostTracker, tracker.DirectionTweetToMisskey, tweet.ID)
+	if claimed, ok := staleClaim(err, cfg.ClaimLease); ok {
+		slog.Error("Tweet claim outlived its lease, giving up",
 			slog.String("tweet_id", tweet.ID),
-			slog.String("in_reply_to_tweet_id", tweet.InReplyToTweetID))
-		m.Tweet2NoteSkipped.WithLabelValues("reply").Inc()
+			slog.Time("claimed_at", claimed.ClaimedAt))
+		m.Tweet2NoteErrors.Inc()
+		return errStaleClaim
+	}
+	if errors.Is(err, tracker.ErrClaimed) {
+		slog.Info("Tweet is being cross-posted by another worker",
+			slog.String("tweet_id", tweet.ID))
+		m.Tweet2NoteSkipped.WithLabelValues("claimed").Inc()
+		return err
+	}
+	if err != nil {
+		slog.Error("Failed to claim tweet in cross-post tracker",
+			slog.String("tweet_id", tweet.ID),
+			slog.Any("error", err))
+		m.Tweet2NoteErrors.Inc()
+		return err
+	}
+	defer claim.release(ctx)
+
+	// Another worker may have posted the tweet and completed its claim between
+	// the check above and the claim, so the tracker is read again.
+	tracked, err = crossPostTracker.HasTweet(ctx, tweet.ID)
+	if err != nil {
+		slog.Error("Failed to check cross-post tracker",
+			slog.String("tweet_id", tweet.ID),
+			slog.Any("error", err))
+		m.Tweet2NoteErrors.Inc()
+		return err
+	}
+	if tracked {
+		slog.Info("Tweet was cross-posted by another worker, skipping",
+			slog.String("tweet_id", tweet.ID))
+		m.Tweet2NoteSkipped.WithLabelValues("crosspost").Inc()
+		m.TrackerDuplicatesHit.Inc()
 		return nil
 	}
 
+	replyNoteID := ""
+	if tweet.InReplyToTweetID != "" {
+		if !tweetReplySameAuthor(tweet) {
+			slog.Info("Tweet is a reply, skipping",
+				slog.String("tweet_id", tweet.ID),
+				slog.String("in_reply_to_tweet_id", tweet.InReplyToTweetID))
+			m.Tweet2NoteSkipped.WithLabelValues("reply").Inc()
+			return nil
+		}
+		resolvedNoteID, ok, err := resolveMisskeyNoteIDForTweet(ctx, crossPostTracker, tweet.InReplyToTweetID)
+		if err != nil {
+			slog.Error("Failed to resolve reply parent from tracker",
+				slog.String("tweet_id", tweet.ID),
+				slog.String("in_reply_to_tweet_id", tweet.InReplyToTweetID),
+				slog.Any("error", err))
+			m.Tweet2NoteErrors.Inc()
+			return err
+		}
+		if !ok {
+			slog.Info("Reply parent not found in tracker, skipping",
+				slog.String("tweet_id", tweet.ID),
+				slog.String("in_reply_to_tweet_id", tweet.InReplyToTweetID))
+			m.Tweet2NoteSkipped.WithLabelValues("reply_parent_missing").Inc()
+			return nil
+		}
+		replyNoteID = resolvedNoteID
+	}
+
 	tweetText := tweet.Text
 	renoteID := ""
 
@@ -155,15 +309,34 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 		tweetText = tweetText + "\n\n" + tweet.URL
 	}
 
-	// "RN [at]" で始まるツイートをスキップ
-	if rnAtPattern.MatchString(tweetText) {
-		escapedText := strings.ReplaceAll(tweetText, "\n", "\\n")
-		slog.Info("Skipping RN [at] tweet",
+	decision := tweet2NoteFilter(cfg).Evaluate(tweetFilterPost(tweet))
+	if decision.Skip {
+		escapedText := strings.ReplaceAll(tweet.Text, "\n", "\\n")
+		slog.Info("Tweet matched a filter rule, skipping",
+			slog.String("tweet_id", tweet.ID),
+			slog.String("rule", decision.Rule),
 			slog.String("text_preview", escapedText[:min(50, len(escapedText))]))
-		m.Tweet2NoteSkipped.WithLabelValues("rn_pattern").Inc()
+		m.Tweet2NoteSkipped.WithLabelValues(decision.Rule).Inc()
 		return nil
 	}
 
+	var poll *misskey.Poll
+	if tweet.Poll != nil {
+		converted, reason := misskeyPollForTweet(tweet.Poll, time.Now())
+		if reason != "" {
+			slog.Info("Poll does not fit Misskey, posting options as text",
+				slog.String("tweet_id", tweet.ID),
+				slog.String("reason", reason))
+			m.PollFallbacks.WithLabelValues("tweet2note", reason).Inc()
+			tweetText = pollFallbackText(tweetText, tweet.Poll.Options)
+		} else {
+			poll = converted
+		}
+	}
+
+	// Twitter の @ メンションや MFM 記法として解釈されないようにエスケープ
+	tweetText = mfm.FromPlainText(tweetText, mfm.EscapeOptions{MentionBaseURL: twitterProfileBaseURL})
+
 	if tweet.QuotedTweetID != "" {
 		if tweetQuoteSameAuthor(tweet) {
 			resolvedNoteID, ok, err := resolveMisskeyNoteIDForTweet(ctx, crossPostTracker, tweet.QuotedTweetID)
@@ -201,11 +374,39 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 		return fmt.Errorf("misskey token is not configured")
 	}
 
+	if edited {
+		applied, err := updateEditedNote(ctx, cfg, tweet, editedRecord, tweetText, decision.Overrides, crossPostTracker, m)
+		if err != nil {
+			return err
+		}
+		if applied {
+			claim.complete(ctx)
+			return nil
+		}
+	}
+
 	var fileIDs []string
-	if !tweet.IsRetweet {
+	if !tweet.IsRetweet && (decision.Overrides.Media == nil || *decision.Overrides.Media) {
 		fileIDs = make([]string, 0, min(len(tweet.MediaURLs), 4))
 		for i := 0; i < len(tweet.MediaURLs) && i < 4; i++ {
-			fileID, err := uploadMisskeyDriveFileFromURL(ctx, cfg.MisskeyHost, cfg.MisskeyToken, tweet.MediaURLs[i], cfg.TwitterMediaAllowedHosts)
+			options := misskey.UploadDriveFileOptions{
+				URL:          tweet.MediaURLs[i],
+				AllowedHosts: cfg.TwitterMediaAllowedHosts,
+				IsSensitive:  tweet.PossiblySensitive,
+				MaxBytes:     cfg.MisskeyDriveMaxFileBytes,
+			}
+			if i < len(tweet.MediaAltTexts) {
+				options.Comment = tweet.MediaAltTexts[i]
+			}
+			fileID, err := uploadMisskeyDriveFileFromURL(ctx, cfg.MisskeyHost, cfg.MisskeyToken, options)
+			if errors.Is(err, misskey.ErrMediaTooLarge) {
+				slog.Warn("Tweet media is larger than the Misskey Drive limit, dropping it",
+					slog.String("tweet_id", tweet.ID),
+					slog.String("media_url", tweet.MediaURLs[i]),
+					slog.Any("error", err))
+				m.MediaSkipped.WithLabelValues("tweet2note", "too_large").Inc()
+				continue
+			}
 			if err != nil {
 				slog.Error("Failed to upload tweet media to Misskey Drive",
 					slog.String("media_url", tweet.MediaURLs[i]),
@@ -218,25 +419,42 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 		}
 	}
 
+	// 添付済みの画像を指す末尾のリンクは不要なので取り除く
+	if len(fileIDs) > 0 {
+		tweetText = trimTrailingMediaLinks(tweetText, tweet.MediaLinks)
+	}
+
 	noteID, err := createMisskeyNoteWithOptions(ctx, cfg.MisskeyHost, cfg.MisskeyToken, misskey.CreateNoteOptions{
-		Text:     tweetText,
-		FileIDs:  fileIDs,
-		RenoteID: renoteID,
+		Text:       tweetText,
+		FileIDs:    fileIDs,
+		RenoteID:   renoteID,
+		ReplyID:    replyNoteID,
+		Poll:       poll,
+		Visibility: decision.Overrides.Visibility,
+		CW:         decision.Overrides.CW,
 	})
 
 	if err == nil {
 		if noteID == "" {
+			claim.keep()
 			m.Tweet2NoteErrors.Inc()
 			return errMissingPostedID("misskey note")
 		}
-		if err := crossPostTracker.RememberTweetToMisskey(ctx, tweet.ID, noteID); err != nil {
+		if edited {
+			err = crossPostTracker.ReplaceTweetToMisskey(ctx, editedRecord.TweetID, tweet.ID, noteID)
+		} else {
+			err = crossPostTracker.RememberTweetToMisskey(ctx, tweet.ID, noteID)
+		}
+		if err != nil {
 			slog.Error("Posted note but failed to record cross-post",
 				slog.String("tweet_id", tweet.ID),
 				slog.String("note_id", noteID),
 				slog.Any("error", err))
+			claim.keep()
 			m.Tweet2NoteErrors.Inc()
 			return err
 		}
+		claim.complete(ctx)
 		escapedText := strings.ReplaceAll(tweetText, "\n", "\\n")
 		slog.Info("Successfully forwarded tweet to note",
 			slog.String("tweet_id", tweet.ID),
@@ -244,9 +462,17 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 			slog.String("text_preview", escapedText[:min(100, len(escapedText))]),
 			slog.String("tweet_url", tweet.URL),
 			slog.String("renote_id", renoteID),
+			slog.String("reply_id", replyNoteID),
 			slog.Bool("has_media", len(fileIDs) > 0),
-			slog.Int("media_count", len(fileIDs)))
+			slog.Int("media_count", len(fileIDs)),
+			slog.Bool("has_poll", poll != nil))
 		m.Tweet2NoteSuccess.Inc()
+		if len(fileIDs) > 0 && tweet.PossiblySensitive {
+			m.SensitiveMediaForwarded.WithLabelValues("tweet2note").Inc()
+		}
+		if edited {
+			replaceEditedNote(ctx, cfg, tweet.ID, editedRecord.MisskeyNoteID)
+		}
 	} else {
 		slog.Error("Failed to post tweet to note", slog.Any("error", err))
 		notifyMisskeyFailure(ctx, cfg, "create note", tweet.ID, err, -1)
@@ -257,6 +483,97 @@ func HandleIncomingTweetWithConfig(ctx context.Context, cfg Config, tweet Incomi
 	return nil
 }
 
+// findEditedTweetRecord returns the tracker record of an earlier version of an
+// edited tweet, starting from the most recent version.
+func findEditedTweetRecord(ctx context.Context, crossPostTracker tracker.CrossPostTracker, tweet IncomingTweet) (tracker.CrossPostRecord, bool, error) {
+	for i := len(tweet.EditHistoryTweetIDs) - 1; i >= 0; i-- {
+		tweetID := tweet.EditHistoryTweetIDs[i]
+		if tweetID == "" || tweetID == tweet.ID {
+			continue
+		}
+		record, ok, err := crossPostTracker.FindByTweetID(ctx, tweetID)
+		if err != nil || ok {
+			return record, ok, err
+		}
+	}
+	return tracker.CrossPostRecord{}, false, nil
+}
+
+// updateEditedNote applies an edited tweet to the note that mirrored its
+// previous version with notes/update, which keeps the note's replies. It
+// reports false when the server cannot update notes and the note has no
+// replies, in which case the caller recreates the note. A note with replies
+// is kept unchanged instead, because deleting it would delete the replies.
+func updateEditedNote(ctx context.Context, cfg Config, tweet IncomingTweet, record tracker.CrossPostRecord, text string, overrides filter.Overrides, crossPostTracker tracker.CrossPostTracker, m *metrics.Metrics) (bool, error) {
+	if !tweet.IsRetweet && len(tweet.MediaURLs) > 0 && (overrides.Media == nil || *overrides.Media) {
+		text = trimTrailingMediaLinks(text, tweet.MediaLinks)
+	}
+
+	updateErr := updateMisskeyNote(ctx, cfg.MisskeyHost, cfg.MisskeyToken, record.MisskeyNoteID, text, overrides.CW)
+	unsupported := errors.Is(updateErr, misskey.ErrNoteUpdateUnsupported)
+	if updateErr != nil && !unsupported {
+		slog.Error("Failed to update note for edited tweet",
+			slog.String("tweet_id", tweet.ID),
+			slog.String("note_id", record.MisskeyNoteID),
+			slog.Any("error", updateErr))
+		notifyMisskeyFailure(ctx, cfg, "update note", tweet.ID, updateErr, -1)
+		m.Tweet2NoteErrors.Inc()
+		return false, updateErr
+	}
+	if unsupported {
+		hasReplies, err := misskeyNoteHasReplies(ctx, cfg.MisskeyHost, cfg.MisskeyToken, record.MisskeyNoteID)
+		if err != nil {
+			slog.Error("Failed to check replies of the note for an edited tweet",
+				slog.String("tweet_id", tweet.ID),
+				slog.String("note_id", record.MisskeyNoteID),
+				slog.Any("error", err))
+			m.Tweet2NoteErrors.Inc()
+			return false, err
+		}
+		if !hasReplies {
+			return false, nil
+		}
+	}
+
+	if err := crossPostTracker.ReplaceTweetToMisskey(ctx, record.TweetID, tweet.ID, record.MisskeyNoteID); err != nil {
+		slog.Error("Failed to record edited tweet",
+			slog.String("tweet_id", tweet.ID),
+			slog.String("note_id", record.MisskeyNoteID),
+			slog.Any("error", err))
+		m.Tweet2NoteErrors.Inc()
+		return false, err
+	}
+	if unsupported {
+		slog.Warn("Misskey cannot update notes and the note has replies, keeping the note of the previous version",
+			slog.String("tweet_id", tweet.ID),
+			slog.String("note_id", record.MisskeyNoteID))
+		m.Tweet2NoteSkipped.WithLabelValues("edit_unsupported").Inc()
+		return true, nil
+	}
+	slog.Info("Updated note for edited tweet",
+		slog.String("tweet_id", tweet.ID),
+		slog.String("note_id", record.MisskeyNoteID))
+	m.Tweet2NoteSuccess.Inc()
+	return true, nil
+}
+
+// replaceEditedNote deletes the note that mirrored the previous version of an
+// edited tweet. The new note is already posted, so a failure is reported but
+// does not fail the tweet.
+func replaceEditedNote(ctx context.Context, cfg Config, tweetID, oldNoteID string) {
+	if err := deleteMisskeyNote(ctx, cfg.MisskeyHost, cfg.MisskeyToken, oldNoteID); err != nil {
+		slog.Error("Failed to delete note for the previous version of an edited tweet",
+			slog.String("tweet_id", tweetID),
+			slog.String("note_id", oldNoteID),
+			slog.Any("error", err))
+		notifyMisskeyFailure(ctx, cfg, "delete note", tweetID, err, -1)
+		return
+	}
+	slog.Info("Replaced note for edited tweet",
+		slog.String("tweet_id", tweetID),
+		slog.String("old_note_id", oldNoteID))
+}
+
 func parseFilteredStreamPayload(data []byte) ([]IncomingTweet, error) {
 	return parseFilteredStreamPayloadWithConfig(data, Config{})
 }
@@ -266,18 +583,66 @@ func parseFilteredStreamPayloadWithConfig(data []byte, cfg Config) ([]IncomingTw
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return nil, err
 	}
+	return incomingTweetsFromPayload(payload, cfg), nil
+}
+
+// ParseUserTimelineWithConfig converts a page of GET /2/users/:id/tweets into
+// incoming tweets, oldest first.
+func ParseUserTimelineWithConfig(data []byte, cfg Config) ([]IncomingTweet, error) {
+	var page struct {
+		Data     []filteredStreamTweet  `json:"data"`
+		Includes filteredStreamIncludes `json:"includes"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+
+	var tweets []IncomingTweet
+	for i := len(page.Data) - 1; i >= 0; i-- {
+		payload := filteredStreamPayload{Data: page.Data[i], Includes: page.Includes}
+		tweets = append(tweets, incomingTweetsFromPayload(payload, cfg)...)
+	}
+	return tweets, nil
+}
+
+// UserTimelinePayloads splits a page of GET /2/users/:id/tweets into
+// Filtered Stream payloads of one tweet each, oldest first.
+func UserTimelinePayloads(data []byte) ([][]byte, error) {
+	var page struct {
+		Data     []json.RawMessage `json:"data"`
+		Includes json.RawMessage   `json:"includes"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+
+	var payloads [][]byte
+	for i := len(page.Data) - 1; i >= 0; i-- {
+		payload, err := json.Marshal(struct {
+			Data     json.RawMessage `json:"data"`
+			Includes json.RawMessage `json:"includes,omitempty"`
+		}{Data: page.Data[i], Includes: page.Includes})
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+func incomingTweetsFromPayload(payload filteredStreamPayload, cfg Config) []IncomingTweet {
 	if payload.Data.ID == "" && payload.Data.Text == "" && len(payload.Data.Attachments.MediaKeys) == 0 {
-		return nil, nil
+		return nil
 	}
 
-	text := payload.Data.Text
+	text, mediaLinks := expandTweetText(payload.Data)
 	isRetweet := filteredStreamRetweetedTweetID(payload) != ""
-	var mediaURLs []string
+	var mediaURLs, mediaAltTexts []string
 	if !isRetweet {
-		mediaURLs = filteredStreamMediaURLs(payload)
+		mediaURLs, mediaAltTexts = filteredStreamMediaURLs(payload, cfg.MisskeyDriveMaxFileBytes)
 	}
 	if text == "" && len(mediaURLs) == 0 {
-		return nil, nil
+		return nil
 	}
 
 	username := filteredStreamUsername(payload, payload.Data.AuthorID)
@@ -291,18 +656,63 @@ func parseFilteredStreamPayloadWithConfig(data []byte, cfg Config) ([]IncomingTw
 	}
 
 	return []IncomingTweet{{
-		ID:               payload.Data.ID,
-		Text:             text,
-		UserID:           payload.Data.AuthorID,
-		Username:         username,
-		URL:              tweetURL,
-		MediaURLs:        mediaURLs,
-		IsRetweet:        isRetweet,
-		QuotedTweetID:    quotedTweetID,
-		QuotedUserID:     quotedUserID,
-		QuotedUsername:   quotedUsername,
-		InReplyToTweetID: filteredStreamReplyTweetID(payload.Data),
-	}}, nil
+		ID:                  payload.Data.ID,
+		Text:                text,
+		UserID:              payload.Data.AuthorID,
+		Username:            username,
+		URL:                 tweetURL,
+		MediaURLs:           mediaURLs,
+		MediaAltTexts:       mediaAltTexts,
+		MediaLinks:          mediaLinks,
+		Poll:                filteredStreamTweetPoll(payload),
+		IsRetweet:           isRetweet,
+		QuotedTweetID:       quotedTweetID,
+		QuotedUserID:        quotedUserID,
+		QuotedUsername:      quotedUsername,
+		InReplyToTweetID:    filteredStreamReplyTweetID(payload.Data),
+		InReplyToUserID:     filteredStreamReplyUserID(payload),
+		PossiblySensitive:   payload.Data.PossiblySensitive,
+		EditHistoryTweetIDs: payload.Data.EditHistoryTweetIDs,
+		Hashtags:            filteredStreamHashtags(payload.Data),
+	}}
+}
+
+// expandTweetText decodes the HTML entities Twitter adds to tweet text and
+// replaces t.co links with their expanded URLs. It also returns the expanded
+// URLs of links that point at the tweet's attached media.
+func expandTweetText(tweet filteredStreamTweet) (string, []string) {
+	text := html.UnescapeString(tweet.Text)
+	var mediaLinks []string
+	for _, entity := range tweet.Entities.URLs {
+		if entity.URL == "" || entity.ExpandedURL == "" {
+			continue
+		}
+		text = strings.ReplaceAll(text, entity.URL, entity.ExpandedURL)
+		if isMediaURLEntity(entity) && !slices.Contains(mediaLinks, entity.ExpandedURL) {
+			mediaLinks = append(mediaLinks, entity.ExpandedURL)
+		}
+	}
+	return text, mediaLinks
+}
+
+func isMediaURLEntity(entity filteredStreamURLEntity) bool {
+	return entity.MediaKey != "" ||
+		strings.HasPrefix(entity.DisplayURL, "pic.twitter.com/") ||
+		strings.HasPrefix(entity.DisplayURL, "pic.x.com/")
+}
+
+// trimTrailingMediaLinks removes media links from the end of text.
+func trimTrailingMediaLinks(text string, mediaLinks []string) string {
+	for {
+		rest := strings.TrimRightFunc(text, unicode.IsSpace)
+		i := slices.IndexFunc(mediaLinks, func(link string) bool {
+			return strings.HasSuffix(rest, link)
+		})
+		if i < 0 {
+			return text
+		}
+		text = strings.TrimRightFunc(strings.TrimSuffix(rest, mediaLinks[i]), unicode.IsSpace)
+	}
 }
 
 func filteredStreamUsername(payload filteredStreamPayload, userID string) string {
@@ -324,6 +734,10 @@ func tweetQuoteSameAuthor(tweet IncomingTweet) bool {
 	return false
 }
 
+func tweetReplySameAuthor(tweet IncomingTweet) bool {
+	return tweet.UserID != "" && tweet.UserID == tweet.InReplyToUserID
+}
+
 func resolveMisskeyNoteIDForTweet(ctx context.Context, crossPostTracker tracker.CrossPostTracker, tweetID string) (string, bool, error) {
 	record, ok, err := crossPostTracker.FindByTweetID(ctx, tweetID)
 	if err != nil {
@@ -335,7 +749,9 @@ func resolveMisskeyNoteIDForTweet(ctx context.Context, crossPostTracker tracker.
 	return record.MisskeyNoteID, true, nil
 }
 
-func filteredStreamMediaURLs(payload filteredStreamPayload) []string {
+// filteredStreamMediaURLs returns the URLs of the media attached to the tweet
+// and their alt texts in the same order.
+func filteredStreamMediaURLs(payload filteredStreamPayload, maxBytes int64) ([]string, []string) {
 	mediaByKey := make(map[string]filteredStreamMedia, len(payload.Includes.Media))
 	for _, media := range payload.Includes.Media {
 		mediaByKey[media.MediaKey] = media
@@ -343,18 +759,94 @@ func filteredStreamMediaURLs(payload filteredStreamPayload) []string {
 
 	seen := map[string]struct{}{}
 	mediaURLs := make([]string, 0, len(payload.Data.Attachments.MediaKeys))
+	altTexts := make([]string, 0, len(payload.Data.Attachments.MediaKeys))
 	for _, mediaKey := range payload.Data.Attachments.MediaKeys {
 		media, ok := mediaByKey[mediaKey]
-		if !ok || media.Type != "photo" || media.URL == "" {
+		if !ok {
+			continue
+		}
+		mediaURL := filteredStreamMediaURL(media, maxBytes)
+		if mediaURL == "" {
+			continue
+		}
+		if _, ok := seen[mediaURL]; ok {
+			continue
+		}
+		seen[mediaURL] = struct{}{}
+		mediaURLs = append(mediaURLs, mediaURL)
+		altTexts = append(altTexts, media.AltText)
+	}
+	return mediaURLs, altTexts
+}
+
+// filteredStreamMediaURL returns the URL to upload for media. Videos and
+// animated GIFs use the highest bitrate MP4 variant whose estimated size fits
+// in maxBytes. The size of a variant without a bitrate, as animated GIFs
+// have, is unknown; it is used only when no variant is known to fit, and the
+// upload rejects it if it turns out to be larger than maxBytes.
+func filteredStreamMediaURL(media filteredStreamMedia, maxBytes int64) string {
+	switch media.Type {
+	case "photo":
+		return media.URL
+	case "video", "animated_gif":
+	default:
+		return ""
+	}
+
+	var best, unknownSize *filteredStreamMediaVariant
+	for i := range media.Variants {
+		variant := &media.Variants[i]
+		if variant.ContentType != "video/mp4" || variant.URL == "" {
+			continue
+		}
+		if variant.BitRate <= 0 {
+			if unknownSize == nil {
+				unknownSize = variant
+			}
+			continue
+		}
+		if maxBytes > 0 && variant.BitRate*media.DurationMS/8000 > maxBytes {
 			continue
 		}
-		if _, ok := seen[media.URL]; ok {
+		if best == nil || variant.BitRate > best.BitRate {
+			best = variant
+		}
+	}
+	if best == nil {
+		best = unknownSize
+	}
+	if best == nil {
+		return ""
+	}
+	return best.URL
+}
+
+func filteredStreamTweetPoll(payload filteredStreamPayload) *TweetPoll {
+	if len(payload.Data.Attachments.PollIDs) == 0 {
+		return nil
+	}
+	pollID := payload.Data.Attachments.PollIDs[0]
+	for _, poll := range payload.Includes.Polls {
+		if poll.ID != pollID {
 			continue
 		}
-		seen[media.URL] = struct{}{}
-		mediaURLs = append(mediaURLs, media.URL)
+		options := slices.Clone(poll.Options)
+		slices.SortFunc(options, func(a, b filteredStreamPollOption) int {
+			return a.Position - b.Position
+		})
+		tweetPoll := &TweetPoll{
+			DurationMinutes: poll.DurationMinutes,
+			Closed:          poll.VotingStatus == "closed",
+		}
+		for _, option := range options {
+			tweetPoll.Options = append(tweetPoll.Options, option.Label)
+		}
+		if endsAt, err := time.Parse(time.RFC3339, poll.EndDatetime); err == nil {
+			tweetPoll.EndsAt = endsAt
+		}
+		return tweetPoll
 	}
-	return mediaURLs
+	return nil
 }
 
 func filteredStreamQuote(payload filteredStreamPayload) (tweetID, userID, username string) {
@@ -405,8 +897,22 @@ func filteredStreamReplyTweetID(tweet filteredStreamTweet) string {
 			return ref.ID
 		}
 	}
-	if tweet.InReplyToUserID != "" {
-		return tweet.InReplyToUserID
+	return ""
+}
+
+func filteredStreamReplyUserID(payload filteredStreamPayload) string {
+	if payload.Data.InReplyToUserID != "" {
+		return payload.Data.InReplyToUserID
+	}
+	for _, ref := range payload.Data.ReferencedTweets {
+		if ref.Type != "replied_to" {
+			continue
+		}
+		for _, tweet := range payload.Includes.Tweets {
+			if tweet.ID == ref.ID {
+				return tweet.AuthorID
+			}
+		}
 	}
 	return ""
 }
@@ -415,5 +921,5 @@ func buildTweetURL(username, tweetID string) string {
 	if username == "" || tweetID == "" {
 		return ""
 	}
-	return "https://twitter.com/" + username + "/status/" + tweetID
+	return twitterProfileBaseURL + username + "/status/" + tweetID
 }
@@ -2,10 +2,13 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Soli0222/note-tweet-connector/internal/filter"
 	"github.com/Soli0222/note-tweet-connector/internal/metrics"
 	"github.com/Soli0222/note-tweet-connector/internal/misskey"
 	"github.com/Soli0222/note-tweet-connector/internal/tracker"
@@ -64,6 +67,8 @@ func TestParseFilteredStreamPayload(t *testing.T) {
 						"id": "123456789",
 						"text": "with media",
 						"author_id": "111",
+						"possibly_sensitive": true,
+						"edit_history_tweet_ids": ["123456788", "123456789"],
 						"attachments": {
 							"media_keys": ["photo-1", "video-1", "photo-2", "photo-2"]
 						}
@@ -83,7 +88,8 @@ func TestParseFilteredStreamPayload(t *testing.T) {
 							{
 								"media_key": "photo-2",
 								"type": "photo",
-								"url": "https://pbs.twimg.com/media/photo2.png"
+								"url": "https://pbs.twimg.com/media/photo2.png",
+								"alt_text": "second photo"
 							}
 						],
 						"users": [
@@ -105,6 +111,16 @@ func TestParseFilteredStreamPayload(t *testing.T) {
 				if !reflect.DeepEqual(tweets[0].MediaURLs, want) {
 					t.Fatalf("MediaURLs = %#v, want %#v", tweets[0].MediaURLs, want)
 				}
+				if !tweets[0].PossiblySensitive {
+					t.Fatal("PossiblySensitive = false, want true")
+				}
+				if !reflect.DeepEqual(tweets[0].EditHistoryTweetIDs, []string{"123456788", "123456789"}) {
+					t.Fatalf("EditHistoryTweetIDs = %#v", tweets[0].EditHistoryTweetIDs)
+				}
+				wantAltTexts := []string{"", "second photo"}
+				if !reflect.DeepEqual(tweets[0].MediaAltTexts, wantAltTexts) {
+					t.Fatalf("MediaAltTexts = %#v, want %#v", tweets[0].MediaAltTexts, wantAltTexts)
+				}
 			},
 		},
 		{
@@ -269,6 +285,97 @@ func TestParseFilteredStreamPayload(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "expand links and decode entities",
+			payload: `{
+					"data": {
+						"id": "123456789",
+						"text": "Q&amp;A &lt;3 https://t.co/abc #go @dummy_user https://t.co/pic",
+						"author_id": "111",
+						"entities": {
+							"urls": [
+								{
+									"start": 13,
+									"end": 36,
+									"url": "https://t.co/abc",
+									"expanded_url": "https://example.com/?a=1&copy=2",
+									"display_url": "example.com/?a=1&copy=2"
+								},
+								{
+									"start": 53,
+									"end": 76,
+									"url": "https://t.co/pic",
+									"expanded_url": "https://twitter.com/dummy_user/status/123456789/photo/1",
+									"display_url": "pic.twitter.com/pic",
+									"media_key": "photo-1"
+								}
+							],
+							"mentions": [
+								{"start": 41, "end": 52, "username": "dummy_user", "id": "111"}
+							],
+							"hashtags": [
+								{"start": 37, "end": 40, "tag": "go"}
+							]
+						}
+					}
+				}`,
+			check: func(t *testing.T, tweets []IncomingTweet) {
+				if len(tweets) != 1 {
+					t.Fatalf("expected 1 tweet, got %d", len(tweets))
+				}
+				wantText := "Q&A <3 https://example.com/?a=1&copy=2 #go @dummy_user https://twitter.com/dummy_user/status/123456789/photo/1"
+				if tweets[0].Text != wantText {
+					t.Fatalf("Text = %q, want %q", tweets[0].Text, wantText)
+				}
+				wantLinks := []string{"https://twitter.com/dummy_user/status/123456789/photo/1"}
+				if !reflect.DeepEqual(tweets[0].MediaLinks, wantLinks) {
+					t.Fatalf("MediaLinks = %#v, want %#v", tweets[0].MediaLinks, wantLinks)
+				}
+				if !reflect.DeepEqual(tweets[0].Hashtags, []string{"go"}) {
+					t.Fatalf("Hashtags = %#v, want the hashtag entity for the filter rules", tweets[0].Hashtags)
+				}
+			},
+		},
+		{
+			name: "extract poll",
+			payload: `{
+					"data": {
+						"id": "123456789",
+						"text": "which?",
+						"author_id": "111",
+						"attachments": {
+							"poll_ids": ["poll-1"]
+						}
+					},
+					"includes": {
+						"polls": [
+							{
+								"id": "poll-1",
+								"options": [
+									{"position": 2, "label": "second"},
+									{"position": 1, "label": "first"}
+								],
+								"duration_minutes": 60,
+								"end_datetime": "2026-01-01T01:00:00.000Z",
+								"voting_status": "open"
+							}
+						]
+					}
+				}`,
+			check: func(t *testing.T, tweets []IncomingTweet) {
+				if len(tweets) != 1 {
+					t.Fatalf("expected 1 tweet, got %d", len(tweets))
+				}
+				want := &TweetPoll{
+					Options:         []string{"first", "second"},
+					DurationMinutes: 60,
+					EndsAt:          time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC),
+				}
+				if !reflect.DeepEqual(tweets[0].Poll, want) {
+					t.Fatalf("Poll = %#v, want %#v", tweets[0].Poll, want)
+				}
+			},
+		},
 		{
 			name:    "invalid JSON",
 			payload: `{invalid json}`,
@@ -299,6 +406,199 @@ func TestParseFilteredStreamPayload(t *testing.T) {
 	}
 }
 
+func TestParseUserTimelineWithConfig(t *testing.T) {
+	page := `{
+		"data": [
+			{"id": "30", "text": "newer", "author_id": "user-1", "attachments": {"media_keys": ["3_1"]}, "edit_history_tweet_ids": ["30"]},
+			{"id": "20", "text": "older", "author_id": "user-1", "edit_history_tweet_ids": ["20"]}
+		],
+		"includes": {
+			"users": [{"id": "user-1", "username": "alice"}],
+			"media": [{"media_key": "3_1", "type": "photo", "url": "https://pbs.twimg.com/media/a.jpg"}]
+		},
+		"meta": {"newest_id": "30", "oldest_id": "20", "result_count": 2}
+	}`
+
+	tweets, err := ParseUserTimelineWithConfig([]byte(page), testHandlerConfig())
+	if err != nil {
+		t.Fatalf("ParseUserTimelineWithConfig() error = %v", err)
+	}
+	if len(tweets) != 2 {
+		t.Fatalf("len(tweets) = %d, want 2", len(tweets))
+	}
+	if tweets[0].ID != "20" || tweets[1].ID != "30" {
+		t.Fatalf("tweet IDs = %q, %q; want oldest first", tweets[0].ID, tweets[1].ID)
+	}
+	if tweets[1].Username != "alice" || tweets[1].URL != "https://twitter.com/alice/status/30" {
+		t.Fatalf("tweet = %+v, want username from includes", tweets[1])
+	}
+	if !reflect.DeepEqual(tweets[1].MediaURLs, []string{"https://pbs.twimg.com/media/a.jpg"}) || len(tweets[0].MediaURLs) != 0 {
+		t.Fatalf("MediaURLs = %v, %v; want media only on tweet 30", tweets[0].MediaURLs, tweets[1].MediaURLs)
+	}
+}
+
+func TestUserTimelinePayloads(t *testing.T) {
+	page := `{
+		"data": [
+			{"id": "30", "text": "newer", "author_id": "user-1", "attachments": {"media_keys": ["3_1"]}},
+			{"id": "20", "text": "older", "author_id": "user-1"}
+		],
+		"includes": {
+			"users": [{"id": "user-1", "username": "alice"}],
+			"media": [{"media_key": "3_1", "type": "photo", "url": "https://pbs.twimg.com/media/a.jpg"}]
+		}
+	}`
+
+	payloads, err := UserTimelinePayloads([]byte(page))
+	if err != nil {
+		t.Fatalf("UserTimelinePayloads() error = %v", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("len(payloads) = %d, want 2", len(payloads))
+	}
+	var tweets []IncomingTweet
+	for _, payload := range payloads {
+		parsed, err := parseFilteredStreamPayloadWithConfig(payload, testHandlerConfig())
+		if err != nil {
+			t.Fatalf("parseFilteredStreamPayloadWithConfig() error = %v", err)
+		}
+		tweets = append(tweets, parsed...)
+	}
+	if len(tweets) != 2 || tweets[0].ID != "20" || tweets[1].ID != "30" {
+		t.Fatalf("tweets = %+v, want one tweet per payload, oldest first", tweets)
+	}
+	if tweets[1].Username != "alice" || !reflect.DeepEqual(tweets[1].MediaURLs, []string{"https://pbs.twimg.com/media/a.jpg"}) {
+		t.Fatalf("tweet = %+v, want the includes in every payload", tweets[1])
+	}
+}
+
+func TestFilteredStreamMediaURL(t *testing.T) {
+	video := filteredStreamMedia{
+		Type:            "video",
+		PreviewImageURL: "https://pbs.twimg.com/media/video.jpg",
+		DurationMS:      10000,
+		Variants: []filteredStreamMediaVariant{
+			{ContentType: "application/x-mpegURL", URL: "https://video.twimg.com/video.m3u8"},
+			{BitRate: 832000, ContentType: "video/mp4", URL: "https://video.twimg.com/480.mp4"},
+			{BitRate: 2176000, ContentType: "video/mp4", URL: "https://video.twimg.com/720.mp4"},
+			{BitRate: 256000, ContentType: "video/mp4", URL: "https://video.twimg.com/240.mp4"},
+		},
+	}
+	gif := filteredStreamMedia{
+		Type: "animated_gif",
+		Variants: []filteredStreamMediaVariant{
+			{ContentType: "video/mp4", URL: "https://video.twimg.com/tweet_video/gif.mp4"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		media    filteredStreamMedia
+		maxBytes int64
+		want     string
+	}{
+		{name: "photo", media: filteredStreamMedia{Type: "photo", URL: "https://pbs.twimg.com/media/photo.png"}, want: "https://pbs.twimg.com/media/photo.png"},
+		{name: "highest bitrate without limit", media: video, want: "https://video.twimg.com/720.mp4"},
+		{name: "highest bitrate under limit", media: video, maxBytes: 2 * 1024 * 1024, want: "https://video.twimg.com/480.mp4"},
+		{name: "no variant under limit", media: video, maxBytes: 100 * 1024},
+		{name: "animated gif of unknown size", media: gif, maxBytes: 1, want: "https://video.twimg.com/tweet_video/gif.mp4"},
+		{name: "known size preferred over unknown size", media: filteredStreamMedia{
+			Type:       "video",
+			DurationMS: 10000,
+			Variants: []filteredStreamMediaVariant{
+				{ContentType: "video/mp4", URL: "https://video.twimg.com/unknown.mp4"},
+				{BitRate: 256000, ContentType: "video/mp4", URL: "https://video.twimg.com/240.mp4"},
+			},
+		}, maxBytes: 1024 * 1024, want: "https://video.twimg.com/240.mp4"},
+		{name: "video without variants", media: filteredStreamMedia{Type: "video", PreviewImageURL: "https://pbs.twimg.com/media/video.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filteredStreamMediaURL(tt.media, tt.maxBytes); got != tt.want {
+				t.Fatalf("filteredStreamMediaURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleIncomingTweet_DropsMediaOverDriveLimit(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldCreate := createMisskeyNoteWithOptions
+	oldUpload := uploadMisskeyDriveFileFromURL
+	defer func() {
+		createMisskeyNoteWithOptions = oldCreate
+		uploadMisskeyDriveFileFromURL = oldUpload
+	}()
+
+	cfg := testHandlerConfig()
+	cfg.MisskeyDriveMaxFileBytes = 1024
+	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token string, options misskey.UploadDriveFileOptions) (string, error) {
+		if options.MaxBytes != cfg.MisskeyDriveMaxFileBytes {
+			t.Fatalf("MaxBytes = %d, want %d", options.MaxBytes, cfg.MisskeyDriveMaxFileBytes)
+		}
+		if strings.HasSuffix(options.URL, "large.mp4") {
+			return "", fmt.Errorf("%w: Content-Length 2048 exceeds 1024 bytes", misskey.ErrMediaTooLarge)
+		}
+		return "file-small", nil
+	}
+	var gotFileIDs []string
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		gotFileIDs = options.FileIDs
+		return "note-media", nil
+	}
+
+	tweet := IncomingTweet{
+		ID:        "124",
+		Text:      "two files",
+		Username:  "dummy_user",
+		MediaURLs: []string{"https://video.twimg.com/large.mp4", "https://pbs.twimg.com/media/small.png"},
+	}
+	if err := HandleIncomingTweetWithConfig(ctx, cfg, tweet, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+		t.Fatalf("HandleIncomingTweet() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotFileIDs, []string{"file-small"}) {
+		t.Fatalf("FileIDs = %#v, want only the file under the limit", gotFileIDs)
+	}
+	if got := testutil.ToFloat64(m.MediaSkipped.WithLabelValues("tweet2note", "too_large")); got != 1 {
+		t.Fatalf("media skipped metric = %v, want 1", got)
+	}
+}
+
+func TestHandleIncomingTweet_ClosedPollFallsBackToText(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.NewNoop()
+
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() { createMisskeyNoteWithOptions = oldCreate }()
+	var got misskey.CreateNoteOptions
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		got = options
+		return "note-poll", nil
+	}
+
+	tweet := IncomingTweet{
+		ID:       "125",
+		Text:     "which?",
+		Username: "dummy_user",
+		Poll:     &TweetPoll{Options: []string{"a", "b"}, DurationMinutes: 60, Closed: true},
+	}
+	if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, tracker.NewCrossPostTracker(ctx, time.Hour), m); err != nil {
+		t.Fatalf("HandleIncomingTweet() error = %v", err)
+	}
+	if got.Poll != nil || !strings.Contains(got.Text, "・a\n・b") {
+		t.Fatalf("options = %#v, want the choices as text", got)
+	}
+	if got := testutil.ToFloat64(m.PollFallbacks.WithLabelValues("tweet2note", "poll_closed")); got != 1 {
+		t.Fatalf("poll_closed fallback metric = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Tweet2NoteSkipped.WithLabelValues("poll_closed")); got != 0 {
+		t.Fatalf("poll_closed skipped metric = %v, want the tweet not counted as skipped", got)
+	}
+}
+
 func TestHandleIncomingTweet_WithMedia(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
@@ -311,15 +611,18 @@ func TestHandleIncomingTweet_WithMedia(t *testing.T) {
 		uploadMisskeyDriveFileFromURL = oldUpload
 	}()
 
-	var uploadedURLs []string
-	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token, fileURL string, allowedHosts []string) (string, error) {
+	var uploadedURLs, uploadedComments []string
+	var uploadedSensitive []bool
+	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token string, options misskey.UploadDriveFileOptions) (string, error) {
 		if host != "misskey.example" || token != "test-token" {
 			t.Fatalf("unexpected upload auth host=%q token=%q", host, token)
 		}
-		if !reflect.DeepEqual(allowedHosts, []string{"pbs.twimg.com", "video.twimg.com"}) {
-			t.Fatalf("allowedHosts = %#v", allowedHosts)
+		if !reflect.DeepEqual(options.AllowedHosts, []string{"pbs.twimg.com", "video.twimg.com"}) {
+			t.Fatalf("allowedHosts = %#v", options.AllowedHosts)
 		}
-		uploadedURLs = append(uploadedURLs, fileURL)
+		uploadedURLs = append(uploadedURLs, options.URL)
+		uploadedComments = append(uploadedComments, options.Comment)
+		uploadedSensitive = append(uploadedSensitive, options.IsSensitive)
 		return "file-" + string(rune('0'+len(uploadedURLs))), nil
 	}
 
@@ -335,11 +638,14 @@ func TestHandleIncomingTweet_WithMedia(t *testing.T) {
 	}
 
 	tweet := IncomingTweet{
-		ID:        "123",
-		Text:      "tweet with media",
-		Username:  "dummy_user",
-		URL:       "https://twitter.com/dummy_user/status/123",
-		MediaURLs: []string{"https://pbs.twimg.com/media/1.png", "https://pbs.twimg.com/media/2.png"},
+		ID:                "123",
+		Text:              "tweet with media https://twitter.com/dummy_user/status/123/photo/1",
+		Username:          "dummy_user",
+		URL:               "https://twitter.com/dummy_user/status/123",
+		MediaURLs:         []string{"https://pbs.twimg.com/media/1.png", "https://pbs.twimg.com/media/2.png"},
+		MediaAltTexts:     []string{"", "a cat on a keyboard"},
+		MediaLinks:        []string{"https://twitter.com/dummy_user/status/123/photo/1"},
+		PossiblySensitive: true,
 	}
 
 	if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
@@ -348,6 +654,15 @@ func TestHandleIncomingTweet_WithMedia(t *testing.T) {
 	if !reflect.DeepEqual(uploadedURLs, tweet.MediaURLs) {
 		t.Fatalf("uploadedURLs = %#v, want %#v", uploadedURLs, tweet.MediaURLs)
 	}
+	if !reflect.DeepEqual(uploadedComments, tweet.MediaAltTexts) {
+		t.Fatalf("uploadedComments = %#v, want %#v", uploadedComments, tweet.MediaAltTexts)
+	}
+	if !reflect.DeepEqual(uploadedSensitive, []bool{true, true}) {
+		t.Fatalf("uploadedSensitive = %#v, want all true", uploadedSensitive)
+	}
+	if got := testutil.ToFloat64(m.SensitiveMediaForwarded.WithLabelValues("tweet2note")); got != 1 {
+		t.Fatalf("sensitive media metric = %v, want 1", got)
+	}
 	if gotText != "tweet with media" {
 		t.Fatalf("gotText = %q", gotText)
 	}
@@ -375,8 +690,8 @@ func TestHandleIncomingTweet_RetweetSkipsMediaUpload(t *testing.T) {
 		uploadMisskeyDriveFileFromURL = oldUpload
 	}()
 
-	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token, fileURL string, allowedHosts []string) (string, error) {
-		t.Fatal("UploadDriveFileFromURLWithAllowedHosts should not be called for a retweet")
+	uploadMisskeyDriveFileFromURL = func(ctx context.Context, host, token string, options misskey.UploadDriveFileOptions) (string, error) {
+		t.Fatal("UploadDriveFileWithOptions should not be called for a retweet")
 		return "", nil
 	}
 
@@ -398,7 +713,7 @@ func TestHandleIncomingTweet_RetweetSkipsMediaUpload(t *testing.T) {
 	if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
 		t.Fatalf("HandleIncomingTweet() error = %v", err)
 	}
-	wantText := "RT @other_user: original text\n\nhttps://twitter.com/other_user/status/456"
+	wantText := "RT [<plain>@other_user</plain>](https://twitter.com/other_user): original text\n\nhttps://twitter.com/other_user/status/456"
 	if gotOptions.Text != wantText {
 		t.Fatalf("Text = %q, want %q", gotOptions.Text, wantText)
 	}
@@ -407,6 +722,198 @@ func TestHandleIncomingTweet_RetweetSkipsMediaUpload(t *testing.T) {
 	}
 }
 
+func TestHandleIncomingTweet_EscapesMFM(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() { createMisskeyNoteWithOptions = oldCreate }()
+
+	var gotOptions misskey.CreateNoteOptions
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		gotOptions = options
+		return "note-123", nil
+	}
+
+	tweet := IncomingTweet{
+		ID:       "123",
+		Text:     "hey @alice, **not bold** $[x2 big] #tag",
+		Username: "dummy_user",
+		URL:      "https://twitter.com/dummy_user/status/123",
+	}
+
+	if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+		t.Fatalf("HandleIncomingTweet() error = %v", err)
+	}
+	wantText := "hey [@alice](https://twitter.com/alice)<plain>, **not bold** $[x2 big] </plain>#tag"
+	if gotOptions.Text != wantText {
+		t.Fatalf("Text = %q, want %q", gotOptions.Text, wantText)
+	}
+}
+
+func TestHandleIncomingTweet_EditReplacesNote(t *testing.T) {
+	ctx := context.Background()
+
+	oldCreate := createMisskeyNoteWithOptions
+	oldDelete := deleteMisskeyNote
+	oldUpdate := updateMisskeyNote
+	oldHasReplies := misskeyNoteHasReplies
+	defer func() {
+		createMisskeyNoteWithOptions = oldCreate
+		deleteMisskeyNote = oldDelete
+		updateMisskeyNote = oldUpdate
+		misskeyNoteHasReplies = oldHasReplies
+	}()
+	errUnsupported := &misskey.APIError{Operation: "update note", StatusCode: 404, Err: misskey.ErrNoteUpdateUnsupported}
+
+	t.Run("updates forwarded note", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberTweetToMisskey(ctx, "100", "note-old"); err != nil {
+			t.Fatalf("RememberTweetToMisskey() error = %v", err)
+		}
+
+		var calls []string
+		updateMisskeyNote = func(ctx context.Context, host, token, noteID, text, cw string) error {
+			calls = append(calls, "update:"+noteID+":"+text)
+			return nil
+		}
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			t.Fatal("CreateNoteWithOptions should not be called when the note can be updated")
+			return "", nil
+		}
+		deleteMisskeyNote = func(ctx context.Context, host, token, noteID string) error {
+			t.Fatal("DeleteNote should not be called when the note can be updated")
+			return nil
+		}
+
+		tweet := IncomingTweet{
+			ID:                  "101",
+			Text:                "fixed typo",
+			Username:            "dummy_user",
+			EditHistoryTweetIDs: []string{"100", "101"},
+		}
+		if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+			t.Fatalf("HandleIncomingTweet() error = %v", err)
+		}
+		if want := []string{"update:note-old:fixed typo"}; !reflect.DeepEqual(calls, want) {
+			t.Fatalf("calls = %#v, want %#v", calls, want)
+		}
+		record, ok, err := crossPostTracker.FindByTweetID(ctx, "101")
+		if err != nil || !ok || record.MisskeyNoteID != "note-old" {
+			t.Fatalf("FindByTweetID(101) = %#v, %v, %v; want note-old", record, ok, err)
+		}
+		if ok, _ := crossPostTracker.HasTweet(ctx, "100"); ok {
+			t.Fatal("previous tweet version is still tracked")
+		}
+	})
+
+	t.Run("keeps note with replies without notes/update", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberTweetToMisskey(ctx, "100", "note-old"); err != nil {
+			t.Fatalf("RememberTweetToMisskey() error = %v", err)
+		}
+		updateMisskeyNote = func(ctx context.Context, host, token, noteID, text, cw string) error {
+			return errUnsupported
+		}
+		misskeyNoteHasReplies = func(ctx context.Context, host, token, noteID string) (bool, error) {
+			return true, nil
+		}
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			t.Fatal("CreateNoteWithOptions should not be called for a note with replies")
+			return "", nil
+		}
+		deleteMisskeyNote = func(ctx context.Context, host, token, noteID string) error {
+			t.Fatal("DeleteNote should not be called for a note with replies")
+			return nil
+		}
+
+		tweet := IncomingTweet{ID: "101", Text: "fixed typo", Username: "dummy_user", EditHistoryTweetIDs: []string{"100", "101"}}
+		if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+			t.Fatalf("HandleIncomingTweet() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Tweet2NoteSkipped.WithLabelValues("edit_unsupported")); got != 1 {
+			t.Fatalf("edit_unsupported skipped metric = %v, want 1", got)
+		}
+		if record, ok, _ := crossPostTracker.FindByTweetID(ctx, "101"); !ok || record.MisskeyNoteID != "note-old" {
+			t.Fatalf("FindByTweetID(101) = %#v, %v; want the kept note", record, ok)
+		}
+	})
+
+	t.Run("recreates note without replies and notes/update", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberTweetToMisskey(ctx, "100", "note-old"); err != nil {
+			t.Fatalf("RememberTweetToMisskey() error = %v", err)
+		}
+		updateMisskeyNote = func(ctx context.Context, host, token, noteID, text, cw string) error {
+			return errUnsupported
+		}
+		misskeyNoteHasReplies = func(ctx context.Context, host, token, noteID string) (bool, error) {
+			return false, nil
+		}
+
+		var calls []string
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			calls = append(calls, "create:"+options.Text)
+			return "note-new", nil
+		}
+		deleteMisskeyNote = func(ctx context.Context, host, token, noteID string) error {
+			calls = append(calls, "delete:"+noteID)
+			return nil
+		}
+
+		tweet := IncomingTweet{
+			ID:                  "101",
+			Text:                "fixed typo",
+			Username:            "dummy_user",
+			URL:                 "https://twitter.com/dummy_user/status/101",
+			EditHistoryTweetIDs: []string{"100", "101"},
+		}
+		if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+			t.Fatalf("HandleIncomingTweet() error = %v", err)
+		}
+
+		if want := []string{"create:fixed typo", "delete:note-old"}; !reflect.DeepEqual(calls, want) {
+			t.Fatalf("calls = %#v, want %#v", calls, want)
+		}
+		record, ok, err := crossPostTracker.FindByTweetID(ctx, "101")
+		if err != nil || !ok || record.MisskeyNoteID != "note-new" {
+			t.Fatalf("FindByTweetID(101) = %#v, %v, %v; want note-new", record, ok, err)
+		}
+		if ok, _ := crossPostTracker.HasMisskeyNote(ctx, "note-old"); ok {
+			t.Fatal("old note is still tracked")
+		}
+	})
+
+	t.Run("skips edit of note cross-post", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberMisskeyToTweet(ctx, "note-1", "200"); err != nil {
+			t.Fatalf("RememberMisskeyToTweet() error = %v", err)
+		}
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			t.Fatal("CreateNoteWithOptions should not be called for an edited cross-post")
+			return "", nil
+		}
+
+		tweet := IncomingTweet{
+			ID:                  "201",
+			Text:                "edited on twitter",
+			Username:            "dummy_user",
+			EditHistoryTweetIDs: []string{"200", "201"},
+		}
+		if err := HandleIncomingTweetWithConfig(ctx, testHandlerConfig(), tweet, crossPostTracker, m); err != nil {
+			t.Fatalf("HandleIncomingTweet() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Tweet2NoteSkipped.WithLabelValues("edited_crosspost")); got != 1 {
+			t.Fatalf("edited_crosspost skipped metric = %v, want 1", got)
+		}
+	})
+}
+
 func TestHandleIncomingTweet_QuoteTweetUsesTrackerNoteID(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
@@ -596,6 +1103,117 @@ func TestTweet2NoteHandler_SkipsReply(t *testing.T) {
 	}
 }
 
+func TestTweet2NoteHandler_OwnReplyCreatesNoteReply(t *testing.T) {
+	ctx := context.Background()
+
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() { createMisskeyNoteWithOptions = oldCreate }()
+
+	payload := `{
+		"data": {
+			"id": "333",
+			"text": "Self reply",
+			"author_id": "111",
+			"in_reply_to_user_id": "111",
+			"referenced_tweets": [
+				{
+					"type": "replied_to",
+					"id": "222"
+				}
+			]
+		},
+		"includes": {
+			"users": [
+				{
+					"id": "111",
+					"username": "dummy_user"
+				}
+			]
+		}
+	}`
+
+	t.Run("parent tracked", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		if err := crossPostTracker.RememberTweetToMisskey(ctx, "222", "note-222"); err != nil {
+			t.Fatalf("RememberTweetToMisskey() error = %v", err)
+		}
+
+		var gotOptions misskey.CreateNoteOptions
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			gotOptions = options
+			return "note-333", nil
+		}
+
+		if err := Tweet2NoteHandlerWithConfig(ctx, testHandlerConfig(), []byte(payload), crossPostTracker, m); err != nil {
+			t.Fatalf("Tweet2NoteHandler() error = %v", err)
+		}
+		if gotOptions.ReplyID != "note-222" {
+			t.Fatalf("ReplyID = %q, want note-222", gotOptions.ReplyID)
+		}
+		if ok, err := crossPostTracker.HasMisskeyNote(ctx, "note-333"); err != nil || !ok {
+			t.Fatal("reply note ID was not recorded")
+		}
+	})
+
+	t.Run("parent missing", func(t *testing.T) {
+		crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+		m := metrics.NewNoop()
+		createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+			t.Fatal("CreateNoteWithOptions should not be called when the reply parent is unknown")
+			return "", nil
+		}
+
+		if err := Tweet2NoteHandlerWithConfig(ctx, testHandlerConfig(), []byte(payload), crossPostTracker, m); err != nil {
+			t.Fatalf("Tweet2NoteHandler() error = %v", err)
+		}
+		if got := testutil.ToFloat64(m.Tweet2NoteSkipped.WithLabelValues("reply_parent_missing")); got != 1 {
+			t.Fatalf("reply_parent_missing skipped metric = %v, want 1", got)
+		}
+	})
+}
+
+func TestTweet2NoteHandler_ReplyUserWithoutReferencedTweet(t *testing.T) {
+	ctx := context.Background()
+	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
+	m := metrics.NewNoop()
+
+	oldCreate := createMisskeyNoteWithOptions
+	defer func() { createMisskeyNoteWithOptions = oldCreate }()
+	var gotOptions misskey.CreateNoteOptions
+	createMisskeyNoteWithOptions = func(ctx context.Context, host, token string, options misskey.CreateNoteOptions) (string, error) {
+		gotOptions = options
+		return "note-333", nil
+	}
+
+	payload := `{
+		"data": {
+			"id": "333",
+			"text": "Mention without a parent",
+			"author_id": "111",
+			"in_reply_to_user_id": "111"
+		},
+		"includes": {
+			"users": [
+				{
+					"id": "111",
+					"username": "dummy_user"
+				}
+			]
+		}
+	}`
+
+	if err := Tweet2NoteHandlerWithConfig(ctx, testHandlerConfig(), []byte(payload), crossPostTracker, m); err != nil {
+		t.Fatalf("Tweet2NoteHandler() error = %v", err)
+	}
+	if gotOptions.ReplyID != "" {
+		t.Fatalf("ReplyID = %q, want no reply without a replied_to tweet", gotOptions.ReplyID)
+	}
+	if ok, err := crossPostTracker.HasMisskeyNote(ctx, "note-333"); err != nil || !ok {
+		t.Fatal("note ID was not recorded")
+	}
+}
+
 func TestTweet2NoteHandler_NoEligibleTweets(t *testing.T) {
 	ctx := context.Background()
 	crossPostTracker := tracker.NewCrossPostTracker(ctx, 1*time.Hour)
@@ -663,9 +1281,9 @@ func TestRnAtPattern(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.text, func(t *testing.T) {
-			result := rnAtPattern.MatchString(tt.text)
-			if result != tt.matches {
-				t.Errorf("rnAtPattern.MatchString(%q) = %v, want %v", tt.text, result, tt.matches)
+			decision := defaultTweet2NoteFilter.Evaluate(filter.Post{Text: tt.text})
+			if result := decision.Skip && decision.Rule == "rn_pattern"; result != tt.matches {
+				t.Errorf("rn_pattern matches %q = %v, want %v", tt.text, result, tt.matches)
 			}
 		})
 	}
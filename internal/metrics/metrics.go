@@ -1,27 +1,48 @@
 package metrics
 
 import (
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Metrics holds all application-specific metrics
+// DefaultPair is the pair label of a process running a single account pair.
+const DefaultPair = "default"
+
+const pairLabel = "pair"
+
+// Directions are the cross-post directions enabled in the process. They are
+// reported as labels of build_info.
+type Directions struct {
+	Note2Tweet bool
+	Tweet2Note bool
+}
+
+// Metrics holds all application-specific metrics of one account pair. Every
+// metric except build_info and config_reloads_total has a pair label.
 type Metrics struct {
 	// Webhook request metrics
 	WebhookRequestsTotal   *prometheus.CounterVec
-	WebhookRequestDuration *prometheus.HistogramVec
+	WebhookRequestDuration prometheus.ObserverVec
 	WebhookRequestErrors   *prometheus.CounterVec
 
 	// Content processing metrics
-	Note2TweetTotal   prometheus.Counter
-	Note2TweetSuccess prometheus.Counter
-	Note2TweetErrors  prometheus.Counter
-	Note2TweetSkipped *prometheus.CounterVec
+	Note2TweetTotal    prometheus.Counter
+	Note2TweetSuccess  prometheus.Counter
+	Note2TweetErrors   prometheus.Counter
+	Note2TweetSkipped  *prometheus.CounterVec
+	Note2TweetDeferred prometheus.Counter
 
 	Tweet2NoteTotal   prometheus.Counter
 	Tweet2NoteSuccess prometheus.Counter
 	Tweet2NoteErrors  prometheus.Counter
 	Tweet2NoteSkipped *prometheus.CounterVec
 
+	SensitiveMediaForwarded *prometheus.CounterVec
+	MediaSkipped            *prometheus.CounterVec
+	PollFallbacks           *prometheus.CounterVec
+	DeletionsPropagated     *prometheus.CounterVec
+
 	// Twitter stream metrics
 	TwitterStreamConnects        *prometheus.CounterVec
 	TwitterStreamDisconnects     *prometheus.CounterVec
@@ -29,315 +50,430 @@ type Metrics struct {
 	TwitterStreamLastMessageTime prometheus.Gauge
 	TwitterStreamRuleUpdates     *prometheus.CounterVec
 
+	// Twitter rate limit metrics
+	TwitterRateLimitLimit     *prometheus.GaugeVec
+	TwitterRateLimitRemaining *prometheus.GaugeVec
+	TwitterRateLimitReset     *prometheus.GaugeVec
+
+	// Misskey stream metrics
+	MisskeyStreamConnects        *prometheus.CounterVec
+	MisskeyStreamDisconnects     *prometheus.CounterVec
+	MisskeyStreamMessages        *prometheus.CounterVec
+	MisskeyStreamLastMessageTime prometheus.Gauge
+	TwitterTimelinePolls         *prometheus.CounterVec
+	TwitterTimelineTweets        *prometheus.CounterVec
+
 	// Tracker metrics
 	TrackerEntriesTotal  prometheus.Gauge
 	TrackerDuplicatesHit prometheus.Counter
+	TrackerClaims        prometheus.Gauge
+
+	// Outbox metrics
+	OutboxJobs         *prometheus.GaugeVec
+	OutboxOldestJobAge prometheus.Gauge
+	OutboxJobAttempts  *prometheus.CounterVec
+
+	// Process metrics
+	ConfigReloads *prometheus.CounterVec
 
 	// Info metric
 	BuildInfo *prometheus.GaugeVec
+
+	collectors *collectors
+}
+
+// collectors holds the registered metrics shared by all pairs.
+type collectors struct {
+	webhookRequestsTotal   *prometheus.CounterVec
+	webhookRequestDuration *prometheus.HistogramVec
+	webhookRequestErrors   *prometheus.CounterVec
+
+	note2TweetTotal    *prometheus.CounterVec
+	note2TweetSuccess  *prometheus.CounterVec
+	note2TweetErrors   *prometheus.CounterVec
+	note2TweetSkipped  *prometheus.CounterVec
+	note2TweetDeferred *prometheus.CounterVec
+
+	tweet2NoteTotal   *prometheus.CounterVec
+	tweet2NoteSuccess *prometheus.CounterVec
+	tweet2NoteErrors  *prometheus.CounterVec
+	tweet2NoteSkipped *prometheus.CounterVec
+
+	sensitiveMediaForwarded *prometheus.CounterVec
+	mediaSkipped            *prometheus.CounterVec
+	pollFallbacks           *prometheus.CounterVec
+	deletionsPropagated     *prometheus.CounterVec
+
+	twitterStreamConnects        *prometheus.CounterVec
+	twitterStreamDisconnects     *prometheus.CounterVec
+	twitterStreamMessages        *prometheus.CounterVec
+	twitterStreamLastMessageTime *prometheus.GaugeVec
+	twitterStreamRuleUpdates     *prometheus.CounterVec
+
+	twitterRateLimitLimit     *prometheus.GaugeVec
+	twitterRateLimitRemaining *prometheus.GaugeVec
+	twitterRateLimitReset     *prometheus.GaugeVec
+
+	misskeyStreamConnects        *prometheus.CounterVec
+	misskeyStreamDisconnects     *prometheus.CounterVec
+	misskeyStreamMessages        *prometheus.CounterVec
+	misskeyStreamLastMessageTime *prometheus.GaugeVec
+	twitterTimelinePolls         *prometheus.CounterVec
+	twitterTimelineTweets        *prometheus.CounterVec
+
+	trackerEntriesTotal  *prometheus.GaugeVec
+	trackerDuplicatesHit *prometheus.CounterVec
+	trackerClaims        *prometheus.GaugeVec
+
+	outboxJobs         *prometheus.GaugeVec
+	outboxOldestJobAge *prometheus.GaugeVec
+	outboxJobAttempts  *prometheus.CounterVec
+
+	configReloads *prometheus.CounterVec
+
+	buildInfo *prometheus.GaugeVec
 }
 
 // New creates and registers all metrics to the default registry
-func New(version string) *Metrics {
-	return NewWithRegistry(version, prometheus.DefaultRegisterer)
+func New(version string, directions Directions) *Metrics {
+	return NewWithRegistry(version, directions, prometheus.DefaultRegisterer)
 }
 
 // NewWithRegistry creates and registers all metrics to a custom registry
-func NewWithRegistry(version string, registerer prometheus.Registerer) *Metrics {
-	m := &Metrics{
-		WebhookRequestsTotal: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "webhook_requests_total",
-				Help: "Total number of webhook requests received",
-			},
-			[]string{"source", "status"},
-		),
-		WebhookRequestDuration: prometheus.NewHistogramVec(
+func NewWithRegistry(version string, directions Directions, registerer prometheus.Registerer) *Metrics {
+	c := newCollectors()
+
+	// Register all metrics
+	registerer.MustRegister(
+		c.webhookRequestsTotal,
+		c.webhookRequestDuration,
+		c.webhookRequestErrors,
+		c.note2TweetTotal,
+		c.note2TweetSuccess,
+		c.note2TweetErrors,
+		c.note2TweetSkipped,
+		c.note2TweetDeferred,
+		c.tweet2NoteTotal,
+		c.tweet2NoteSuccess,
+		c.tweet2NoteErrors,
+		c.tweet2NoteSkipped,
+		c.sensitiveMediaForwarded,
+		c.mediaSkipped,
+		c.pollFallbacks,
+		c.deletionsPropagated,
+		c.twitterStreamConnects,
+		c.twitterStreamDisconnects,
+		c.twitterStreamMessages,
+		c.twitterStreamLastMessageTime,
+		c.twitterStreamRuleUpdates,
+		c.twitterRateLimitLimit,
+		c.twitterRateLimitRemaining,
+		c.twitterRateLimitReset,
+		c.misskeyStreamConnects,
+		c.misskeyStreamDisconnects,
+		c.misskeyStreamMessages,
+		c.misskeyStreamLastMessageTime,
+		c.twitterTimelinePolls,
+		c.twitterTimelineTweets,
+		c.trackerEntriesTotal,
+		c.trackerDuplicatesHit,
+		c.trackerClaims,
+		c.outboxJobs,
+		c.outboxOldestJobAge,
+		c.outboxJobAttempts,
+		c.configReloads,
+		c.buildInfo,
+	)
+
+	// Set build info
+	c.buildInfo.WithLabelValues(version, strconv.FormatBool(directions.Note2Tweet), strconv.FormatBool(directions.Tweet2Note)).Set(1)
+
+	return c.forPair(DefaultPair)
+}
+
+// NewNoop creates metrics that are not registered (for testing)
+func NewNoop() *Metrics {
+	return newCollectors().forPair(DefaultPair)
+}
+
+// ForPair returns the metrics of another account pair. They share the
+// registered collectors with m.
+func (m *Metrics) ForPair(pair string) *Metrics {
+	return m.collectors.forPair(pair)
+}
+
+func (c *collectors) forPair(pair string) *Metrics {
+	labels := prometheus.Labels{pairLabel: pair}
+	return &Metrics{
+		WebhookRequestsTotal:   c.webhookRequestsTotal.MustCurryWith(labels),
+		WebhookRequestDuration: c.webhookRequestDuration.MustCurryWith(labels),
+		WebhookRequestErrors:   c.webhookRequestErrors.MustCurryWith(labels),
+
+		Note2TweetTotal:    c.note2TweetTotal.WithLabelValues(pair),
+		Note2TweetSuccess:  c.note2TweetSuccess.WithLabelValues(pair),
+		Note2TweetErrors:   c.note2TweetErrors.WithLabelValues(pair),
+		Note2TweetSkipped:  c.note2TweetSkipped.MustCurryWith(labels),
+		Note2TweetDeferred: c.note2TweetDeferred.WithLabelValues(pair),
+
+		Tweet2NoteTotal:   c.tweet2NoteTotal.WithLabelValues(pair),
+		Tweet2NoteSuccess: c.tweet2NoteSuccess.WithLabelValues(pair),
+		Tweet2NoteErrors:  c.tweet2NoteErrors.WithLabelValues(pair),
+		Tweet2NoteSkipped: c.tweet2NoteSkipped.MustCurryWith(labels),
+
+		SensitiveMediaForwarded: c.sensitiveMediaForwarded.MustCurryWith(labels),
+		MediaSkipped:            c.mediaSkipped.MustCurryWith(labels),
+		PollFallbacks:           c.pollFallbacks.MustCurryWith(labels),
+		DeletionsPropagated:     c.deletionsPropagated.MustCurryWith(labels),
+
+		TwitterStreamConnects:        c.twitterStreamConnects.MustCurryWith(labels),
+		TwitterStreamDisconnects:     c.twitterStreamDisconnects.MustCurryWith(labels),
+		TwitterStreamMessages:        c.twitterStreamMessages.MustCurryWith(labels),
+		TwitterStreamLastMessageTime: c.twitterStreamLastMessageTime.WithLabelValues(pair),
+		TwitterStreamRuleUpdates:     c.twitterStreamRuleUpdates.MustCurryWith(labels),
+
+		TwitterRateLimitLimit:     c.twitterRateLimitLimit.MustCurryWith(labels),
+		TwitterRateLimitRemaining: c.twitterRateLimitRemaining.MustCurryWith(labels),
+		TwitterRateLimitReset:     c.twitterRateLimitReset.MustCurryWith(labels),
+
+		MisskeyStreamConnects:        c.misskeyStreamConnects.MustCurryWith(labels),
+		MisskeyStreamDisconnects:     c.misskeyStreamDisconnects.MustCurryWith(labels),
+		MisskeyStreamMessages:        c.misskeyStreamMessages.MustCurryWith(labels),
+		MisskeyStreamLastMessageTime: c.misskeyStreamLastMessageTime.WithLabelValues(pair),
+		TwitterTimelinePolls:         c.twitterTimelinePolls.MustCurryWith(labels),
+		TwitterTimelineTweets:        c.twitterTimelineTweets.MustCurryWith(labels),
+
+		TrackerEntriesTotal:  c.trackerEntriesTotal.WithLabelValues(pair),
+		TrackerDuplicatesHit: c.trackerDuplicatesHit.WithLabelValues(pair),
+		TrackerClaims:        c.trackerClaims.WithLabelValues(pair),
+
+		OutboxJobs:         c.outboxJobs.MustCurryWith(labels),
+		OutboxOldestJobAge: c.outboxOldestJobAge.WithLabelValues(pair),
+		OutboxJobAttempts:  c.outboxJobAttempts.MustCurryWith(labels),
+
+		ConfigReloads: c.configReloads,
+
+		BuildInfo: c.buildInfo,
+
+		collectors: c,
+	}
+}
+
+func newCollectors() *collectors {
+	return &collectors{
+		webhookRequestsTotal: newCounterVec(
+			"webhook_requests_total",
+			"Total number of webhook requests received",
+			"source", "status",
+		),
+		webhookRequestDuration: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "webhook_request_duration_seconds",
 				Help:    "Duration of webhook request processing",
 				Buckets: prometheus.DefBuckets,
 			},
-			[]string{"source"},
+			[]string{pairLabel, "source"},
 		),
-		WebhookRequestErrors: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "webhook_request_errors_total",
-				Help: "Total number of webhook request errors",
-			},
-			[]string{"source", "error_type"},
+		webhookRequestErrors: newCounterVec(
+			"webhook_request_errors_total",
+			"Total number of webhook request errors",
+			"source", "error_type",
 		),
 
-		Note2TweetTotal: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_total",
-				Help: "Total number of note to tweet conversions attempted",
-			},
-		),
-		Note2TweetSuccess: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_success_total",
-				Help: "Total number of successful note to tweet conversions",
-			},
-		),
-		Note2TweetErrors: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_errors_total",
-				Help: "Total number of failed note to tweet conversions",
-			},
+		note2TweetTotal: newCounterVec(
+			"note2tweet_total",
+			"Total number of note to tweet conversions attempted",
 		),
-		Note2TweetSkipped: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "note2tweet_skipped_total",
-				Help: "Total number of skipped note to tweet conversions",
-			},
-			[]string{"reason"},
-		),
-
-		Tweet2NoteTotal: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_total",
-				Help: "Total number of tweet to note conversions attempted",
-			},
+		note2TweetSuccess: newCounterVec(
+			"note2tweet_success_total",
+			"Total number of successful note to tweet conversions",
 		),
-		Tweet2NoteSuccess: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_success_total",
-				Help: "Total number of successful tweet to note conversions",
-			},
+		note2TweetErrors: newCounterVec(
+			"note2tweet_errors_total",
+			"Total number of failed note to tweet conversions",
 		),
-		Tweet2NoteErrors: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_errors_total",
-				Help: "Total number of failed tweet to note conversions",
-			},
+		note2TweetSkipped: newCounterVec(
+			"note2tweet_skipped_total",
+			"Total number of skipped note to tweet conversions",
+			"reason",
 		),
-		Tweet2NoteSkipped: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "tweet2note_skipped_total",
-				Help: "Total number of skipped tweet to note conversions",
-			},
-			[]string{"reason"},
+		note2TweetDeferred: newCounterVec(
+			"note2tweet_deferred_total",
+			"Total number of note to tweet conversions deferred until a Twitter rate limit resets",
 		),
 
-		TwitterStreamConnects: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_connects_total",
-				Help: "Total number of Twitter stream connection attempts",
-			},
-			[]string{"status"},
+		tweet2NoteTotal: newCounterVec(
+			"tweet2note_total",
+			"Total number of tweet to note conversions attempted",
 		),
-		TwitterStreamDisconnects: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_disconnects_total",
-				Help: "Total number of Twitter stream disconnects",
-			},
-			[]string{"reason"},
+		tweet2NoteSuccess: newCounterVec(
+			"tweet2note_success_total",
+			"Total number of successful tweet to note conversions",
 		),
-		TwitterStreamMessages: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_messages_total",
-				Help: "Total number of Twitter stream messages processed",
-			},
-			[]string{"status"},
+		tweet2NoteErrors: newCounterVec(
+			"tweet2note_errors_total",
+			"Total number of failed tweet to note conversions",
 		),
-		TwitterStreamLastMessageTime: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Name: "twitter_stream_last_message_timestamp_seconds",
-				Help: "Unix timestamp of the last Twitter stream message",
-			},
-		),
-		TwitterStreamRuleUpdates: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_rule_updates_total",
-				Help: "Total number of Twitter stream rule update attempts",
-			},
-			[]string{"action", "status"},
+		tweet2NoteSkipped: newCounterVec(
+			"tweet2note_skipped_total",
+			"Total number of skipped tweet to note conversions",
+			"reason",
 		),
 
-		TrackerEntriesTotal: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Name: "tracker_entries_total",
-				Help: "Current number of entries in the content tracker",
-			},
-		),
-		TrackerDuplicatesHit: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tracker_duplicates_hit_total",
-				Help: "Total number of duplicate content detected",
-			},
+		sensitiveMediaForwarded: newCounterVec(
+			"sensitive_media_forwarded_total",
+			"Total number of posts forwarded with sensitive media",
+			"direction",
+		),
+		mediaSkipped: newCounterVec(
+			"media_skipped_total",
+			"Total number of attached files dropped from forwarded posts",
+			"direction", "reason",
+		),
+		pollFallbacks: newCounterVec(
+			"poll_fallbacks_total",
+			"Total number of polls forwarded as text or dropped instead of as polls",
+			"direction", "reason",
+		),
+		deletionsPropagated: newCounterVec(
+			"deletions_propagated_total",
+			"Total number of deletions propagated to the other side",
+			"direction",
 		),
 
-		BuildInfo: prometheus.NewGaugeVec(
-			prometheus.GaugeOpts{
-				Name: "build_info",
-				Help: "Build information",
-			},
-			[]string{"version"},
+		twitterStreamConnects: newCounterVec(
+			"twitter_stream_connects_total",
+			"Total number of Twitter stream connection attempts",
+			"status",
+		),
+		twitterStreamDisconnects: newCounterVec(
+			"twitter_stream_disconnects_total",
+			"Total number of Twitter stream disconnects",
+			"reason",
+		),
+		twitterStreamMessages: newCounterVec(
+			"twitter_stream_messages_total",
+			"Total number of Twitter stream messages processed",
+			"status",
+		),
+		twitterStreamLastMessageTime: newGaugeVec(
+			"twitter_stream_last_message_timestamp_seconds",
+			"Unix timestamp of the last Twitter stream message",
+		),
+		twitterStreamRuleUpdates: newCounterVec(
+			"twitter_stream_rule_updates_total",
+			"Total number of Twitter stream rule update attempts",
+			"action", "status",
 		),
-	}
 
-	// Register all metrics
-	registerer.MustRegister(
-		m.WebhookRequestsTotal,
-		m.WebhookRequestDuration,
-		m.WebhookRequestErrors,
-		m.Note2TweetTotal,
-		m.Note2TweetSuccess,
-		m.Note2TweetErrors,
-		m.Note2TweetSkipped,
-		m.Tweet2NoteTotal,
-		m.Tweet2NoteSuccess,
-		m.Tweet2NoteErrors,
-		m.Tweet2NoteSkipped,
-		m.TwitterStreamConnects,
-		m.TwitterStreamDisconnects,
-		m.TwitterStreamMessages,
-		m.TwitterStreamLastMessageTime,
-		m.TwitterStreamRuleUpdates,
-		m.TrackerEntriesTotal,
-		m.TrackerDuplicatesHit,
-		m.BuildInfo,
-	)
-
-	// Set build info
-	m.BuildInfo.WithLabelValues(version).Set(1)
-
-	return m
-}
-
-// NewNoop creates metrics that are not registered (for testing)
-func NewNoop() *Metrics {
-	return &Metrics{
-		WebhookRequestsTotal: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "webhook_requests_total",
-				Help: "Total number of webhook requests received",
-			},
-			[]string{"source", "status"},
+		twitterRateLimitLimit: newGaugeVec(
+			"twitter_rate_limit_limit",
+			"Requests allowed in the current Twitter rate limit window",
+			"endpoint", "window",
 		),
-		WebhookRequestDuration: prometheus.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Name:    "webhook_request_duration_seconds",
-				Help:    "Duration of webhook request processing",
-				Buckets: prometheus.DefBuckets,
-			},
-			[]string{"source"},
+		twitterRateLimitRemaining: newGaugeVec(
+			"twitter_rate_limit_remaining",
+			"Requests remaining in the current Twitter rate limit window",
+			"endpoint", "window",
 		),
-		WebhookRequestErrors: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "webhook_request_errors_total",
-				Help: "Total number of webhook request errors",
-			},
-			[]string{"source", "error_type"},
+		twitterRateLimitReset: newGaugeVec(
+			"twitter_rate_limit_reset_timestamp_seconds",
+			"Unix timestamp when the Twitter rate limit window resets",
+			"endpoint", "window",
 		),
 
-		Note2TweetTotal: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_total",
-				Help: "Total number of note to tweet conversions attempted",
-			},
+		misskeyStreamConnects: newCounterVec(
+			"misskey_stream_connects_total",
+			"Total number of Misskey stream connection attempts",
+			"status",
 		),
-		Note2TweetSuccess: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_success_total",
-				Help: "Total number of successful note to tweet conversions",
-			},
+		misskeyStreamDisconnects: newCounterVec(
+			"misskey_stream_disconnects_total",
+			"Total number of Misskey stream disconnects",
+			"reason",
 		),
-		Note2TweetErrors: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "note2tweet_errors_total",
-				Help: "Total number of failed note to tweet conversions",
-			},
+		misskeyStreamMessages: newCounterVec(
+			"misskey_stream_messages_total",
+			"Total number of Misskey stream notes processed",
+			"status",
 		),
-		Note2TweetSkipped: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "note2tweet_skipped_total",
-				Help: "Total number of skipped note to tweet conversions",
-			},
-			[]string{"reason"},
+		misskeyStreamLastMessageTime: newGaugeVec(
+			"misskey_stream_last_message_timestamp_seconds",
+			"Unix timestamp of the last Misskey stream note",
 		),
 
-		Tweet2NoteTotal: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_total",
-				Help: "Total number of tweet to note conversions attempted",
-			},
-		),
-		Tweet2NoteSuccess: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_success_total",
-				Help: "Total number of successful tweet to note conversions",
-			},
+		twitterTimelinePolls: newCounterVec(
+			"twitter_timeline_polls_total",
+			"Total number of Twitter user timeline polls",
+			"status",
 		),
-		Tweet2NoteErrors: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "tweet2note_errors_total",
-				Help: "Total number of failed tweet to note conversions",
-			},
-		),
-		Tweet2NoteSkipped: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "tweet2note_skipped_total",
-				Help: "Total number of skipped tweet to note conversions",
-			},
-			[]string{"reason"},
+		twitterTimelineTweets: newCounterVec(
+			"twitter_timeline_tweets_total",
+			"Total number of tweets processed from the Twitter user timeline",
+			"status",
 		),
 
-		TwitterStreamConnects: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_connects_total",
-				Help: "Total number of Twitter stream connection attempts",
-			},
-			[]string{"status"},
+		trackerEntriesTotal: newGaugeVec(
+			"tracker_entries_total",
+			"Current number of entries in the content tracker",
 		),
-		TwitterStreamDisconnects: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_disconnects_total",
-				Help: "Total number of Twitter stream disconnects",
-			},
-			[]string{"reason"},
+		trackerDuplicatesHit: newCounterVec(
+			"tracker_duplicates_hit_total",
+			"Total number of duplicate content detected",
 		),
-		TwitterStreamMessages: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_messages_total",
-				Help: "Total number of Twitter stream messages processed",
-			},
-			[]string{"status"},
+		trackerClaims: newGaugeVec(
+			"tracker_claims",
+			"Current number of posts claimed in the content tracker",
 		),
-		TwitterStreamLastMessageTime: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Name: "twitter_stream_last_message_timestamp_seconds",
-				Help: "Unix timestamp of the last Twitter stream message",
-			},
+
+		outboxJobs: newGaugeVec(
+			"outbox_jobs",
+			"Current number of jobs in the cross-post outbox",
+			"state",
 		),
-		TwitterStreamRuleUpdates: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "twitter_stream_rule_updates_total",
-				Help: "Total number of Twitter stream rule update attempts",
-			},
-			[]string{"action", "status"},
+		outboxOldestJobAge: newGaugeVec(
+			"outbox_oldest_job_age_seconds",
+			"Age of the oldest pending job in the cross-post outbox",
 		),
-
-		TrackerEntriesTotal: prometheus.NewGauge(
-			prometheus.GaugeOpts{
-				Name: "tracker_entries_total",
-				Help: "Current number of entries in the content tracker",
-			},
+		outboxJobAttempts: newCounterVec(
+			"outbox_job_attempts_total",
+			"Total number of cross-post outbox job attempts",
+			"kind", "result",
 		),
-		TrackerDuplicatesHit: prometheus.NewCounter(
+
+		configReloads: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "tracker_duplicates_hit_total",
-				Help: "Total number of duplicate content detected",
+				Name: "config_reloads_total",
+				Help: "Total number of configuration reloads",
 			},
+			[]string{"status"},
 		),
 
-		BuildInfo: prometheus.NewGaugeVec(
+		buildInfo: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "build_info",
-				Help: "Build information",
+				Help: "Build information and the enabled cross-post directions",
 			},
-			[]string{"version"},
+			[]string{"version", "note2tweet", "tweet2note"},
 		),
 	}
 }
+
+func newCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: name,
+			Help: help,
+		},
+		append([]string{pairLabel}, labels...),
+	)
+}
+
+func newGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: name,
+			Help: help,
+		},
+		append([]string{pairLabel}, labels...),
+	)
+}
@@ -0,0 +1,112 @@
+package mfm
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// EscapeOptions controls how FromPlainText escapes text.
+type EscapeOptions struct {
+	// MentionBaseURL is the profile URL prefix for @handles in the source
+	// text, such as https://twitter.com/. When set, handles become links to
+	// that profile instead of Misskey mentions.
+	MentionBaseURL string
+}
+
+var (
+	handlePattern    = regexp.MustCompile(`^@([A-Za-z0-9_]{1,15})`)
+	hashtagPattern   = regexp.MustCompile(`^#[\p{L}\p{M}\p{N}_]+`)
+	plainURLPattern  = regexp.MustCompile(`^https?://[^\s<>()\[\]]+`)
+	shortcodePattern = regexp.MustCompile(`:[A-Za-z0-9_+-]+:`)
+)
+
+// specialChars are the characters that can start MFM syntax other than
+// custom emoji shortcodes.
+const specialChars = "*_~`$[]<>@\\"
+
+const zeroWidthSpace = "\u200b"
+
+// FromPlainText escapes text so that Misskey renders it as written. URLs and
+// hashtags stay live, handles are linked to MentionBaseURL, and every other
+// run of text that could be read as MFM is wrapped in <plain>.
+func FromPlainText(text string, options EscapeOptions) string {
+	var b, pending strings.Builder
+	flush := func() {
+		writePlain(&b, pending.String())
+		pending.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		var prev rune
+		if i > 0 {
+			prev, _ = utf8.DecodeLastRuneInString(text[:i])
+		}
+
+		if token, out, ok := escapeToken(rest, prev, options); ok {
+			flush()
+			b.WriteString(out)
+			i += len(token)
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		pending.WriteString(rest[:size])
+		i += size
+	}
+	flush()
+	return b.String()
+}
+
+// escapeToken reports the token at the start of text that is copied outside
+// <plain>, together with its MFM rendering.
+func escapeToken(text string, prev rune, options EscapeOptions) (string, string, bool) {
+	if isWordRune(prev) {
+		return "", "", false
+	}
+	switch {
+	case strings.HasPrefix(text, "http://"), strings.HasPrefix(text, "https://"):
+		if url := trimURL(plainURLPattern.FindString(text)); url != "" {
+			return url, url, true
+		}
+	case strings.HasPrefix(text, "#"):
+		if tag := hashtagPattern.FindString(text); tag != "" {
+			return tag, tag, true
+		}
+	case strings.HasPrefix(text, "@"):
+		if options.MentionBaseURL == "" || prev == '@' {
+			break
+		}
+		match := handlePattern.FindStringSubmatch(text)
+		if match == nil {
+			break
+		}
+		if next, _ := utf8.DecodeRuneInString(text[len(match[0]):]); isWordRune(next) || next == '@' {
+			break
+		}
+		label := match[0]
+		if strings.Contains(label, "_") {
+			label = "<plain>" + label + "</plain>"
+		}
+		return match[0], "[" + label + "](" + options.MentionBaseURL + match[1] + ")", true
+	}
+	return "", "", false
+}
+
+// writePlain writes text, wrapping it in <plain> when it contains MFM syntax.
+// Leading and trailing newlines stay outside the tag because the parser drops
+// them inside it.
+func writePlain(b *strings.Builder, text string) {
+	if !strings.ContainsAny(text, specialChars) && !shortcodePattern.MatchString(text) {
+		b.WriteString(text)
+		return
+	}
+	body := strings.Trim(text, "\n")
+	start := strings.Index(text, body)
+	b.WriteString(text[:start])
+	b.WriteString("<plain>")
+	b.WriteString(strings.ReplaceAll(body, "</plain>", "<"+zeroWidthSpace+"/plain>"))
+	b.WriteString("</plain>")
+	b.WriteString(text[start+len(body):])
+}
@@ -0,0 +1,37 @@
+package mfm
+
+import "testing"
+
+func TestFromPlainText(t *testing.T) {
+	options := EscapeOptions{MentionBaseURL: "https://twitter.com/"}
+	tests := []struct {
+		name    string
+		text    string
+		options EscapeOptions
+		want    string
+	}{
+		{name: "plain", text: "hello world", options: options, want: "hello world"},
+		{name: "bold", text: "this is **bold**", options: options, want: "<plain>this is **bold**</plain>"},
+		{name: "function", text: "$[x2 big]", options: options, want: "<plain>$[x2 big]</plain>"},
+		{name: "tag", text: "<small>hi</small>", options: options, want: "<plain><small>hi</small></plain>"},
+		{name: "custom emoji", text: "hi :blobcat:", options: options, want: "<plain>hi :blobcat:</plain>"},
+		{name: "time", text: "at 12:30", options: options, want: "at 12:30"},
+		{name: "handle", text: "hi @alice!", options: options, want: "hi [@alice](https://twitter.com/alice)!"},
+		{name: "handle with underscore", text: "@a_b", options: options, want: "[<plain>@a_b</plain>](https://twitter.com/a_b)"},
+		{name: "handle without base url", text: "hi @alice", want: "<plain>hi @alice</plain>"},
+		{name: "remote mention", text: "@alice@misskey.example", options: options, want: "<plain>@alice@misskey.example</plain>"},
+		{name: "email", text: "mail me@example.com", options: options, want: "<plain>mail me@example.com</plain>"},
+		{name: "url stays live", text: "see https://example.com/a_b **x**", options: options, want: "see https://example.com/a_b<plain> **x**</plain>"},
+		{name: "hashtag stays live", text: "*new* #go_lang", options: options, want: "<plain>*new* </plain>#go_lang"},
+		{name: "newlines outside plain", text: "\n**a**\n", options: options, want: "\n<plain>**a**</plain>\n"},
+		{name: "closing plain tag", text: "</plain>**", options: options, want: "<plain><\u200b/plain>**</plain>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromPlainText(tt.text, tt.options); got != tt.want {
+				t.Fatalf("FromPlainText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Package mfm converts between Misskey Flavored Markdown and plain text.
+package mfm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// CustomEmojiText renders custom emoji as their :name: shortcode.
+	CustomEmojiText = "text"
+	// CustomEmojiDrop removes custom emoji from the output.
+	CustomEmojiDrop = "drop"
+)
+
+// Options controls how ToPlainText renders a note.
+type Options struct {
+	// CustomEmoji is CustomEmojiText or CustomEmojiDrop. The zero value keeps
+	// the shortcode text.
+	CustomEmoji string
+	// LocalBaseURL is the Misskey server URL, such as https://misskey.example.
+	// When set, local mentions are rendered as profile URLs as well.
+	LocalBaseURL string
+}
+
+var (
+	customEmojiPattern = regexp.MustCompile(`^:[A-Za-z0-9_+-]+(?:@[A-Za-z0-9_.-]*)?:`)
+	mentionPattern     = regexp.MustCompile(`^@([A-Za-z0-9_]+(?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)(?:@([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+))?`)
+	urlPattern         = regexp.MustCompile(`^https?://[A-Za-z0-9.,_/:%#@$&?!~=+\-]+`)
+	italicPattern      = regexp.MustCompile(`^[A-Za-z0-9 ]+$`)
+)
+
+// decorationTags are the MFM tags that only change how their content looks.
+var decorationTags = []string{"center", "small", "b", "i", "s"}
+
+// ToPlainText renders MFM text as readable plain text. Decorations are
+// unwrapped, links keep their URL, and mentions become profile URLs so they
+// are not mistaken for handles on other services.
+func ToPlainText(text string, options Options) string {
+	r := renderer{options: options}
+	return r.render(text)
+}
+
+type renderer struct {
+	options Options
+}
+
+func (r *renderer) render(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		var prev rune
+		if i > 0 {
+			prev, _ = utf8.DecodeLastRuneInString(text[:i])
+		}
+
+		if consumed, out, ok := r.renderNode(rest, prev); ok {
+			b.WriteString(out)
+			i += consumed
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(rest[:size])
+		i += size
+	}
+	return b.String()
+}
+
+// renderNode renders the MFM node at the start of text. It reports how many
+// bytes were consumed, or ok == false when text does not start with a node.
+func (r *renderer) renderNode(text string, prev rune) (int, string, bool) {
+	switch {
+	case strings.HasPrefix(text, "<plain>"):
+		if end := strings.Index(text, "</plain>"); end >= 0 {
+			return end + len("</plain>"), text[len("<plain>"):end], true
+		}
+	case strings.HasPrefix(text, "```"):
+		if end := strings.Index(text[3:], "```"); end >= 0 {
+			code := text[3 : 3+end]
+			if newline := strings.IndexByte(code, '\n'); newline >= 0 && !strings.ContainsAny(code[:newline], " \t") {
+				code = code[newline+1:]
+			}
+			return 3 + end + 3, strings.TrimSuffix(code, "\n"), true
+		}
+	case strings.HasPrefix(text, "`"):
+		if end := strings.IndexAny(text[1:], "`\n"); end >= 0 && text[1+end] == '`' {
+			return 1 + end + 1, text[1 : 1+end], true
+		}
+	case strings.HasPrefix(text, "$["):
+		return r.renderFunction(text)
+	case strings.HasPrefix(text, `\(`):
+		if end := strings.Index(text, `\)`); end >= 0 {
+			return end + 2, text[2:end], true
+		}
+	case strings.HasPrefix(text, `\[`):
+		if end := strings.Index(text, `\]`); end >= 0 {
+			return end + 2, text[2:end], true
+		}
+	case strings.HasPrefix(text, "<http"):
+		if end := strings.IndexAny(text, ">\n"); end >= 0 && text[end] == '>' {
+			return end + 1, text[1:end], true
+		}
+	case strings.HasPrefix(text, "<"):
+		for _, tag := range decorationTags {
+			open, closing := "<"+tag+">", "</"+tag+">"
+			if !strings.HasPrefix(text, open) {
+				continue
+			}
+			if end := strings.Index(text, closing); end >= 0 {
+				return end + len(closing), r.render(text[len(open):end]), true
+			}
+		}
+	case strings.HasPrefix(text, "**"), strings.HasPrefix(text, "__"), strings.HasPrefix(text, "~~"):
+		marker := text[:2]
+		if end := strings.Index(text[2:], marker); end > 0 {
+			return 2 + end + 2, r.render(text[2 : 2+end]), true
+		}
+	case strings.HasPrefix(text, "*"), strings.HasPrefix(text, "_"):
+		if isWordRune(prev) {
+			break
+		}
+		if end := strings.IndexByte(text[1:], text[0]); end > 0 && italicPattern.MatchString(text[1:1+end]) {
+			return 1 + end + 1, text[1 : 1+end], true
+		}
+	case strings.HasPrefix(text, "?[") || strings.HasPrefix(text, "["):
+		return r.renderLink(text)
+	case strings.HasPrefix(text, "http://"), strings.HasPrefix(text, "https://"):
+		if isWordRune(prev) {
+			break
+		}
+		if url := trimURL(urlPattern.FindString(text)); url != "" {
+			return len(url), url, true
+		}
+	case strings.HasPrefix(text, ":"):
+		if isWordRune(prev) {
+			break
+		}
+		if code := customEmojiPattern.FindString(text); code != "" && !startsWithWordRune(text[len(code):]) {
+			if r.options.CustomEmoji == CustomEmojiDrop {
+				return len(code), "", true
+			}
+			return len(code), code, true
+		}
+	case strings.HasPrefix(text, "@"):
+		if isWordRune(prev) {
+			break
+		}
+		return r.renderMention(text)
+	}
+	return 0, "", false
+}
+
+// renderFunction unwraps $[name.args content], keeping the readable parts of
+// functions whose arguments carry meaning.
+func (r *renderer) renderFunction(text string) (int, string, bool) {
+	end := matchingBracket(text, 1)
+	if end < 0 {
+		return 0, "", false
+	}
+	body := text[2:end]
+	name, content, ok := strings.Cut(body, " ")
+	if !ok {
+		return 0, "", false
+	}
+	name, _, _ = strings.Cut(name, ".")
+	if name == "" {
+		return 0, "", false
+	}
+
+	switch name {
+	case "ruby":
+		base, reading, ok := strings.Cut(strings.TrimSpace(content), " ")
+		if ok {
+			return end + 1, r.render(base) + "(" + strings.TrimSpace(reading) + ")", true
+		}
+	}
+	return end + 1, r.render(content), true
+}
+
+// renderLink renders [label](url) and ?[label](url) as "label (url)".
+func (r *renderer) renderLink(text string) (int, string, bool) {
+	start := strings.IndexByte(text, '[')
+	labelEnd := matchingBracket(text, start)
+	if labelEnd < 0 || labelEnd+1 >= len(text) || text[labelEnd+1] != '(' {
+		return 0, "", false
+	}
+	urlEnd := strings.IndexAny(text[labelEnd+2:], ")\n ")
+	if urlEnd < 0 || text[labelEnd+2+urlEnd] != ')' {
+		return 0, "", false
+	}
+	url := text[labelEnd+2 : labelEnd+2+urlEnd]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return 0, "", false
+	}
+	label := strings.TrimSpace(r.render(text[start+1 : labelEnd]))
+	consumed := labelEnd + 2 + urlEnd + 1
+	if label == "" || label == url {
+		return consumed, url, true
+	}
+	return consumed, label + " (" + url + ")", true
+}
+
+func (r *renderer) renderMention(text string) (int, string, bool) {
+	match := mentionPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, "", false
+	}
+	username, host := match[1], match[2]
+	if host != "" {
+		return len(match[0]), "https://" + strings.ToLower(host) + "/@" + username, true
+	}
+	if r.options.LocalBaseURL != "" {
+		return len(match[0]), strings.TrimSuffix(r.options.LocalBaseURL, "/") + "/@" + username, true
+	}
+	return 0, "", false
+}
+
+// matchingBracket returns the index of the ']' that closes the '[' at start,
+// or -1 when the bracket is not closed.
+func matchingBracket(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func trimURL(url string) string {
+	return strings.TrimRight(url, ".,:;!?")
+}
+
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+func startsWithWordRune(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return isWordRune(r)
+}
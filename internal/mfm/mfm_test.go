@@ -0,0 +1,43 @@
+package mfm
+
+import "testing"
+
+func TestToPlainText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		options Options
+		want    string
+	}{
+		{name: "plain", text: "hello world", want: "hello world"},
+		{name: "function", text: "$[x2 big] and $[flip.h flipped]", want: "big and flipped"},
+		{name: "nested function", text: "$[x2 $[spin.speed=1s spin] **bold**]", want: "spin bold"},
+		{name: "ruby", text: "$[ruby 漢字 かんじ]", want: "漢字(かんじ)"},
+		{name: "unclosed function", text: "$[x2 open", want: "$[x2 open"},
+		{name: "center and small", text: "<center>title</center>\n<small>note</small>", want: "title\nnote"},
+		{name: "bold", text: "**bold** __also__ ~~gone~~", want: "bold also gone"},
+		{name: "italic", text: "*italic* snake_case_name", want: "italic snake_case_name"},
+		{name: "plain tag", text: "<plain>**not bold** $[x2 raw]</plain>", want: "**not bold** $[x2 raw]"},
+		{name: "inline code", text: "`**code**`", want: "**code**"},
+		{name: "code block", text: "```go\nfmt.Println()\n```", want: "fmt.Println()"},
+		{name: "custom emoji", text: "hi :blobcat: there", want: "hi :blobcat: there"},
+		{name: "custom emoji dropped", text: "hi :blobcat: there", options: Options{CustomEmoji: CustomEmojiDrop}, want: "hi  there"},
+		{name: "time is not emoji", text: "at 12:30:00", want: "at 12:30:00"},
+		{name: "remote mention", text: "cc @alice@Example.COM", want: "cc https://example.com/@alice"},
+		{name: "local mention without base", text: "cc @alice", want: "cc @alice"},
+		{name: "local mention", text: "cc @alice", options: Options{LocalBaseURL: "https://misskey.example/"}, want: "cc https://misskey.example/@alice"},
+		{name: "email", text: "mail me@example.com", want: "mail me@example.com"},
+		{name: "link", text: "[docs](https://example.com/docs)", want: "docs (https://example.com/docs)"},
+		{name: "silent link", text: "?[https://example.com](https://example.com)", want: "https://example.com"},
+		{name: "url keeps markup characters", text: "https://example.com/a_b_c", want: "https://example.com/a_b_c"},
+		{name: "angle url", text: "<https://example.com>", want: "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToPlainText(tt.text, tt.options); got != tt.want {
+				t.Fatalf("ToPlainText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
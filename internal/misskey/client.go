@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,6 +14,7 @@ import (
 	"path"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const DefaultTwitterMediaHosts = "pbs.twimg.com,video.twimg.com"
@@ -26,6 +28,45 @@ type CreateNoteOptions struct {
 	Text     string
 	FileIDs  []string
 	RenoteID string
+	ReplyID  string
+	Poll     *Poll
+	// Visibility defaults to the account's default visibility when empty.
+	Visibility string
+	CW         string
+}
+
+// UploadDriveFileOptions describes a Twitter media file to upload to Misskey
+// Drive.
+type UploadDriveFileOptions struct {
+	URL          string
+	AllowedHosts []string
+	Comment      string
+	IsSensitive  bool
+	// MaxBytes rejects files larger than the Drive accepts before they are
+	// read into memory. Zero means no limit.
+	MaxBytes int64
+}
+
+// ErrMediaTooLarge is returned when a media file is larger than
+// UploadDriveFileOptions.MaxBytes.
+var ErrMediaTooLarge = errors.New("media file is larger than the Misskey Drive limit")
+
+// MaxDriveFileCommentLength is the longest drive file comment Misskey accepts.
+const MaxDriveFileCommentLength = 512
+
+// Poll limits enforced by the Misskey notes/create API.
+const (
+	MinPollChoices      = 2
+	MaxPollChoices      = 10
+	MaxPollChoiceLength = 50
+)
+
+// Poll is a poll attached to a Misskey note. A zero ExpiresAt creates a poll
+// that never closes.
+type Poll struct {
+	Choices   []string
+	Multiple  bool
+	ExpiresAt time.Time
 }
 
 type APIError struct {
@@ -80,6 +121,25 @@ func CreateNoteWithOptions(ctx context.Context, host, token string, options Crea
 	if options.RenoteID != "" {
 		jsonData["renoteId"] = options.RenoteID
 	}
+	if options.ReplyID != "" {
+		jsonData["replyId"] = options.ReplyID
+	}
+	if options.Visibility != "" {
+		jsonData["visibility"] = options.Visibility
+	}
+	if options.CW != "" {
+		jsonData["cw"] = options.CW
+	}
+	if options.Poll != nil {
+		poll := map[string]interface{}{
+			"choices":  options.Poll.Choices,
+			"multiple": options.Poll.Multiple,
+		}
+		if !options.Poll.ExpiresAt.IsZero() {
+			poll["expiresAt"] = options.Poll.ExpiresAt.UnixMilli()
+		}
+		jsonData["poll"] = poll
+	}
 
 	jsonBytes, err := json.Marshal(jsonData)
 	if err != nil {
@@ -140,17 +200,206 @@ func CreateNoteWithOptions(ctx context.Context, host, token string, options Crea
 	return createResp.CreatedNote.ID, nil
 }
 
+// DeleteNote deletes a note with notes/delete. A note that is already gone is
+// treated as deleted.
+func DeleteNote(ctx context.Context, host, token, noteID string) error {
+	endpoint := "https://" + host + "/api/notes/delete"
+
+	jsonBytes, err := json.Marshal(map[string]interface{}{"noteId": noteID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if isNoSuchNote(resp.StatusCode, respBytes) {
+		return nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &APIError{
+			Operation:   "delete note",
+			StatusCode:  resp.StatusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+	}
+
+	slog.Debug("Successfully deleted Misskey note",
+		slog.String("endpoint", endpoint),
+		slog.String("note_id", noteID),
+		slog.Int("status_code", resp.StatusCode))
+
+	return nil
+}
+
+// NoteExists reports whether a note can still be fetched with notes/show.
+func NoteExists(ctx context.Context, host, token, noteID string) (bool, error) {
+	endpoint := "https://" + host + "/api/notes/show"
+
+	jsonBytes, err := json.Marshal(map[string]interface{}{"noteId": noteID})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonBytes))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if isNoSuchNote(resp.StatusCode, respBytes) {
+		return false, nil
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return false, &APIError{
+			Operation:   "show note",
+			StatusCode:  resp.StatusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+	}
+	return true, nil
+}
+
+// ErrNoteUpdateUnsupported is returned by UpdateNote when the server has no
+// notes/update endpoint or does not let the account edit notes.
+var ErrNoteUpdateUnsupported = errors.New("misskey server does not support notes/update")
+
+// UpdateNote replaces the text and CW of a note with notes/update. Attached
+// files and polls are left as they are.
+func UpdateNote(ctx context.Context, host, token, noteID, text, cw string) error {
+	body := map[string]interface{}{"noteId": noteID, "text": text}
+	if cw != "" {
+		body["cw"] = cw
+	}
+	statusCode, respBytes, err := postAPI(ctx, host, token, "notes/update", body)
+	if err != nil {
+		return err
+	}
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		apiErr := &APIError{
+			Operation:   "update note",
+			StatusCode:  statusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+		switch errorCode(respBytes) {
+		case "UNKNOWN_API_ENDPOINT", "ROLE_PERMISSION_DENIED":
+			apiErr.Err = ErrNoteUpdateUnsupported
+		}
+		return apiErr
+	}
+	return nil
+}
+
+// NoteHasReplies reports whether anyone replied to a note. Deleting a note
+// also deletes its replies.
+func NoteHasReplies(ctx context.Context, host, token, noteID string) (bool, error) {
+	statusCode, respBytes, err := postAPI(ctx, host, token, "notes/replies", map[string]interface{}{"noteId": noteID, "limit": 1})
+	if err != nil {
+		return false, err
+	}
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return false, &APIError{
+			Operation:   "list note replies",
+			StatusCode:  statusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+	}
+	var replies []json.RawMessage
+	if err := json.Unmarshal(respBytes, &replies); err != nil {
+		return false, fmt.Errorf("failed to parse note replies response: %w", err)
+	}
+	return len(replies) > 0, nil
+}
+
+// postAPI posts a JSON body to a Misskey API endpoint and returns the status
+// code and body of the response.
+func postAPI(ctx context.Context, host, token, endpoint string, body map[string]interface{}) (int, []byte, error) {
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/api/"+endpoint, bytes.NewReader(jsonBytes))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, respBytes, nil
+}
+
+// errorCode returns the code of a Misskey API error response.
+func errorCode(body []byte) string {
+	var errResp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return ""
+	}
+	return errResp.Error.Code
+}
+
+// isNoSuchNote reports whether a response is Misskey's NO_SUCH_NOTE error.
+// Other statuses, a bare 404 from a proxy or a wrong host included, do not
+// mean that the note was deleted.
+func isNoSuchNote(statusCode int, body []byte) bool {
+	return statusCode == http.StatusBadRequest && errorCode(body) == "NO_SUCH_NOTE"
+}
+
 // UploadDriveFileFromURL downloads an image from fileURL and uploads it to Misskey Drive.
 func UploadDriveFileFromURL(ctx context.Context, host, token, fileURL string) (string, error) {
 	return UploadDriveFileFromURLWithAllowedHosts(ctx, host, token, fileURL, ParseAllowedHosts(DefaultTwitterMediaHosts))
 }
 
 func UploadDriveFileFromURLWithAllowedHosts(ctx context.Context, host, token, fileURL string, allowedHosts []string) (string, error) {
-	if err := validateTwitterMediaURL(fileURL, allowedHosts); err != nil {
+	return UploadDriveFileWithOptions(ctx, host, token, UploadDriveFileOptions{URL: fileURL, AllowedHosts: allowedHosts})
+}
+
+// UploadDriveFileWithOptions downloads options.URL and uploads it to Misskey
+// Drive with the given file properties.
+func UploadDriveFileWithOptions(ctx context.Context, host, token string, options UploadDriveFileOptions) (string, error) {
+	if err := validateTwitterMediaURL(options.URL, options.AllowedHosts); err != nil {
 		return "", err
 	}
 
-	mediaBytes, mediaType, filename, err := downloadImage(ctx, fileURL)
+	mediaBytes, mediaType, filename, err := downloadMedia(ctx, options.URL, options.MaxBytes)
 	if err != nil {
 		return "", err
 	}
@@ -172,6 +421,16 @@ func UploadDriveFileFromURLWithAllowedHosts(ctx context.Context, host, token, fi
 	if err := writer.WriteField("force", "true"); err != nil {
 		return "", err
 	}
+	if options.IsSensitive {
+		if err := writer.WriteField("isSensitive", "true"); err != nil {
+			return "", err
+		}
+	}
+	if comment := truncateRunes(options.Comment, MaxDriveFileCommentLength); comment != "" {
+		if err := writer.WriteField("comment", comment); err != nil {
+			return "", err
+		}
+	}
 	if err := writer.Close(); err != nil {
 		return "", err
 	}
@@ -214,7 +473,9 @@ func UploadDriveFileFromURLWithAllowedHosts(ctx context.Context, host, token, fi
 	return driveFile.ID, nil
 }
 
-func downloadImage(ctx context.Context, fileURL string) ([]byte, string, string, error) {
+// downloadMedia reads a media file of at most maxBytes, or of any size when
+// maxBytes is zero.
+func downloadMedia(ctx context.Context, fileURL string, maxBytes int64) ([]byte, string, string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
 	if err != nil {
 		return nil, "", "", err
@@ -231,14 +492,25 @@ func downloadImage(ctx context.Context, fileURL string) ([]byte, string, string,
 	}
 
 	mediaType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
-	if !strings.HasPrefix(mediaType, "image/") {
+	if !strings.HasPrefix(mediaType, "image/") && mediaType != "video/mp4" {
 		return nil, "", "", fmt.Errorf("unsupported media type %q", mediaType)
 	}
 
-	mediaBytes, err := io.ReadAll(resp.Body)
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return nil, "", "", fmt.Errorf("%w: Content-Length %d exceeds %d bytes", ErrMediaTooLarge, resp.ContentLength, maxBytes)
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	mediaBytes, err := io.ReadAll(body)
 	if err != nil {
 		return nil, "", "", err
 	}
+	if maxBytes > 0 && int64(len(mediaBytes)) > maxBytes {
+		return nil, "", "", fmt.Errorf("%w: body exceeds %d bytes", ErrMediaTooLarge, maxBytes)
+	}
 	if len(mediaBytes) == 0 {
 		return nil, "", "", fmt.Errorf("media body is empty")
 	}
@@ -289,6 +561,13 @@ func filenameFromURL(fileURL string) string {
 	return filename
 }
 
+func truncateRunes(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit])
+}
+
 func previewBody(body []byte) string {
 	const limit = 512
 	preview := strings.TrimSpace(string(body))
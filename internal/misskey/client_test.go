@@ -3,11 +3,14 @@ package misskey
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateNoteWithFilesUsesBearerAuth(t *testing.T) {
@@ -54,6 +57,53 @@ func TestCreateNoteWithFilesUsesBearerAuth(t *testing.T) {
 	}
 }
 
+func TestCreateNoteWithOptionsIncludesReplyIDAndPoll(t *testing.T) {
+	var gotBody map[string]interface{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"createdNote":{"id":"note-reply"}}`))
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	if _, err := CreateNoteWithOptions(context.Background(), host, "test-token", CreateNoteOptions{
+		Text:    "reply text",
+		ReplyID: "parent-note",
+		Poll: &Poll{
+			Choices:   []string{"a", "b"},
+			ExpiresAt: time.UnixMilli(1700000000000),
+		},
+		Visibility: "home",
+		CW:         "spoiler",
+	}); err != nil {
+		t.Fatalf("CreateNoteWithOptions() error = %v", err)
+	}
+	if gotBody["replyId"] != "parent-note" {
+		t.Fatalf("replyId = %#v, want parent-note", gotBody["replyId"])
+	}
+	if gotBody["visibility"] != "home" || gotBody["cw"] != "spoiler" {
+		t.Fatalf("visibility = %#v, cw = %#v; want home and spoiler", gotBody["visibility"], gotBody["cw"])
+	}
+	wantPoll := map[string]interface{}{
+		"choices":   []interface{}{"a", "b"},
+		"multiple":  false,
+		"expiresAt": float64(1700000000000),
+	}
+	if !reflect.DeepEqual(gotBody["poll"], wantPoll) {
+		t.Fatalf("poll = %#v, want %#v", gotBody["poll"], wantPoll)
+	}
+	if _, ok := gotBody["renoteId"]; ok {
+		t.Fatalf("renoteId = %#v, want omitted", gotBody["renoteId"])
+	}
+}
+
 func TestCreateNoteWithOptionsIncludesRenoteID(t *testing.T) {
 	var gotBody map[string]interface{}
 
@@ -194,3 +244,254 @@ func TestUploadDriveFileFromURLRejectsNonImage(t *testing.T) {
 		t.Fatal("UploadDriveFileFromURL() expected error for non-image response")
 	}
 }
+
+func TestUploadDriveFileWithOptionsRejectsLargeMedia(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunked bool
+	}{
+		{name: "content length"},
+		{name: "chunked body", chunked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/media/large.png" {
+					t.Fatalf("unexpected path: %s", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "image/png")
+				if tt.chunked {
+					w.(http.Flusher).Flush()
+				}
+				_, _ = w.Write([]byte(strings.Repeat("x", 11)))
+			}))
+			defer server.Close()
+
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+
+			host := strings.TrimPrefix(server.URL, "https://")
+			_, err := UploadDriveFileWithOptions(context.Background(), host, "test-token", UploadDriveFileOptions{
+				URL:          server.URL + "/media/large.png",
+				AllowedHosts: []string{host},
+				MaxBytes:     10,
+			})
+			if !errors.Is(err, ErrMediaTooLarge) {
+				t.Fatalf("UploadDriveFileWithOptions() error = %v, want ErrMediaTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestUploadDriveFileWithOptionsAcceptsMP4(t *testing.T) {
+	var gotFilename string
+	var gotContentType string
+	var gotComment string
+	var gotSensitive string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ext_tw_video/720.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			_, _ = w.Write([]byte("mp4-bytes"))
+		case "/api/drive/files/create":
+			gotContentType = r.Header.Get("X-Upload-Content-Type")
+			if err := r.ParseMultipartForm(1024); err != nil {
+				t.Fatalf("ParseMultipartForm() error = %v", err)
+			}
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				t.Fatalf("FormFile() error = %v", err)
+			}
+			_ = file.Close()
+			gotFilename = header.Filename
+			gotComment = r.FormValue("comment")
+			gotSensitive = r.FormValue("isSensitive")
+			_, _ = w.Write([]byte(`{"id":"drive-file-video"}`))
+		default:
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	gotID, err := UploadDriveFileWithOptions(context.Background(), host, "test-token", UploadDriveFileOptions{
+		URL:          server.URL + "/ext_tw_video/720.mp4?tag=12",
+		AllowedHosts: []string{host},
+		Comment:      "a cat on a keyboard",
+		IsSensitive:  true,
+	})
+	if err != nil {
+		t.Fatalf("UploadDriveFileWithOptions() error = %v", err)
+	}
+	if gotID != "drive-file-video" {
+		t.Fatalf("id = %q", gotID)
+	}
+	if gotFilename != "720.mp4" {
+		t.Fatalf("filename = %q, want 720.mp4", gotFilename)
+	}
+	if gotContentType != "video/mp4" {
+		t.Fatalf("X-Upload-Content-Type = %q, want video/mp4", gotContentType)
+	}
+	if gotComment != "a cat on a keyboard" {
+		t.Fatalf("comment = %q, want alt text", gotComment)
+	}
+	if gotSensitive != "true" {
+		t.Fatalf("isSensitive = %q, want true", gotSensitive)
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	var gotBody map[string]interface{}
+	var gotAuth string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/notes/delete" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	if err := DeleteNote(context.Background(), host, "test-token", "note-1"); err != nil {
+		t.Fatalf("DeleteNote() error = %v", err)
+	}
+	if gotAuth != "Bearer test-token" {
+		t.Fatalf("Authorization = %q", gotAuth)
+	}
+	if gotBody["noteId"] != "note-1" {
+		t.Fatalf("noteId = %#v, want note-1", gotBody["noteId"])
+	}
+}
+
+func TestUpdateNote(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{name: "updated", status: http.StatusNoContent},
+		{name: "unknown endpoint", status: http.StatusNotFound, body: `{"error":{"code":"UNKNOWN_API_ENDPOINT"}}`, wantErr: true, wantUnsupported: true},
+		{name: "not permitted", status: http.StatusBadRequest, body: `{"error":{"code":"ROLE_PERMISSION_DENIED"}}`, wantErr: true, wantUnsupported: true},
+		{name: "server error", status: http.StatusInternalServerError, body: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody map[string]interface{}
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/notes/update" {
+					t.Fatalf("unexpected path: %s", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+					t.Fatalf("failed to decode body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+
+			host := strings.TrimPrefix(server.URL, "https://")
+			err := UpdateNote(context.Background(), host, "test-token", "note-1", "edited", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateNote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrNoteUpdateUnsupported); got != tt.wantUnsupported {
+				t.Fatalf("errors.Is(ErrNoteUpdateUnsupported) = %v, want %v", got, tt.wantUnsupported)
+			}
+			if gotBody["noteId"] != "note-1" || gotBody["text"] != "edited" {
+				t.Fatalf("body = %#v, want noteId and text", gotBody)
+			}
+		})
+	}
+}
+
+func TestNoteHasReplies(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want bool
+	}{
+		{body: `[]`, want: false},
+		{body: `[{"id":"reply-1"}]`, want: true},
+	} {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/notes/replies" {
+				t.Fatalf("unexpected path: %s", r.URL.Path)
+			}
+			_, _ = w.Write([]byte(tt.body))
+		}))
+
+		oldClient := httpClient
+		httpClient = server.Client()
+		got, err := NoteHasReplies(context.Background(), strings.TrimPrefix(server.URL, "https://"), "test-token", "note-1")
+		httpClient = oldClient
+		server.Close()
+		if err != nil || got != tt.want {
+			t.Fatalf("NoteHasReplies(%s) = %v, %v; want %v", tt.body, got, err, tt.want)
+		}
+	}
+}
+
+func TestNoteExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "exists", status: http.StatusOK, body: `{"id":"note-1"}`, want: true},
+		{name: "no such note", status: http.StatusBadRequest, body: `{"error":{"code":"NO_SUCH_NOTE","message":"No such note."}}`},
+		{name: "other client error", status: http.StatusBadRequest, body: `{"error":{"code":"INVALID_PARAM"}}`, wantErr: true},
+		{name: "bare not found", status: http.StatusNotFound, body: `<html>Not Found</html>`, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, body: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/notes/show" {
+					t.Fatalf("unexpected path: %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+
+			host := strings.TrimPrefix(server.URL, "https://")
+			got, err := NoteExists(context.Background(), host, "test-token", "note-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NoteExists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NoteExists() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
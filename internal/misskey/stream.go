@@ -0,0 +1,219 @@
+package misskey
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultStreamKeepAliveTimeout = 90 * time.Second
+	// streamChannel delivers the notes of the authenticated user and the
+	// users they follow. The main channel does not deliver the user's own
+	// notes.
+	streamChannel   = "homeTimeline"
+	streamChannelID = "note-tweet-connector"
+)
+
+var ErrStreamKeepAliveTimeout = errors.New("misskey stream keep-alive timeout")
+
+// StreamClient reads the authenticated user's own notes from the Misskey
+// streaming API.
+type StreamClient struct {
+	Host  string
+	Token string
+	// UserID is the authenticated user's ID. It is looked up with the i
+	// endpoint on the first connect when empty.
+	UserID string
+	// Endpoint overrides the wss://<host>/streaming URL.
+	Endpoint         string
+	TLSConfig        *tls.Config
+	KeepAliveTimeout time.Duration
+	OnConnect        func()
+}
+
+type streamMessage struct {
+	Type string `json:"type"`
+	Body struct {
+		ID   string          `json:"id"`
+		Type string          `json:"type"`
+		Body json.RawMessage `json:"body"`
+	} `json:"body"`
+}
+
+func NewStreamClient(host, token string) *StreamClient {
+	return &StreamClient{
+		Host:             host,
+		Token:            token,
+		KeepAliveTimeout: defaultStreamKeepAliveTimeout,
+	}
+}
+
+// Consume connects to the streaming API and calls handleNote with each note
+// posted by the authenticated user until the connection fails or ctx is
+// cancelled.
+func (c *StreamClient) Consume(ctx context.Context, handleNote func(context.Context, []byte) error) error {
+	if c.UserID == "" {
+		userID, err := CurrentUserID(ctx, c.Host, c.Token)
+		if err != nil {
+			return err
+		}
+		c.UserID = userID
+	}
+
+	conn, err := dialWebSocket(ctx, c.streamURL(), c.TLSConfig)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	connectMessage, err := json.Marshal(map[string]interface{}{
+		"type": "connect",
+		"body": map[string]string{
+			"channel": streamChannel,
+			"id":      streamChannelID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteText(connectMessage); err != nil {
+		return err
+	}
+	if c.OnConnect != nil {
+		c.OnConnect()
+	}
+
+	keepAliveTimeout := c.KeepAliveTimeout
+	if keepAliveTimeout <= 0 {
+		keepAliveTimeout = defaultStreamKeepAliveTimeout
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(keepAliveTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				_ = conn.Close()
+				return
+			case <-ticker.C:
+				_ = conn.Ping()
+			}
+		}
+	}()
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(keepAliveTimeout)); err != nil {
+			return err
+		}
+		data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return ErrStreamKeepAliveTimeout
+			}
+			return err
+		}
+
+		note, ok := c.ownNote(data)
+		if !ok {
+			continue
+		}
+		if err := handleNote(ctx, note); err != nil {
+			return err
+		}
+	}
+}
+
+// ownNote returns the note in a channel message when it was posted by the
+// authenticated user.
+func (c *StreamClient) ownNote(data []byte) ([]byte, bool) {
+	var message streamMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, false
+	}
+	if message.Type != "channel" || message.Body.ID != streamChannelID || message.Body.Type != "note" {
+		return nil, false
+	}
+	var note struct {
+		UserID string `json:"userId"`
+	}
+	if err := json.Unmarshal(message.Body.Body, &note); err != nil {
+		return nil, false
+	}
+	if note.UserID == "" || note.UserID != c.UserID {
+		return nil, false
+	}
+	return message.Body.Body, true
+}
+
+func (c *StreamClient) streamURL() string {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "wss://" + c.Host + "/streaming"
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	q := parsed.Query()
+	q.Set("i", c.Token)
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// CurrentUserID returns the ID of the user that owns token.
+func CurrentUserID(ctx context.Context, host, token string) (string, error) {
+	endpoint := "https://" + host + "/api/i"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", &APIError{
+			Operation:   "get current user",
+			StatusCode:  resp.StatusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBytes, &user); err != nil {
+		return "", &APIError{Operation: "get current user", Err: err}
+	}
+	if user.ID == "" {
+		return "", &APIError{Operation: "get current user", Err: errors.New("response did not include user id")}
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,227 @@
+package misskey
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamClientConsumeDeliversOwnNotes(t *testing.T) {
+	connectMessages := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/streaming" {
+			t.Errorf("path = %q, want /streaming", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("i"); got != "test-token" {
+			t.Errorf("i = %q, want test-token", got)
+		}
+		conn, rw := acceptTestWebSocket(t, w, r)
+		defer func() { _ = conn.Close() }()
+
+		_, payload := readTestClientFrame(t, rw.Reader)
+		connectMessages <- string(payload)
+
+		for _, message := range []string{
+			`{"type":"channel","body":{"id":"note-tweet-connector","type":"note","body":{"id":"note-1","userId":"user-1","text":"mine"}}}`,
+			`{"type":"channel","body":{"id":"note-tweet-connector","type":"note","body":{"id":"note-2","userId":"user-2","text":"followee"}}}`,
+			`{"type":"channel","body":{"id":"other","type":"note","body":{"id":"note-3","userId":"user-1"}}}`,
+			`{"type":"noteUpdated","body":{"id":"note-1"}}`,
+		} {
+			writeTestServerFrame(t, rw.Writer, wsOpText, []byte(message))
+		}
+		// Split a message across a continuation frame.
+		message := `{"type":"channel","body":{"id":"note-tweet-connector","type":"note","body":{"id":"note-4","userId":"user-1"}}}`
+		writeTestFrame(t, rw.Writer, false, wsOpText, []byte(message[:20]))
+		writeTestServerFrame(t, rw.Writer, wsOpContinuation, []byte(message[20:]))
+		writeTestServerFrame(t, rw.Writer, wsOpClose, nil)
+	}))
+	defer server.Close()
+
+	client := NewStreamClient("misskey.example", "test-token")
+	client.UserID = "user-1"
+	client.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http") + "/streaming"
+	var connected bool
+	client.OnConnect = func() { connected = true }
+
+	var noteIDs []string
+	err := client.Consume(context.Background(), func(ctx context.Context, note []byte) error {
+		var parsed struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(note, &parsed); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		noteIDs = append(noteIDs, parsed.ID)
+		return nil
+	})
+	if !errors.Is(err, ErrWebSocketClosed) {
+		t.Fatalf("Consume() error = %v, want ErrWebSocketClosed", err)
+	}
+	if !connected {
+		t.Fatal("OnConnect was not called")
+	}
+
+	var connect struct {
+		Type string `json:"type"`
+		Body struct {
+			Channel string `json:"channel"`
+			ID      string `json:"id"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(<-connectMessages), &connect); err != nil {
+		t.Fatalf("Unmarshal(connect) error = %v", err)
+	}
+	if connect.Type != "connect" || connect.Body.Channel != "homeTimeline" || connect.Body.ID != "note-tweet-connector" {
+		t.Fatalf("connect message = %+v", connect)
+	}
+	if strings.Join(noteIDs, ",") != "note-1,note-4" {
+		t.Fatalf("notes = %v, want [note-1 note-4]", noteIDs)
+	}
+}
+
+func TestStreamClientConsumeKeepAliveTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw := acceptTestWebSocket(t, w, r)
+		defer func() { _ = conn.Close() }()
+		// Read the connect message and pings without answering them.
+		for {
+			if _, err := rw.Reader.ReadByte(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client := NewStreamClient("misskey.example", "test-token")
+	client.UserID = "user-1"
+	client.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http") + "/streaming"
+	client.KeepAliveTimeout = 50 * time.Millisecond
+
+	err := client.Consume(context.Background(), func(ctx context.Context, note []byte) error { return nil })
+	if !errors.Is(err, ErrStreamKeepAliveTimeout) {
+		t.Fatalf("Consume() error = %v, want ErrStreamKeepAliveTimeout", err)
+	}
+}
+
+func TestStreamClientConsumeHandshakeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewStreamClient("misskey.example", "bad-token")
+	client.UserID = "user-1"
+	client.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http") + "/streaming"
+
+	err := client.Consume(context.Background(), func(ctx context.Context, note []byte) error { return nil })
+	var handshakeErr *WebSocketHandshakeError
+	if !errors.As(err, &handshakeErr) || handshakeErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Consume() error = %v, want 401 handshake error", err)
+	}
+}
+
+func TestCurrentUserID(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/i" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Fatalf("Authorization = %q", got)
+		}
+		_, _ = w.Write([]byte(`{"id":"user-1","username":"alice"}`))
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	userID, err := CurrentUserID(context.Background(), strings.TrimPrefix(server.URL, "https://"), "test-token")
+	if err != nil {
+		t.Fatalf("CurrentUserID() error = %v", err)
+	}
+	if userID != "user-1" {
+		t.Fatalf("CurrentUserID() = %q, want user-1", userID)
+	}
+}
+
+func acceptTestWebSocket(t *testing.T, w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter) {
+	t.Helper()
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		t.Fatalf("Hijack() error = %v", err)
+	}
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	return conn, rw
+}
+
+func writeTestServerFrame(t *testing.T, w *bufio.Writer, opcode byte, payload []byte) {
+	t.Helper()
+	writeTestFrame(t, w, true, opcode, payload)
+}
+
+func writeTestFrame(t *testing.T, w *bufio.Writer, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else {
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	frame = append(frame, payload...)
+	if _, err := w.Write(frame); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+}
+
+func readTestClientFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if header[1]&0x80 == 0 {
+		t.Fatal("client frame is not masked")
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			t.Fatalf("ReadFull() error = %v", err)
+		}
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	var maskKey [4]byte
+	if _, err := io.ReadFull(r, maskKey[:]); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	maskBytes(payload, maskKey)
+	return header[0] & 0x0F, payload
+}
@@ -0,0 +1,313 @@
+package misskey
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is the RFC 6455 value used to compute Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// maxWebSocketMessageBytes bounds a single message so that a broken server
+// cannot make the client allocate without limit.
+const maxWebSocketMessageBytes = 16 * 1024 * 1024
+
+// ErrWebSocketClosed is returned when the server closes the connection.
+var ErrWebSocketClosed = errors.New("websocket closed by server")
+
+// WebSocketHandshakeError is returned when the server does not upgrade the
+// connection.
+type WebSocketHandshakeError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *WebSocketHandshakeError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("misskey streaming handshake failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("misskey streaming handshake failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// wsConn is a minimal RFC 6455 client connection. It supports text messages,
+// ping/pong and close, which is all the Misskey streaming API uses.
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+func dialWebSocket(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*wsConn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := parsed.Host
+	switch parsed.Scheme {
+	case "wss":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "443")
+		}
+	case "ws":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "80")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", parsed.Scheme)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "wss" {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = parsed.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := websocketHandshake(ctx, conn, parsed)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func websocketHandshake(ctx context.Context, conn net.Conn, target *url.URL) (*wsConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: target.Path, RawQuery: target.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       target.Host,
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, &WebSocketHandshakeError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("misskey streaming handshake did not upgrade to websocket")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, fmt.Errorf("misskey streaming handshake returned an invalid Sec-WebSocket-Accept")
+	}
+
+	return &wsConn{conn: conn, reader: reader}, nil
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs are skipped.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	var inMessage bool
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = c.writeFrame(wsOpClose, nil)
+			return nil, ErrWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if inMessage {
+				return nil, fmt.Errorf("websocket message started before the previous one finished")
+			}
+			message = payload
+			inMessage = true
+		case wsOpContinuation:
+			if !inMessage {
+				return nil, fmt.Errorf("websocket continuation frame without a message")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("unsupported websocket opcode %d", opcode)
+		}
+
+		if len(message) > maxWebSocketMessageBytes {
+			return nil, fmt.Errorf("websocket message exceeds %d bytes", maxWebSocketMessageBytes)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxWebSocketMessageBytes {
+		return false, 0, nil, fmt.Errorf("websocket frame exceeds %d bytes", maxWebSocketMessageBytes)
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, maskKey[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(payload, maskKey)
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsOpText, payload)
+}
+
+// Ping sends a ping frame.
+func (c *wsConn) Ping() error {
+	return c.writeFrame(wsOpPing, nil)
+}
+
+// writeFrame sends a single masked frame, as RFC 6455 requires of clients.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	var maskKey [4]byte
+	if _, err := rand.Read(maskKey[:]); err != nil {
+		return err
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, maskKey[:]...)
+	start := len(frame)
+	frame = append(frame, payload...)
+	maskBytes(frame[start:], maskKey)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// SetReadDeadline sets the deadline for the next read.
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close closes the underlying connection.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func maskBytes(data []byte, key [4]byte) {
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,7 +23,9 @@ const (
 	EventTwitterPostFailed             EventKind = "twitter_post_failed"
 	EventTwitterMediaUploadFailed      EventKind = "twitter_media_upload_failed"
 	EventTwitterStreamDisconnectLoop   EventKind = "twitter_stream_disconnect_loop"
+	EventTwitterRateLimitLow           EventKind = "twitter_rate_limit_low"
 	EventMisskeyAPIFailed              EventKind = "misskey_api_failed"
+	EventConfigReloaded                EventKind = "config_reloaded"
 )
 
 type Severity string
@@ -167,6 +170,60 @@ func (n *DedupeNotifier) pruneLocked(now time.Time) {
 	}
 }
 
+// PairNotifier labels events with the account pair they belong to. The pair
+// is added as the first field and to the dedupe key, so that the same failure
+// on two pairs is reported twice.
+type PairNotifier struct {
+	next Notifier
+	pair string
+}
+
+func NewPairNotifier(next Notifier, pair string) *PairNotifier {
+	if next == nil {
+		next = NoopNotifier{}
+	}
+	return &PairNotifier{
+		next: next,
+		pair: pair,
+	}
+}
+
+func (n *PairNotifier) Notify(ctx context.Context, event Event) error {
+	if n.pair == "" {
+		return n.next.Notify(ctx, event)
+	}
+	event.Fields = append([]Field{{Name: "pair", Value: n.pair}}, event.Fields...)
+	if event.DedupeKey != "" {
+		event.DedupeKey = n.pair + ":" + event.DedupeKey
+	}
+	return n.next.Notify(ctx, event)
+}
+
+// SwappableNotifier forwards events to a notifier that can be replaced while
+// events are being sent, so that a configuration reload can rebuild the
+// notifier chain.
+type SwappableNotifier struct {
+	next atomic.Pointer[Notifier]
+}
+
+func NewSwappableNotifier(next Notifier) *SwappableNotifier {
+	n := &SwappableNotifier{}
+	n.Swap(next)
+	return n
+}
+
+// Swap replaces the notifier that receives the events.
+func (n *SwappableNotifier) Swap(next Notifier) {
+	if next == nil {
+		next = NoopNotifier{}
+	}
+	n.next.Store(&next)
+}
+
+func (n *SwappableNotifier) Notify(ctx context.Context, event Event) error {
+	return (*n.next.Load()).Notify(ctx, event)
+}
+
 type discordPayload struct {
 	Embeds []discordEmbed `json:"embeds"`
 }
@@ -101,6 +101,53 @@ func TestDedupeNotifierSuppressesWithinWindow(t *testing.T) {
 	}
 }
 
+func TestPairNotifierLabelsEvents(t *testing.T) {
+	var calls int32
+	dedupe := NewDedupeNotifier(notifierFunc(func(ctx context.Context, event Event) error {
+		atomic.AddInt32(&calls, 1)
+		if len(event.Fields) != 2 || event.Fields[0].Name != "pair" || event.Fields[1].Name != "note_id" {
+			t.Fatalf("Fields = %#v, want pair first", event.Fields)
+		}
+		return nil
+	}), time.Hour)
+
+	event := Event{DedupeKey: "same", Fields: []Field{{Name: "note_id", Value: "note-1"}}}
+	for _, pair := range []string{"brand-a", "brand-b", "brand-a"} {
+		if err := NewPairNotifier(dedupe, pair).Notify(context.Background(), event); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("calls = %d, want one per pair", got)
+	}
+	if len(event.Fields) != 1 {
+		t.Fatalf("caller fields were modified: %#v", event.Fields)
+	}
+}
+
+func TestSwappableNotifierSwapsTarget(t *testing.T) {
+	var first, second int32
+	n := NewSwappableNotifier(notifierFunc(func(ctx context.Context, event Event) error {
+		atomic.AddInt32(&first, 1)
+		return nil
+	}))
+
+	_ = n.Notify(context.Background(), Event{})
+	n.Swap(notifierFunc(func(ctx context.Context, event Event) error {
+		atomic.AddInt32(&second, 1)
+		return nil
+	}))
+	_ = n.Notify(context.Background(), Event{})
+	n.Swap(nil)
+	if err := n.Notify(context.Background(), Event{}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if atomic.LoadInt32(&first) != 1 || atomic.LoadInt32(&second) != 1 {
+		t.Fatalf("calls = %d, %d; want 1, 1", first, second)
+	}
+}
+
 type notifierFunc func(context.Context, Event) error
 
 func (f notifierFunc) Notify(ctx context.Context, event Event) error {
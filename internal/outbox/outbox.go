@@ -0,0 +1,256 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+)
+
+// Default retry settings.
+const (
+	DefaultRetryMin = 30 * time.Second
+	DefaultRetryMax = 30 * time.Minute
+	// DefaultLease is how long a submitted job is held back from the retry
+	// loop while its first attempt runs. A job left by a crashed process is
+	// retried once the lease has passed.
+	DefaultLease = 10 * time.Minute
+)
+
+// dueBatchSize is the number of due jobs fetched per retry round.
+const dueBatchSize = 100
+
+// Results of the outbox_job_attempts_total metric.
+const (
+	resultSuccess  = "success"
+	resultRetry    = "retry"
+	resultDeferred = "deferred"
+	resultFailed   = "failed"
+)
+
+// Handler posts the cross-post stored in a job payload.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Queue records cross-posts as jobs before posting them and retries the ones
+// that fail with a transient error.
+type Queue struct {
+	// RetryMin and RetryMax bound the exponential backoff between attempts.
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// MaxAttempts moves a job to the failed state after that many attempts.
+	// Zero retries until the job succeeds or fails permanently.
+	MaxAttempts int
+	Lease       time.Duration
+	// IsPermanent reports the errors that are not retried. When nil, every
+	// error is retried.
+	IsPermanent func(error) bool
+	// DeferUntil reports the errors that only delay a job, such as an
+	// exhausted rate limit, and when to attempt it again. Deferred attempts
+	// do not count toward MaxAttempts.
+	DeferUntil func(error) (time.Time, bool)
+
+	store    tracker.Outbox
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+	handlers map[string]Handler
+	now      func() time.Time
+}
+
+// New creates the queue of an account pair that stores jobs in store.
+func New(pair string, store tracker.Outbox, m *metrics.Metrics) *Queue {
+	return &Queue{
+		RetryMin: DefaultRetryMin,
+		RetryMax: DefaultRetryMax,
+		Lease:    DefaultLease,
+		store:    store,
+		metrics:  m,
+		logger:   slog.With(slog.String("pair", pair)),
+		handlers: make(map[string]Handler),
+		now:      time.Now,
+	}
+}
+
+// Handle registers the handler of a job kind. Handlers must be registered
+// before the queue is used.
+func (q *Queue) Handle(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Submit records a job and makes the first attempt. It returns nil when the
+// job succeeded or was queued for a retry, and the error of a job that failed
+// permanently. When the job cannot be recorded, it is attempted once without
+// retries.
+func (q *Queue) Submit(ctx context.Context, kind string, payload []byte) error {
+	job, err := q.Enqueue(ctx, kind, payload)
+	if err != nil {
+		handler, ok := q.handlers[kind]
+		if !ok {
+			return err
+		}
+		q.logger.Error("Failed to record outbox job, posting without retries", slog.String("kind", kind), slog.Any("error", err))
+		return handler(ctx, payload)
+	}
+	return q.Attempt(ctx, job)
+}
+
+// Enqueue records a job without attempting it. The job is held back from the
+// retry loop for the lease, so the caller is expected to pass it to Attempt.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload []byte) (tracker.Job, error) {
+	if _, ok := q.handlers[kind]; !ok {
+		return tracker.Job{}, fmt.Errorf("unknown outbox job kind %q", kind)
+	}
+	id, err := q.store.EnqueueJob(ctx, kind, payload, q.now().Add(q.Lease))
+	if err != nil {
+		return tracker.Job{}, err
+	}
+	return tracker.Job{ID: id, Kind: kind, Payload: payload, State: tracker.JobStatePending}, nil
+}
+
+// Attempt makes the first attempt of a job returned by Enqueue. Its result is
+// the same as that of Submit.
+func (q *Queue) Attempt(ctx context.Context, job tracker.Job) error {
+	defer q.UpdateMetrics(context.WithoutCancel(ctx))
+	return q.attempt(ctx, job)
+}
+
+// Run retries due jobs every interval until ctx is canceled.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	q.RetryDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.RetryDue(ctx)
+		}
+	}
+}
+
+// RetryDue attempts the jobs whose retry time has passed.
+func (q *Queue) RetryDue(ctx context.Context) {
+	defer q.UpdateMetrics(context.WithoutCancel(ctx))
+
+	for ctx.Err() == nil {
+		jobs, err := q.store.DueJobs(ctx, q.now(), dueBatchSize)
+		if err != nil {
+			q.logger.Error("Failed to list due outbox jobs", slog.Any("error", err))
+			return
+		}
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			// The error was logged by attempt.
+			_ = q.attempt(ctx, job)
+		}
+		if len(jobs) < dueBatchSize {
+			return
+		}
+	}
+}
+
+func (q *Queue) attempt(ctx context.Context, job tracker.Job) error {
+	// The job has to be updated even when ctx was canceled during the
+	// attempt.
+	storeCtx := context.WithoutCancel(ctx)
+	logger := q.logger.With(slog.Int64("job_id", job.ID), slog.String("kind", job.Kind))
+
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		err := fmt.Errorf("unknown outbox job kind %q", job.Kind)
+		q.fail(storeCtx, logger, job, err)
+		return err
+	}
+
+	err := handler(ctx, job.Payload)
+	attempts := job.Attempts + 1
+	if err == nil {
+		if err := q.store.DeleteJob(storeCtx, job.ID); err != nil {
+			logger.Error("Failed to delete finished outbox job", slog.Any("error", err))
+		}
+		q.metrics.OutboxJobAttempts.WithLabelValues(job.Kind, resultSuccess).Inc()
+		if job.Attempts > 0 {
+			logger.Info("Outbox job succeeded after retrying", slog.Int("attempts", attempts))
+		}
+		return nil
+	}
+
+	if q.DeferUntil != nil {
+		if until, ok := q.DeferUntil(err); ok {
+			if err := q.store.RescheduleJob(storeCtx, job.ID, job.Attempts, err.Error(), until); err != nil {
+				logger.Error("Failed to reschedule outbox job", slog.Any("error", err))
+			}
+			q.metrics.OutboxJobAttempts.WithLabelValues(job.Kind, resultDeferred).Inc()
+			logger.Info("Outbox job deferred",
+				slog.Time("next_attempt_at", until),
+				slog.Any("error", err))
+			return nil
+		}
+	}
+
+	job.Attempts = attempts
+	if (q.IsPermanent != nil && q.IsPermanent(err)) || (q.MaxAttempts > 0 && attempts >= q.MaxAttempts) {
+		q.fail(storeCtx, logger, job, err)
+		return err
+	}
+
+	// An attempt interrupted by shutdown is retried as soon as the process
+	// is back.
+	next := q.now().Add(q.backoff(attempts))
+	if ctx.Err() != nil {
+		next = q.now()
+	}
+	if err := q.store.RescheduleJob(storeCtx, job.ID, attempts, err.Error(), next); err != nil {
+		logger.Error("Failed to reschedule outbox job", slog.Any("error", err))
+	}
+	q.metrics.OutboxJobAttempts.WithLabelValues(job.Kind, resultRetry).Inc()
+	logger.Warn("Outbox job failed, retrying later",
+		slog.Int("attempts", attempts),
+		slog.Time("next_attempt_at", next),
+		slog.Any("error", err))
+	return nil
+}
+
+func (q *Queue) fail(ctx context.Context, logger *slog.Logger, job tracker.Job, err error) {
+	if storeErr := q.store.FailJob(ctx, job.ID, job.Attempts, err.Error()); storeErr != nil {
+		logger.Error("Failed to mark outbox job as failed", slog.Any("error", storeErr))
+	}
+	q.metrics.OutboxJobAttempts.WithLabelValues(job.Kind, resultFailed).Inc()
+	logger.Error("Outbox job failed permanently",
+		slog.Int("attempts", job.Attempts),
+		slog.Any("error", err))
+}
+
+// backoff returns the delay before the attempt after attempts failures.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.RetryMin
+	for i := 1; i < attempts && delay < q.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > q.RetryMax {
+		delay = q.RetryMax
+	}
+	return delay
+}
+
+// UpdateMetrics refreshes the queue depth and age metrics.
+func (q *Queue) UpdateMetrics(ctx context.Context) {
+	stats, err := q.store.JobStats(ctx)
+	if err != nil {
+		q.logger.Error("Failed to count outbox jobs", slog.Any("error", err))
+		return
+	}
+	q.metrics.OutboxJobs.WithLabelValues(tracker.JobStatePending).Set(float64(stats.Pending))
+	q.metrics.OutboxJobs.WithLabelValues(tracker.JobStateFailed).Set(float64(stats.Failed))
+	age := 0.0
+	if !stats.OldestPending.IsZero() {
+		age = q.now().Sub(stats.OldestPending).Seconds()
+	}
+	q.metrics.OutboxOldestJobAge.Set(age)
+}
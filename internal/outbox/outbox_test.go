@@ -0,0 +1,218 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Soli0222/note-tweet-connector/internal/metrics"
+	"github.com/Soli0222/note-tweet-connector/internal/tracker"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var errPermanent = errors.New("duplicate content")
+
+func newTestQueue(t *testing.T) (*Queue, *tracker.MemoryCrossPostTracker, *time.Time) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store := tracker.NewCrossPostTracker(ctx, time.Hour)
+	q := New("default", store, metrics.NewNoop())
+	q.RetryMin = time.Minute
+	q.RetryMax = 4 * time.Minute
+	q.IsPermanent = func(err error) bool { return errors.Is(err, errPermanent) }
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	return q, store, &now
+}
+
+func TestQueueSubmitSuccess(t *testing.T) {
+	ctx := context.Background()
+	q, store, _ := newTestQueue(t)
+
+	var got string
+	q.Handle("note2tweet", func(ctx context.Context, payload []byte) error {
+		got = string(payload)
+		return nil
+	})
+	if err := q.Submit(ctx, "note2tweet", []byte("note-1")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if got != "note-1" {
+		t.Fatalf("handled payload = %q, want note-1", got)
+	}
+	if stats, err := store.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Fatalf("JobStats() = %+v, %v; want the finished job to be deleted", stats, err)
+	}
+	if got := testutil.ToFloat64(q.metrics.OutboxJobAttempts.WithLabelValues("note2tweet", resultSuccess)); got != 1 {
+		t.Fatalf("success attempts = %v, want 1", got)
+	}
+}
+
+func TestQueueRetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newTestQueue(t)
+
+	calls := 0
+	q.Handle("tweet2note", func(ctx context.Context, payload []byte) error {
+		calls++
+		if calls < 4 {
+			return errors.New("status 503")
+		}
+		return nil
+	})
+	if err := q.Submit(ctx, "tweet2note", []byte("tweet-1")); err != nil {
+		t.Fatalf("Submit() error = %v, want nil for a queued job", err)
+	}
+	if got := testutil.ToFloat64(q.metrics.OutboxJobs.WithLabelValues(tracker.JobStatePending)); got != 1 {
+		t.Fatalf("pending jobs metric = %v, want 1", got)
+	}
+
+	q.RetryDue(ctx)
+	if calls != 1 {
+		t.Fatalf("calls = %d, want no retry before the backoff", calls)
+	}
+
+	for i, delay := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		*now = now.Add(delay)
+		q.RetryDue(ctx)
+		if calls != i+2 {
+			t.Fatalf("calls = %d after %v, want %d", calls, delay, i+2)
+		}
+	}
+	if stats, err := store.JobStats(ctx); err != nil || stats.Pending != 0 {
+		t.Fatalf("JobStats() = %+v, %v; want the job to finish", stats, err)
+	}
+	if got := testutil.ToFloat64(q.metrics.OutboxJobAttempts.WithLabelValues("tweet2note", resultRetry)); got != 3 {
+		t.Fatalf("retry attempts = %v, want 3", got)
+	}
+}
+
+func TestQueueFailsPermanentErrors(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newTestQueue(t)
+
+	q.Handle("note2tweet", func(ctx context.Context, payload []byte) error {
+		return errPermanent
+	})
+	if err := q.Submit(ctx, "note2tweet", []byte("note-1")); !errors.Is(err, errPermanent) {
+		t.Fatalf("Submit() error = %v, want the permanent error", err)
+	}
+	*now = now.Add(time.Hour)
+	if jobs, err := store.DueJobs(ctx, *now, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("DueJobs() = %+v, %v; want no retry", jobs, err)
+	}
+	if got := testutil.ToFloat64(q.metrics.OutboxJobs.WithLabelValues(tracker.JobStateFailed)); got != 1 {
+		t.Fatalf("failed jobs metric = %v, want 1", got)
+	}
+}
+
+func TestQueueMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newTestQueue(t)
+	q.MaxAttempts = 2
+
+	q.Handle("note2tweet", func(ctx context.Context, payload []byte) error {
+		return errors.New("status 503")
+	})
+	if err := q.Submit(ctx, "note2tweet", []byte("note-1")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	*now = now.Add(time.Minute)
+	q.RetryDue(ctx)
+	if stats, err := store.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 1 {
+		t.Fatalf("JobStats() = %+v, %v; want the job to fail after 2 attempts", stats, err)
+	}
+}
+
+func TestQueueDefersRateLimitedJobs(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newTestQueue(t)
+	q.MaxAttempts = 1
+	resetAt := now.Add(time.Hour)
+	errRateLimited := errors.New("rate limited")
+	q.DeferUntil = func(err error) (time.Time, bool) {
+		return resetAt, errors.Is(err, errRateLimited)
+	}
+
+	calls := 0
+	q.Handle("note2tweet", func(ctx context.Context, payload []byte) error {
+		calls++
+		if calls == 1 {
+			return errRateLimited
+		}
+		return nil
+	})
+	if err := q.Submit(ctx, "note2tweet", []byte("note-1")); err != nil {
+		t.Fatalf("Submit() error = %v, want nil for a deferred job", err)
+	}
+	jobs, err := store.DueJobs(ctx, resetAt, 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 0 || !jobs[0].NextAttemptAt.Equal(resetAt) {
+		t.Fatalf("DueJobs() = %+v, want the job deferred until %v without counting the attempt", jobs, resetAt)
+	}
+
+	*now = resetAt.Add(-time.Second)
+	q.RetryDue(ctx)
+	if calls != 1 {
+		t.Fatalf("calls = %d, want no attempt before the reset", calls)
+	}
+	*now = resetAt
+	q.RetryDue(ctx)
+	if stats, err := store.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Fatalf("JobStats() = %+v, %v; want the deferred job to finish", stats, err)
+	}
+	if got := testutil.ToFloat64(q.metrics.OutboxJobAttempts.WithLabelValues("note2tweet", resultDeferred)); got != 1 {
+		t.Fatalf("deferred attempts = %v, want 1", got)
+	}
+}
+
+func TestQueueRetriesInterruptedAttemptImmediately(t *testing.T) {
+	q, store, now := newTestQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q.Handle("note2tweet", func(ctx context.Context, payload []byte) error {
+		cancel()
+		return ctx.Err()
+	})
+	if err := q.Submit(ctx, "note2tweet", []byte("note-1")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	jobs, err := store.DueJobs(context.Background(), *now, 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 1 {
+		t.Fatalf("DueJobs() = %+v, want the interrupted job to be due", jobs)
+	}
+}
+
+func TestQueueOldestJobAge(t *testing.T) {
+	ctx := context.Background()
+	q, store, now := newTestQueue(t)
+
+	if _, err := store.EnqueueJob(ctx, "note2tweet", []byte("note-1"), now.Add(time.Hour)); err != nil {
+		t.Fatalf("EnqueueJob() error = %v", err)
+	}
+	*now = now.Add(90 * time.Second)
+	q.UpdateMetrics(ctx)
+	if got := testutil.ToFloat64(q.metrics.OutboxOldestJobAge); got < 89 {
+		t.Fatalf("oldest job age = %v, want about 90", got)
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := New("default", nil, metrics.NewNoop())
+	q.RetryMin = time.Second
+	q.RetryMax = 5 * time.Second
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range want {
+		if got := q.backoff(i + 1); got != delay {
+			t.Fatalf("backoff(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+}
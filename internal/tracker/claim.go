@@ -0,0 +1,94 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrClaimed is returned by Claim when another worker holds the claim.
+var ErrClaimed = errors.New("cross-post is claimed by another worker")
+
+// ClaimedError is returned by Claim when another worker holds the claim. It
+// matches ErrClaimed and carries the held claim, so that callers can tell a
+// claim left by a crashed process from one of a running worker.
+type ClaimedError struct {
+	Claim Claim
+}
+
+func (e *ClaimedError) Error() string {
+	return ErrClaimed.Error()
+}
+
+func (e *ClaimedError) Is(target error) bool {
+	return target == ErrClaimed
+}
+
+// Claim marks a note or tweet that a worker is cross-posting. A claim is
+// completed once the cross-post is recorded and released when nothing was
+// posted. A claim left by a crashed process stays until an operator resolves
+// it, because its post may already exist; callers treat a claim older than
+// their lease as such.
+type Claim struct {
+	Direction string
+	// SourceID is the Misskey note ID for DirectionMisskeyToTweet and the
+	// tweet ID for DirectionTweetToMisskey.
+	SourceID  string
+	ClaimedAt time.Time
+}
+
+type claimKey struct {
+	direction string
+	sourceID  string
+}
+
+// Claim takes the claim of a source post. It returns a *ClaimedError when the
+// claim is already held.
+func (t *MemoryCrossPostTracker) Claim(ctx context.Context, direction, sourceID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	claim := Claim{Direction: direction, SourceID: sourceID, ClaimedAt: time.Now()}
+	if held, loaded := t.claims.LoadOrStore(claimKey{direction, sourceID}, claim); loaded {
+		heldClaim, _ := held.(Claim)
+		return &ClaimedError{Claim: heldClaim}
+	}
+	return nil
+}
+
+// CompleteClaim drops the claim of a source post whose cross-post was
+// recorded.
+func (t *MemoryCrossPostTracker) CompleteClaim(ctx context.Context, direction, sourceID string) error {
+	return t.dropClaim(ctx, direction, sourceID)
+}
+
+// ReleaseClaim drops the claim of a source post that was not cross-posted, so
+// that another worker can take it.
+func (t *MemoryCrossPostTracker) ReleaseClaim(ctx context.Context, direction, sourceID string) error {
+	return t.dropClaim(ctx, direction, sourceID)
+}
+
+func (t *MemoryCrossPostTracker) dropClaim(ctx context.Context, direction, sourceID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.claims.Delete(claimKey{direction, sourceID})
+	return nil
+}
+
+// ListClaims returns the held claims, oldest first.
+func (t *MemoryCrossPostTracker) ListClaims(ctx context.Context) ([]Claim, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var claims []Claim
+	t.claims.Range(func(_, value interface{}) bool {
+		if claim, ok := value.(Claim); ok {
+			claims = append(claims, claim)
+		}
+		return true
+	})
+	sort.Slice(claims, func(i, j int) bool { return claims[i].ClaimedAt.Before(claims[j].ClaimedAt) })
+	return claims, nil
+}
@@ -0,0 +1,138 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testClaims(t *testing.T, tracker CrossPostTracker) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := tracker.Claim(ctx, DirectionMisskeyToTweet, "note-1"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	err := tracker.Claim(ctx, DirectionMisskeyToTweet, "note-1")
+	var claimedErr *ClaimedError
+	if !errors.Is(err, ErrClaimed) || !errors.As(err, &claimedErr) {
+		t.Fatalf("Claim() second error = %v, want %v", err, ErrClaimed)
+	}
+	if claimedErr.Claim.SourceID != "note-1" || claimedErr.Claim.ClaimedAt.IsZero() {
+		t.Fatalf("ClaimedError.Claim = %+v, want the held claim", claimedErr.Claim)
+	}
+	if err := tracker.Claim(ctx, DirectionTweetToMisskey, "note-1"); err != nil {
+		t.Fatalf("Claim() other direction error = %v", err)
+	}
+
+	claims, err := tracker.ListClaims(ctx)
+	if err != nil {
+		t.Fatalf("ListClaims() error = %v", err)
+	}
+	if len(claims) != 2 || claims[0].SourceID != "note-1" || claims[0].ClaimedAt.IsZero() {
+		t.Fatalf("ListClaims() = %+v, want both claims", claims)
+	}
+
+	if err := tracker.ReleaseClaim(ctx, DirectionMisskeyToTweet, "note-1"); err != nil {
+		t.Fatalf("ReleaseClaim() error = %v", err)
+	}
+	if err := tracker.Claim(ctx, DirectionMisskeyToTweet, "note-1"); err != nil {
+		t.Fatalf("Claim() after release error = %v", err)
+	}
+	for _, direction := range []string{DirectionMisskeyToTweet, DirectionTweetToMisskey} {
+		if err := tracker.CompleteClaim(ctx, direction, "note-1"); err != nil {
+			t.Fatalf("CompleteClaim(%s) error = %v", direction, err)
+		}
+	}
+	if claims, err := tracker.ListClaims(ctx); err != nil || len(claims) != 0 {
+		t.Fatalf("ListClaims() = %+v, %v; want no claims", claims, err)
+	}
+}
+
+func testConcurrentClaims(t *testing.T, tracker CrossPostTracker) {
+	t.Helper()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	won := 0
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := tracker.Claim(ctx, DirectionMisskeyToTweet, "note-2")
+			if err != nil && !errors.Is(err, ErrClaimed) {
+				t.Errorf("Claim() error = %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				won++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Fatalf("claims taken = %d, want 1", won)
+	}
+}
+
+func TestCrossPostTracker_Claims(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testClaims(t, NewCrossPostTracker(ctx, time.Hour))
+	testConcurrentClaims(t, NewCrossPostTracker(ctx, time.Hour))
+}
+
+func TestSQLiteCrossPostTracker_Claims(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	testClaims(t, tracker)
+	testConcurrentClaims(t, tracker)
+}
+
+func TestSQLiteCrossPostTracker_ClaimsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "tracker.sqlite")
+
+	tracker, err := NewSQLiteCrossPostTracker(ctx, dbPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	if err := tracker.WithNamespace("alice").Claim(ctx, DirectionTweetToMisskey, "tweet-1"); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tracker, err = NewSQLiteCrossPostTracker(ctx, dbPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() reopen error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	if claims, err := tracker.ListClaims(ctx); err != nil || len(claims) != 0 {
+		t.Fatalf("default namespace ListClaims() = %+v, %v; want no claims", claims, err)
+	}
+	claims, err := tracker.WithNamespace("alice").ListClaims(ctx)
+	if err != nil {
+		t.Fatalf("ListClaims() error = %v", err)
+	}
+	if len(claims) != 1 || claims[0].Direction != DirectionTweetToMisskey || claims[0].SourceID != "tweet-1" {
+		t.Fatalf("ListClaims() = %+v, want the stale claim", claims)
+	}
+	if err := tracker.WithNamespace("alice").Claim(ctx, DirectionTweetToMisskey, "tweet-1"); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("Claim() error = %v, want %v for a stale claim", err, ErrClaimed)
+	}
+}
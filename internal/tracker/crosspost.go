@@ -13,14 +13,39 @@ type CrossPostRecord struct {
 	TweetID       string
 	Direction     string
 	CreatedAt     time.Time
+	// DeletedAt is set once the post was deleted on either side. Deleted
+	// records stay in the tracker so that a late webhook is still skipped.
+	DeletedAt time.Time
+	// ThreadTweetIDs lists the later tweets of a thread in order. It is
+	// filled by ListActive and FindByMisskeyNoteID.
+	ThreadTweetIDs []string
+	// Incomplete is set when posting the thread stopped partway. The
+	// remaining parts are posted by the next attempt.
+	Incomplete bool
 }
 
 // CrossPostTracker tracks cross-posted note/tweet IDs to prevent loops.
 type CrossPostTracker interface {
 	RememberMisskeyToTweet(ctx context.Context, noteID, tweetID string) error
 	RememberTweetToMisskey(ctx context.Context, tweetID, noteID string) error
+	RememberMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error
+	// RememberIncompleteMisskeyToTweetThread records the posted part of a
+	// thread that stopped partway, so that a retry continues it instead of
+	// posting it again.
+	RememberIncompleteMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error
+	ReplaceTweetToMisskey(ctx context.Context, oldTweetID, tweetID, noteID string) error
+	MarkDeleted(ctx context.Context, noteID string, deletedAt time.Time) error
+	ListActive(ctx context.Context, since time.Time) ([]CrossPostRecord, error)
+	LoadCursor(ctx context.Context, name string) (string, error)
+	SaveCursor(ctx context.Context, name, value string) error
 	HasMisskeyNote(ctx context.Context, noteID string) (bool, error)
 	HasTweet(ctx context.Context, tweetID string) (bool, error)
+	// Claim takes the claim of a source post before it is cross-posted and
+	// returns ErrClaimed when another worker holds it.
+	Claim(ctx context.Context, direction, sourceID string) error
+	CompleteClaim(ctx context.Context, direction, sourceID string) error
+	ReleaseClaim(ctx context.Context, direction, sourceID string) error
+	ListClaims(ctx context.Context) ([]Claim, error)
 	FindByMisskeyNoteID(ctx context.Context, noteID string) (CrossPostRecord, bool, error)
 	FindByTweetID(ctx context.Context, tweetID string) (CrossPostRecord, bool, error)
 	Prune(ctx context.Context, now time.Time) (int64, error)
@@ -32,7 +57,17 @@ type CrossPostTracker interface {
 type MemoryCrossPostTracker struct {
 	byMisskeyNoteID sync.Map
 	byTweetID       sync.Map
-	retention       time.Duration
+	cursors         sync.Map
+	claims          sync.Map
+	// threads holds the later tweets of each thread in order, keyed by note
+	// ID.
+	threads    sync.Map
+	rateLimits sync.Map
+	retention  time.Duration
+
+	jobsMu    sync.Mutex
+	jobs      map[int64]Job
+	nextJobID int64
 }
 
 const (
@@ -81,6 +116,7 @@ func (t *MemoryCrossPostTracker) Prune(_ context.Context, now time.Time) (int64,
 		record, ok := value.(CrossPostRecord)
 		if !ok || record.CreatedAt.Before(cutoff) {
 			t.byMisskeyNoteID.Delete(key)
+			t.threads.Delete(key)
 			deleted++
 			if ok && record.TweetID != "" {
 				t.byTweetID.Delete(record.TweetID)
@@ -96,11 +132,13 @@ func (t *MemoryCrossPostTracker) Prune(_ context.Context, now time.Time) (int64,
 			deleted++
 			if ok && record.MisskeyNoteID != "" {
 				t.byMisskeyNoteID.Delete(record.MisskeyNoteID)
+				t.threads.Delete(record.MisskeyNoteID)
 			}
 		}
 		return true
 	})
 
+	t.pruneJobs(cutoff)
 	return deleted, nil
 }
 
@@ -114,6 +152,67 @@ func (t *MemoryCrossPostTracker) RememberTweetToMisskey(ctx context.Context, twe
 	return t.remember(ctx, noteID, tweetID, DirectionTweetToMisskey)
 }
 
+// RememberMisskeyToTweetThread records a Misskey note that was cross-posted as a
+// reply thread. The first tweet becomes the note's primary record and every
+// tweet in the chain resolves back to the note.
+func (t *MemoryCrossPostTracker) RememberMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error {
+	return t.rememberThread(ctx, noteID, tweetIDs, false)
+}
+
+// RememberIncompleteMisskeyToTweetThread records the posted part of a thread
+// that stopped partway.
+func (t *MemoryCrossPostTracker) RememberIncompleteMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error {
+	return t.rememberThread(ctx, noteID, tweetIDs, true)
+}
+
+func (t *MemoryCrossPostTracker) rememberThread(ctx context.Context, noteID string, tweetIDs []string, incomplete bool) error {
+	if len(tweetIDs) == 0 {
+		return nil
+	}
+	if err := t.remember(ctx, noteID, tweetIDs[0], DirectionMisskeyToTweet); err != nil {
+		return err
+	}
+	if noteID == "" {
+		return nil
+	}
+	if value, ok := t.byMisskeyNoteID.Load(noteID); ok {
+		if record, ok := value.(CrossPostRecord); ok {
+			record.Incomplete = incomplete
+			t.byMisskeyNoteID.Store(noteID, record)
+		}
+	}
+	now := time.Now()
+	threadTweetIDs := make([]string, 0, len(tweetIDs)-1)
+	for _, tweetID := range tweetIDs[1:] {
+		if tweetID == "" {
+			continue
+		}
+		threadTweetIDs = append(threadTweetIDs, tweetID)
+		t.byTweetID.Store(tweetID, CrossPostRecord{
+			MisskeyNoteID: noteID,
+			TweetID:       tweetID,
+			Direction:     DirectionMisskeyToTweet,
+			CreatedAt:     now,
+		})
+	}
+	t.threads.Store(noteID, threadTweetIDs)
+	return nil
+}
+
+// ReplaceTweetToMisskey replaces the record of oldTweetID with a record for
+// an edited tweet and the note that mirrors it.
+func (t *MemoryCrossPostTracker) ReplaceTweetToMisskey(ctx context.Context, oldTweetID, tweetID, noteID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if value, ok := t.byTweetID.LoadAndDelete(oldTweetID); ok {
+		if record, ok := value.(CrossPostRecord); ok {
+			t.byMisskeyNoteID.Delete(record.MisskeyNoteID)
+		}
+	}
+	return t.remember(ctx, noteID, tweetID, DirectionTweetToMisskey)
+}
+
 func (t *MemoryCrossPostTracker) remember(ctx context.Context, noteID, tweetID, direction string) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -179,9 +278,21 @@ func (t *MemoryCrossPostTracker) FindByMisskeyNoteID(ctx context.Context, noteID
 		return CrossPostRecord{}, false, nil
 	}
 	record, ok := value.(CrossPostRecord)
+	if ok {
+		record.ThreadTweetIDs = t.threadTweetIDs(noteID)
+	}
 	return record, ok, nil
 }
 
+func (t *MemoryCrossPostTracker) threadTweetIDs(noteID string) []string {
+	value, ok := t.threads.Load(noteID)
+	if !ok {
+		return nil
+	}
+	tweetIDs, _ := value.([]string)
+	return append([]string(nil), tweetIDs...)
+}
+
 // FindByTweetID returns the record for a Twitter tweet ID.
 func (t *MemoryCrossPostTracker) FindByTweetID(ctx context.Context, tweetID string) (CrossPostRecord, bool, error) {
 	if err := ctx.Err(); err != nil {
@@ -195,6 +306,73 @@ func (t *MemoryCrossPostTracker) FindByTweetID(ctx context.Context, tweetID stri
 	return record, ok, nil
 }
 
+// MarkDeleted marks the records of a Misskey note, including its thread
+// tweets, as deleted.
+func (t *MemoryCrossPostTracker) MarkDeleted(ctx context.Context, noteID string, deletedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if value, ok := t.byMisskeyNoteID.Load(noteID); ok {
+		if record, ok := value.(CrossPostRecord); ok {
+			record.DeletedAt = deletedAt
+			t.byMisskeyNoteID.Store(noteID, record)
+		}
+	}
+	t.byTweetID.Range(func(key, value interface{}) bool {
+		if record, ok := value.(CrossPostRecord); ok && record.MisskeyNoteID == noteID {
+			record.DeletedAt = deletedAt
+			t.byTweetID.Store(key, record)
+		}
+		return true
+	})
+	return nil
+}
+
+// ListActive returns the records created at or after since that are not
+// marked as deleted.
+func (t *MemoryCrossPostTracker) ListActive(ctx context.Context, since time.Time) ([]CrossPostRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var records []CrossPostRecord
+	t.byMisskeyNoteID.Range(func(_, value interface{}) bool {
+		record, ok := value.(CrossPostRecord)
+		if ok && record.DeletedAt.IsZero() && !record.CreatedAt.Before(since) {
+			records = append(records, record)
+		}
+		return true
+	})
+	for i := range records {
+		records[i].ThreadTweetIDs = t.threadTweetIDs(records[i].MisskeyNoteID)
+	}
+	return records, nil
+}
+
+// LoadCursor returns the value saved under name, or an empty string when no
+// value was saved.
+func (t *MemoryCrossPostTracker) LoadCursor(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	value, ok := t.cursors.Load(name)
+	if !ok {
+		return "", nil
+	}
+	cursor, _ := value.(string)
+	return cursor, nil
+}
+
+// SaveCursor saves a source position, such as the newest tweet ID seen by the
+// timeline poller. Cursors are not pruned.
+func (t *MemoryCrossPostTracker) SaveCursor(ctx context.Context, name, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.cursors.Store(name, value)
+	return nil
+}
+
 // Count returns the number of records in the tracker.
 func (t *MemoryCrossPostTracker) Count(ctx context.Context) (int64, error) {
 	if err := ctx.Err(); err != nil {
@@ -3,6 +3,7 @@ package tracker
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -80,6 +81,126 @@ func TestCrossPostTracker_RememberTweetToMisskey(t *testing.T) {
 	}
 }
 
+func TestCrossPostTracker_RememberMisskeyToTweetThread(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := NewCrossPostTracker(ctx, 1*time.Hour)
+	if err := tracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2", "tweet-3"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+
+	record, ok, err := tracker.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok {
+		t.Fatalf("FindByMisskeyNoteID() = %v, %v; want record", ok, err)
+	}
+	if record.TweetID != "tweet-1" {
+		t.Fatalf("TweetID = %q, want tweet-1", record.TweetID)
+	}
+	for _, tweetID := range []string{"tweet-1", "tweet-2", "tweet-3"} {
+		record, ok, err := tracker.FindByTweetID(ctx, tweetID)
+		if err != nil || !ok {
+			t.Fatalf("FindByTweetID(%q) = %v, %v; want record", tweetID, ok, err)
+		}
+		if record.MisskeyNoteID != "note-1" {
+			t.Fatalf("FindByTweetID(%q).MisskeyNoteID = %q, want note-1", tweetID, record.MisskeyNoteID)
+		}
+	}
+	if count, err := tracker.Count(ctx); err != nil || count != 1 {
+		t.Fatalf("Count() = %d, %v; want 1", count, err)
+	}
+}
+
+func TestCrossPostTracker_ReplaceTweetToMisskey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := NewCrossPostTracker(ctx, 1*time.Hour)
+	if err := tracker.RememberTweetToMisskey(ctx, "tweet-1", "note-1"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() error = %v", err)
+	}
+	if err := tracker.ReplaceTweetToMisskey(ctx, "tweet-1", "tweet-2", "note-2"); err != nil {
+		t.Fatalf("ReplaceTweetToMisskey() error = %v", err)
+	}
+
+	if ok, _ := tracker.HasTweet(ctx, "tweet-1"); ok {
+		t.Fatal("HasTweet(tweet-1) = true, want replaced record removed")
+	}
+	if ok, _ := tracker.HasMisskeyNote(ctx, "note-1"); ok {
+		t.Fatal("HasMisskeyNote(note-1) = true, want replaced record removed")
+	}
+	record, ok, err := tracker.FindByTweetID(ctx, "tweet-2")
+	if err != nil || !ok || record.MisskeyNoteID != "note-2" || record.Direction != DirectionTweetToMisskey {
+		t.Fatalf("FindByTweetID(tweet-2) = %#v, %v, %v; want note-2 tweet_to_misskey", record, ok, err)
+	}
+	if count, err := tracker.Count(ctx); err != nil || count != 1 {
+		t.Fatalf("Count() = %d, %v; want 1", count, err)
+	}
+}
+
+func TestCrossPostTracker_MarkDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := NewCrossPostTracker(ctx, 1*time.Hour)
+	if err := tracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	if err := tracker.RememberTweetToMisskey(ctx, "tweet-3", "note-3"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() error = %v", err)
+	}
+
+	active, err := tracker.ListActive(ctx, time.Now().Add(-time.Minute))
+	if err != nil || len(active) != 2 {
+		t.Fatalf("ListActive() = %#v, %v; want 2 records", active, err)
+	}
+	for _, record := range active {
+		if record.MisskeyNoteID == "note-1" && !reflect.DeepEqual(record.ThreadTweetIDs, []string{"tweet-2"}) {
+			t.Fatalf("ThreadTweetIDs = %v, want [tweet-2]", record.ThreadTweetIDs)
+		}
+	}
+
+	deletedAt := time.Now()
+	if err := tracker.MarkDeleted(ctx, "note-1", deletedAt); err != nil {
+		t.Fatalf("MarkDeleted() error = %v", err)
+	}
+	for _, tweetID := range []string{"tweet-1", "tweet-2"} {
+		record, ok, err := tracker.FindByTweetID(ctx, tweetID)
+		if err != nil || !ok || !record.DeletedAt.Equal(deletedAt) {
+			t.Fatalf("FindByTweetID(%q) = %#v, %v, %v; want deleted record", tweetID, record, ok, err)
+		}
+	}
+	if ok, _ := tracker.HasMisskeyNote(ctx, "note-1"); !ok {
+		t.Fatal("HasMisskeyNote(note-1) = false, want deleted record kept")
+	}
+
+	active, err = tracker.ListActive(ctx, time.Now().Add(-time.Minute))
+	if err != nil || len(active) != 1 || active[0].MisskeyNoteID != "note-3" {
+		t.Fatalf("ListActive() = %#v, %v; want note-3 only", active, err)
+	}
+	if active, err := tracker.ListActive(ctx, time.Now().Add(time.Minute)); err != nil || len(active) != 0 {
+		t.Fatalf("ListActive(future) = %#v, %v; want none", active, err)
+	}
+}
+
+func TestCrossPostTracker_Cursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := NewCrossPostTracker(ctx, 1*time.Hour)
+	if value, err := tracker.LoadCursor(ctx, "cursor-1"); err != nil || value != "" {
+		t.Fatalf("LoadCursor() = %q, %v; want empty", value, err)
+	}
+	for _, want := range []string{"100", "200"} {
+		if err := tracker.SaveCursor(ctx, "cursor-1", want); err != nil {
+			t.Fatalf("SaveCursor() error = %v", err)
+		}
+		if value, err := tracker.LoadCursor(ctx, "cursor-1"); err != nil || value != want {
+			t.Fatalf("LoadCursor() = %q, %v; want %q", value, err, want)
+		}
+	}
+}
+
 func TestCrossPostTracker_EmptyIDsAreIgnored(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -158,3 +279,31 @@ func TestCrossPostTracker_ConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func testIncompleteThread(t *testing.T, tracker CrossPostTracker) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := tracker.RememberIncompleteMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2"}); err != nil {
+		t.Fatalf("RememberIncompleteMisskeyToTweetThread() error = %v", err)
+	}
+	record, ok, err := tracker.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok || !record.Incomplete || !reflect.DeepEqual(record.ThreadTweetIDs, []string{"tweet-2"}) {
+		t.Fatalf("FindByMisskeyNoteID() = %+v, %v, %v; want the incomplete thread", record, ok, err)
+	}
+
+	if err := tracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2", "tweet-3"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	record, ok, err = tracker.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok || record.Incomplete || !reflect.DeepEqual(record.ThreadTweetIDs, []string{"tweet-2", "tweet-3"}) {
+		t.Fatalf("FindByMisskeyNoteID() = %+v, %v, %v; want the completed thread", record, ok, err)
+	}
+}
+
+func TestCrossPostTracker_IncompleteThread(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testIncompleteThread(t, NewCrossPostTracker(ctx, time.Hour))
+}
@@ -0,0 +1,178 @@
+package tracker
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Outbox job states. Jobs are deleted once they succeed.
+const (
+	JobStatePending = "pending"
+	JobStateFailed  = "failed"
+)
+
+// Job is a cross-post waiting in the outbox.
+type Job struct {
+	ID      int64
+	Kind    string
+	Payload []byte
+	State   string
+	// Attempts counts the finished attempts.
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	// NextAttemptAt is when a pending job is due.
+	NextAttemptAt time.Time
+}
+
+// JobStats summarizes the outbox.
+type JobStats struct {
+	Pending int64
+	Failed  int64
+	// OldestPending is the creation time of the oldest pending job, or the
+	// zero time when no job is pending.
+	OldestPending time.Time
+}
+
+// Outbox persists cross-posts until they are posted, so that they can be
+// retried after a failure or a restart.
+type Outbox interface {
+	// EnqueueJob adds a pending job that is due at nextAttemptAt.
+	EnqueueJob(ctx context.Context, kind string, payload []byte, nextAttemptAt time.Time) (int64, error)
+	// DueJobs returns up to limit pending jobs that are due at now, oldest
+	// first.
+	DueJobs(ctx context.Context, now time.Time, limit int) ([]Job, error)
+	// RescheduleJob records a failed attempt of a pending job.
+	RescheduleJob(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt time.Time) error
+	// FailJob moves a job to the failed state. Failed jobs are not retried
+	// and are pruned with the cross-post records.
+	FailJob(ctx context.Context, id int64, attempts int, lastError string) error
+	DeleteJob(ctx context.Context, id int64) error
+	JobStats(ctx context.Context) (JobStats, error)
+}
+
+// EnqueueJob adds a pending job that is due at nextAttemptAt.
+func (t *MemoryCrossPostTracker) EnqueueJob(ctx context.Context, kind string, payload []byte, nextAttemptAt time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	if t.jobs == nil {
+		t.jobs = make(map[int64]Job)
+	}
+	t.nextJobID++
+	t.jobs[t.nextJobID] = Job{
+		ID:            t.nextJobID,
+		Kind:          kind,
+		Payload:       append([]byte(nil), payload...),
+		State:         JobStatePending,
+		CreatedAt:     time.Now(),
+		NextAttemptAt: nextAttemptAt,
+	}
+	return t.nextJobID, nil
+}
+
+// DueJobs returns up to limit pending jobs that are due at now, oldest first.
+func (t *MemoryCrossPostTracker) DueJobs(ctx context.Context, now time.Time, limit int) ([]Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	var jobs []Job
+	for _, job := range t.jobs {
+		if job.State == JobStatePending && !job.NextAttemptAt.After(now) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// RescheduleJob records a failed attempt of a pending job.
+func (t *MemoryCrossPostTracker) RescheduleJob(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt time.Time) error {
+	return t.updateJob(ctx, id, func(job *Job) {
+		job.Attempts = attempts
+		job.LastError = lastError
+		job.NextAttemptAt = nextAttemptAt
+	})
+}
+
+// FailJob moves a job to the failed state.
+func (t *MemoryCrossPostTracker) FailJob(ctx context.Context, id int64, attempts int, lastError string) error {
+	return t.updateJob(ctx, id, func(job *Job) {
+		job.State = JobStateFailed
+		job.Attempts = attempts
+		job.LastError = lastError
+	})
+}
+
+func (t *MemoryCrossPostTracker) updateJob(ctx context.Context, id int64, update func(*Job)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return nil
+	}
+	update(&job)
+	t.jobs[id] = job
+	return nil
+}
+
+// DeleteJob removes a job from the outbox.
+func (t *MemoryCrossPostTracker) DeleteJob(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	delete(t.jobs, id)
+	return nil
+}
+
+// JobStats summarizes the outbox.
+func (t *MemoryCrossPostTracker) JobStats(ctx context.Context) (JobStats, error) {
+	if err := ctx.Err(); err != nil {
+		return JobStats{}, err
+	}
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	var stats JobStats
+	for _, job := range t.jobs {
+		switch job.State {
+		case JobStatePending:
+			stats.Pending++
+			if stats.OldestPending.IsZero() || job.CreatedAt.Before(stats.OldestPending) {
+				stats.OldestPending = job.CreatedAt
+			}
+		case JobStateFailed:
+			stats.Failed++
+		}
+	}
+	return stats, nil
+}
+
+// pruneJobs removes failed jobs created before cutoff.
+func (t *MemoryCrossPostTracker) pruneJobs(cutoff time.Time) {
+	t.jobsMu.Lock()
+	defer t.jobsMu.Unlock()
+
+	for id, job := range t.jobs {
+		if job.State == JobStateFailed && job.CreatedAt.Before(cutoff) {
+			delete(t.jobs, id)
+		}
+	}
+}
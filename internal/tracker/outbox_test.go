@@ -0,0 +1,140 @@
+package tracker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testOutbox(t *testing.T, outbox Outbox) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+
+	first, err := outbox.EnqueueJob(ctx, "note2tweet", []byte(`{"id":"1"}`), now.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("EnqueueJob() error = %v", err)
+	}
+	second, err := outbox.EnqueueJob(ctx, "tweet2note", []byte(`{"id":"2"}`), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("EnqueueJob() error = %v", err)
+	}
+
+	jobs, err := outbox.DueJobs(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != first || jobs[0].Kind != "note2tweet" || string(jobs[0].Payload) != `{"id":"1"}` || jobs[0].State != JobStatePending {
+		t.Fatalf("DueJobs() = %+v, want the first job", jobs)
+	}
+
+	if err := outbox.RescheduleJob(ctx, first, 1, "status 503", now.Add(time.Minute)); err != nil {
+		t.Fatalf("RescheduleJob() error = %v", err)
+	}
+	if jobs, err := outbox.DueJobs(ctx, now, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("DueJobs() = %+v, %v; want no job before the retry", jobs, err)
+	}
+	jobs, err = outbox.DueJobs(ctx, now.Add(2*time.Hour), 1)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != first || jobs[0].Attempts != 1 || jobs[0].LastError != "status 503" {
+		t.Fatalf("DueJobs() = %+v, want the rescheduled first job only", jobs)
+	}
+
+	if err := outbox.FailJob(ctx, second, 1, "status 403"); err != nil {
+		t.Fatalf("FailJob() error = %v", err)
+	}
+	stats, err := outbox.JobStats(ctx)
+	if err != nil {
+		t.Fatalf("JobStats() error = %v", err)
+	}
+	if stats.Pending != 1 || stats.Failed != 1 || stats.OldestPending.IsZero() {
+		t.Fatalf("JobStats() = %+v, want one pending and one failed job", stats)
+	}
+
+	if err := outbox.DeleteJob(ctx, first); err != nil {
+		t.Fatalf("DeleteJob() error = %v", err)
+	}
+	stats, err = outbox.JobStats(ctx)
+	if err != nil {
+		t.Fatalf("JobStats() error = %v", err)
+	}
+	if stats.Pending != 0 || stats.Failed != 1 || !stats.OldestPending.IsZero() {
+		t.Fatalf("JobStats() = %+v, want only the failed job", stats)
+	}
+	if jobs, err := outbox.DueJobs(ctx, now.Add(2*time.Hour), 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("DueJobs() = %+v, %v; want failed jobs to stay out of the queue", jobs, err)
+	}
+}
+
+func TestCrossPostTracker_Outbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testOutbox(t, NewCrossPostTracker(ctx, time.Hour))
+}
+
+func TestSQLiteCrossPostTracker_Outbox(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	testOutbox(t, tracker)
+}
+
+func TestSQLiteCrossPostTracker_OutboxPersistsAndPrunes(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "tracker.sqlite")
+
+	tracker, err := NewSQLiteCrossPostTracker(ctx, dbPath, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	alice := tracker.WithNamespace("alice")
+	pending, err := alice.EnqueueJob(ctx, "note2tweet", []byte("pending"), time.Now())
+	if err != nil {
+		t.Fatalf("EnqueueJob() error = %v", err)
+	}
+	failed, err := alice.EnqueueJob(ctx, "note2tweet", []byte("failed"), time.Now())
+	if err != nil {
+		t.Fatalf("EnqueueJob() error = %v", err)
+	}
+	if err := alice.FailJob(ctx, failed, 1, "status 403"); err != nil {
+		t.Fatalf("FailJob() error = %v", err)
+	}
+	if stats, err := tracker.JobStats(ctx); err != nil || stats.Pending != 0 || stats.Failed != 0 {
+		t.Fatalf("default namespace JobStats() = %+v, %v; want no jobs", stats, err)
+	}
+	if _, err := tracker.db.ExecContext(ctx, `UPDATE outbox_jobs SET created_at = ?`, time.Now().Add(-48*time.Hour).Unix()); err != nil {
+		t.Fatalf("backdate jobs: %v", err)
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tracker, err = NewSQLiteCrossPostTracker(ctx, dbPath, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() reopen error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	jobs, err := tracker.WithNamespace("alice").DueJobs(ctx, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("DueJobs() error = %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != pending {
+		t.Fatalf("DueJobs() = %+v, want the pending job to survive the restart", jobs)
+	}
+	stats, err := tracker.WithNamespace("alice").JobStats(ctx)
+	if err != nil {
+		t.Fatalf("JobStats() error = %v", err)
+	}
+	if stats.Failed != 0 {
+		t.Fatalf("JobStats() = %+v, want the old failed job to be pruned", stats)
+	}
+}
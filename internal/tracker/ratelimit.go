@@ -0,0 +1,60 @@
+package tracker
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// RateLimit is the last known state of a Twitter rate limit.
+type RateLimit struct {
+	Endpoint  string
+	Window    string
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// RateLimitStore persists Twitter rate limits, so that a restarted process
+// does not spend requests on a limit that is still exhausted.
+type RateLimitStore interface {
+	// SaveRateLimit replaces the saved state of a limit.
+	SaveRateLimit(ctx context.Context, limit RateLimit) error
+	// LoadRateLimits returns the saved limits that were not reset at now.
+	LoadRateLimits(ctx context.Context, now time.Time) ([]RateLimit, error)
+}
+
+type rateLimitKey struct {
+	endpoint string
+	window   string
+}
+
+// SaveRateLimit replaces the saved state of a limit.
+func (t *MemoryCrossPostTracker) SaveRateLimit(ctx context.Context, limit RateLimit) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.rateLimits.Store(rateLimitKey{limit.Endpoint, limit.Window}, limit)
+	return nil
+}
+
+// LoadRateLimits returns the saved limits that were not reset at now.
+func (t *MemoryCrossPostTracker) LoadRateLimits(ctx context.Context, now time.Time) ([]RateLimit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var limits []RateLimit
+	t.rateLimits.Range(func(_, value interface{}) bool {
+		if limit, ok := value.(RateLimit); ok && limit.ResetAt.After(now) {
+			limits = append(limits, limit)
+		}
+		return true
+	})
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].Endpoint != limits[j].Endpoint {
+			return limits[i].Endpoint < limits[j].Endpoint
+		}
+		return limits[i].Window < limits[j].Window
+	})
+	return limits, nil
+}
@@ -0,0 +1,77 @@
+package tracker
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRateLimits(t *testing.T, store RateLimitStore) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	limits := []RateLimit{
+		{Endpoint: "create_tweet", Window: "user_24hour", Limit: 17, Remaining: 5, ResetAt: now.Add(time.Hour)},
+		{Endpoint: "create_tweet", Window: "endpoint", Limit: 100, Remaining: 99, ResetAt: now.Add(15 * time.Minute)},
+		{Endpoint: "media_upload", Window: "endpoint", Limit: 500, Remaining: 0, ResetAt: now.Add(-time.Minute)},
+	}
+	for _, limit := range limits {
+		if err := store.SaveRateLimit(ctx, limit); err != nil {
+			t.Fatalf("SaveRateLimit() error = %v", err)
+		}
+	}
+	updated := limits[0]
+	updated.Remaining = 4
+	if err := store.SaveRateLimit(ctx, updated); err != nil {
+		t.Fatalf("SaveRateLimit() update error = %v", err)
+	}
+
+	got, err := store.LoadRateLimits(ctx, now)
+	if err != nil {
+		t.Fatalf("LoadRateLimits() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("LoadRateLimits() = %+v, want the two unexpired limits", got)
+	}
+	if got[0] != limits[1] {
+		t.Fatalf("LoadRateLimits()[0] = %+v, want %+v", got[0], limits[1])
+	}
+	if !got[1].ResetAt.Equal(updated.ResetAt) || got[1].Remaining != 4 || got[1].Window != "user_24hour" {
+		t.Fatalf("LoadRateLimits()[1] = %+v, want %+v", got[1], updated)
+	}
+}
+
+func TestCrossPostTracker_RateLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testRateLimits(t, NewCrossPostTracker(ctx, time.Hour))
+}
+
+func TestSQLiteCrossPostTracker_RateLimits(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "tracker.sqlite")
+	tracker, err := NewSQLiteCrossPostTracker(ctx, dbPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	testRateLimits(t, tracker.WithNamespace("alice"))
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tracker, err = NewSQLiteCrossPostTracker(ctx, dbPath, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() reopen error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	if limits, err := tracker.LoadRateLimits(ctx, time.Now()); err != nil || len(limits) != 0 {
+		t.Fatalf("default namespace LoadRateLimits() = %+v, %v; want none", limits, err)
+	}
+	if limits, err := tracker.WithNamespace("alice").LoadRateLimits(ctx, time.Now()); err != nil || len(limits) != 2 {
+		t.Fatalf("LoadRateLimits() after restart = %+v, %v; want the saved limits", limits, err)
+	}
+}
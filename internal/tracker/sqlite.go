@@ -17,6 +17,12 @@ import (
 type SQLiteCrossPostTracker struct {
 	db        *sql.DB
 	retention time.Duration
+	// namespace separates the records of account pairs that share the
+	// database. The empty namespace holds the records of a single-pair setup.
+	namespace string
+	// shared is set on trackers returned by WithNamespace, which do not own
+	// the database.
+	shared bool
 }
 
 // NewSQLiteCrossPostTracker creates a sqlite-backed cross-post tracker.
@@ -67,12 +73,51 @@ func (t *SQLiteCrossPostTracker) init(ctx context.Context) error {
 			created_at INTEGER NOT NULL,
 			PRIMARY KEY (misskey_note_id, tweet_id)
 		);`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_cross_posts_misskey_note_id
-			ON cross_posts (misskey_note_id);`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_cross_posts_tweet_id
-			ON cross_posts (tweet_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_cross_posts_created_at
 			ON cross_posts (created_at);`,
+		`CREATE TABLE IF NOT EXISTS cross_post_thread_tweets (
+			tweet_id TEXT NOT NULL PRIMARY KEY,
+			misskey_note_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			created_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_cross_post_thread_tweets_created_at
+			ON cross_post_thread_tweets (created_at);`,
+		`CREATE TABLE IF NOT EXISTS cursors (
+			name TEXT NOT NULL PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS outbox_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			namespace TEXT NOT NULL DEFAULT '',
+			kind TEXT NOT NULL,
+			payload BLOB NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			next_attempt_at INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_jobs_namespace_state_next_attempt_at
+			ON outbox_jobs (namespace, state, next_attempt_at);`,
+		`CREATE TABLE IF NOT EXISTS cross_post_claims (
+			namespace TEXT NOT NULL DEFAULT '',
+			direction TEXT NOT NULL,
+			source_id TEXT NOT NULL,
+			claimed_at INTEGER NOT NULL,
+			PRIMARY KEY (namespace, direction, source_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS twitter_rate_limits (
+			namespace TEXT NOT NULL DEFAULT '',
+			endpoint TEXT NOT NULL,
+			limit_window TEXT NOT NULL,
+			rate_limit INTEGER NOT NULL,
+			remaining INTEGER NOT NULL,
+			reset_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (namespace, endpoint, limit_window)
+		);`,
 	}
 
 	for _, statement := range statements {
@@ -80,6 +125,77 @@ func (t *SQLiteCrossPostTracker) init(ctx context.Context) error {
 			return fmt.Errorf("initialize tracker db: %w", err)
 		}
 	}
+	if err := t.ensureColumn(ctx, "cross_posts", "deleted_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := t.ensureColumn(ctx, "cross_posts", "incomplete", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, table := range []string{"cross_posts", "cross_post_thread_tweets"} {
+		if err := t.ensureColumn(ctx, table, "namespace", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	indexes := []string{
+		`DROP INDEX IF EXISTS idx_cross_posts_misskey_note_id;`,
+		`DROP INDEX IF EXISTS idx_cross_posts_tweet_id;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_cross_posts_namespace_misskey_note_id
+			ON cross_posts (namespace, misskey_note_id);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_cross_posts_namespace_tweet_id
+			ON cross_posts (namespace, tweet_id);`,
+	}
+	for _, statement := range indexes {
+		if _, err := t.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("initialize tracker db: %w", err)
+		}
+	}
+	return nil
+}
+
+// WithNamespace returns a tracker that shares the database with t but only
+// sees the records of namespace. Closing it does not close the database.
+func (t *SQLiteCrossPostTracker) WithNamespace(namespace string) *SQLiteCrossPostTracker {
+	return &SQLiteCrossPostTracker{
+		db:        t.db,
+		retention: t.retention,
+		namespace: namespace,
+		shared:    true,
+	}
+}
+
+// ensureColumn adds a column to databases created before it existed.
+func (t *SQLiteCrossPostTracker) ensureColumn(ctx context.Context, table, column, definition string) error {
+	rows, err := t.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect tracker db: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("inspect tracker db: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("inspect tracker db: %w", err)
+	}
+	_ = rows.Close()
+
+	if _, err := t.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("migrate tracker db: %w", err)
+	}
 	return nil
 }
 
@@ -115,6 +231,101 @@ func (t *SQLiteCrossPostTracker) RememberTweetToMisskey(ctx context.Context, twe
 	return t.remember(ctx, noteID, tweetID, DirectionTweetToMisskey)
 }
 
+// RememberMisskeyToTweetThread records a Misskey note that was cross-posted as a
+// reply thread. The first tweet becomes the note's primary record and every
+// tweet in the chain resolves back to the note.
+func (t *SQLiteCrossPostTracker) RememberMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error {
+	return t.rememberThread(ctx, noteID, tweetIDs, false)
+}
+
+// RememberIncompleteMisskeyToTweetThread records the posted part of a thread
+// that stopped partway.
+func (t *SQLiteCrossPostTracker) RememberIncompleteMisskeyToTweetThread(ctx context.Context, noteID string, tweetIDs []string) error {
+	return t.rememberThread(ctx, noteID, tweetIDs, true)
+}
+
+func (t *SQLiteCrossPostTracker) rememberThread(ctx context.Context, noteID string, tweetIDs []string, incomplete bool) error {
+	if len(tweetIDs) == 0 {
+		return nil
+	}
+	if err := t.remember(ctx, noteID, tweetIDs[0], DirectionMisskeyToTweet); err != nil {
+		return err
+	}
+	if noteID == "" {
+		return nil
+	}
+
+	const query = `
+INSERT INTO cross_post_thread_tweets (tweet_id, misskey_note_id, position, created_at, namespace)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(tweet_id) DO UPDATE SET
+	misskey_note_id = excluded.misskey_note_id,
+	namespace = excluded.namespace,
+	position = excluded.position,
+	created_at = excluded.created_at;`
+
+	now := time.Now().Unix()
+	for i, tweetID := range tweetIDs[1:] {
+		if tweetID == "" {
+			continue
+		}
+		if _, err := t.db.ExecContext(ctx, query, tweetID, noteID, i+1, now, t.namespace); err != nil {
+			return fmt.Errorf("remember cross-post thread tweet: %w", err)
+		}
+	}
+	if _, err := t.db.ExecContext(ctx, `UPDATE cross_posts SET incomplete = ? WHERE namespace = ? AND misskey_note_id = ?`, incomplete, t.namespace, noteID); err != nil {
+		return fmt.Errorf("remember cross-post thread state: %w", err)
+	}
+
+	slog.Debug("Cross-post thread recorded",
+		slog.String("misskey_note_id", noteID),
+		slog.Int("tweet_count", len(tweetIDs)),
+		slog.Bool("incomplete", incomplete))
+
+	return nil
+}
+
+// ReplaceTweetToMisskey replaces the record of oldTweetID with a record for
+// an edited tweet and the note that mirrors it.
+func (t *SQLiteCrossPostTracker) ReplaceTweetToMisskey(ctx context.Context, oldTweetID, tweetID, noteID string) error {
+	if noteID == "" || tweetID == "" {
+		slog.Warn("Skipping cross-post record with empty ID",
+			slog.String("misskey_note_id", noteID),
+			slog.String("tweet_id", tweetID),
+			slog.String("direction", DirectionTweetToMisskey))
+		return nil
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin cross-post replace: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cross_posts WHERE namespace = ? AND tweet_id = ?`, t.namespace, oldTweetID); err != nil {
+		return fmt.Errorf("delete replaced cross-post: %w", err)
+	}
+	const query = `
+INSERT INTO cross_posts (misskey_note_id, tweet_id, direction, created_at, namespace)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(misskey_note_id, tweet_id) DO UPDATE SET
+	direction = excluded.direction,
+	created_at = excluded.created_at;`
+	if _, err := tx.ExecContext(ctx, query, noteID, tweetID, DirectionTweetToMisskey, time.Now().Unix(), t.namespace); err != nil {
+		return fmt.Errorf("remember replaced cross-post: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit cross-post replace: %w", err)
+	}
+
+	slog.Debug("Cross-post replaced",
+		slog.String("old_tweet_id", oldTweetID),
+		slog.String("misskey_note_id", noteID),
+		slog.String("tweet_id", tweetID))
+
+	return nil
+}
+
 func (t *SQLiteCrossPostTracker) remember(ctx context.Context, noteID, tweetID, direction string) error {
 	if noteID == "" || tweetID == "" {
 		slog.Warn("Skipping cross-post record with empty ID",
@@ -125,13 +336,13 @@ func (t *SQLiteCrossPostTracker) remember(ctx context.Context, noteID, tweetID,
 	}
 
 	const query = `
-INSERT INTO cross_posts (misskey_note_id, tweet_id, direction, created_at)
-VALUES (?, ?, ?, ?)
+INSERT INTO cross_posts (misskey_note_id, tweet_id, direction, created_at, namespace)
+VALUES (?, ?, ?, ?, ?)
 ON CONFLICT(misskey_note_id, tweet_id) DO UPDATE SET
 	direction = excluded.direction,
 	created_at = excluded.created_at;`
 
-	if _, err := t.db.ExecContext(ctx, query, noteID, tweetID, direction, time.Now().Unix()); err != nil {
+	if _, err := t.db.ExecContext(ctx, query, noteID, tweetID, direction, time.Now().Unix(), t.namespace); err != nil {
 		return fmt.Errorf("remember cross-post: %w", err)
 	}
 
@@ -156,13 +367,18 @@ func (t *SQLiteCrossPostTracker) HasTweet(ctx context.Context, tweetID string) (
 	if tweetID == "" {
 		return false, nil
 	}
-	return t.exists(ctx, "tweet_id", tweetID)
+	ok, err := t.exists(ctx, "tweet_id", tweetID)
+	if err != nil || ok {
+		return ok, err
+	}
+	_, ok, err = t.findThreadTweet(ctx, tweetID)
+	return ok, err
 }
 
 func (t *SQLiteCrossPostTracker) exists(ctx context.Context, column, id string) (bool, error) {
-	query := fmt.Sprintf("SELECT 1 FROM cross_posts WHERE %s = ? LIMIT 1", column)
+	query := fmt.Sprintf("SELECT 1 FROM cross_posts WHERE namespace = ? AND %s = ? LIMIT 1", column)
 	var one int
-	err := t.db.QueryRowContext(ctx, query, id).Scan(&one)
+	err := t.db.QueryRowContext(ctx, query, t.namespace, id).Scan(&one)
 	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
@@ -174,12 +390,57 @@ func (t *SQLiteCrossPostTracker) exists(ctx context.Context, column, id string)
 
 // FindByMisskeyNoteID returns the record for a Misskey note ID.
 func (t *SQLiteCrossPostTracker) FindByMisskeyNoteID(ctx context.Context, noteID string) (CrossPostRecord, bool, error) {
-	return t.findBy(ctx, "misskey_note_id", noteID)
+	record, ok, err := t.findBy(ctx, "misskey_note_id", noteID)
+	if err != nil || !ok {
+		return record, ok, err
+	}
+	record.ThreadTweetIDs, err = t.threadTweetIDs(ctx, noteID)
+	if err != nil {
+		return CrossPostRecord{}, false, err
+	}
+	return record, true, nil
 }
 
-// FindByTweetID returns the record for a Twitter tweet ID.
+// FindByTweetID returns the record for a Twitter tweet ID. Tweets posted as
+// later parts of a thread resolve to the note that started the thread.
 func (t *SQLiteCrossPostTracker) FindByTweetID(ctx context.Context, tweetID string) (CrossPostRecord, bool, error) {
-	return t.findBy(ctx, "tweet_id", tweetID)
+	record, ok, err := t.findBy(ctx, "tweet_id", tweetID)
+	if err != nil || ok {
+		return record, ok, err
+	}
+	return t.findThreadTweet(ctx, tweetID)
+}
+
+func (t *SQLiteCrossPostTracker) findThreadTweet(ctx context.Context, tweetID string) (CrossPostRecord, bool, error) {
+	if tweetID == "" {
+		return CrossPostRecord{}, false, nil
+	}
+
+	const query = `
+SELECT t.misskey_note_id, t.tweet_id, t.created_at, COALESCE(p.deleted_at, 0)
+FROM cross_post_thread_tweets t
+LEFT JOIN cross_posts p ON p.namespace = t.namespace AND p.misskey_note_id = t.misskey_note_id
+WHERE t.namespace = ? AND t.tweet_id = ?
+LIMIT 1`
+
+	record := CrossPostRecord{Direction: DirectionMisskeyToTweet}
+	var createdAt, deletedAt int64
+	err := t.db.QueryRowContext(ctx, query, t.namespace, tweetID).Scan(
+		&record.MisskeyNoteID,
+		&record.TweetID,
+		&createdAt,
+		&deletedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CrossPostRecord{}, false, nil
+	}
+	if err != nil {
+		return CrossPostRecord{}, false, fmt.Errorf("find cross-post thread tweet: %w", err)
+	}
+
+	record.CreatedAt = time.Unix(createdAt, 0)
+	record.DeletedAt = unixOrZero(deletedAt)
+	return record, true, nil
 }
 
 func (t *SQLiteCrossPostTracker) findBy(ctx context.Context, column, id string) (CrossPostRecord, bool, error) {
@@ -188,18 +449,20 @@ func (t *SQLiteCrossPostTracker) findBy(ctx context.Context, column, id string)
 	}
 
 	query := fmt.Sprintf(`
-SELECT misskey_note_id, tweet_id, direction, created_at
+SELECT misskey_note_id, tweet_id, direction, created_at, deleted_at, incomplete
 FROM cross_posts
-WHERE %s = ?
+WHERE namespace = ? AND %s = ?
 LIMIT 1`, column)
 
 	var record CrossPostRecord
-	var createdAt int64
-	err := t.db.QueryRowContext(ctx, query, id).Scan(
+	var createdAt, deletedAt int64
+	err := t.db.QueryRowContext(ctx, query, t.namespace, id).Scan(
 		&record.MisskeyNoteID,
 		&record.TweetID,
 		&record.Direction,
 		&createdAt,
+		&deletedAt,
+		&record.Incomplete,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return CrossPostRecord{}, false, nil
@@ -209,17 +472,378 @@ LIMIT 1`, column)
 	}
 
 	record.CreatedAt = time.Unix(createdAt, 0)
+	record.DeletedAt = unixOrZero(deletedAt)
 	return record, true, nil
 }
 
-// Prune removes records older than the configured retention. A non-positive
-// retention keeps records indefinitely.
+// MarkDeleted marks the record of a Misskey note as deleted. Thread tweets
+// resolve through the note's record, so they are covered as well.
+func (t *SQLiteCrossPostTracker) MarkDeleted(ctx context.Context, noteID string, deletedAt time.Time) error {
+	if _, err := t.db.ExecContext(ctx, `UPDATE cross_posts SET deleted_at = ? WHERE namespace = ? AND misskey_note_id = ?`, deletedAt.Unix(), t.namespace, noteID); err != nil {
+		return fmt.Errorf("mark cross-post deleted: %w", err)
+	}
+	return nil
+}
+
+// ListActive returns the records created at or after since that are not
+// marked as deleted.
+func (t *SQLiteCrossPostTracker) ListActive(ctx context.Context, since time.Time) ([]CrossPostRecord, error) {
+	const query = `
+SELECT misskey_note_id, tweet_id, direction, created_at, incomplete
+FROM cross_posts
+WHERE namespace = ? AND deleted_at = 0 AND created_at >= ?
+ORDER BY created_at`
+
+	rows, err := t.db.QueryContext(ctx, query, t.namespace, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("list active cross-posts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []CrossPostRecord
+	for rows.Next() {
+		var record CrossPostRecord
+		var createdAt int64
+		if err := rows.Scan(&record.MisskeyNoteID, &record.TweetID, &record.Direction, &createdAt, &record.Incomplete); err != nil {
+			return nil, fmt.Errorf("list active cross-posts: %w", err)
+		}
+		record.CreatedAt = time.Unix(createdAt, 0)
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list active cross-posts: %w", err)
+	}
+	_ = rows.Close()
+
+	for i := range records {
+		threadTweetIDs, err := t.threadTweetIDs(ctx, records[i].MisskeyNoteID)
+		if err != nil {
+			return nil, err
+		}
+		records[i].ThreadTweetIDs = threadTweetIDs
+	}
+	return records, nil
+}
+
+func (t *SQLiteCrossPostTracker) threadTweetIDs(ctx context.Context, noteID string) ([]string, error) {
+	rows, err := t.db.QueryContext(ctx, `SELECT tweet_id FROM cross_post_thread_tweets WHERE namespace = ? AND misskey_note_id = ? ORDER BY position`, t.namespace, noteID)
+	if err != nil {
+		return nil, fmt.Errorf("list cross-post thread tweets: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tweetIDs []string
+	for rows.Next() {
+		var tweetID string
+		if err := rows.Scan(&tweetID); err != nil {
+			return nil, fmt.Errorf("list cross-post thread tweets: %w", err)
+		}
+		tweetIDs = append(tweetIDs, tweetID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list cross-post thread tweets: %w", err)
+	}
+	return tweetIDs, nil
+}
+
+// LoadCursor returns the value saved under name, or an empty string when no
+// value was saved.
+func (t *SQLiteCrossPostTracker) LoadCursor(ctx context.Context, name string) (string, error) {
+	var value string
+	err := t.db.QueryRowContext(ctx, `SELECT value FROM cursors WHERE name = ?`, t.cursorName(name)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("load cursor: %w", err)
+	}
+	return value, nil
+}
+
+// SaveCursor saves a source position, such as the newest tweet ID seen by the
+// timeline poller. Cursors are not pruned.
+func (t *SQLiteCrossPostTracker) SaveCursor(ctx context.Context, name, value string) error {
+	const query = `
+INSERT INTO cursors (name, value, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`
+
+	if _, err := t.db.ExecContext(ctx, query, t.cursorName(name), value, time.Now().Unix()); err != nil {
+		return fmt.Errorf("save cursor: %w", err)
+	}
+	return nil
+}
+
+func (t *SQLiteCrossPostTracker) cursorName(name string) string {
+	if t.namespace == "" {
+		return name
+	}
+	return t.namespace + ":" + name
+}
+
+// EnqueueJob adds a pending job that is due at nextAttemptAt.
+func (t *SQLiteCrossPostTracker) EnqueueJob(ctx context.Context, kind string, payload []byte, nextAttemptAt time.Time) (int64, error) {
+	const query = `
+INSERT INTO outbox_jobs (namespace, kind, payload, state, created_at, next_attempt_at)
+VALUES (?, ?, ?, ?, ?, ?)`
+
+	result, err := t.db.ExecContext(ctx, query, t.namespace, kind, payload, JobStatePending, time.Now().Unix(), nextAttemptAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("enqueue outbox job: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("enqueue outbox job: %w", err)
+	}
+	return id, nil
+}
+
+// DueJobs returns up to limit pending jobs that are due at now, oldest first.
+func (t *SQLiteCrossPostTracker) DueJobs(ctx context.Context, now time.Time, limit int) ([]Job, error) {
+	const query = `
+SELECT id, kind, payload, state, attempts, last_error, created_at, next_attempt_at
+FROM outbox_jobs
+WHERE namespace = ? AND state = ? AND next_attempt_at <= ?
+ORDER BY id
+LIMIT ?`
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := t.db.QueryContext(ctx, query, t.namespace, JobStatePending, now.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("list due outbox jobs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var createdAt, nextAttemptAt int64
+		if err := rows.Scan(&job.ID, &job.Kind, &job.Payload, &job.State, &job.Attempts, &job.LastError, &createdAt, &nextAttemptAt); err != nil {
+			return nil, fmt.Errorf("list due outbox jobs: %w", err)
+		}
+		job.CreatedAt = time.Unix(createdAt, 0)
+		job.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list due outbox jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// RescheduleJob records a failed attempt of a pending job.
+func (t *SQLiteCrossPostTracker) RescheduleJob(ctx context.Context, id int64, attempts int, lastError string, nextAttemptAt time.Time) error {
+	const query = `UPDATE outbox_jobs SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE namespace = ? AND id = ?`
+	if _, err := t.db.ExecContext(ctx, query, attempts, lastError, nextAttemptAt.Unix(), t.namespace, id); err != nil {
+		return fmt.Errorf("reschedule outbox job: %w", err)
+	}
+	return nil
+}
+
+// FailJob moves a job to the failed state.
+func (t *SQLiteCrossPostTracker) FailJob(ctx context.Context, id int64, attempts int, lastError string) error {
+	const query = `UPDATE outbox_jobs SET state = ?, attempts = ?, last_error = ? WHERE namespace = ? AND id = ?`
+	if _, err := t.db.ExecContext(ctx, query, JobStateFailed, attempts, lastError, t.namespace, id); err != nil {
+		return fmt.Errorf("fail outbox job: %w", err)
+	}
+	return nil
+}
+
+// DeleteJob removes a job from the outbox.
+func (t *SQLiteCrossPostTracker) DeleteJob(ctx context.Context, id int64) error {
+	if _, err := t.db.ExecContext(ctx, `DELETE FROM outbox_jobs WHERE namespace = ? AND id = ?`, t.namespace, id); err != nil {
+		return fmt.Errorf("delete outbox job: %w", err)
+	}
+	return nil
+}
+
+// JobStats summarizes the outbox of the tracker's namespace.
+func (t *SQLiteCrossPostTracker) JobStats(ctx context.Context) (JobStats, error) {
+	const query = `
+SELECT
+	COALESCE(SUM(state = ?), 0),
+	COALESCE(SUM(state = ?), 0),
+	COALESCE(MIN(CASE WHEN state = ? THEN created_at END), 0)
+FROM outbox_jobs
+WHERE namespace = ?`
+
+	var stats JobStats
+	var oldestPending int64
+	err := t.db.QueryRowContext(ctx, query, JobStatePending, JobStateFailed, JobStatePending, t.namespace).Scan(&stats.Pending, &stats.Failed, &oldestPending)
+	if err != nil {
+		return JobStats{}, fmt.Errorf("count outbox jobs: %w", err)
+	}
+	stats.OldestPending = unixOrZero(oldestPending)
+	return stats, nil
+}
+
+// Claim takes the claim of a source post. It returns a *ClaimedError when the
+// claim is already held.
+func (t *SQLiteCrossPostTracker) Claim(ctx context.Context, direction, sourceID string) error {
+	const query = `
+INSERT INTO cross_post_claims (namespace, direction, source_id, claimed_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(namespace, direction, source_id) DO NOTHING`
+
+	result, err := t.db.ExecContext(ctx, query, t.namespace, direction, sourceID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("claim cross-post: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("claim cross-post: %w", err)
+	}
+	if inserted == 0 {
+		return t.claimedError(ctx, direction, sourceID)
+	}
+	return nil
+}
+
+// claimedError returns the error for a claim that is already held. A claim
+// dropped since the insert was refused is reported without its time.
+func (t *SQLiteCrossPostTracker) claimedError(ctx context.Context, direction, sourceID string) error {
+	const query = `
+SELECT claimed_at
+FROM cross_post_claims
+WHERE namespace = ? AND direction = ? AND source_id = ?`
+
+	var claimedAt int64
+	err := t.db.QueryRowContext(ctx, query, t.namespace, direction, sourceID).Scan(&claimedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrClaimed
+	}
+	if err != nil {
+		return fmt.Errorf("claim cross-post: %w", err)
+	}
+	return &ClaimedError{Claim: Claim{Direction: direction, SourceID: sourceID, ClaimedAt: time.Unix(claimedAt, 0)}}
+}
+
+// CompleteClaim drops the claim of a source post whose cross-post was
+// recorded.
+func (t *SQLiteCrossPostTracker) CompleteClaim(ctx context.Context, direction, sourceID string) error {
+	return t.dropClaim(ctx, direction, sourceID)
+}
+
+// ReleaseClaim drops the claim of a source post that was not cross-posted, so
+// that another worker can take it.
+func (t *SQLiteCrossPostTracker) ReleaseClaim(ctx context.Context, direction, sourceID string) error {
+	return t.dropClaim(ctx, direction, sourceID)
+}
+
+func (t *SQLiteCrossPostTracker) dropClaim(ctx context.Context, direction, sourceID string) error {
+	const query = `DELETE FROM cross_post_claims WHERE namespace = ? AND direction = ? AND source_id = ?`
+	if _, err := t.db.ExecContext(ctx, query, t.namespace, direction, sourceID); err != nil {
+		return fmt.Errorf("drop cross-post claim: %w", err)
+	}
+	return nil
+}
+
+// ListClaims returns the held claims of the tracker's namespace, oldest
+// first.
+func (t *SQLiteCrossPostTracker) ListClaims(ctx context.Context) ([]Claim, error) {
+	const query = `
+SELECT direction, source_id, claimed_at
+FROM cross_post_claims
+WHERE namespace = ?
+ORDER BY claimed_at, source_id`
+
+	rows, err := t.db.QueryContext(ctx, query, t.namespace)
+	if err != nil {
+		return nil, fmt.Errorf("list cross-post claims: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var claims []Claim
+	for rows.Next() {
+		var claim Claim
+		var claimedAt int64
+		if err := rows.Scan(&claim.Direction, &claim.SourceID, &claimedAt); err != nil {
+			return nil, fmt.Errorf("list cross-post claims: %w", err)
+		}
+		claim.ClaimedAt = time.Unix(claimedAt, 0)
+		claims = append(claims, claim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list cross-post claims: %w", err)
+	}
+	return claims, nil
+}
+
+// SaveRateLimit replaces the saved state of a limit.
+func (t *SQLiteCrossPostTracker) SaveRateLimit(ctx context.Context, limit RateLimit) error {
+	const query = `
+INSERT INTO twitter_rate_limits (namespace, endpoint, limit_window, rate_limit, remaining, reset_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(namespace, endpoint, limit_window) DO UPDATE SET
+	rate_limit = excluded.rate_limit,
+	remaining = excluded.remaining,
+	reset_at = excluded.reset_at,
+	updated_at = excluded.updated_at`
+
+	_, err := t.db.ExecContext(ctx, query, t.namespace, limit.Endpoint, limit.Window,
+		limit.Limit, limit.Remaining, limit.ResetAt.Unix(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("save rate limit: %w", err)
+	}
+	return nil
+}
+
+// LoadRateLimits returns the saved limits of the tracker's namespace that
+// were not reset at now.
+func (t *SQLiteCrossPostTracker) LoadRateLimits(ctx context.Context, now time.Time) ([]RateLimit, error) {
+	const query = `
+SELECT endpoint, limit_window, rate_limit, remaining, reset_at
+FROM twitter_rate_limits
+WHERE namespace = ? AND reset_at > ?
+ORDER BY endpoint, limit_window`
+
+	rows, err := t.db.QueryContext(ctx, query, t.namespace, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("load rate limits: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var limits []RateLimit
+	for rows.Next() {
+		var limit RateLimit
+		var resetAt int64
+		if err := rows.Scan(&limit.Endpoint, &limit.Window, &limit.Limit, &limit.Remaining, &resetAt); err != nil {
+			return nil, fmt.Errorf("load rate limits: %w", err)
+		}
+		limit.ResetAt = time.Unix(resetAt, 0)
+		limits = append(limits, limit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load rate limits: %w", err)
+	}
+	return limits, nil
+}
+
+func unixOrZero(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Prune removes records and failed outbox jobs older than the configured
+// retention from every namespace. A non-positive retention keeps records
+// indefinitely.
 func (t *SQLiteCrossPostTracker) Prune(ctx context.Context, now time.Time) (int64, error) {
 	if t.retention <= 0 {
 		return 0, nil
 	}
 
-	result, err := t.db.ExecContext(ctx, `DELETE FROM cross_posts WHERE created_at < ?`, now.Add(-t.retention).Unix())
+	cutoff := now.Add(-t.retention).Unix()
+	if _, err := t.db.ExecContext(ctx, `DELETE FROM outbox_jobs WHERE state = ? AND created_at < ?`, JobStateFailed, cutoff); err != nil {
+		return 0, fmt.Errorf("prune failed outbox jobs: %w", err)
+	}
+	if _, err := t.db.ExecContext(ctx, `DELETE FROM cross_post_thread_tweets WHERE created_at < ?`, cutoff); err != nil {
+		return 0, fmt.Errorf("prune cross-post thread tweets: %w", err)
+	}
+	result, err := t.db.ExecContext(ctx, `DELETE FROM cross_posts WHERE created_at < ?`, cutoff)
 	if err != nil {
 		return 0, fmt.Errorf("prune cross-post tracker: %w", err)
 	}
@@ -231,10 +855,10 @@ func (t *SQLiteCrossPostTracker) Prune(ctx context.Context, now time.Time) (int6
 	return deleted, nil
 }
 
-// Count returns the number of records in the tracker.
+// Count returns the number of records in the tracker's namespace.
 func (t *SQLiteCrossPostTracker) Count(ctx context.Context) (int64, error) {
 	var count int64
-	if err := t.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cross_posts`).Scan(&count); err != nil {
+	if err := t.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cross_posts WHERE namespace = ?`, t.namespace).Scan(&count); err != nil {
 		return 0, fmt.Errorf("count cross-post records: %w", err)
 	}
 	return count, nil
@@ -242,5 +866,8 @@ func (t *SQLiteCrossPostTracker) Count(ctx context.Context) (int64, error) {
 
 // Close releases tracker resources.
 func (t *SQLiteCrossPostTracker) Close() error {
+	if t.shared {
+		return nil
+	}
 	return t.db.Close()
 }
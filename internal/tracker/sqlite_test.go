@@ -2,8 +2,10 @@ package tracker
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -115,6 +117,235 @@ func TestSQLiteCrossPostTracker_RejectsConflictingIDs(t *testing.T) {
 	}
 }
 
+func TestSQLiteCrossPostTracker_ReplaceTweetToMisskey(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	if err := tracker.RememberTweetToMisskey(ctx, "tweet-1", "note-1"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() error = %v", err)
+	}
+	if err := tracker.ReplaceTweetToMisskey(ctx, "tweet-1", "tweet-2", "note-2"); err != nil {
+		t.Fatalf("ReplaceTweetToMisskey() error = %v", err)
+	}
+
+	if ok, err := tracker.HasTweet(ctx, "tweet-1"); err != nil || ok {
+		t.Fatalf("HasTweet(tweet-1) = %v, %v; want false, nil", ok, err)
+	}
+	record, ok, err := tracker.FindByTweetID(ctx, "tweet-2")
+	if err != nil || !ok || record.MisskeyNoteID != "note-2" || record.Direction != DirectionTweetToMisskey {
+		t.Fatalf("FindByTweetID(tweet-2) = %#v, %v, %v; want note-2 tweet_to_misskey", record, ok, err)
+	}
+	if count, err := tracker.Count(ctx); err != nil || count != 1 {
+		t.Fatalf("Count() = %d, %v; want 1", count, err)
+	}
+}
+
+func TestSQLiteCrossPostTracker_RemembersThreadTweets(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	if err := tracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	if ok, err := tracker.HasTweet(ctx, "tweet-2"); err != nil || !ok {
+		t.Fatalf("HasTweet(tweet-2) = %v, %v; want true, nil", ok, err)
+	}
+	record, ok, err := tracker.FindByTweetID(ctx, "tweet-2")
+	if err != nil || !ok {
+		t.Fatalf("FindByTweetID(tweet-2) = %v, %v; want record", ok, err)
+	}
+	if record.MisskeyNoteID != "note-1" || record.Direction != DirectionMisskeyToTweet {
+		t.Fatalf("record = %#v, want note-1 misskey_to_tweet", record)
+	}
+	record, ok, err = tracker.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok || record.TweetID != "tweet-1" {
+		t.Fatalf("FindByMisskeyNoteID(note-1) = %#v, %v, %v; want tweet-1", record, ok, err)
+	}
+
+	if _, err := tracker.Prune(ctx, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if ok, err := tracker.HasTweet(ctx, "tweet-2"); err != nil || ok {
+		t.Fatal("expired thread tweet should be removed")
+	}
+}
+
+func TestSQLiteCrossPostTracker_MarkDeleted(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracker.sqlite")
+	tracker, err := NewSQLiteCrossPostTracker(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+
+	if err := tracker.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-1", "tweet-2", "tweet-3"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	if err := tracker.RememberTweetToMisskey(ctx, "tweet-4", "note-4"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() error = %v", err)
+	}
+
+	active, err := tracker.ListActive(ctx, time.Now().Add(-time.Minute))
+	if err != nil || len(active) != 2 {
+		t.Fatalf("ListActive() = %#v, %v; want 2 records", active, err)
+	}
+	for _, record := range active {
+		if record.MisskeyNoteID == "note-1" && !reflect.DeepEqual(record.ThreadTweetIDs, []string{"tweet-2", "tweet-3"}) {
+			t.Fatalf("ThreadTweetIDs = %v, want [tweet-2 tweet-3]", record.ThreadTweetIDs)
+		}
+	}
+
+	if err := tracker.MarkDeleted(ctx, "note-1", time.Now()); err != nil {
+		t.Fatalf("MarkDeleted() error = %v", err)
+	}
+	closeTracker(t, tracker)
+
+	reopened, err := NewSQLiteCrossPostTracker(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() reopen error = %v", err)
+	}
+	defer closeTracker(t, reopened)
+
+	record, ok, err := reopened.FindByTweetID(ctx, "tweet-3")
+	if err != nil || !ok || record.DeletedAt.IsZero() {
+		t.Fatalf("FindByTweetID(tweet-3) = %#v, %v, %v; want deleted record", record, ok, err)
+	}
+	active, err = reopened.ListActive(ctx, time.Now().Add(-time.Minute))
+	if err != nil || len(active) != 1 || active[0].MisskeyNoteID != "note-4" {
+		t.Fatalf("ListActive() = %#v, %v; want note-4 only", active, err)
+	}
+}
+
+func TestSQLiteCrossPostTracker_PersistsCursor(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracker.sqlite")
+	tracker, err := NewSQLiteCrossPostTracker(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+
+	if value, err := tracker.LoadCursor(ctx, "cursor-1"); err != nil || value != "" {
+		t.Fatalf("LoadCursor() = %q, %v; want empty", value, err)
+	}
+	for _, value := range []string{"100", "200"} {
+		if err := tracker.SaveCursor(ctx, "cursor-1", value); err != nil {
+			t.Fatalf("SaveCursor() error = %v", err)
+		}
+	}
+	closeTracker(t, tracker)
+
+	reopened, err := NewSQLiteCrossPostTracker(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() reopen error = %v", err)
+	}
+	defer closeTracker(t, reopened)
+
+	if value, err := reopened.LoadCursor(ctx, "cursor-1"); err != nil || value != "200" {
+		t.Fatalf("LoadCursor() = %q, %v; want 200", value, err)
+	}
+}
+
+func TestSQLiteCrossPostTracker_Namespaces(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	brandA := tracker.WithNamespace("brand-a")
+	brandB := tracker.WithNamespace("brand-b")
+	if err := brandA.RememberMisskeyToTweetThread(ctx, "note-1", []string{"tweet-a1", "tweet-a2"}); err != nil {
+		t.Fatalf("RememberMisskeyToTweetThread() error = %v", err)
+	}
+	if err := brandB.RememberTweetToMisskey(ctx, "tweet-b1", "note-1"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() same note ID in another namespace error = %v", err)
+	}
+	if err := brandA.SaveCursor(ctx, "cursor-1", "100"); err != nil {
+		t.Fatalf("SaveCursor() error = %v", err)
+	}
+
+	record, ok, err := brandB.FindByMisskeyNoteID(ctx, "note-1")
+	if err != nil || !ok || record.TweetID != "tweet-b1" {
+		t.Fatalf("FindByMisskeyNoteID() = %#v, %v, %v; want brand-b record", record, ok, err)
+	}
+	for _, view := range []*SQLiteCrossPostTracker{tracker, brandB} {
+		if ok, err := view.HasTweet(ctx, "tweet-a2"); err != nil || ok {
+			t.Fatalf("HasTweet(tweet-a2) in %q = %v, %v; want false", view.namespace, ok, err)
+		}
+		if value, err := view.LoadCursor(ctx, "cursor-1"); err != nil || value != "" {
+			t.Fatalf("LoadCursor() in %q = %q, %v; want empty", view.namespace, value, err)
+		}
+	}
+	if err := brandB.MarkDeleted(ctx, "note-1", time.Now()); err != nil {
+		t.Fatalf("MarkDeleted() error = %v", err)
+	}
+	if active, err := brandA.ListActive(ctx, time.Now().Add(-time.Minute)); err != nil || len(active) != 1 {
+		t.Fatalf("ListActive() = %#v, %v; want brand-a record untouched", active, err)
+	}
+	if count, err := tracker.Count(ctx); err != nil || count != 0 {
+		t.Fatalf("Count() = %d, %v; want 0 in the default namespace", count, err)
+	}
+
+	if err := brandA.Close(); err != nil {
+		t.Fatalf("Close() namespace error = %v", err)
+	}
+	if count, err := brandB.Count(ctx); err != nil || count != 1 {
+		t.Fatalf("Count() after closing another namespace = %d, %v; want 1", count, err)
+	}
+}
+
+func TestSQLiteCrossPostTracker_MigratesExistingDB(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracker.sqlite")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	for _, statement := range []string{
+		`CREATE TABLE cross_posts (
+			misskey_note_id TEXT NOT NULL,
+			tweet_id TEXT NOT NULL,
+			direction TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (misskey_note_id, tweet_id)
+		);`,
+		`CREATE UNIQUE INDEX idx_cross_posts_misskey_note_id ON cross_posts (misskey_note_id);`,
+		`CREATE UNIQUE INDEX idx_cross_posts_tweet_id ON cross_posts (tweet_id);`,
+		fmt.Sprintf(`INSERT INTO cross_posts VALUES ('note-1', 'tweet-1', '%s', %d);`, DirectionMisskeyToTweet, time.Now().Unix()),
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("create old schema: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tracker, err := NewSQLiteCrossPostTracker(ctx, path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	record, ok, err := tracker.FindByTweetID(ctx, "tweet-1")
+	if err != nil || !ok || record.MisskeyNoteID != "note-1" || !record.DeletedAt.IsZero() {
+		t.Fatalf("FindByTweetID() = %#v, %v, %v; want migrated record", record, ok, err)
+	}
+	if err := tracker.WithNamespace("brand-a").RememberTweetToMisskey(ctx, "tweet-2", "note-1"); err != nil {
+		t.Fatalf("RememberTweetToMisskey() in new namespace error = %v", err)
+	}
+}
+
 func TestSQLiteCrossPostTracker_ConcurrentAccess(t *testing.T) {
 	ctx := context.Background()
 	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), 90*24*time.Hour)
@@ -157,3 +388,14 @@ func closeTracker(t *testing.T, tracker *SQLiteCrossPostTracker) {
 		t.Errorf("Close() error = %v", err)
 	}
 }
+
+func TestSQLiteCrossPostTracker_IncompleteThread(t *testing.T) {
+	ctx := context.Background()
+	tracker, err := NewSQLiteCrossPostTracker(ctx, filepath.Join(t.TempDir(), "tracker.sqlite"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewSQLiteCrossPostTracker() error = %v", err)
+	}
+	defer closeTracker(t, tracker)
+
+	testIncompleteThread(t, tracker)
+}
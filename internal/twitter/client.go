@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -23,8 +24,9 @@ const (
 )
 
 var (
-	ManageTweetEndpoint = "https://api.twitter.com/2/tweets"
-	UploadMediaEndpoint = "https://api.x.com/2/media/upload"
+	ManageTweetEndpoint   = "https://api.twitter.com/2/tweets"
+	UploadMediaEndpoint   = "https://api.x.com/2/media/upload"
+	MediaMetadataEndpoint = "https://api.x.com/2/media/metadata"
 )
 
 // httpClient is a reusable HTTP client with timeout
@@ -51,9 +53,32 @@ type ProcessingInfo struct {
 }
 
 type PostOptions struct {
-	Text         string
-	MediaURLs    []string
-	QuoteTweetID string
+	Text             string
+	MediaURLs        []string
+	MediaAltTexts    []string
+	MediaSensitive   []bool
+	QuoteTweetID     string
+	InReplyToTweetID string
+	Poll             *Poll
+	// OnMediaSkipped, when set, is called for a media file that turns out to
+	// exceed the upload limits after it is downloaded. The file is dropped
+	// and the tweet is posted without it. Without it the post fails.
+	OnMediaSkipped func(mediaURL string, err error)
+}
+
+// Poll limits for tweets created through the v2 API.
+const (
+	MinPollOptions         = 2
+	MaxPollOptions         = 4
+	MaxPollOptionLength    = 25
+	MinPollDurationMinutes = 5
+	MaxPollDurationMinutes = 7 * 24 * 60
+)
+
+// Poll is a single-choice poll attached to a tweet.
+type Poll struct {
+	Options         []string
+	DurationMinutes int
 }
 
 type APIError struct {
@@ -103,6 +128,9 @@ type Config struct {
 	TokenStorePath    string
 	BearerTokenSource BearerTokenSource
 	MisskeyMediaHost  string
+	// Budget tracks the rate limits of the user. Posts are refused with a
+	// *RateLimitError while a limit is exhausted. Nil tracks nothing.
+	Budget *Budget
 }
 
 // validateMediaURL validates that the media URL is from an allowed host
@@ -179,37 +207,78 @@ func PostWithOptionsConfig(ctx context.Context, cfg Config, options PostOptions)
 		limit = 4
 	}
 
+	tokenSource, err := cfg.bearerTokenSource()
+	if err != nil {
+		return "", err
+	}
+
+	// Check the budget before uploading media for a tweet that cannot be
+	// posted.
+	if err := cfg.Budget.check(EndpointCreateTweet); err != nil {
+		return "", err
+	}
+	if limit > 0 {
+		if err := cfg.Budget.check(EndpointMediaUpload); err != nil {
+			return "", err
+		}
+	}
+
 	var mediaIDs []string
 	for i := 0; i < limit; i++ {
 		mediaID, err := uploadMediaFromURL(ctx, cfg, options.MediaURLs[i])
+		if err != nil && options.OnMediaSkipped != nil && errors.Is(err, ErrMediaLimit) {
+			options.OnMediaSkipped(options.MediaURLs[i], err)
+			continue
+		}
 		if err != nil {
 			return "", err
 		}
+		var altText string
+		if i < len(options.MediaAltTexts) {
+			altText = options.MediaAltTexts[i]
+		}
+		sensitive := i < len(options.MediaSensitive) && options.MediaSensitive[i]
+		if altText != "" || sensitive {
+			if err := createMediaMetadata(ctx, tokenSource, cfg.Budget, mediaID, altText, sensitive); err != nil {
+				return "", err
+			}
+		}
 		mediaIDs = append(mediaIDs, mediaID)
 	}
 
-	tokenSource, err := cfg.bearerTokenSource()
-	if err != nil {
-		return "", err
-	}
-	return postTweet(ctx, tokenSource, options.Text, mediaIDs, options.QuoteTweetID)
+	return postTweet(ctx, tokenSource, cfg.Budget, options, mediaIDs)
 }
 
-func tweetBody(text string, mediaIDs []string, quoteTweetID string) map[string]interface{} {
-	tweetBodyMap := map[string]interface{}{"text": text}
+func tweetBody(options PostOptions, mediaIDs []string) map[string]interface{} {
+	tweetBodyMap := map[string]interface{}{"text": options.Text}
 	if len(mediaIDs) > 0 {
 		tweetBodyMap["media"] = map[string]interface{}{
 			"media_ids": mediaIDs,
 		}
 	}
-	if quoteTweetID != "" {
-		tweetBodyMap["quote_tweet_id"] = quoteTweetID
+	if options.QuoteTweetID != "" {
+		tweetBodyMap["quote_tweet_id"] = options.QuoteTweetID
+	}
+	if options.InReplyToTweetID != "" {
+		tweetBodyMap["reply"] = map[string]interface{}{
+			"in_reply_to_tweet_id": options.InReplyToTweetID,
+		}
+	}
+	if options.Poll != nil {
+		tweetBodyMap["poll"] = map[string]interface{}{
+			"options":          options.Poll.Options,
+			"duration_minutes": options.Poll.DurationMinutes,
+		}
 	}
 	return tweetBodyMap
 }
 
-func postTweet(ctx context.Context, tokenSource BearerTokenSource, text string, mediaIDs []string, quoteTweetID string) (string, error) {
-	tweetBodyMap := tweetBody(text, mediaIDs, quoteTweetID)
+func postTweet(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, options PostOptions, mediaIDs []string) (string, error) {
+	if err := budget.check(EndpointCreateTweet); err != nil {
+		return "", err
+	}
+
+	tweetBodyMap := tweetBody(options, mediaIDs)
 	tweetBody, err := json.Marshal(tweetBodyMap)
 	if err != nil {
 		slog.Error("Error marshaling tweet data", slog.Any("error", err))
@@ -218,6 +287,7 @@ func postTweet(ctx context.Context, tokenSource BearerTokenSource, text string,
 
 	var respBytes []byte
 	var statusCode int
+	var header http.Header
 	for attempt := 0; attempt < 2; attempt++ {
 		bearerToken, err := tokenSource.BearerToken(ctx)
 		if err != nil {
@@ -244,6 +314,8 @@ func postTweet(ctx context.Context, tokenSource BearerTokenSource, text string,
 		}
 
 		statusCode = resp.StatusCode
+		header = resp.Header
+		budget.observe(EndpointCreateTweet, header)
 		if statusCode == http.StatusUnauthorized && attempt == 0 {
 			refresher, ok := tokenSource.(ForceRefreshBearerTokenSource)
 			if ok {
@@ -257,12 +329,16 @@ func postTweet(ctx context.Context, tokenSource BearerTokenSource, text string,
 	}
 
 	if statusCode != http.StatusOK && statusCode != http.StatusCreated {
-		slog.Error("Non-OK response from Twitter", slog.Int("status", statusCode))
-		return "", &APIError{
+		err := &APIError{
 			Operation:   "POST request",
 			StatusCode:  statusCode,
 			BodyPreview: previewBody(respBytes),
 		}
+		if statusCode == http.StatusTooManyRequests {
+			return "", rateLimited(EndpointCreateTweet, header, err)
+		}
+		slog.Error("Non-OK response from Twitter", slog.Int("status", statusCode))
+		return "", err
 	}
 
 	var postResp struct {
@@ -277,7 +353,7 @@ func postTweet(ctx context.Context, tokenSource BearerTokenSource, text string,
 		return "", fmt.Errorf("twitter post response did not include tweet id")
 	}
 
-	escapedText := strings.ReplaceAll(text, "\n", "\\n")
+	escapedText := strings.ReplaceAll(options.Text, "\n", "\\n")
 	slog.Info("Successfully posted note to tweet",
 		slog.String("tweet_id", postResp.Data.ID),
 		slog.String("text_preview", escapedText[:min(100, len(escapedText))]),
@@ -311,14 +387,6 @@ func uploadMediaFromURL(ctx context.Context, cfg Config, fileURL string) (string
 		}
 	}
 
-	mediaBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	if len(mediaBytes) == 0 {
-		return "", fmt.Errorf("media body is empty")
-	}
-
 	mediaType := resp.Header.Get("Content-Type")
 	mediaType = strings.Split(mediaType, ";")[0]
 	if mediaType == "" {
@@ -328,6 +396,27 @@ func uploadMediaFromURL(ctx context.Context, cfg Config, fileURL string) (string
 	if err != nil {
 		return "", err
 	}
+	if err := CheckMediaSize(mediaType, resp.ContentLength); err != nil {
+		return "", err
+	}
+
+	body := io.Reader(resp.Body)
+	if limit := mediaSizeLimit(mediaType); limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	mediaBytes, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if len(mediaBytes) == 0 {
+		return "", fmt.Errorf("media body is empty")
+	}
+	if err := CheckMediaSize(mediaType, int64(len(mediaBytes))); err != nil {
+		return "", err
+	}
+	if err := checkVideoDuration(mediaType, mediaBytes); err != nil {
+		return "", err
+	}
 
 	tokenSource, err := cfg.bearerTokenSource()
 	if err != nil {
@@ -335,10 +424,10 @@ func uploadMediaFromURL(ctx context.Context, cfg Config, fileURL string) (string
 	}
 
 	if shouldUseSimpleMediaUpload(mediaType, len(mediaBytes)) {
-		return simpleMediaUpload(ctx, tokenSource, mediaType, mediaCategory, mediaBytes)
+		return simpleMediaUpload(ctx, tokenSource, cfg.Budget, mediaType, mediaCategory, mediaBytes)
 	}
 
-	mediaID, err := initMediaUpload(ctx, tokenSource, mediaType, mediaCategory, len(mediaBytes))
+	mediaID, err := initMediaUpload(ctx, tokenSource, cfg.Budget, mediaType, mediaCategory, len(mediaBytes))
 	if err != nil {
 		return "", err
 	}
@@ -348,12 +437,12 @@ func uploadMediaFromURL(ctx context.Context, cfg Config, fileURL string) (string
 		if end > len(mediaBytes) {
 			end = len(mediaBytes)
 		}
-		if err := appendMediaUpload(ctx, tokenSource, mediaID, segmentIndex, mediaBytes[offset:end]); err != nil {
+		if err := appendMediaUpload(ctx, tokenSource, cfg.Budget, mediaID, segmentIndex, mediaBytes[offset:end]); err != nil {
 			return "", err
 		}
 	}
 
-	if err := finalizeMediaUpload(ctx, tokenSource, mediaID); err != nil {
+	if err := finalizeMediaUpload(ctx, tokenSource, cfg.Budget, mediaID); err != nil {
 		return "", err
 	}
 
@@ -366,7 +455,7 @@ func shouldUseSimpleMediaUpload(mediaType string, totalBytes int) bool {
 		totalBytes <= maxSimpleImageUploadBytes
 }
 
-func simpleMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaType, mediaCategory string, mediaBytes []byte) (string, error) {
+func simpleMediaUpload(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, mediaType, mediaCategory string, mediaBytes []byte) (string, error) {
 	body := map[string]interface{}{
 		"media":          base64.StdEncoding.EncodeToString(mediaBytes),
 		"media_type":     mediaType,
@@ -374,7 +463,7 @@ func simpleMediaUpload(ctx context.Context, tokenSource BearerTokenSource, media
 	}
 
 	var uploadResponse UploadMediaResponse
-	if err := postMediaJSON(ctx, tokenSource, body, &uploadResponse); err != nil {
+	if err := postMediaJSON(ctx, tokenSource, budget, UploadMediaEndpoint, "", body, &uploadResponse); err != nil {
 		return "", err
 	}
 	if uploadResponse.Data.ID == "" {
@@ -383,7 +472,36 @@ func simpleMediaUpload(ctx context.Context, tokenSource BearerTokenSource, media
 	return uploadResponse.Data.ID, nil
 }
 
-func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, body map[string]interface{}, responseBody interface{}) error {
+// createMediaMetadata sets the alt text and the sensitive media warning of an
+// uploaded media file.
+func createMediaMetadata(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, mediaID, altText string, sensitive bool) error {
+	metadata := map[string]interface{}{}
+	if altText != "" {
+		if runes := []rune(altText); len(runes) > MaxAltTextLength {
+			altText = string(runes[:MaxAltTextLength])
+		}
+		metadata["alt_text"] = map[string]interface{}{"text": altText}
+	}
+	if sensitive {
+		// Misskey has no warning categories, so every flagged file is "other".
+		metadata["sensitive_media_warning"] = []string{"other"}
+	}
+	body := map[string]interface{}{
+		"id":       mediaID,
+		"metadata": metadata,
+	}
+	return postMediaJSON(ctx, tokenSource, budget, MediaMetadataEndpoint, "metadata", body, nil)
+}
+
+func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, endpoint, command string, body map[string]interface{}, responseBody interface{}) error {
+	limitEndpoint := EndpointMediaUpload
+	if endpoint == MediaMetadataEndpoint {
+		limitEndpoint = EndpointMediaMetadata
+	}
+	if err := budget.check(limitEndpoint); err != nil {
+		return err
+	}
+
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
 		return err
@@ -396,7 +514,7 @@ func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, body map[
 			return err
 		}
 
-		uploadReq, err := http.NewRequestWithContext(ctx, http.MethodPost, UploadMediaEndpoint, bytes.NewReader(bodyBytes))
+		uploadReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(bodyBytes))
 		if err != nil {
 			return err
 		}
@@ -412,6 +530,7 @@ func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, body map[
 		if err != nil {
 			return err
 		}
+		budget.observe(limitEndpoint, uploadResp.Header)
 
 		if uploadResp.StatusCode == http.StatusUnauthorized && attempt == 0 {
 			refresher, ok := tokenSource.(ForceRefreshBearerTokenSource)
@@ -423,7 +542,7 @@ func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, body map[
 			}
 		}
 		if uploadResp.StatusCode < http.StatusOK || uploadResp.StatusCode >= http.StatusMultipleChoices {
-			return mediaUploadRequestError("", uploadResp.StatusCode, respBytes)
+			return mediaUploadRequestError(limitEndpoint, command, uploadResp.StatusCode, uploadResp.Header, respBytes)
 		}
 		break
 	}
@@ -437,7 +556,7 @@ func postMediaJSON(ctx context.Context, tokenSource BearerTokenSource, body map[
 	return nil
 }
 
-func initMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaType, mediaCategory string, totalBytes int) (string, error) {
+func initMediaUpload(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, mediaType, mediaCategory string, totalBytes int) (string, error) {
 	fields := map[string]string{
 		"command":        "INIT",
 		"media_type":     mediaType,
@@ -446,7 +565,7 @@ func initMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaTy
 	}
 
 	var uploadResponse UploadMediaResponse
-	if err := postMediaForm(ctx, tokenSource, fields, "", nil, &uploadResponse); err != nil {
+	if err := postMediaForm(ctx, tokenSource, budget, fields, "", nil, &uploadResponse); err != nil {
 		return "", err
 	}
 	if uploadResponse.Data.ID == "" {
@@ -455,23 +574,23 @@ func initMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaTy
 	return uploadResponse.Data.ID, nil
 }
 
-func appendMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaID string, segmentIndex int, mediaBytes []byte) error {
+func appendMediaUpload(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, mediaID string, segmentIndex int, mediaBytes []byte) error {
 	fields := map[string]string{
 		"command":       "APPEND",
 		"media_id":      mediaID,
 		"segment_index": fmt.Sprintf("%d", segmentIndex),
 	}
-	return postMediaForm(ctx, tokenSource, fields, "media", mediaBytes, nil)
+	return postMediaForm(ctx, tokenSource, budget, fields, "media", mediaBytes, nil)
 }
 
-func finalizeMediaUpload(ctx context.Context, tokenSource BearerTokenSource, mediaID string) error {
+func finalizeMediaUpload(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, mediaID string) error {
 	fields := map[string]string{
 		"command":  "FINALIZE",
 		"media_id": mediaID,
 	}
 
 	var uploadResponse UploadMediaResponse
-	if err := postMediaForm(ctx, tokenSource, fields, "", nil, &uploadResponse); err != nil {
+	if err := postMediaForm(ctx, tokenSource, budget, fields, "", nil, &uploadResponse); err != nil {
 		return err
 	}
 	if uploadResponse.Data.ProcessingInfo == nil {
@@ -486,7 +605,12 @@ func waitForMediaProcessing(ctx context.Context, tokenSource BearerTokenSource,
 		case "succeeded":
 			return nil
 		case "failed":
-			return fmt.Errorf("media processing failed: %s", processingInfo.Error.Message)
+			return &APIError{
+				Operation:   "media upload",
+				Command:     "STATUS",
+				BodyPreview: processingInfo.Error.Message,
+				Err:         fmt.Errorf("media processing failed: %s", processingInfo.Error.Message),
+			}
 		}
 
 		wait := time.Duration(processingInfo.CheckAfterSecs) * time.Second
@@ -523,7 +647,7 @@ func waitForMediaProcessing(ctx context.Context, tokenSource BearerTokenSource,
 			break
 		}
 		if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
-			return fmt.Errorf("media STATUS failed with status %d: %s", statusCode, string(respBytes))
+			return mediaUploadRequestError(EndpointMediaUpload, "STATUS", statusCode, nil, respBytes)
 		}
 
 		var uploadResponse UploadMediaResponse
@@ -536,7 +660,11 @@ func waitForMediaProcessing(ctx context.Context, tokenSource BearerTokenSource,
 		processingInfo = uploadResponse.Data.ProcessingInfo
 	}
 
-	return fmt.Errorf("media processing did not complete after %d polls", maxMediaStatusPolls)
+	return &APIError{
+		Operation: "media upload",
+		Command:   "STATUS",
+		Err:       fmt.Errorf("media is still processing after %d status checks", maxMediaStatusPolls),
+	}
 }
 
 func getMediaUploadStatus(ctx context.Context, tokenSource BearerTokenSource, mediaID string) (int, []byte, error) {
@@ -563,7 +691,11 @@ func getMediaUploadStatus(ctx context.Context, tokenSource BearerTokenSource, me
 	return resp.StatusCode, respBytes, nil
 }
 
-func postMediaForm(ctx context.Context, tokenSource BearerTokenSource, fields map[string]string, fileField string, fileBytes []byte, responseBody interface{}) error {
+func postMediaForm(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, fields map[string]string, fileField string, fileBytes []byte, responseBody interface{}) error {
+	if err := budget.check(EndpointMediaUpload); err != nil {
+		return err
+	}
+
 	bodyBuffer := &bytes.Buffer{}
 	writer := multipart.NewWriter(bodyBuffer)
 
@@ -613,6 +745,7 @@ func postMediaForm(ctx context.Context, tokenSource BearerTokenSource, fields ma
 		if err != nil {
 			return err
 		}
+		budget.observe(EndpointMediaUpload, uploadResp.Header)
 
 		if uploadResp.StatusCode == http.StatusUnauthorized && attempt == 0 {
 			refresher, ok := tokenSource.(ForceRefreshBearerTokenSource)
@@ -624,7 +757,7 @@ func postMediaForm(ctx context.Context, tokenSource BearerTokenSource, fields ma
 			}
 		}
 		if uploadResp.StatusCode < http.StatusOK || uploadResp.StatusCode >= http.StatusMultipleChoices {
-			return mediaUploadRequestError(fields["command"], uploadResp.StatusCode, respBytes)
+			return mediaUploadRequestError(EndpointMediaUpload, fields["command"], uploadResp.StatusCode, uploadResp.Header, respBytes)
 		}
 		break
 	}
@@ -638,11 +771,19 @@ func postMediaForm(ctx context.Context, tokenSource BearerTokenSource, fields ma
 	return nil
 }
 
-func mediaUploadRequestError(command string, statusCode int, respBytes []byte) error {
+func mediaUploadRequestError(endpoint, command string, statusCode int, header http.Header, respBytes []byte) error {
 	detail := previewBody(respBytes)
 	if command == "" {
 		command = "request"
 	}
+	if statusCode == http.StatusTooManyRequests {
+		return rateLimited(endpoint, header, &APIError{
+			Operation:   "media upload",
+			Command:     command,
+			StatusCode:  statusCode,
+			BodyPreview: detail,
+		})
+	}
 	if statusCode == http.StatusForbidden {
 		return &APIError{
 			Operation:   "media upload",
@@ -689,6 +830,8 @@ func mediaTypeFromURL(fileURL string) string {
 		return "image/webp"
 	case ".mp4":
 		return "video/mp4"
+	case ".mov":
+		return "video/quicktime"
 	default:
 		return ""
 	}
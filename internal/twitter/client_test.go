@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,7 +14,7 @@ import (
 )
 
 func TestTweetBodyIncludesQuoteTweetID(t *testing.T) {
-	got := tweetBody("hello", []string{"media-1"}, "tweet-quote")
+	got := tweetBody(PostOptions{Text: "hello", QuoteTweetID: "tweet-quote"}, []string{"media-1"})
 	want := map[string]interface{}{
 		"text": "hello",
 		"media": map[string]interface{}{
@@ -26,6 +27,33 @@ func TestTweetBodyIncludesQuoteTweetID(t *testing.T) {
 	}
 }
 
+func TestTweetBodyIncludesReplyTarget(t *testing.T) {
+	got := tweetBody(PostOptions{Text: "part 2", InReplyToTweetID: "tweet-1"}, nil)
+	want := map[string]interface{}{
+		"text": "part 2",
+		"reply": map[string]interface{}{
+			"in_reply_to_tweet_id": "tweet-1",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tweetBody() = %#v, want %#v", got, want)
+	}
+}
+
+func TestTweetBodyIncludesPoll(t *testing.T) {
+	got := tweetBody(PostOptions{Text: "which?", Poll: &Poll{Options: []string{"a", "b"}, DurationMinutes: 60}}, nil)
+	want := map[string]interface{}{
+		"text": "which?",
+		"poll": map[string]interface{}{
+			"options":          []string{"a", "b"},
+			"duration_minutes": 60,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tweetBody() = %#v, want %#v", got, want)
+	}
+}
+
 func TestPostWithOptionsConfigUsesOAuth2BearerToken(t *testing.T) {
 	ctx := context.Background()
 	var sawRequest bool
@@ -255,8 +283,70 @@ func TestUploadMediaFromURLUsesSimpleUploadForImage(t *testing.T) {
 	}
 }
 
+func TestPostWithOptionsConfigSkipsMediaOverLimits(t *testing.T) {
+	ctx := context.Background()
+	var body map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/long.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			_, _ = w.Write(testMP4(1000, 141000))
+		case "/2/tweets":
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"data":{"id":"tweet-1"}}`))
+		default:
+			t.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	oldEndpoint := ManageTweetEndpoint
+	ManageTweetEndpoint = server.URL + "/2/tweets"
+	defer func() { ManageTweetEndpoint = oldEndpoint }()
+
+	mediaURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var skipped []string
+	tweetID, err := PostWithOptionsConfig(ctx, Config{
+		BearerTokenSource: StaticBearerTokenSource{Token: "token-1"},
+		MisskeyMediaHost:  mediaURL.Host,
+	}, PostOptions{
+		Text:      "video",
+		MediaURLs: []string{server.URL + "/long.mp4"},
+		OnMediaSkipped: func(mediaURL string, err error) {
+			if !errors.Is(err, ErrMediaDuration) {
+				t.Fatalf("OnMediaSkipped() error = %v, want ErrMediaDuration", err)
+			}
+			skipped = append(skipped, mediaURL)
+		},
+	})
+	if err != nil {
+		t.Fatalf("PostWithOptionsConfig() error = %v", err)
+	}
+	if tweetID != "tweet-1" {
+		t.Fatalf("tweetID = %q, want tweet-1", tweetID)
+	}
+	if len(skipped) != 1 || skipped[0] != server.URL+"/long.mp4" {
+		t.Fatalf("skipped = %v, want the long video", skipped)
+	}
+	if _, ok := body["media"]; ok {
+		t.Fatalf("tweet body = %#v, want no media", body)
+	}
+}
+
 func TestMediaUploadForbiddenErrorIncludesUploadContext(t *testing.T) {
-	err := mediaUploadRequestError("INIT", http.StatusForbidden, []byte(`{"title":"Forbidden"}`))
+	err := mediaUploadRequestError(EndpointMediaUpload, "INIT", http.StatusForbidden, nil, []byte(`{"title":"Forbidden"}`))
 	if err == nil {
 		t.Fatal("mediaUploadRequestError() returned nil")
 	}
@@ -266,3 +356,60 @@ func TestMediaUploadForbiddenErrorIncludesUploadContext(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateMediaMetadata(t *testing.T) {
+	var gotAuth string
+	var body struct {
+		ID       string `json:"id"`
+		Metadata struct {
+			AltText *struct {
+				Text string `json:"text"`
+			} `json:"alt_text"`
+			SensitiveMediaWarning []string `json:"sensitive_media_warning"`
+		} `json:"metadata"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/media/metadata" {
+			t.Fatalf("unexpected path %q", r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"associated_metadata":true}}`))
+	}))
+	defer server.Close()
+
+	oldEndpoint := MediaMetadataEndpoint
+	MediaMetadataEndpoint = server.URL + "/2/media/metadata"
+	defer func() { MediaMetadataEndpoint = oldEndpoint }()
+
+	altText := strings.Repeat("あ", MaxAltTextLength+10)
+	if err := createMediaMetadata(context.Background(), StaticBearerTokenSource{Token: "token-1"}, nil, "media-1", altText, false); err != nil {
+		t.Fatalf("createMediaMetadata() error = %v", err)
+	}
+	if gotAuth != "Bearer token-1" {
+		t.Fatalf("Authorization = %q", gotAuth)
+	}
+	if body.ID != "media-1" {
+		t.Fatalf("id = %q, want media-1", body.ID)
+	}
+	if body.Metadata.AltText == nil || body.Metadata.AltText.Text != strings.Repeat("あ", MaxAltTextLength) {
+		t.Fatalf("alt_text = %#v, want %d runes", body.Metadata.AltText, MaxAltTextLength)
+	}
+	if body.Metadata.SensitiveMediaWarning != nil {
+		t.Fatalf("sensitive_media_warning = %#v, want none", body.Metadata.SensitiveMediaWarning)
+	}
+
+	body.Metadata.AltText = nil
+	if err := createMediaMetadata(context.Background(), StaticBearerTokenSource{Token: "token-1"}, nil, "media-2", "", true); err != nil {
+		t.Fatalf("createMediaMetadata() error = %v", err)
+	}
+	if body.Metadata.AltText != nil {
+		t.Fatalf("alt_text = %#v, want none", body.Metadata.AltText)
+	}
+	if !reflect.DeepEqual(body.Metadata.SensitiveMediaWarning, []string{"other"}) {
+		t.Fatalf("sensitive_media_warning = %#v, want [other]", body.Metadata.SensitiveMediaWarning)
+	}
+}
@@ -0,0 +1,160 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxTweetLookupIDs is the number of IDs GET /2/tweets accepts per request.
+const maxTweetLookupIDs = 100
+
+// resourceNotFoundType is the problem type returned for deleted tweets.
+const resourceNotFoundType = "https://api.twitter.com/2/problems/resource-not-found"
+
+// DeleteWithConfig deletes a tweet. A tweet that is already gone is treated
+// as deleted.
+func DeleteWithConfig(ctx context.Context, cfg Config, tweetID string) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	tokenSource, err := cfg.bearerTokenSource()
+	if err != nil {
+		return err
+	}
+
+	statusCode, header, respBytes, err := doTweetRequest(ctx, tokenSource, cfg.Budget, EndpointDeleteTweet, http.MethodDelete, ManageTweetEndpoint+"/"+url.PathEscape(tweetID))
+	if err != nil {
+		return err
+	}
+	if statusCode == http.StatusNotFound {
+		return nil
+	}
+	if statusCode != http.StatusOK {
+		err := &APIError{
+			Operation:   "DELETE request",
+			StatusCode:  statusCode,
+			BodyPreview: previewBody(respBytes),
+		}
+		if statusCode == http.StatusTooManyRequests {
+			return rateLimited(EndpointDeleteTweet, header, err)
+		}
+		return err
+	}
+
+	var deleteResp struct {
+		Data struct {
+			Deleted bool `json:"deleted"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBytes, &deleteResp); err != nil {
+		return fmt.Errorf("failed to parse twitter delete response: %w", err)
+	}
+	if !deleteResp.Data.Deleted {
+		return fmt.Errorf("twitter did not delete tweet %s", tweetID)
+	}
+	return nil
+}
+
+// DeletedTweetIDsWithConfig returns the tweets among tweetIDs that no longer
+// exist. Tweets that are only unavailable, for example because the account
+// was protected or suspended, are not reported.
+func DeletedTweetIDsWithConfig(ctx context.Context, cfg Config, tweetIDs []string) ([]string, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	tokenSource, err := cfg.bearerTokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for start := 0; start < len(tweetIDs); start += maxTweetLookupIDs {
+		end := min(start+maxTweetLookupIDs, len(tweetIDs))
+		lookupURL := ManageTweetEndpoint + "?ids=" + url.QueryEscape(strings.Join(tweetIDs[start:end], ","))
+		statusCode, header, respBytes, err := doTweetRequest(ctx, tokenSource, cfg.Budget, EndpointLookupTweets, http.MethodGet, lookupURL)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != http.StatusOK {
+			err := &APIError{
+				Operation:   "lookup request",
+				StatusCode:  statusCode,
+				BodyPreview: previewBody(respBytes),
+			}
+			if statusCode == http.StatusTooManyRequests {
+				return nil, rateLimited(EndpointLookupTweets, header, err)
+			}
+			return nil, err
+		}
+
+		var lookupResp struct {
+			Errors []struct {
+				ResourceID string `json:"resource_id"`
+				Type       string `json:"type"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(respBytes, &lookupResp); err != nil {
+			return nil, fmt.Errorf("failed to parse twitter lookup response: %w", err)
+		}
+		for _, lookupErr := range lookupResp.Errors {
+			if lookupErr.Type == resourceNotFoundType && lookupErr.ResourceID != "" {
+				deleted = append(deleted, lookupErr.ResourceID)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// doTweetRequest sends a request without a body, refreshing the bearer token
+// and retrying once on 401. It is refused while budget has a limit of
+// endpoint exhausted, and records the limits in the response headers.
+func doTweetRequest(ctx context.Context, tokenSource BearerTokenSource, budget *Budget, endpoint, method, requestURL string) (int, http.Header, []byte, error) {
+	if err := budget.check(endpoint); err != nil {
+		return 0, nil, nil, err
+	}
+
+	var respBytes []byte
+	var statusCode int
+	var header http.Header
+	for attempt := 0; attempt < 2; attempt++ {
+		bearerToken, err := tokenSource.BearerToken(ctx)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, nil)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		respBytes, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return 0, nil, nil, err
+		}
+
+		statusCode = resp.StatusCode
+		header = resp.Header
+		budget.observe(endpoint, header)
+		if statusCode == http.StatusUnauthorized && attempt == 0 {
+			if refresher, ok := tokenSource.(ForceRefreshBearerTokenSource); ok {
+				if err := refresher.Refresh(ctx); err != nil {
+					return 0, nil, nil, err
+				}
+				continue
+			}
+		}
+		break
+	}
+	return statusCode, header, respBytes, nil
+}
@@ -0,0 +1,145 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeleteWithConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{name: "deleted", status: http.StatusOK, body: `{"data":{"deleted":true}}`},
+		{name: "already gone", status: http.StatusNotFound, body: `{"title":"Not Found Error"}`},
+		{name: "not deleted", status: http.StatusOK, body: `{"data":{"deleted":false}}`, wantErr: true},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"title":"Forbidden"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Fatalf("method = %q, want DELETE", r.Method)
+				}
+				if r.URL.Path != "/tweet-1" {
+					t.Fatalf("path = %q, want /tweet-1", r.URL.Path)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer access-token" {
+					t.Fatalf("Authorization = %q, want Bearer access-token", got)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+
+			oldEndpoint := ManageTweetEndpoint
+			ManageTweetEndpoint = server.URL
+			defer func() { ManageTweetEndpoint = oldEndpoint }()
+
+			err := DeleteWithConfig(context.Background(), Config{
+				BearerTokenSource: StaticBearerTokenSource{Token: "access-token"},
+			}, "tweet-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteWithConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeletedTweetIDsWithConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Fatalf("method = %q, want GET", r.Method)
+		}
+		if got := r.URL.Query().Get("ids"); got != "tweet-1,tweet-2,tweet-3" {
+			t.Fatalf("ids = %q, want tweet-1,tweet-2,tweet-3", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"data": [{"id": "tweet-1", "text": "hello"}],
+			"errors": [
+				{"resource_id": "tweet-2", "type": "https://api.twitter.com/2/problems/resource-not-found"},
+				{"resource_id": "tweet-3", "type": "https://api.twitter.com/2/problems/not-authorized-for-resource"}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	oldEndpoint := ManageTweetEndpoint
+	ManageTweetEndpoint = server.URL
+	defer func() { ManageTweetEndpoint = oldEndpoint }()
+
+	got, err := DeletedTweetIDsWithConfig(context.Background(), Config{
+		BearerTokenSource: StaticBearerTokenSource{Token: "access-token"},
+	}, []string{"tweet-1", "tweet-2", "tweet-3"})
+	if err != nil {
+		t.Fatalf("DeletedTweetIDsWithConfig() error = %v", err)
+	}
+	if want := []string{"tweet-2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("DeletedTweetIDsWithConfig() = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteAndLookupUseBudget(t *testing.T) {
+	ctx := context.Background()
+	reset := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-rate-limit-limit", "50")
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"title":"Too Many Requests"}`))
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	oldEndpoint := ManageTweetEndpoint
+	ManageTweetEndpoint = server.URL
+	defer func() { ManageTweetEndpoint = oldEndpoint }()
+
+	cfg := Config{
+		BearerTokenSource: StaticBearerTokenSource{Token: "access-token"},
+		Budget:            NewBudget(nil),
+	}
+	var rateLimitErr *RateLimitError
+	err := DeleteWithConfig(ctx, cfg, "tweet-1")
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.Endpoint != EndpointDeleteTweet || !rateLimitErr.Reset.Equal(reset) {
+		t.Fatalf("DeleteWithConfig() error = %v, want a delete rate limit error until %v", err, reset)
+	}
+	if err := DeleteWithConfig(ctx, cfg, "tweet-2"); !errors.As(err, &rateLimitErr) || rateLimitErr.Err != nil {
+		t.Fatalf("DeleteWithConfig() second error = %v, want the budget to refuse the delete", err)
+	}
+
+	_, err = DeletedTweetIDsWithConfig(ctx, cfg, []string{"tweet-1"})
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.Endpoint != EndpointLookupTweets || rateLimitErr.Err == nil {
+		t.Fatalf("DeletedTweetIDsWithConfig() error = %v, want the lookup 429 as a rate limit error", err)
+	}
+	if _, err := DeletedTweetIDsWithConfig(ctx, cfg, []string{"tweet-1"}); !errors.As(err, &rateLimitErr) || rateLimitErr.Err != nil {
+		t.Fatalf("DeletedTweetIDsWithConfig() second error = %v, want the budget to refuse the lookup", err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want one request per endpoint before the reset", requests)
+	}
+}
@@ -0,0 +1,167 @@
+package twitter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Media limits for tweet_gif and tweet_video uploads.
+const (
+	MaxGIFBytes      = 15 * 1024 * 1024
+	MaxVideoBytes    = 512 * 1024 * 1024
+	MinVideoDuration = 500 * time.Millisecond
+	MaxVideoDuration = 140 * time.Second
+)
+
+// ErrMediaLimit matches the errors of media that exceed the upload limits.
+// ErrMediaTooLarge and ErrMediaDuration tell which limit was exceeded.
+var (
+	ErrMediaLimit    = errors.New("media exceeds the Twitter upload limits")
+	ErrMediaTooLarge = errors.New("media exceeds the Twitter size limit")
+	ErrMediaDuration = errors.New("video is outside the Twitter duration limits")
+)
+
+// MaxAltTextLength is the longest media alt text Twitter accepts.
+const MaxAltTextLength = 1000
+
+// IsVideoMediaType reports whether mediaType is uploaded as a video or an
+// animated GIF. Twitter allows only one such file per tweet.
+func IsVideoMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "image/gif")
+}
+
+// CheckMediaSize returns an error when a video or GIF of size bytes exceeds
+// Twitter's upload limit. Other media types and unknown sizes are accepted.
+func CheckMediaSize(mediaType string, size int64) error {
+	limit := mediaSizeLimit(mediaType)
+	if limit <= 0 || size <= limit {
+		return nil
+	}
+	return mediaLimitError(ErrMediaTooLarge, fmt.Errorf("%s is %d bytes, exceeding the %d byte limit", mediaType, size, limit))
+}
+
+// CheckVideoDuration returns an error when a video of the given duration is
+// outside Twitter's duration limits. Other media types and unknown durations
+// are accepted.
+func CheckVideoDuration(mediaType string, duration time.Duration) error {
+	if !strings.HasPrefix(mediaType, "video/") || duration <= 0 {
+		return nil
+	}
+	if duration < MinVideoDuration || duration > MaxVideoDuration {
+		return mediaLimitError(ErrMediaDuration, fmt.Errorf("video is %s long, outside the %s to %s limit", duration, MinVideoDuration, MaxVideoDuration))
+	}
+	return nil
+}
+
+func mediaSizeLimit(mediaType string) int64 {
+	switch {
+	case strings.HasPrefix(mediaType, "image/gif"):
+		return MaxGIFBytes
+	case strings.HasPrefix(mediaType, "video/"):
+		return MaxVideoBytes
+	default:
+		return 0
+	}
+}
+
+// checkVideoDuration returns an error when an MP4 or QuickTime video is
+// outside Twitter's duration limits. Files without a readable movie header
+// are left to the API.
+func checkVideoDuration(mediaType string, mediaBytes []byte) error {
+	if !strings.HasPrefix(mediaType, "video/") {
+		return nil
+	}
+	duration, ok := mp4Duration(mediaBytes)
+	if !ok {
+		return nil
+	}
+	return CheckVideoDuration(mediaType, duration)
+}
+
+func mediaLimitError(limit, err error) error {
+	return &APIError{
+		Operation: "media upload",
+		Command:   "validate",
+		Err:       mediaLimitErr{error: err, limit: limit},
+	}
+}
+
+// mediaLimitErr keeps the message of a limit error while matching
+// ErrMediaLimit and the sentinel of the exceeded limit.
+type mediaLimitErr struct {
+	error
+	limit error
+}
+
+func (e mediaLimitErr) Is(target error) bool {
+	return target == ErrMediaLimit || target == e.limit
+}
+
+func (e mediaLimitErr) Unwrap() error {
+	return e.error
+}
+
+// mp4Duration reads the movie duration from the mvhd box of an ISO base media
+// file.
+func mp4Duration(data []byte) (time.Duration, bool) {
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 4 {
+		return 0, false
+	}
+
+	var timescale, duration uint64
+	switch mvhd[0] {
+	case 0:
+		if len(mvhd) < 20 {
+			return 0, false
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case 1:
+		if len(mvhd) < 32 {
+			return 0, false
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	default:
+		return 0, false
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), true
+}
+
+// findBox returns the payload of the first box named boxType in data.
+func findBox(data []byte, boxType string) ([]byte, bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		name := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, false
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, false
+		}
+		if name == boxType {
+			return data[header:size], true
+		}
+		data = data[size:]
+	}
+	return nil, false
+}
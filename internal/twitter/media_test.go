@@ -0,0 +1,76 @@
+package twitter
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mp4Box(boxType string, payload []byte) []byte {
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(payload)))
+	copy(box[4:8], boxType)
+	return append(box, payload...)
+}
+
+func testMP4(timescale, duration uint32) []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:20], duration)
+	moov := mp4Box("moov", mp4Box("mvhd", mvhd))
+	return append(mp4Box("ftyp", []byte("isom")), moov...)
+}
+
+func TestMP4Duration(t *testing.T) {
+	got, ok := mp4Duration(testMP4(1000, 12500))
+	if !ok || got != 12500*time.Millisecond {
+		t.Fatalf("mp4Duration() = %v, %v; want 12.5s", got, ok)
+	}
+	if _, ok := mp4Duration([]byte("not an mp4 file")); ok {
+		t.Fatal("mp4Duration() ok = true for invalid data")
+	}
+}
+
+func TestCheckVideoDuration(t *testing.T) {
+	if err := checkVideoDuration("video/mp4", testMP4(1000, 60000)); err != nil {
+		t.Fatalf("checkVideoDuration(60s) error = %v", err)
+	}
+	err := checkVideoDuration("video/mp4", testMP4(1000, 141000))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Operation != "media upload" {
+		t.Fatalf("checkVideoDuration(141s) error = %v, want media upload APIError", err)
+	}
+	if !errors.Is(err, ErrMediaLimit) {
+		t.Fatalf("checkVideoDuration(141s) error = %v, want ErrMediaLimit", err)
+	}
+	if err := checkVideoDuration("video/webm", []byte("unknown")); err != nil {
+		t.Fatalf("checkVideoDuration(unreadable) error = %v", err)
+	}
+	if err := CheckVideoDuration("video/mp4", 0); err != nil {
+		t.Fatalf("CheckVideoDuration(unknown) error = %v", err)
+	}
+	if err := CheckVideoDuration("video/mp4", 100*time.Millisecond); !errors.Is(err, ErrMediaDuration) || !errors.Is(err, ErrMediaLimit) {
+		t.Fatalf("CheckVideoDuration(0.1s) error = %v, want ErrMediaDuration", err)
+	}
+}
+
+func TestCheckMediaSize(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		size      int64
+		wantErr   bool
+	}{
+		{mediaType: "image/png", size: 100 * 1024 * 1024},
+		{mediaType: "image/gif", size: MaxGIFBytes},
+		{mediaType: "image/gif", size: MaxGIFBytes + 1, wantErr: true},
+		{mediaType: "video/mp4", size: MaxVideoBytes + 1, wantErr: true},
+		{mediaType: "video/mp4", size: -1},
+	}
+
+	for _, tt := range tests {
+		if err := CheckMediaSize(tt.mediaType, tt.size); (err != nil) != tt.wantErr || errors.Is(err, ErrMediaTooLarge) != tt.wantErr {
+			t.Fatalf("CheckMediaSize(%q, %d) error = %v, wantErr %v", tt.mediaType, tt.size, err, tt.wantErr)
+		}
+	}
+}
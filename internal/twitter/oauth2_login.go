@@ -13,8 +13,9 @@ import (
 )
 
 const (
-	OAuth2Scope         = "tweet.read tweet.write users.read media.write offline.access"
-	oauth2LoginTokenTTL = 5 * time.Minute
+	OAuth2Scope            = "tweet.read tweet.write users.read media.write offline.access"
+	oauth2LoginTokenTTL    = 5 * time.Minute
+	defaultOAuth2LoginPath = "/twitter/login"
 )
 
 var (
@@ -28,6 +29,7 @@ type OAuth2LoginManager struct {
 	tokenManager *TokenManager
 	clientID     string
 	redirectURL  string
+	loginPath    string
 	ttl          time.Duration
 	now          func() time.Time
 	authTokens   map[string]time.Time
@@ -57,10 +59,16 @@ func NewOAuth2LoginManager(tokenManager *TokenManager, cfg OAuth2Config) (*OAuth
 		return nil, fmt.Errorf("invalid twitter OAuth 2.0 redirect URL")
 	}
 
+	loginPath := cfg.LoginPath
+	if loginPath == "" {
+		loginPath = defaultOAuth2LoginPath
+	}
+
 	return &OAuth2LoginManager{
 		tokenManager: tokenManager,
 		clientID:     cfg.ClientID,
 		redirectURL:  cfg.RedirectURL,
+		loginPath:    loginPath,
 		ttl:          oauth2LoginTokenTTL,
 		now:          time.Now,
 		authTokens:   map[string]time.Time{},
@@ -151,6 +159,15 @@ func (m *OAuth2LoginManager) CompleteLogin(ctx context.Context, state, code stri
 	return m.tokenManager.ExchangeAuthorizationCode(ctx, code, loginState.codeVerifier)
 }
 
+// HasLoginState reports whether state belongs to a login started by m. It is
+// used to route a shared callback URL to the right account.
+func (m *OAuth2LoginManager) HasLoginState(state string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.states[state]
+	return ok
+}
+
 func (m *OAuth2LoginManager) CancelLogin(state string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -162,7 +179,7 @@ func (m *OAuth2LoginManager) loginURLForToken(token string) string {
 	if err != nil {
 		return ""
 	}
-	redirectURL.Path = "/twitter/login"
+	redirectURL.Path = m.loginPath
 	redirectURL.RawQuery = url.Values{"auth": {token}}.Encode()
 	redirectURL.Fragment = ""
 	return redirectURL.String()
@@ -46,6 +46,9 @@ type OAuth2Config struct {
 	ClientID       string
 	RedirectURL    string
 	TokenStorePath string
+	// LoginPath is the path of the login URLs issued for re-authorization.
+	// It defaults to /twitter/login.
+	LoginPath string
 }
 
 type OAuth2Token struct {
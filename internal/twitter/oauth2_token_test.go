@@ -200,7 +200,7 @@ func TestPostMediaFormRefreshesAndRetriesOnUnauthorized(t *testing.T) {
 	defer func() { UploadMediaEndpoint = oldEndpoint }()
 
 	var response UploadMediaResponse
-	if err := postMediaForm(ctx, source, map[string]string{"command": "INIT"}, "", nil, &response); err != nil {
+	if err := postMediaForm(ctx, source, nil, map[string]string{"command": "INIT"}, "", nil, &response); err != nil {
 		t.Fatalf("postMediaForm() error = %v", err)
 	}
 	if response.Data.ID != "media-1" {
@@ -227,7 +227,7 @@ func TestPostMediaFormForbiddenErrorIncludesUploadContext(t *testing.T) {
 	UploadMediaEndpoint = server.URL
 	defer func() { UploadMediaEndpoint = oldEndpoint }()
 
-	err := postMediaForm(ctx, source, map[string]string{"command": "INIT"}, "", nil, nil)
+	err := postMediaForm(ctx, source, nil, map[string]string{"command": "INIT"}, "", nil, nil)
 	if err == nil {
 		t.Fatal("postMediaForm() succeeded, want error")
 	}
@@ -426,6 +426,47 @@ func TestOAuth2LoginManagerIssuesLoginAndAuthorizeURL(t *testing.T) {
 	}
 }
 
+func TestOAuth2LoginManagerUsesConfiguredLoginPath(t *testing.T) {
+	cfg := OAuth2Config{
+		ClientID:    "client-1",
+		RedirectURL: "https://example.com/twitter/callback",
+		LoginPath:   "/twitter/login/brand-a",
+	}
+	manager, err := NewTokenManager(cfg)
+	if err != nil {
+		t.Fatalf("NewTokenManager() error = %v", err)
+	}
+	loginManager, err := NewOAuth2LoginManager(manager, cfg)
+	if err != nil {
+		t.Fatalf("NewOAuth2LoginManager() error = %v", err)
+	}
+
+	loginURL, _, err := loginManager.IssueLoginURL()
+	if err != nil {
+		t.Fatalf("IssueLoginURL() error = %v", err)
+	}
+	if !strings.HasPrefix(loginURL, "https://example.com/twitter/login/brand-a?auth=") {
+		t.Fatalf("login URL = %q, want configured login path", loginURL)
+	}
+
+	parsedLoginURL, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatalf("Parse(loginURL) error = %v", err)
+	}
+	authorizeURL, err := loginManager.BeginLogin(parsedLoginURL.Query().Get("auth"))
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	parsedAuthorizeURL, err := url.Parse(authorizeURL)
+	if err != nil {
+		t.Fatalf("Parse(authorizeURL) error = %v", err)
+	}
+	state := parsedAuthorizeURL.Query().Get("state")
+	if !loginManager.HasLoginState(state) || loginManager.HasLoginState("other-state") {
+		t.Fatalf("HasLoginState() does not match the started login")
+	}
+}
+
 type recordingTokenSource struct {
 	token     string
 	refreshes int
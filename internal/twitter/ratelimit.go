@@ -0,0 +1,220 @@
+package twitter
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Endpoints whose rate limits are tracked by Budget.
+const (
+	EndpointCreateTweet   = "create_tweet"
+	EndpointMediaUpload   = "media_upload"
+	EndpointMediaMetadata = "media_metadata"
+	EndpointDeleteTweet   = "delete_tweet"
+	EndpointLookupTweets  = "lookup_tweets"
+)
+
+// Rate limit windows. WindowEndpoint is reported in the x-rate-limit-*
+// headers, usually per 15 minutes, and WindowUser24Hour in the
+// x-user-limit-24hour-* headers, which hold the daily post allowance of the
+// user.
+const (
+	WindowEndpoint   = "endpoint"
+	WindowUser24Hour = "user_24hour"
+)
+
+var rateLimitHeaders = []struct {
+	window string
+	prefix string
+}{
+	{window: WindowEndpoint, prefix: "X-Rate-Limit-"},
+	{window: WindowUser24Hour, prefix: "X-User-Limit-24hour-"},
+}
+
+// RateLimit is a limit reported in the headers of a Twitter API response.
+type RateLimit struct {
+	Endpoint  string
+	Window    string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitError is returned when a request is refused because a rate limit is
+// exhausted. Err is the 429 response, or nil when Budget refused the request
+// before sending it.
+type RateLimitError struct {
+	Endpoint string
+	Window   string
+	Reset    time.Time
+	Err      error
+}
+
+func (e *RateLimitError) Error() string {
+	message := fmt.Sprintf("twitter %s rate limit (%s) is exhausted until %s", e.Endpoint, e.Window, e.Reset.Format(time.RFC3339))
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// parseRateLimits reads the rate limits in the headers of a response.
+func parseRateLimits(endpoint string, header http.Header) []RateLimit {
+	var limits []RateLimit
+	for _, h := range rateLimitHeaders {
+		remaining, err := strconv.Atoi(header.Get(h.prefix + "Remaining"))
+		if err != nil {
+			continue
+		}
+		reset, err := strconv.ParseInt(header.Get(h.prefix+"Reset"), 10, 64)
+		if err != nil {
+			continue
+		}
+		limit, _ := strconv.Atoi(header.Get(h.prefix + "Limit"))
+		limits = append(limits, RateLimit{
+			Endpoint:  endpoint,
+			Window:    h.window,
+			Limit:     limit,
+			Remaining: remaining,
+			Reset:     time.Unix(reset, 0),
+		})
+	}
+	return limits
+}
+
+// rateLimited converts a 429 response into a *RateLimitError that carries the
+// reset time of the exhausted limit. Without a usable reset time, err is
+// returned as is.
+func rateLimited(endpoint string, header http.Header, err error) error {
+	var exhausted *RateLimit
+	for _, limit := range parseRateLimits(endpoint, header) {
+		if limit.Remaining > 0 {
+			continue
+		}
+		if exhausted == nil || limit.Reset.After(exhausted.Reset) {
+			exhausted = &limit
+		}
+	}
+	if exhausted == nil || !exhausted.Reset.After(time.Now()) {
+		return err
+	}
+	return &RateLimitError{Endpoint: endpoint, Window: exhausted.Window, Reset: exhausted.Reset, Err: err}
+}
+
+type budgetKey struct {
+	endpoint string
+	window   string
+}
+
+// Budget keeps the latest rate limits of a Twitter user and refuses requests
+// while one of them is exhausted, instead of spending a request on a 429. A
+// nil *Budget tracks nothing.
+type Budget struct {
+	mu       sync.Mutex
+	limits   map[budgetKey]RateLimit
+	onUpdate func(RateLimit)
+	now      func() time.Time
+}
+
+// NewBudget creates a budget. onUpdate, when not nil, is called with each
+// limit read from a response.
+func NewBudget(onUpdate func(RateLimit)) *Budget {
+	return &Budget{
+		limits:   make(map[budgetKey]RateLimit),
+		onUpdate: onUpdate,
+		now:      time.Now,
+	}
+}
+
+// Restore loads limits saved by an earlier process. Limits that were reset
+// since are ignored.
+func (b *Budget) Restore(limits []RateLimit) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for _, limit := range limits {
+		if limit.Reset.After(now) {
+			b.limits[budgetKey{limit.Endpoint, limit.Window}] = limit
+		}
+	}
+}
+
+// Limits returns the tracked limits that were not reset yet.
+func (b *Budget) Limits() []RateLimit {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var limits []RateLimit
+	for _, limit := range b.limits {
+		if limit.Reset.After(now) {
+			limits = append(limits, limit)
+		}
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].Endpoint != limits[j].Endpoint {
+			return limits[i].Endpoint < limits[j].Endpoint
+		}
+		return limits[i].Window < limits[j].Window
+	})
+	return limits
+}
+
+// check returns a *RateLimitError when a limit of endpoint is exhausted until
+// a later reset.
+func (b *Budget) check(endpoint string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var err *RateLimitError
+	for key, limit := range b.limits {
+		if key.endpoint != endpoint || limit.Remaining > 0 || !limit.Reset.After(now) {
+			continue
+		}
+		if err == nil || limit.Reset.After(err.Reset) {
+			err = &RateLimitError{Endpoint: endpoint, Window: limit.Window, Reset: limit.Reset}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+// observe records the limits in the headers of a response.
+func (b *Budget) observe(endpoint string, header http.Header) {
+	if b == nil {
+		return
+	}
+	limits := parseRateLimits(endpoint, header)
+	b.mu.Lock()
+	for _, limit := range limits {
+		b.limits[budgetKey{limit.Endpoint, limit.Window}] = limit
+	}
+	b.mu.Unlock()
+
+	if b.onUpdate != nil {
+		for _, limit := range limits {
+			b.onUpdate(limit)
+		}
+	}
+}
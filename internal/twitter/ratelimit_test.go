@@ -0,0 +1,133 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	reset := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+	header := http.Header{}
+	header.Set("x-rate-limit-limit", "100")
+	header.Set("x-rate-limit-remaining", "99")
+	header.Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+	header.Set("x-user-limit-24hour-limit", "17")
+	header.Set("x-user-limit-24hour-remaining", "3")
+	header.Set("x-user-limit-24hour-reset", strconv.FormatInt(reset.Add(time.Hour).Unix(), 10))
+
+	limits := parseRateLimits(EndpointCreateTweet, header)
+	if len(limits) != 2 {
+		t.Fatalf("parseRateLimits() = %+v, want two limits", limits)
+	}
+	if got := limits[0]; got.Window != WindowEndpoint || got.Limit != 100 || got.Remaining != 99 || !got.Reset.Equal(reset) {
+		t.Fatalf("endpoint limit = %+v", got)
+	}
+	if got := limits[1]; got.Window != WindowUser24Hour || got.Limit != 17 || got.Remaining != 3 || !got.Reset.Equal(reset.Add(time.Hour)) {
+		t.Fatalf("24 hour limit = %+v", got)
+	}
+	if limits := parseRateLimits(EndpointCreateTweet, http.Header{}); len(limits) != 0 {
+		t.Fatalf("parseRateLimits() without headers = %+v, want none", limits)
+	}
+}
+
+func TestBudgetRefusesExhaustedEndpoint(t *testing.T) {
+	var updates []RateLimit
+	budget := NewBudget(func(limit RateLimit) { updates = append(updates, limit) })
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	header := http.Header{}
+	header.Set("x-user-limit-24hour-limit", "17")
+	header.Set("x-user-limit-24hour-remaining", "0")
+	header.Set("x-user-limit-24hour-reset", strconv.FormatInt(reset.Unix(), 10))
+	budget.observe(EndpointCreateTweet, header)
+	if len(updates) != 1 || updates[0].Remaining != 0 {
+		t.Fatalf("updates = %+v, want the exhausted limit", updates)
+	}
+
+	var rateLimitErr *RateLimitError
+	if err := budget.check(EndpointCreateTweet); !errors.As(err, &rateLimitErr) || !rateLimitErr.Reset.Equal(reset) || rateLimitErr.Window != WindowUser24Hour {
+		t.Fatalf("check() error = %v, want a rate limit error until %v", err, reset)
+	}
+	if err := budget.check(EndpointMediaUpload); err != nil {
+		t.Fatalf("check(media upload) error = %v, want nil", err)
+	}
+
+	budget.now = func() time.Time { return reset.Add(time.Second) }
+	if err := budget.check(EndpointCreateTweet); err != nil {
+		t.Fatalf("check() after reset error = %v, want nil", err)
+	}
+	if limits := budget.Limits(); len(limits) != 0 {
+		t.Fatalf("Limits() after reset = %+v, want none", limits)
+	}
+}
+
+func TestBudgetRestore(t *testing.T) {
+	budget := NewBudget(nil)
+	budget.Restore([]RateLimit{
+		{Endpoint: EndpointCreateTweet, Window: WindowEndpoint, Limit: 100, Remaining: 0, Reset: time.Now().Add(time.Minute)},
+		{Endpoint: EndpointMediaUpload, Window: WindowEndpoint, Limit: 100, Remaining: 0, Reset: time.Now().Add(-time.Minute)},
+	})
+	if err := budget.check(EndpointCreateTweet); err == nil {
+		t.Fatal("check() error = nil, want the restored limit to refuse posts")
+	}
+	if err := budget.check(EndpointMediaUpload); err != nil {
+		t.Fatalf("check(media upload) error = %v, want the expired limit to be ignored", err)
+	}
+
+	var nilBudget *Budget
+	if err := nilBudget.check(EndpointCreateTweet); err != nil || nilBudget.Limits() != nil {
+		t.Fatalf("nil budget check() = %v, Limits() = %v; want nothing tracked", err, nilBudget.Limits())
+	}
+}
+
+func TestPostWithOptionsConfigDefersRateLimitedPost(t *testing.T) {
+	ctx := context.Background()
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-rate-limit-limit", "100")
+		w.Header().Set("x-rate-limit-remaining", "97")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+		w.Header().Set("x-user-limit-24hour-limit", "17")
+		w.Header().Set("x-user-limit-24hour-remaining", "0")
+		w.Header().Set("x-user-limit-24hour-reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"title":"Too Many Requests"}`))
+	}))
+	defer server.Close()
+
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	oldEndpoint := ManageTweetEndpoint
+	ManageTweetEndpoint = server.URL
+	defer func() { ManageTweetEndpoint = oldEndpoint }()
+
+	cfg := Config{
+		BearerTokenSource: StaticBearerTokenSource{Token: "access-token"},
+		Budget:            NewBudget(nil),
+	}
+	_, err := PostWithOptionsConfig(ctx, cfg, PostOptions{Text: "hello"})
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || !rateLimitErr.Reset.Equal(reset) || rateLimitErr.Window != WindowUser24Hour {
+		t.Fatalf("PostWithOptionsConfig() error = %v, want a rate limit error until %v", err, reset)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("PostWithOptionsConfig() error = %v, want the 429 response", err)
+	}
+
+	if _, err := PostWithOptionsConfig(ctx, cfg, PostOptions{Text: "hello again"}); !errors.As(err, &rateLimitErr) || rateLimitErr.Err != nil {
+		t.Fatalf("PostWithOptionsConfig() second error = %v, want the budget to refuse the post", err)
+	}
+	if requests != 1 {
+		t.Fatalf("requests = %d, want the second post to wait for the reset", requests)
+	}
+}
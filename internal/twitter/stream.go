@@ -71,13 +71,45 @@ func DefaultStreamRule(username string) string {
 	if username == "" {
 		return ""
 	}
-	return "from:" + username + " -is:reply"
+	return "from:" + username
 }
 
 func DefaultStreamRuleTag() string {
 	return defaultStreamRuleTag
 }
 
+// StreamRuleTag returns the rule tag of an account pair. An empty pair uses
+// the default tag, so that a single-pair setup keeps its existing rule.
+func StreamRuleTag(pair string) string {
+	if pair == "" {
+		return defaultStreamRuleTag
+	}
+	return defaultStreamRuleTag + ":" + pair
+}
+
+// IsStreamRuleTag reports whether tag is the tag of an account pair's rule.
+func IsStreamRuleTag(tag string) bool {
+	return tag == defaultStreamRuleTag || strings.HasPrefix(tag, defaultStreamRuleTag+":")
+}
+
+// MatchingRuleTags returns the tags of the rules that matched a Filtered
+// Stream payload.
+func MatchingRuleTags(payload []byte) []string {
+	var parsed struct {
+		MatchingRules []StreamRule `json:"matching_rules"`
+	}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil
+	}
+	tags := make([]string, 0, len(parsed.MatchingRules))
+	for _, rule := range parsed.MatchingRules {
+		if rule.Tag != "" {
+			tags = append(tags, rule.Tag)
+		}
+	}
+	return tags
+}
+
 func NewStreamClient(source BearerTokenSource) *StreamClient {
 	return &StreamClient{
 		BearerTokenSource: source,
@@ -125,6 +157,62 @@ func (c *StreamClient) EnsureRule(ctx context.Context, value, tag string) error
 	return c.AddRule(ctx, value, tag)
 }
 
+// SyncRules makes the connector rules of the app equal to rules. Rules with a
+// connector tag that is not in rules, such as the rule of a pair that was
+// removed or moved to another bearer token, are deleted so that their tweets
+// are no longer delivered on this connection. Rules with other tags are kept.
+// It returns the deleted rules.
+func (c *StreamClient) SyncRules(ctx context.Context, rules []StreamRule) ([]StreamRule, error) {
+	rules = append([]StreamRule(nil), rules...)
+	want := make(map[string]string, len(rules))
+	for i, rule := range rules {
+		if rule.Value == "" {
+			return nil, fmt.Errorf("twitter stream rule is not configured")
+		}
+		if rule.Tag == "" {
+			rules[i].Tag = defaultStreamRuleTag
+		}
+		want[rules[i].Tag] = rule.Value
+	}
+
+	current, err := c.ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(rules))
+	var stale []StreamRule
+	for _, rule := range current {
+		value, ok := want[rule.Tag]
+		if ok && rule.Value == value && !present[rule.Tag] {
+			present[rule.Tag] = true
+			continue
+		}
+		if ok || IsStreamRuleTag(rule.Tag) {
+			stale = append(stale, rule)
+		}
+	}
+	if len(stale) > 0 {
+		ids := make([]string, 0, len(stale))
+		for _, rule := range stale {
+			ids = append(ids, rule.ID)
+		}
+		if err := c.DeleteRules(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range rules {
+		if present[rule.Tag] {
+			continue
+		}
+		if err := c.AddRule(ctx, rule.Value, rule.Tag); err != nil {
+			return stale, err
+		}
+		present[rule.Tag] = true
+	}
+	return stale, nil
+}
+
 func (c *StreamClient) ListRules(ctx context.Context) ([]StreamRule, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.rulesEndpoint(), nil)
 	if err != nil {
@@ -317,24 +405,33 @@ func (c *StreamClient) streamURL() string {
 		return endpoint
 	}
 	q := parsed.Query()
+	setTweetQueryFields(q)
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// setTweetQueryFields requests the tweet fields and expansions the handler
+// needs to convert a tweet into a note.
+func setTweetQueryFields(q url.Values) {
 	q.Set("tweet.fields", strings.Join([]string{
 		"author_id",
 		"attachments",
 		"entities",
 		"referenced_tweets",
 		"in_reply_to_user_id",
+		"possibly_sensitive",
 		"edit_history_tweet_ids",
 	}, ","))
 	q.Set("expansions", strings.Join([]string{
 		"author_id",
 		"attachments.media_keys",
+		"attachments.poll_ids",
 		"referenced_tweets.id",
 		"referenced_tweets.id.author_id",
 	}, ","))
 	q.Set("user.fields", "username")
-	q.Set("media.fields", "type,url,preview_image_url")
-	parsed.RawQuery = q.Encode()
-	return parsed.String()
+	q.Set("media.fields", "type,url,preview_image_url,alt_text,duration_ms,variants")
+	q.Set("poll.fields", "options,duration_minutes,end_datetime,voting_status")
 }
 
 func httpError(resp *http.Response) error {
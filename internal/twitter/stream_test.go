@@ -12,7 +12,7 @@ import (
 )
 
 func TestDefaultStreamRule(t *testing.T) {
-	if got := DefaultStreamRule("dummy_user"); got != "from:dummy_user -is:reply" {
+	if got := DefaultStreamRule("dummy_user"); got != "from:dummy_user" {
 		t.Fatalf("DefaultStreamRule() = %q", got)
 	}
 	if got := DefaultStreamRule(""); got != "" {
@@ -20,6 +20,26 @@ func TestDefaultStreamRule(t *testing.T) {
 	}
 }
 
+func TestStreamRuleTag(t *testing.T) {
+	if got := StreamRuleTag(""); got != DefaultStreamRuleTag() {
+		t.Fatalf("StreamRuleTag(empty) = %q, want default tag", got)
+	}
+	if got := StreamRuleTag("brand-a"); got != "note-tweet-connector:brand-a" {
+		t.Fatalf("StreamRuleTag(brand-a) = %q", got)
+	}
+}
+
+func TestMatchingRuleTags(t *testing.T) {
+	payload := []byte(`{"data":{"id":"1"},"matching_rules":[{"id":"r1","tag":"note-tweet-connector:brand-a"},{"id":"r2","tag":""},{"id":"r3","tag":"note-tweet-connector"}]}`)
+	want := []string{"note-tweet-connector:brand-a", "note-tweet-connector"}
+	if got := MatchingRuleTags(payload); !reflect.DeepEqual(got, want) {
+		t.Fatalf("MatchingRuleTags() = %q, want %q", got, want)
+	}
+	if got := MatchingRuleTags([]byte(`{"data":{"id":"1"}}`)); len(got) != 0 {
+		t.Fatalf("MatchingRuleTags(no rules) = %q, want none", got)
+	}
+}
+
 func TestEnsureRuleNoopWhenRuleExists(t *testing.T) {
 	ctx := context.Background()
 	var requests []string
@@ -31,7 +51,7 @@ func TestEnsureRuleNoopWhenRuleExists(t *testing.T) {
 		if r.Method != http.MethodGet {
 			t.Fatalf("unexpected method %s", r.Method)
 		}
-		_, _ = w.Write([]byte(`{"data":[{"id":"rule-1","value":"from:dummy_user -is:reply","tag":"note-tweet-connector"}]}`))
+		_, _ = w.Write([]byte(`{"data":[{"id":"rule-1","value":"from:dummy_user","tag":"note-tweet-connector"}]}`))
 	}))
 	defer server.Close()
 
@@ -89,6 +109,60 @@ func TestEnsureRuleReplacesStaleTaggedRule(t *testing.T) {
 	}
 }
 
+func TestSyncRulesDeletesRulesOfOtherPairs(t *testing.T) {
+	ctx := context.Background()
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"data":[{"id":"kept","value":"from:alice","tag":"note-tweet-connector:alice"},{"id":"moved","value":"from:bob","tag":"note-tweet-connector:bob"},{"id":"other","value":"cats","tag":"external"}]}`))
+		case http.MethodPost:
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			bodies = append(bodies, body)
+			_, _ = w.Write([]byte(`{"meta":{"sent":"ok"}}`))
+		default:
+			t.Fatalf("unexpected method %s", r.Method)
+		}
+	}))
+	defer server.Close()
+
+	client := NewStreamClient(StaticBearerTokenSource{Token: "token-1"})
+	client.RulesEndpoint = server.URL + "/2/tweets/search/stream/rules"
+	client.HTTPClient = server.Client()
+
+	deleted, err := client.SyncRules(ctx, []StreamRule{
+		{Value: "from:alice", Tag: StreamRuleTag("alice")},
+		{Value: "from:carol", Tag: StreamRuleTag("carol")},
+	})
+	if err != nil {
+		t.Fatalf("SyncRules() error = %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "moved" {
+		t.Fatalf("deleted = %+v, want the rule of bob", deleted)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("POST count = %d, want 2", len(bodies))
+	}
+	if got := bodies[0]["delete"]; !reflect.DeepEqual(got, map[string]interface{}{"ids": []interface{}{"moved"}}) {
+		t.Fatalf("first POST body = %#v, want delete of bob", bodies[0])
+	}
+	if got, _ := bodies[1]["add"].([]interface{}); len(got) != 1 || got[0].(map[string]interface{})["tag"] != "note-tweet-connector:carol" {
+		t.Fatalf("second POST body = %#v, want add for carol", bodies[1])
+	}
+
+	bodies = nil
+	if _, err := client.SyncRules(ctx, nil); err != nil {
+		t.Fatalf("SyncRules(nil) error = %v", err)
+	}
+	want := []map[string]interface{}{{"delete": map[string]interface{}{"ids": []interface{}{"kept", "moved"}}}}
+	if !reflect.DeepEqual(bodies, want) {
+		t.Fatalf("POST bodies = %#v, want %#v", bodies, want)
+	}
+}
+
 func TestConsumeReadsStreamLines(t *testing.T) {
 	ctx := context.Background()
 	var gotQuery string
@@ -119,7 +193,7 @@ func TestConsumeReadsStreamLines(t *testing.T) {
 	if len(lines) != 1 || string(lines[0]) != `{"data":{"id":"1","text":"hello"}}` {
 		t.Fatalf("lines = %q", lines)
 	}
-	for _, want := range []string{"tweet.fields=", "expansions=", "user.fields=username", "media.fields="} {
+	for _, want := range []string{"tweet.fields=", "expansions=", "user.fields=username", "media.fields=", "poll.fields="} {
 		if !strings.Contains(gotQuery, want) {
 			t.Fatalf("query %q does not contain %q", gotQuery, want)
 		}
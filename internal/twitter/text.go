@@ -0,0 +1,157 @@
+package twitter
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTweetLength is the weighted length limit for a single tweet.
+const MaxTweetLength = 280
+
+const (
+	transformedURLLength = 23
+	lightCharacterWeight = 1
+	heavyCharacterWeight = 2
+	emojiPresentation    = 0xFE0F
+	zeroWidthJoiner      = 0x200D
+)
+
+// urlPattern matches the links Twitter wraps with t.co. Trailing punctuation
+// is trimmed separately because it is rarely part of the link.
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s<>"　]+`)
+
+// lightRanges are the code point ranges twitter-text v3 counts with weight 1.
+// Everything else, including CJK characters and emoji, counts as 2.
+var lightRanges = [][2]rune{
+	{0x0000, 0x10FF},
+	{0x2000, 0x200D},
+	{0x2010, 0x201F},
+	{0x2032, 0x2037},
+}
+
+// WeightedLength returns the tweet length of text as counted by twitter-text
+// v3: URLs count as 23, CJK characters and emoji count as 2, and most other
+// characters count as 1.
+func WeightedLength(text string) int {
+	length := 0
+	last := 0
+	for _, loc := range urlLocations(text) {
+		length += weightedTextLength(text[last:loc[0]])
+		length += transformedURLLength
+		last = loc[1]
+	}
+	return length + weightedTextLength(text[last:])
+}
+
+// TruncateToWeightedLength returns the longest prefix of text whose weighted
+// length does not exceed limit. URLs are either kept whole or dropped.
+func TruncateToWeightedLength(text string, limit int) string {
+	if WeightedLength(text) <= limit {
+		return text
+	}
+
+	length := 0
+	last := 0
+	var b strings.Builder
+	appendText := func(segment string) bool {
+		for _, r := range segment {
+			weight := runeWeight(r)
+			if length+weight > limit {
+				return false
+			}
+			length += weight
+			b.WriteRune(r)
+		}
+		return true
+	}
+
+	for _, loc := range urlLocations(text) {
+		if !appendText(text[last:loc[0]]) {
+			return b.String()
+		}
+		if length+transformedURLLength > limit {
+			return b.String()
+		}
+		length += transformedURLLength
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	appendText(text[last:])
+	return b.String()
+}
+
+func urlLocations(text string) [][]int {
+	locations := urlPattern.FindAllStringIndex(text, -1)
+	for _, loc := range locations {
+		for loc[1] > loc[0] {
+			r, size := utf8.DecodeLastRuneInString(text[loc[0]:loc[1]])
+			if !strings.ContainsRune(".,:;!?)]}'\"", r) {
+				break
+			}
+			loc[1] -= size
+		}
+	}
+	return locations
+}
+
+func weightedTextLength(text string) int {
+	length := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if isEmojiBase(runes[i]) {
+			// An emoji sequence (modifiers, variation selectors, ZWJ joined
+			// emoji and flag pairs) counts as a single heavy character.
+			length += heavyCharacterWeight
+			i = emojiSequenceEnd(runes, i)
+			continue
+		}
+		length += runeWeight(runes[i])
+	}
+	return length
+}
+
+// emojiSequenceEnd returns the index of the last rune of the emoji sequence
+// starting at start.
+func emojiSequenceEnd(runes []rune, start int) int {
+	i := start
+	if isRegionalIndicator(runes[i]) {
+		if i+1 < len(runes) && isRegionalIndicator(runes[i+1]) {
+			return i + 1
+		}
+		return i
+	}
+	for i+1 < len(runes) {
+		next := runes[i+1]
+		switch {
+		case next == emojiPresentation || isEmojiModifier(next):
+			i++
+		case next == zeroWidthJoiner && i+2 < len(runes):
+			i += 2
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func runeWeight(r rune) int {
+	for _, lightRange := range lightRanges {
+		if r >= lightRange[0] && r <= lightRange[1] {
+			return lightCharacterWeight
+		}
+	}
+	return heavyCharacterWeight
+}
+
+func isEmojiBase(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF)
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -0,0 +1,66 @@
+package twitter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWeightedLength(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "ascii", text: "hello", want: 5},
+		{name: "japanese", text: "こんにちは", want: 10},
+		{name: "mixed", text: "Go言語", want: 6},
+		{name: "url", text: "see https://example.com/a/very/long/path?with=query", want: 4 + 23},
+		{name: "url trailing punctuation", text: "https://example.com.", want: 24},
+		{name: "emoji", text: "👍", want: 2},
+		{name: "emoji with skin tone", text: "👍🏽", want: 2},
+		{name: "zwj sequence", text: "👨‍👩‍👧", want: 2},
+		{name: "flag", text: "🇯🇵", want: 2},
+		{name: "general punctuation", text: "“quote”", want: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WeightedLength(tt.text); got != tt.want {
+				t.Fatalf("WeightedLength(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateToWeightedLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{name: "fits", text: "hello", limit: 10, want: "hello"},
+		{name: "ascii", text: "hello world", limit: 5, want: "hello"},
+		{name: "japanese", text: "あいうえお", limit: 5, want: "あい"},
+		{name: "drops url that does not fit", text: "ab https://example.com", limit: 20, want: "ab "},
+		{name: "keeps url that fits", text: "https://example.com tail", limit: 25, want: "https://example.com t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateToWeightedLength(tt.text, tt.limit)
+			if got != tt.want {
+				t.Fatalf("TruncateToWeightedLength(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+			if WeightedLength(got) > tt.limit {
+				t.Fatalf("truncated length %d exceeds %d", WeightedLength(got), tt.limit)
+			}
+		})
+	}
+}
+
+func TestWeightedLengthMaxJapaneseTweet(t *testing.T) {
+	if got := WeightedLength(strings.Repeat("あ", 140)); got != MaxTweetLength {
+		t.Fatalf("WeightedLength() = %d, want %d", got, MaxTweetLength)
+	}
+}
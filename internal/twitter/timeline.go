@@ -0,0 +1,209 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var UsersEndpoint = "https://api.x.com/2/users"
+
+const (
+	maxTimelineResults = 100
+	// maxTimelinePages bounds a single poll so that a long outage does not
+	// replay an unbounded backlog.
+	maxTimelinePages = 10
+)
+
+// TimelineClient polls a user's tweets as an alternative to the Filtered
+// Stream on API tiers without stream access.
+type TimelineClient struct {
+	BearerTokenSource BearerTokenSource
+	HTTPClient        *http.Client
+	Endpoint          string
+}
+
+// TimelinePage is one page of a user timeline response. Body has the same
+// includes as a Filtered Stream payload, but data is a list of tweets ordered
+// newest first.
+type TimelinePage struct {
+	Body []byte
+}
+
+// TimelineResult is the result of polling a user timeline.
+type TimelineResult struct {
+	// Pages are ordered newest first.
+	Pages []TimelinePage
+	// NewestID is the newest tweet ID seen, or empty when there were no new
+	// tweets.
+	NewestID string
+	// OldestID is the oldest tweet ID seen.
+	OldestID string
+	// Complete reports whether every tweet back to sinceID was fetched. It is
+	// false when paging stopped at maxTimelinePages or an exhausted rate
+	// limit; callers resume below OldestID on the next poll.
+	Complete bool
+	// RateLimitResetAt is set when the rate limit window is exhausted.
+	RateLimitResetAt time.Time
+}
+
+type timelineMeta struct {
+	NewestID    string `json:"newest_id"`
+	OldestID    string `json:"oldest_id"`
+	NextToken   string `json:"next_token"`
+	ResultCount int    `json:"result_count"`
+}
+
+func NewTimelineClient(source BearerTokenSource) *TimelineClient {
+	return &TimelineClient{
+		BearerTokenSource: source,
+		HTTPClient:        httpClient,
+		Endpoint:          UsersEndpoint,
+	}
+}
+
+// LookupUserID returns the ID of the user with the given username.
+func (c *TimelineClient) LookupUserID(ctx context.Context, username string) (string, error) {
+	_, respBytes, err := c.get(ctx, c.endpoint()+"/by/username/"+url.PathEscape(username))
+	if err != nil {
+		return "", err
+	}
+
+	var lookupResp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBytes, &lookupResp); err != nil {
+		return "", fmt.Errorf("failed to parse twitter user lookup response: %w", err)
+	}
+	if lookupResp.Data.ID == "" {
+		return "", fmt.Errorf("twitter user %q was not found", username)
+	}
+	return lookupResp.Data.ID, nil
+}
+
+// UserTweetsSince returns the user's tweets newer than sinceID. Without a
+// sinceID only the latest page is fetched, which callers use to find the
+// starting point without replaying old tweets.
+func (c *TimelineClient) UserTweetsSince(ctx context.Context, userID, sinceID string) (TimelineResult, error) {
+	return c.UserTweetsBetween(ctx, userID, sinceID, "")
+}
+
+// UserTweetsBetween returns the user's tweets newer than sinceID and, when
+// untilID is set, older than untilID.
+func (c *TimelineClient) UserTweetsBetween(ctx context.Context, userID, sinceID, untilID string) (TimelineResult, error) {
+	var result TimelineResult
+	var paginationToken string
+	for page := 0; page < maxTimelinePages; page++ {
+		q := url.Values{}
+		setTweetQueryFields(q)
+		q.Set("max_results", strconv.Itoa(maxTimelineResults))
+		if sinceID != "" {
+			q.Set("since_id", sinceID)
+		}
+		if untilID != "" {
+			q.Set("until_id", untilID)
+		}
+		if paginationToken != "" {
+			q.Set("pagination_token", paginationToken)
+		}
+
+		resp, respBytes, err := c.get(ctx, c.endpoint()+"/"+url.PathEscape(userID)+"/tweets?"+q.Encode())
+		if err != nil {
+			return result, err
+		}
+
+		var timelineResp struct {
+			Meta timelineMeta `json:"meta"`
+		}
+		if err := json.Unmarshal(respBytes, &timelineResp); err != nil {
+			return result, fmt.Errorf("failed to parse twitter timeline response: %w", err)
+		}
+		if timelineResp.Meta.ResultCount > 0 {
+			result.Pages = append(result.Pages, TimelinePage{Body: respBytes})
+		}
+		if result.NewestID == "" {
+			result.NewestID = timelineResp.Meta.NewestID
+		}
+		if timelineResp.Meta.OldestID != "" {
+			result.OldestID = timelineResp.Meta.OldestID
+		}
+
+		resetAt, exhausted := rateLimitExhausted(resp)
+		if exhausted {
+			result.RateLimitResetAt = resetAt
+		}
+		paginationToken = timelineResp.Meta.NextToken
+		if sinceID == "" || paginationToken == "" {
+			result.Complete = true
+			return result, nil
+		}
+		if exhausted {
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+func (c *TimelineClient) get(ctx context.Context, requestURL string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.BearerTokenSource == nil {
+		return nil, nil, fmt.Errorf("twitter bearer token source is not configured")
+	}
+	token, err := c.BearerTokenSource.BearerToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = httpClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, rateLimitError(resp)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, nil, httpError(resp)
+	}
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBytes, nil
+}
+
+func (c *TimelineClient) endpoint() string {
+	if c.Endpoint != "" {
+		return c.Endpoint
+	}
+	return UsersEndpoint
+}
+
+// rateLimitExhausted reports the reset time when a successful response used
+// the last request of the rate limit window.
+func rateLimitExhausted(resp *http.Response) (time.Time, bool) {
+	if resp.Header.Get("x-rate-limit-remaining") != "0" {
+		return time.Time{}, false
+	}
+	unix, err := parseUnixTimestamp(resp.Header.Get("x-rate-limit-reset"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
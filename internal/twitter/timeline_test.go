@@ -0,0 +1,153 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimelineClientUserTweetsSincePaginates(t *testing.T) {
+	ctx := context.Background()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/users/user-1/tweets" {
+			t.Fatalf("path = %q, want /2/users/user-1/tweets", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token-1" {
+			t.Fatalf("Authorization = %q, want Bearer token-1", got)
+		}
+		queries = append(queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pagination_token") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"id":"30"},{"id":"20"}],"meta":{"newest_id":"30","oldest_id":"20","result_count":2,"next_token":"page-2"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"id":"15"}],"meta":{"newest_id":"15","oldest_id":"15","result_count":1}}`))
+	}))
+	defer server.Close()
+
+	client := NewTimelineClient(StaticBearerTokenSource{Token: "token-1"})
+	client.HTTPClient = server.Client()
+	client.Endpoint = server.URL + "/2/users"
+
+	result, err := client.UserTweetsSince(ctx, "user-1", "10")
+	if err != nil {
+		t.Fatalf("UserTweetsSince() error = %v", err)
+	}
+	if result.NewestID != "30" || result.OldestID != "15" || !result.Complete {
+		t.Fatalf("result = %+v, want a complete poll from 30 to 15", result)
+	}
+	if len(result.Pages) != 2 || !strings.Contains(string(result.Pages[1].Body), `"id":"15"`) {
+		t.Fatalf("Pages = %q, want two pages newest first", result.Pages)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("requests = %d, want 2", len(queries))
+	}
+	for _, want := range []string{"since_id=10", "max_results=100", "tweet.fields=", "expansions=", "media.fields=", "poll.fields="} {
+		if !strings.Contains(queries[0], want) {
+			t.Fatalf("query %q does not contain %q", queries[0], want)
+		}
+	}
+	if !strings.Contains(queries[1], "pagination_token=page-2") {
+		t.Fatalf("second query %q does not contain the pagination token", queries[1])
+	}
+}
+
+func TestTimelineClientUserTweetsSinceWithoutSinceIDFetchesOnePage(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"data":[{"id":"30"}],"meta":{"newest_id":"30","result_count":1,"next_token":"page-2"}}`))
+	}))
+	defer server.Close()
+
+	client := NewTimelineClient(StaticBearerTokenSource{Token: "token-1"})
+	client.HTTPClient = server.Client()
+	client.Endpoint = server.URL
+
+	result, err := client.UserTweetsSince(context.Background(), "user-1", "")
+	if err != nil {
+		t.Fatalf("UserTweetsSince() error = %v", err)
+	}
+	if requests != 1 || result.NewestID != "30" {
+		t.Fatalf("requests = %d, NewestID = %q; want 1, 30", requests, result.NewestID)
+	}
+}
+
+func TestTimelineClientUserTweetsSinceRateLimits(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).Unix()
+
+	t.Run("exhausted window stops paging", func(t *testing.T) {
+		var requests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+			_, _ = w.Write([]byte(`{"data":[{"id":"30"}],"meta":{"newest_id":"30","result_count":1,"next_token":"page-2"}}`))
+		}))
+		defer server.Close()
+
+		client := NewTimelineClient(StaticBearerTokenSource{Token: "token-1"})
+		client.HTTPClient = server.Client()
+		client.Endpoint = server.URL
+
+		result, err := client.UserTweetsSince(context.Background(), "user-1", "10")
+		if err != nil {
+			t.Fatalf("UserTweetsSince() error = %v", err)
+		}
+		if requests != 1 {
+			t.Fatalf("requests = %d, want 1", requests)
+		}
+		if result.RateLimitResetAt.Unix() != reset {
+			t.Fatalf("RateLimitResetAt = %v, want %v", result.RateLimitResetAt, time.Unix(reset, 0))
+		}
+		if result.Complete {
+			t.Fatal("Complete = true, want the poll to resume from the next page")
+		}
+	})
+
+	t.Run("429 returns rate limit error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+			http.Error(w, `{"title":"Too Many Requests"}`, http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		client := NewTimelineClient(StaticBearerTokenSource{Token: "token-1"})
+		client.HTTPClient = server.Client()
+		client.Endpoint = server.URL
+
+		_, err := client.UserTweetsSince(context.Background(), "user-1", "10")
+		var rateLimitErr *StreamRateLimitError
+		if !errors.As(err, &rateLimitErr) || rateLimitErr.ResetAt.Unix() != reset {
+			t.Fatalf("UserTweetsSince() error = %v, want rate limit error until %d", err, reset)
+		}
+	})
+}
+
+func TestTimelineClientLookupUserID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/by/username/alice" {
+			t.Fatalf("path = %q, want /by/username/alice", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"data":{"id":"user-1","username":"alice"}}`))
+	}))
+	defer server.Close()
+
+	client := NewTimelineClient(StaticBearerTokenSource{Token: "token-1"})
+	client.HTTPClient = server.Client()
+	client.Endpoint = server.URL
+
+	userID, err := client.LookupUserID(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("LookupUserID() error = %v", err)
+	}
+	if userID != "user-1" {
+		t.Fatalf("LookupUserID() = %q, want user-1", userID)
+	}
+}